@@ -58,7 +58,7 @@ already has a fee set, overwrite it with a new value.
 		payerFl  = flHex(fl, "payer", "", "Optional address of a payer. If not provided the main signer will be used.")
 		amountFl = flCoin(fl, "amount", "", "Fee value that should be attached to the transaction. If not provided, default minimal fee is used.")
 		tmAddrFl = fl.String("tm", env("CUSTOMCLI_TM_ADDR", "https://custom.NETWORK.iov.one:443"),
-			"Tendermint node address. Use proper NETWORK name. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
+			"Tendermint node address. Use proper NETWORK name. Separate several addresses with a comma to fail over between them. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
 	)
 	fl.Parse(args)
 
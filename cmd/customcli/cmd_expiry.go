@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+)
+
+func cmdWithExpiry(input io.Reader, output io.Writer, args []string) error {
+	fl := flag.NewFlagSet("", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), `
+Read a transaction from the input and set until when it is valid. An expired
+transaction is rejected, even if its nonce was never used. If a transaction
+already has an expiry set, overwrite it with a new value.
+
+The expiry is compared with the time and height of blocks. Set it before
+signing the transaction, because any later modification invalidates the
+signature.
+		`)
+		fl.PrintDefaults()
+	}
+	var (
+		untilFl  = flTime(fl, "until", nil, "Block time (UTC) from which the transaction is expired, in the "+flagTimeFormat+" format.")
+		inFl     = fl.Duration("in", 0, "Duration from now after which the transaction is expired. It cannot be used with -until.")
+		heightFl = fl.Int64("height", 0, "Last block height that can include the transaction.")
+	)
+	fl.Parse(args)
+
+	var until customd.ValidUntil
+	switch {
+	case !untilFl.Time().IsZero() && *inFl != 0:
+		flagDie("-until and -in cannot be used together.")
+	case !untilFl.Time().IsZero():
+		until.Time = untilFl.UnixTime()
+	case *inFl < 0:
+		flagDie("-in cannot be negative.")
+	case *inFl != 0:
+		until.Time = weave.AsUnixTime(time.Now().Add(*inFl))
+	}
+	until.Height = *heightFl
+	if err := until.Validate(); err != nil {
+		flagDie("invalid expiry: %s", err)
+	}
+
+	tx, _, err := readTx(input)
+	if err != nil {
+		return fmt.Errorf("cannot read transaction: %s", err)
+	}
+	if len(tx.Signatures) != 0 {
+		return errors.New("transaction is already signed, set the expiry before signing it")
+	}
+	tx.ValidUntil = &until
+
+	_, err = writeTx(output, tx)
+	return err
+}
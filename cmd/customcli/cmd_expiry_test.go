@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/cash"
+	"github.com/iov-one/weave/x/sigs"
+)
+
+func TestCmdWithExpiryHappyPath(t *testing.T) {
+	sendMsg := &cash.SendMsg{
+		Metadata: &weave.Metadata{Schema: 1},
+		Memo:     "a memo",
+	}
+	sendTx := &customd.Tx{
+		ValidUntil: &customd.ValidUntil{Height: 1},
+		Sum: &customd.Tx_CashSendMsg{
+			CashSendMsg: sendMsg,
+		},
+	}
+	var input bytes.Buffer
+	if _, err := writeTx(&input, sendTx); err != nil {
+		t.Fatalf("cannot serialize transaction: %s", err)
+	}
+
+	var output bytes.Buffer
+	before := time.Now()
+	if err := cmdWithExpiry(&input, &output, []string{"-in", "1h"}); err != nil {
+		t.Fatalf("cannot set the transaction expiry: %s", err)
+	}
+
+	tx, _, err := readTx(&output)
+	if err != nil {
+		t.Fatalf("cannot unmarshal created transaction: %s", err)
+	}
+	// Previous expiry is overwritten.
+	assert.Equal(t, int64(0), tx.ValidUntil.Height)
+	if got, want := tx.ValidUntil.Time, weave.AsUnixTime(before.Add(time.Hour)); got < want || got > want+1 {
+		t.Fatalf("want expiry at %s, got %s", want, got)
+	}
+
+	txmsg, err := tx.GetMsg()
+	if err != nil {
+		t.Fatalf("cannot get transaction message: %s", err)
+	}
+	// Message must be unmodified.
+	assert.Equal(t, sendMsg, txmsg)
+}
+
+func TestCmdWithExpirySignedTransaction(t *testing.T) {
+	signedTx := &customd.Tx{
+		Signatures: []*sigs.StdSignature{{Sequence: 1}},
+		Sum:        &customd.Tx_CashSendMsg{CashSendMsg: &cash.SendMsg{}},
+	}
+	var input bytes.Buffer
+	if _, err := writeTx(&input, signedTx); err != nil {
+		t.Fatalf("cannot serialize transaction: %s", err)
+	}
+
+	var output bytes.Buffer
+	if err := cmdWithExpiry(&input, &output, []string{"-height", "100"}); err == nil {
+		t.Fatal("expiry set on a signed transaction")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave-starter-kit/cmd/customd/client"
+)
+
+func cmdHistory(input io.Reader, output io.Writer, args []string) error {
+	fl := flag.NewFlagSet("", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), `
+Print transactions that affected an address, starting with the newest one.
+
+Transactions that sent or received tokens, were signed by the address or
+created a custom state for it are listed. They are found in the transaction
+index of the node, which must index all tags.
+
+Use -limit and -before to list the history page by page. The last block is
+always listed completely, so that the height of the last listed transaction
+can be used as -before value of the next page.
+`)
+		fl.PrintDefaults()
+	}
+	var (
+		tmAddrFl = fl.String("tm", env("CUSTOMCLI_TM_ADDR", "https://custom.NETWORK:443"),
+			"Tendermint node address. Use proper NETWORK name. Separate several addresses with a comma to fail over between them. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
+		addrFl     = flAddress(fl, "addr", "", "Address to list the transactions of.")
+		beforeFl   = fl.Int64("before", 0, "List only transactions included in blocks below the given height. If not provided, the history starts with the latest block.")
+		limitFl    = fl.Int("limit", 0, "Maximum number of listed transactions. Zero means no limit.")
+		pageSizeFl = fl.Int("page-size", client.DefaultHistoryLimit, "Number of transactions fetched from the node with a single request.")
+		formatFl   = flFormat(fl, "format", "table", "Output format. Use ndjson to write each transaction as soon as it is fetched.")
+	)
+	fl.Parse(args)
+
+	if len(*addrFl) == 0 {
+		flagDie("address is required")
+	}
+	if *beforeFl < 0 {
+		flagDie("height cannot be negative")
+	}
+	if *limitFl < 0 {
+		flagDie("limit cannot be negative")
+	}
+	if *pageSizeFl < 1 || *pageSizeFl > client.MaxHistoryLimit {
+		flagDie("page size must be between 1 and %d", client.MaxHistoryLimit)
+	}
+
+	customClient := client.NewClient(client.NewHTTPConnection(*tmAddrFl))
+	opts := client.HistoryOptions{BeforeHeight: *beforeFl, Limit: *pageSizeFl}
+
+	result := make([]historyEntry, 0)
+	var (
+		listed     int
+		lastHeight int64
+	)
+	for {
+		page, err := customClient.TxHistoryContext(context.Background(), *addrFl, opts)
+		if err != nil {
+			return fmt.Errorf("cannot fetch history: %s", err)
+		}
+		for _, e := range page.Entries {
+			if *limitFl != 0 && listed >= *limitFl && e.Height != lastHeight {
+				return writeHistory(output, *formatFl, result)
+			}
+			entry := newHistoryEntry(e)
+			if *formatFl == streamFormat {
+				if err := writeFormatted(output, *formatFl, entry); err != nil {
+					return err
+				}
+			} else {
+				result = append(result, entry)
+			}
+			listed++
+			lastHeight = e.Height
+		}
+		if page.Next == 0 {
+			return writeHistory(output, *formatFl, result)
+		}
+		opts.BeforeHeight = page.Next
+	}
+}
+
+// writeHistory writes collected history entries, unless they were already
+// streamed.
+func writeHistory(output io.Writer, format flagformat, entries []historyEntry) error {
+	if format == streamFormat {
+		return nil
+	}
+	return writeFormatted(output, format, entries)
+}
+
+// historyEntry is a human readable representation of a transaction listed
+// in the history.
+type historyEntry struct {
+	Height int64
+	Time   string
+	Hash   []byte
+	// Result is "ok" or the error of a failed transaction.
+	Result string
+	// Action is the path of the transaction message.
+	Action string
+	Msg    weave.Msg
+}
+
+func newHistoryEntry(e client.HistoryEntry) historyEntry {
+	entry := historyEntry{
+		Height: e.Height,
+		Time:   e.Time.UTC().Format(time.RFC3339),
+		Hash:   e.Hash,
+		Result: "ok",
+		Action: "unknown",
+	}
+	if e.Result.IsErr() {
+		entry.Result = e.Result.Log
+	}
+	if e.Tx != nil {
+		if msg, err := e.Tx.GetMsg(); err == nil {
+			entry.Action = msg.Path()
+			entry.Msg = msg
+		}
+	}
+	return entry
+}
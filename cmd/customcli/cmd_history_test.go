@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave-starter-kit/cmd/customd/client"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/weavetest"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/cash"
+)
+
+func TestCmdHistory(t *testing.T) {
+	rcpt := weavetest.NewCondition().Address()
+	tx := &customd.Tx{
+		Sum: &customd.Tx_CashSendMsg{
+			CashSendMsg: &cash.SendMsg{
+				Metadata:    &weave.Metadata{Schema: 1},
+				Source:      fromHex(t, addr),
+				Destination: rcpt,
+				Amount:      &coin.Coin{Whole: 1, Ticker: "CSTM"},
+				Memo:        "history",
+			},
+		},
+	}
+	var input bytes.Buffer
+	if _, err := writeTx(&input, tx); err != nil {
+		t.Fatalf("cannot marshal transaction: %s", err)
+	}
+	var withFee, signedTx, submitted bytes.Buffer
+	assert.Nil(t, cmdWithFee(&input, &withFee, []string{"-tm", tmURL}))
+	signArgs := []string{
+		"-tm", tmURL,
+		"-key", mustCreateFile(t, bytes.NewReader(fromHex(t, privKeyHex))),
+	}
+	assert.Nil(t, cmdSignTransaction(&withFee, &signedTx, signArgs))
+	assert.Nil(t, cmdSubmitTransaction(&signedTx, &submitted, []string{"-tm", tmURL}))
+
+	var res []struct {
+		Height int64
+		Time   string
+		Result string
+		Action string
+		Msg    struct{ Memo string }
+	}
+	// Transactions are indexed shortly after the block is committed.
+	for deadline := time.Now().Add(10 * time.Second); len(res) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("transaction not found in the history")
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		var output bytes.Buffer
+		args := []string{
+			"-tm", tmURL,
+			"-addr", rcpt.String(),
+			"-format", "json",
+		}
+		if err := cmdHistory(nil, &output, args); err != nil {
+			t.Fatalf("history failed: %s", err)
+		}
+		if err := json.Unmarshal(output.Bytes(), &res); err != nil {
+			t.Fatalf("cannot unmarshal result: %s", err)
+		}
+	}
+	assert.Equal(t, 1, len(res))
+	assert.Equal(t, "ok", res[0].Result)
+	assert.Equal(t, "cash/send", res[0].Action)
+	assert.Equal(t, "history", res[0].Msg.Memo)
+	if _, err := time.Parse(time.RFC3339, res[0].Time); err != nil {
+		t.Fatalf("invalid time: %s", err)
+	}
+}
+
+func TestNewHistoryEntry(t *testing.T) {
+	// A transaction that cannot be parsed is listed as well.
+	entry := newHistoryEntry(client.HistoryEntry{
+		Height: 3,
+		Time:   time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+		Hash:   []byte{0xca, 0xfe},
+	})
+	assert.Equal(t, "unknown", entry.Action)
+	assert.Equal(t, "ok", entry.Result)
+
+	var output bytes.Buffer
+	assert.Nil(t, writeFormatted(&output, "table", []historyEntry{entry}))
+	want := "HEIGHT  TIME                  HASH  RESULT  ACTION\n3       2019-01-02T03:04:05Z  cafe  ok      unknown\n"
+	assert.Equal(t, want, output.String())
+}
@@ -126,7 +126,7 @@ Print out a hex-address associated with your private key.
 	var (
 		keyPathFl = fl.String("key", env("CUSTOMCLI_PRIV_KEY", os.Getenv("HOME")+"/.customd.priv.key"),
 			"Path to the private key file that transaction should be signed with. You can use CUSTOMCLI_PRIV_KEY environment variable to set it.")
-		bechPrefixFl = fl.String("bp", "custm", "Bech32 prefix.")
+		bechPrefixFl = fl.String("bp", bech32Prefix, "Bech32 prefix.")
 	)
 	fl.Parse(args)
 
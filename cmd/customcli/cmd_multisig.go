@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/iov-one/weave"
 	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave-starter-kit/cmd/customd/client"
 	"github.com/iov-one/weave/x/multisig"
+	"github.com/iov-one/weave/x/sigs"
 )
 
 func cmdMultisig(input io.Reader, output io.Writer, args []string) error {
@@ -140,3 +146,258 @@ Given multisig IDs must be a decimal number or a hex encoded 8 byte bigendian se
 	_, err = writeTx(output, tx)
 	return err
 }
+
+func cmdMultisigSign(input io.Reader, output io.Writer, args []string) error {
+	fl := flag.NewFlagSet("", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), `
+Read a transaction from the input and write a detached signature of that
+transaction to the output. The transaction itself is not modified. Detached
+signatures created by all participants can be attached to the transaction
+using the multisig-combine command.
+
+Make sure that the transaction is complete (fee and multisig IDs are attached)
+before signing it, because any later modification invalidates the signature.
+
+If both the chain ID and the nonce are provided, no connection to a node is
+made and the signature can be created offline.
+		`)
+		fl.PrintDefaults()
+	}
+	var (
+		tmAddrFl = fl.String("tm", env("CUSTOMCLI_TM_ADDR", "https://custom.NETWORK.iov.one:443"),
+			"Tendermint node address. Use proper NETWORK name. Separate several addresses with a comma to fail over between them. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
+		keyPathFl = fl.String("key", env("CUSTOMCLI_PRIV_KEY", os.Getenv("HOME")+"/.customd.priv.key"),
+			"Path to the private key file that transaction should be signed with. You can use CUSTOMCLI_PRIV_KEY environment variable to set it.")
+		chainIDFl = fl.String("chain-id", "", "Chain ID of the network. If not provided, it is fetched from the node.")
+		nonceFl   = fl.Int64("nonce", -1, "Nonce (sequence) of the signer. If not provided, it is fetched from the node.")
+	)
+	fl.Parse(args)
+
+	if *keyPathFl == "" {
+		return errors.New("private key is required")
+	}
+	key, err := decodePrivateKey(*keyPathFl)
+	if err != nil {
+		return fmt.Errorf("cannot load private key: %s", err)
+	}
+
+	tx, _, err := readTx(input)
+	if err != nil {
+		return fmt.Errorf("cannot read transaction: %s", err)
+	}
+
+	chainID := *chainIDFl
+	if chainID == "" {
+		genesis, err := fetchGenesis(*tmAddrFl)
+		if err != nil {
+			return fmt.Errorf("cannot fetch genesis: %s", err)
+		}
+		chainID = genesis.ChainID
+	}
+
+	nonce := *nonceFl
+	if nonce < 0 {
+		customClient := client.NewClient(client.NewHTTPConnection(*tmAddrFl))
+		nonce, err = customClient.NextNonceContext(context.Background(), key.PublicKey().Address())
+		if err != nil {
+			return fmt.Errorf("cannot get the next sequence number: %s", err)
+		}
+	}
+
+	sig, err := sigs.SignTx(key, tx, chainID, nonce)
+	if err != nil {
+		return fmt.Errorf("cannot sign transaction: %s", err)
+	}
+
+	_, err = writeSignature(output, sig)
+	return err
+}
+
+func cmdMultisigCombine(input io.Reader, output io.Writer, args []string) error {
+	fl := flag.NewFlagSet("", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), `
+Read a transaction from the input and attach detached signatures from all
+given files to it. Signature files are created by the multisig-sign command.
+
+Signatures are attached in the order the files are given. Remember that the
+first signature of a transaction is the default fee payer.
+
+  $ customcli multisig-combine alice.sig bob.sig < tx.bin | customcli submit
+		`)
+		fl.PrintDefaults()
+	}
+	fl.Parse(args)
+
+	tx, _, err := readTx(input)
+	if err != nil {
+		return fmt.Errorf("cannot read input transaction: %s", err)
+	}
+
+	for _, path := range fl.Args() {
+		sig, err := readSignatureFile(path)
+		if err != nil {
+			return fmt.Errorf("cannot read %q signature: %s", path, err)
+		}
+		if err := sig.Validate(); err != nil {
+			return fmt.Errorf("invalid %q signature: %s", path, err)
+		}
+		tx.Signatures, err = appendSignature(tx.Signatures, sig)
+		if err != nil {
+			return fmt.Errorf("cannot attach %q signature: %s", path, err)
+		}
+	}
+
+	_, err = writeTx(output, tx)
+	return err
+}
+
+func readSignatureFile(path string) (*sigs.StdSignature, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return readSignature(fd)
+}
+
+// appendSignature returns the list of signatures extended with given
+// signature. Attaching the same signature again is a no-op, so that combining
+// can be repeated safely. A different signature of an already present signer
+// is rejected.
+func appendSignature(list []*sigs.StdSignature, sig *sigs.StdSignature) ([]*sigs.StdSignature, error) {
+	addr := sig.Pubkey.Address()
+	for _, s := range list {
+		if !s.Pubkey.Address().Equals(addr) {
+			continue
+		}
+		if s.Sequence == sig.Sequence && bytes.Equal(s.Signature.GetEd25519(), sig.Signature.GetEd25519()) {
+			return list, nil
+		}
+		return nil, fmt.Errorf("transaction is already signed by %s", addr)
+	}
+	return append(list, sig), nil
+}
+
+func cmdMultisigStatus(input io.Reader, output io.Writer, args []string) error {
+	fl := flag.NewFlagSet("", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), `
+Read a transaction from the input and for every attached multisig contract
+print the weight accumulated by the transaction signatures and the contract
+activation threshold.
+
+Additional multisig contract IDs can be provided as arguments. They must be a
+decimal number or a hex encoded 8 byte bigendian sequence.
+		`)
+		fl.PrintDefaults()
+	}
+	var (
+		tmAddrFl = fl.String("tm", env("CUSTOMCLI_TM_ADDR", "https://custom.NETWORK.iov.one:443"),
+			"Tendermint node address. Use proper NETWORK name. Separate several addresses with a comma to fail over between them. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
+		formatFl = flFormat(fl, "format", "json", "Output format.")
+	)
+	fl.Parse(args)
+
+	var (
+		contractIDs [][]byte
+		signers     []weave.Address
+	)
+	switch tx, _, err := readTx(input); {
+	case err == nil:
+		contractIDs = append(contractIDs, tx.Multisig...)
+		for _, sig := range tx.Signatures {
+			signers = append(signers, sig.Pubkey.Address())
+		}
+	case err == io.EOF:
+		// No transaction given, only contract IDs from arguments.
+	default:
+		return fmt.Errorf("cannot read input transaction: %s", err)
+	}
+	for i, mid := range fl.Args() {
+		seq, err := unpackSequence(mid)
+		if err != nil {
+			return fmt.Errorf("sequence value #%d is invalid: %s", i, err)
+		}
+		contractIDs = append(contractIDs, seq)
+	}
+	if len(contractIDs) == 0 {
+		return errors.New("no multisig contract ID provided")
+	}
+
+	customClient := client.NewClient(client.NewHTTPConnection(*tmAddrFl))
+	statuses := make([]multisigStatus, 0, len(contractIDs))
+	for _, id := range contractIDs {
+		resp, err := customClient.AbciQueryContext(context.Background(), "/contracts", id)
+		if err != nil {
+			return fmt.Errorf("cannot query contract: %s", err)
+		}
+		if len(resp.Models) == 0 {
+			return fmt.Errorf("contract %x not found", id)
+		}
+		var contract multisig.Contract
+		if err := contract.Unmarshal(resp.Models[0].Value); err != nil {
+			return fmt.Errorf("cannot unmarshal contract: %s", err)
+		}
+		statuses = append(statuses, newMultisigStatus(id, &contract, signers))
+	}
+	return writeFormatted(output, *formatFl, statuses)
+}
+
+// multisigStatus describes how far a transaction is from activating a
+// multisig contract.
+type multisigStatus struct {
+	ContractID          []byte              `json:"contract_id"`
+	Weight              multisig.Weight     `json:"weight"`
+	ActivationThreshold multisig.Weight     `json:"activation_threshold"`
+	AdminThreshold      multisig.Weight     `json:"admin_threshold"`
+	Activated           bool                `json:"activated"`
+	Participants        []participantStatus `json:"participants"`
+}
+
+type participantStatus struct {
+	Signature weave.Address   `json:"signature"`
+	Weight    multisig.Weight `json:"weight"`
+	Signed    bool            `json:"signed"`
+}
+
+func newMultisigStatus(id []byte, c *multisig.Contract, signers []weave.Address) multisigStatus {
+	weight := multisigWeight(c, signers)
+	status := multisigStatus{
+		ContractID:          id,
+		Weight:              weight,
+		ActivationThreshold: c.ActivationThreshold,
+		AdminThreshold:      c.AdminThreshold,
+		Activated:           weight >= c.ActivationThreshold,
+	}
+	for _, p := range c.Participants {
+		status.Participants = append(status.Participants, participantStatus{
+			Signature: p.Signature,
+			Weight:    p.Weight,
+			Signed:    containsAddress(signers, p.Signature),
+		})
+	}
+	return status
+}
+
+// multisigWeight returns the sum of weights of all contract participants that
+// are present in the signers list.
+func multisigWeight(c *multisig.Contract, signers []weave.Address) multisig.Weight {
+	var total multisig.Weight
+	for _, p := range c.Participants {
+		if containsAddress(signers, p.Signature) {
+			total += p.Weight
+		}
+	}
+	return total
+}
+
+func containsAddress(addrs []weave.Address, a weave.Address) bool {
+	for _, addr := range addrs {
+		if addr.Equals(a) {
+			return true
+		}
+	}
+	return false
+}
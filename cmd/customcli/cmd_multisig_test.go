@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave/crypto"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/cash"
+	"github.com/iov-one/weave/x/multisig"
+	"github.com/iov-one/weave/x/sigs"
+)
+
+func TestCmdMultisigSignAndCombine(t *testing.T) {
+	tx := &customd.Tx{
+		Sum: &customd.Tx_CashSendMsg{
+			CashSendMsg: &cash.SendMsg{
+				Metadata: &weave.Metadata{Schema: 1},
+			},
+		},
+		Multisig: [][]byte{sequenceID(1)},
+	}
+	var input bytes.Buffer
+	if _, err := writeTx(&input, tx); err != nil {
+		t.Fatalf("cannot marshal transaction: %s", err)
+	}
+	rawTx := input.Bytes()
+
+	// Both chain ID and nonce are provided, so signing is done offline.
+	var sigOutput bytes.Buffer
+	args := []string{
+		"-chain-id", "test-chain",
+		"-nonce", "3",
+		"-key", mustCreateFile(t, bytes.NewReader(fromHex(t, privKeyHex))),
+	}
+	if err := cmdMultisigSign(bytes.NewReader(rawTx), &sigOutput, args); err != nil {
+		t.Fatalf("transaction signing failed: %s", err)
+	}
+	sigPath := mustCreateFile(t, bytes.NewReader(sigOutput.Bytes()))
+
+	sig, err := readSignature(&sigOutput)
+	if err != nil {
+		t.Fatalf("cannot read signature: %s", err)
+	}
+	assert.Equal(t, int64(3), sig.Sequence)
+	signBytes, err := sigs.BuildSignBytesTx(tx, "test-chain", 3)
+	if err != nil {
+		t.Fatalf("cannot build sign bytes: %s", err)
+	}
+	if !sig.Pubkey.Verify(signBytes, sig.Signature) {
+		t.Fatal("invalid signature")
+	}
+
+	// Combining the same signature twice must not duplicate it.
+	var output bytes.Buffer
+	if err := cmdMultisigCombine(bytes.NewReader(rawTx), &output, []string{sigPath, sigPath}); err != nil {
+		t.Fatalf("cannot combine signatures: %s", err)
+	}
+	combined, _, err := readTx(&output)
+	if err != nil {
+		t.Fatalf("cannot read combined transaction: %s", err)
+	}
+	if n := len(combined.Signatures); n != 1 {
+		t.Fatalf("want one signature, got %d", n)
+	}
+	assert.Equal(t, fromHex(t, addr), []byte(combined.Signatures[0].Pubkey.Address()))
+}
+
+func TestAppendSignature(t *testing.T) {
+	key := crypto.GenPrivKeyEd25519()
+	tx := &customd.Tx{
+		Sum: &customd.Tx_CashSendMsg{
+			CashSendMsg: &cash.SendMsg{Metadata: &weave.Metadata{Schema: 1}},
+		},
+	}
+	sig1, err := sigs.SignTx(key, tx, "test-chain", 1)
+	if err != nil {
+		t.Fatalf("cannot sign: %s", err)
+	}
+	sig2, err := sigs.SignTx(key, tx, "test-chain", 2)
+	if err != nil {
+		t.Fatalf("cannot sign: %s", err)
+	}
+	other, err := sigs.SignTx(crypto.GenPrivKeyEd25519(), tx, "test-chain", 1)
+	if err != nil {
+		t.Fatalf("cannot sign: %s", err)
+	}
+
+	list, err := appendSignature(nil, sig1)
+	assert.Nil(t, err)
+	list, err = appendSignature(list, sig1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list))
+	list, err = appendSignature(list, other)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list))
+
+	if _, err := appendSignature(list, sig2); err == nil {
+		t.Fatal("a different signature of the same signer must be rejected")
+	}
+}
+
+func TestMultisigWeight(t *testing.T) {
+	alice := weave.NewCondition("sigs", "ed25519", []byte("alice")).Address()
+	bob := weave.NewCondition("sigs", "ed25519", []byte("bob")).Address()
+	carol := weave.NewCondition("sigs", "ed25519", []byte("carol")).Address()
+
+	contract := &multisig.Contract{
+		Participants: []*multisig.Participant{
+			{Signature: alice, Weight: 1},
+			{Signature: bob, Weight: 2},
+			{Signature: carol, Weight: 4},
+		},
+		ActivationThreshold: 3,
+		AdminThreshold:      7,
+	}
+
+	cases := map[string]struct {
+		Signers []weave.Address
+		Want    multisig.Weight
+	}{
+		"no signers": {
+			Signers: nil,
+			Want:    0,
+		},
+		"single signer": {
+			Signers: []weave.Address{bob},
+			Want:    2,
+		},
+		"all signers": {
+			Signers: []weave.Address{carol, alice, bob},
+			Want:    7,
+		},
+		"non participant signers are ignored": {
+			Signers: []weave.Address{alice, weave.NewCondition("sigs", "ed25519", []byte("dave")).Address()},
+			Want:    1,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, tc.Want, multisigWeight(contract, tc.Signers))
+		})
+	}
+}
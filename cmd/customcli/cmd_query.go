@@ -2,38 +2,61 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
 	"github.com/iov-one/weave-starter-kit/cmd/customd/client"
 	"github.com/iov-one/weave-starter-kit/x/custom"
+	"github.com/iov-one/weave/migration"
 	"github.com/iov-one/weave/orm"
 	"github.com/iov-one/weave/x/cash"
+	"github.com/iov-one/weave/x/gov"
 	"github.com/iov-one/weave/x/multisig"
+	"github.com/iov-one/weave/x/sigs"
+	"github.com/iov-one/weave/x/validators"
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
 )
 
 func cmdQuery(input io.Reader, output io.Writer, args []string) error {
 	fl := flag.NewFlagSet("", flag.ExitOnError)
 	fl.Usage = func() {
 		fmt.Fprint(flag.CommandLine.Output(), `
-Execute a ABCI query and print JSON encoded result.
+Execute a ABCI query and print the result in the requested format.
+
+Prefix queries are fetched from the node in pages and can return any number of
+results. Use -limit and -after to list results page by page.
+
+Use -verify to check an exact match result with a Merkle proof instead of
+trusting the node. The proof is verified against the app hash of a header
+certified by a light client, which trusts the validators of the first block.
+Use -trust-dir to keep the trusted headers between runs.
 `)
 		fl.PrintDefaults()
 	}
 	var (
 		tmAddrFl = fl.String("tm", env("CUSTOMCLI_TM_ADDR", "https://custom.NETWORK:443"),
-			"Tendermint node address. Use proper NETWORK name. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
+			"Tendermint node address. Use proper NETWORK name. Separate several addresses with a comma to fail over between them. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
 		pathFl        = fl.String("path", "", "Path to be queried. Must be one of the supported.")
-		dataFl        = fl.String("data", "", "individual query data. Format depends on the queried entity. Use 'id/version' for electoraterules, electorates")
+		dataFl        = fl.String("data", "", "individual query data. Format depends on the queried entity. Use 'pkg/version' for schemas.")
 		prefixQueryFl = fl.Bool("prefix", false, "If true, use prefix queries instead of the exact match with provided data.")
+		heightFl      = fl.Int64("height", 0, "Block height to query the state at. If not provided, the latest state is queried.")
+		limitFl       = fl.Int("limit", 0, "Maximum number of results returned by a prefix query. Zero means no limit.")
+		afterFl       = fl.String("after", "", "Return only prefix query results with a key greater than the given one. Format is the same as for the data. Use the last key of a previous result to continue listing.")
+		pageSizeFl    = fl.Int("page-size", customd.DefaultRangeQueryLimit, "Number of results fetched from the node with a single request.")
+		formatFl      = flFormat(fl, "format", "json", "Output format. Use ndjson to write each result as soon as it is fetched.")
+		verifyFl      = fl.Bool("verify", false, "If true, verify the result with a Merkle proof instead of trusting the node. Only exact match queries can be verified.")
+		trustDirFl    = fl.String("trust-dir", env("CUSTOMCLI_TRUST_DIR", ""), "Directory storing headers trusted by the light client of verified queries. If not provided, the first block is trusted on each run. You can use CUSTOMCLI_TRUST_DIR environment variable to set it.")
 	)
 	fl.Parse(args)
 
@@ -43,8 +66,21 @@ Execute a ABCI query and print JSON encoded result.
 		for p := range queries {
 			paths = append(paths, p)
 		}
+		sort.Strings(paths)
 		return fmt.Errorf("available query paths:\n\t- %s", strings.Join(paths, "\n\t- "))
 	}
+	if *heightFl < 0 {
+		flagDie("height cannot be negative")
+	}
+	if *limitFl < 0 {
+		flagDie("limit cannot be negative")
+	}
+	if *pageSizeFl < 0 || *pageSizeFl > customd.MaxRangeQueryLimit {
+		flagDie("page size must be between 0 and %d", customd.MaxRangeQueryLimit)
+	}
+	if *verifyFl && (*prefixQueryFl || *dataFl == "") {
+		flagDie("only exact match queries can be verified")
+	}
 
 	var data []byte
 	if len(*dataFl) != 0 {
@@ -53,35 +89,106 @@ Execute a ABCI query and print JSON encoded result.
 			return fmt.Errorf("can not encode data: %s", err)
 		}
 	}
-	queryPath := *pathFl
-	if *prefixQueryFl || *dataFl == "" {
-		queryPath += "?" + weave.PrefixQueryMod
-	}
 
-	customClient := client.NewClient(client.NewHTTPConnection(*tmAddrFl))
-	resp, err := customClient.AbciQuery(queryPath, data)
-	if err != nil {
-		return fmt.Errorf("failed to run query: %s", err)
-	}
-
-	result := make([]keyval, 0, len(resp.Models))
-	for i, m := range resp.Models {
+	// Each result is written as soon as it is available when streaming.
+	// Otherwise all results are collected and written at once.
+	result := make([]keyval, 0)
+	emit := func(m weave.Model) error {
 		obj := conf.newObj()
 		if err := obj.Unmarshal(m.Value); err != nil {
-			return fmt.Errorf("failed to unmarshal model %d: %s", i, err)
+			return fmt.Errorf("failed to unmarshal %x model: %s", m.Key, err)
 		}
 		key, err := conf.decKey(m.Key)
 		if err != nil {
 			return fmt.Errorf("cannot decode %x key: %s", m.Key, err)
 		}
-		result = append(result, keyval{Key: key, Value: obj})
+		kv := keyval{Key: key, Value: obj}
+		if *formatFl == streamFormat {
+			return writeFormatted(output, *formatFl, kv)
+		}
+		result = append(result, kv)
+		return nil
 	}
-	pretty, err := json.MarshalIndent(result, "", "\t")
-	if err != nil {
-		return fmt.Errorf("cannot JSON serialize: %s", err)
+	// A node that does not support historical queries returns the latest
+	// state instead. Do not present it as the requested one.
+	checkHeight := func(height int64) error {
+		if *heightFl != 0 && height != *heightFl {
+			return fmt.Errorf("node returned state at height %d instead of %d, historical queries are not supported", height, *heightFl)
+		}
+		return nil
 	}
-	_, err = output.Write(pretty)
-	return err
+
+	conn := client.NewHTTPConnection(*tmAddrFl)
+	customClient := client.NewClient(conn)
+
+	if *verifyFl {
+		ctx := context.Background()
+		if *trustDirFl != "" {
+			chainID, err := customClient.ChainIDContext(ctx)
+			if err != nil {
+				return fmt.Errorf("cannot fetch chain ID: %s", err)
+			}
+			verifier, err := client.NewLightVerifier(conn, chainID, *trustDirFl)
+			if err != nil {
+				return fmt.Errorf("cannot create light client: %s", err)
+			}
+			customClient.SetVerifier(verifier)
+		}
+		key := append(append([]byte(nil), conf.prefix...), data...)
+		resp, err := customClient.VerifiedQueryContext(ctx, key, *heightFl)
+		if err != nil {
+			return fmt.Errorf("failed to run verified query: %s", err)
+		}
+		for _, m := range resp.Models {
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+	} else if *prefixQueryFl || *dataFl == "" {
+		// Prefix queries are paginated, so that collections of any
+		// size can be listed.
+		prefix := append(append([]byte(nil), conf.prefix...), data...)
+		var cursor []byte
+		if *afterFl != "" {
+			after, err := conf.encID(*afterFl)
+			if err != nil {
+				return fmt.Errorf("can not encode after key: %s", err)
+			}
+			cursor = append(append(append([]byte(nil), conf.prefix...), after...), 0)
+		}
+		opts := rpcclient.ABCIQueryOptions{Height: *heightFl}
+		it := customClient.IterateFromWithOptionsContext(context.Background(), prefix, cursor, *pageSizeFl, opts)
+		for n := 0; (*limitFl == 0 || n < *limitFl) && it.Next(); n++ {
+			if err := checkHeight(it.Height()); err != nil {
+				return err
+			}
+			if err := emit(it.Model()); err != nil {
+				return err
+			}
+		}
+		if err := it.Err(); err != nil {
+			return fmt.Errorf("failed to run query: %s", err)
+		}
+	} else {
+		opts := rpcclient.ABCIQueryOptions{Height: *heightFl}
+		resp, err := customClient.AbciQueryWithOptionsContext(context.Background(), *pathFl, data, opts)
+		if err != nil {
+			return fmt.Errorf("failed to run query: %s", err)
+		}
+		if err := checkHeight(resp.Height); err != nil {
+			return err
+		}
+		for _, m := range resp.Models {
+			if err := emit(m); err != nil {
+				return err
+			}
+		}
+	}
+
+	if *formatFl == streamFormat {
+		return nil
+	}
+	return writeFormatted(output, *formatFl, result)
 }
 
 type keyval struct {
@@ -102,26 +209,73 @@ var queries = map[string]struct {
 	// form that will be passed to the ABCI query. The format can differ
 	// from decKey if we use secondary index for matching.
 	encID func(string) ([]byte, error)
+	// prefix is the database key prefix of the queried bucket. It is
+	// used to paginate prefix queries.
+	prefix []byte
 }{
 	"/customTimedStates": {
 		newObj: func() model { return &custom.TimedState{} },
 		decKey: sequenceKey,
 		encID:  numericID,
+		prefix: []byte("timedstate:"),
 	},
 	"/customStates": {
 		newObj: func() model { return &custom.State{} },
 		decKey: sequenceKey,
 		encID:  numericID,
+		prefix: []byte("state:"),
 	},
 	"/wallets": {
 		newObj: func() model { return &cash.Set{} },
-		decKey: rawKey,
+		decKey: addressKey,
+		encID:  addressID,
+		prefix: []byte("cash:"),
+	},
+	"/auth": {
+		newObj: func() model { return &sigs.UserData{} },
+		decKey: addressKey,
 		encID:  addressID,
+		prefix: []byte("sigs:"),
 	},
 	"/contracts": {
 		newObj: func() model { return &multisig.Contract{} },
 		decKey: sequenceKey,
 		encID:  numericID,
+		prefix: []byte("contracts:"),
+	},
+	"/validators": {
+		newObj: func() model { return &validators.Accounts{} },
+		decKey: stringKey,
+		encID:  stringID,
+		prefix: []byte("uvalid:"),
+	},
+	"/schemas": {
+		newObj: func() model { return &migration.Schema{} },
+		decKey: schemaKey,
+		encID:  schemaID,
+		prefix: []byte("schema:"),
+	},
+	"/electorates": {
+		newObj: func() model { return &gov.Electorate{} },
+		decKey: refKey,
+		encID:  refID,
+		prefix: []byte("electorate:"),
+	},
+	"/electionrules": {
+		newObj: func() model { return &gov.ElectionRule{} },
+		decKey: refKey,
+		encID:  refID,
+		prefix: []byte("electnrule:"),
+	},
+	// Root path gives access to any data stored in the database, without
+	// a bucket prefix. This is how global configurations (gconf) are
+	// accessed, for example "_c:cash". Values are returned as they are
+	// stored as their type cannot be known.
+	"/": {
+		newObj: func() model { return &rawModel{} },
+		decKey: stringKey,
+		encID:  stringID,
+		prefix: nil,
 	},
 }
 
@@ -131,7 +285,21 @@ type model interface {
 	Unmarshal([]byte) error
 }
 
+// rawModel is a model that keeps the serialized data as it is. Use it when
+// the type of the model cannot be determined.
+type rawModel struct {
+	Raw []byte
+}
+
+func (m *rawModel) Unmarshal(raw []byte) error {
+	m.Raw = raw
+	return nil
+}
+
 // refID expects `id/version` pair with integers.
+//
+// Use it together with refKey for buckets that are storing versioned
+// entities.
 func refID(s string) ([]byte, error) {
 	tokens := strings.Split(s, "/")
 
@@ -206,3 +374,61 @@ func sequenceKey(raw []byte) (string, error) {
 func rawKey(raw []byte) (string, error) {
 	return hex.EncodeToString(raw), nil
 }
+
+// addressKey returns an address representation of the key, without the
+// bucket prefix.
+func addressKey(raw []byte) (string, error) {
+	addr := weave.Address(raw[bytes.Index(raw, []byte(":"))+1:])
+	if err := addr.Validate(); err != nil {
+		return "", fmt.Errorf("invalid address: %s", err)
+	}
+	return addr.String(), nil
+}
+
+// stringKey returns the key as a string if it contains only printable
+// characters. Otherwise hex encoded representation is returned.
+func stringKey(raw []byte) (string, error) {
+	for _, r := range string(raw) {
+		if !unicode.IsPrint(r) {
+			return rawKey(raw)
+		}
+	}
+	return string(raw), nil
+}
+
+func stringID(s string) ([]byte, error) {
+	return []byte(s), nil
+}
+
+// schemaID expects `pkg/version` or just `pkg` to enable prefix queries.
+func schemaID(s string) ([]byte, error) {
+	tokens := strings.Split(s, "/")
+	switch len(tokens) {
+	case 1:
+		return []byte(tokens[0]), nil
+	case 2:
+		n, err := strconv.ParseUint(tokens[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode version: %s", err)
+		}
+		raw := make([]byte, len(tokens[0])+4)
+		copy(raw, tokens[0])
+		binary.BigEndian.PutUint32(raw[len(tokens[0]):], uint32(n))
+		return raw, nil
+	default:
+		return nil, errors.New("invalid schema format, use 'pkg/version'")
+	}
+}
+
+// schemaKey returns a `pkg/version` representation of the schema key. This is
+// the opposite of schemaID.
+func schemaKey(raw []byte) (string, error) {
+	// Skip the prefix, being the characters before : (including separator)
+	id := raw[bytes.Index(raw, []byte(":"))+1:]
+	if len(id) < 5 {
+		return "", fmt.Errorf("invalid schema key length: %d", len(id))
+	}
+	pkg := id[:len(id)-4]
+	version := binary.BigEndian.Uint32(id[len(id)-4:])
+	return fmt.Sprintf("%s/%d", pkg, version), nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/cash"
+)
+
+func TestQueryPathsAreRegistered(t *testing.T) {
+	router := customd.QueryRouter()
+	for path := range queries {
+		if router.Handler(path) == nil {
+			t.Errorf("%q query path is not registered by the application", path)
+		}
+	}
+}
+
+func TestQueryKeyDecoders(t *testing.T) {
+	cases := map[string]struct {
+		Dec     func([]byte) (string, error)
+		Raw     []byte
+		Want    string
+		WantErr bool
+	}{
+		"address key": {
+			Dec:  addressKey,
+			Raw:  append([]byte("cash:"), fromHex(t, addr)...),
+			Want: addr,
+		},
+		"invalid address key": {
+			Dec:     addressKey,
+			Raw:     []byte("cash:xyz"),
+			WantErr: true,
+		},
+		"printable string key": {
+			Dec:  stringKey,
+			Raw:  []byte("_c:cash"),
+			Want: "_c:cash",
+		},
+		"binary string key": {
+			Dec:  stringKey,
+			Raw:  []byte{0, 1, 2},
+			Want: "000102",
+		},
+		"schema key": {
+			Dec:  schemaKey,
+			Raw:  []byte("schema:cash\x00\x00\x00\x02"),
+			Want: "cash/2",
+		},
+		"too short schema key": {
+			Dec:     schemaKey,
+			Raw:     []byte("schema:\x00\x00\x00\x02"),
+			WantErr: true,
+		},
+		"sequence key": {
+			Dec:  sequenceKey,
+			Raw:  append([]byte("contract:"), sequenceID(7)...),
+			Want: "7",
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			got, err := tc.Dec(tc.Raw)
+			if hasErr := err != nil; hasErr != tc.WantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assert.Equal(t, tc.Want, got)
+		})
+	}
+}
+
+func TestSchemaIDRoundTrip(t *testing.T) {
+	raw, err := schemaID("custom/3")
+	if err != nil {
+		t.Fatalf("cannot encode schema ID: %s", err)
+	}
+	got, err := schemaKey(append([]byte("schema:"), raw...))
+	if err != nil {
+		t.Fatalf("cannot decode schema key: %s", err)
+	}
+	assert.Equal(t, "custom/3", got)
+
+	prefix, err := schemaID("custom")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("custom"), prefix)
+
+	if _, err := schemaID("custom/x"); err == nil {
+		t.Fatal("invalid version must be rejected")
+	}
+}
+
+func TestRefIDRoundTrip(t *testing.T) {
+	raw, err := refID("5/2")
+	if err != nil {
+		t.Fatalf("cannot encode versioned ID: %s", err)
+	}
+	got, err := refKey(append([]byte("electorate:"), raw...))
+	if err != nil {
+		t.Fatalf("cannot decode versioned key: %s", err)
+	}
+	assert.Equal(t, "5/2", got)
+}
+
+func TestCmdQueryVerified(t *testing.T) {
+	var output bytes.Buffer
+	args := []string{
+		"-tm", tmURL,
+		"-path", "/wallets",
+		"-data", addr,
+		"-verify",
+	}
+	if err := cmdQuery(nil, &output, args); err != nil {
+		t.Fatalf("verified query failed: %s", err)
+	}
+	var res []struct {
+		Key   string
+		Value cash.Set
+	}
+	if err := json.Unmarshal(output.Bytes(), &res); err != nil {
+		t.Fatalf("cannot unmarshal result: %s", err)
+	}
+	if len(res) != 1 {
+		t.Fatalf("want one result, got %d", len(res))
+	}
+	assert.Equal(t, addr, res[0].Key)
+	if len(res[0].Value.Coins) == 0 {
+		t.Fatal("want wallet with coins")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -32,7 +33,7 @@ content.
 	}
 	var (
 		tmAddrFl = fl.String("tm", env("CUSTOMCLI_TM_ADDR", "https://CUSTOM.NETWORK.iov.one:443"),
-			"Tendermint node address. Use proper NETWORK name. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
+			"Tendermint node address. Use proper NETWORK name. Separate several addresses with a comma to fail over between them. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
 		keyPathFl = fl.String("key", env("CUSTOMCLI_PRIV_KEY", os.Getenv("HOME")+"/.customd.priv.key"),
 			"Path to the private key file that transaction should be signed with. You can use CUSTOMCLI_PRIV_KEY environment variable to set it.")
 	)
@@ -57,7 +58,7 @@ content.
 	}
 
 	customClient := client.NewClient(client.NewHTTPConnection(*tmAddrFl))
-	seq, err := customClient.NextNonce(key.PublicKey().Address())
+	seq, err := customClient.NextNonceContext(context.Background(), key.PublicKey().Address())
 	if err != nil {
 		return fmt.Errorf("cannot get the next sequence number: %s", err)
 	}
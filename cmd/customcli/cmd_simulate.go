@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/iov-one/weave-starter-kit/cmd/customd/client"
+	"github.com/iov-one/weave/coin"
+)
+
+func cmdSimulate(input io.Reader, output io.Writer, args []string) error {
+	fl := flag.NewFlagSet("", flag.ExitOnError)
+	fl.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), `
+Read binary serialized transaction from standard input and execute it against
+the latest state of the node, without broadcasting it. No change is committed.
+
+Use it to learn whether a transaction would be accepted and how much gas and
+fee it requires. Make sure the transaction is signed, the same as for the
+submission.
+`)
+		fl.PrintDefaults()
+	}
+	var (
+		tmAddrFl = fl.String("tm", env("CUSTOMCLI_TM_ADDR", "https://custom.NETWORK.iov.one:443"),
+			"Tendermint node address. Use proper NETWORK name. Separate several addresses with a comma to fail over between them. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
+		formatFl = flFormat(fl, "format", "json", "Output format.")
+	)
+	fl.Parse(args)
+
+	tx, _, err := readTx(input)
+	if err != nil {
+		return fmt.Errorf("cannot read transaction from input: %s", err)
+	}
+
+	customClient := client.NewClient(client.NewHTTPConnection(*tmAddrFl))
+	res, err := customClient.SimulateContext(context.Background(), tx)
+	if err != nil {
+		return fmt.Errorf("transaction rejected: %s", err)
+	}
+	return writeFormatted(output, *formatFl, newSimulation(res))
+}
+
+// simulation is a human friendly representation of the simulation result.
+type simulation struct {
+	Height      int64     `json:"height"`
+	GasWanted   int64     `json:"gas_wanted"`
+	GasUsed     int64     `json:"gas_used"`
+	RequiredFee coin.Coin `json:"required_fee"`
+	Tags        []tag     `json:"tags,omitempty"`
+	Log         string    `json:"log,omitempty"`
+	Data        []byte    `json:"data,omitempty"`
+}
+
+type tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func newSimulation(res *client.SimulateResponse) simulation {
+	s := simulation{
+		Height:      res.Height,
+		GasWanted:   res.GasWanted,
+		GasUsed:     res.GasUsed,
+		RequiredFee: res.RequiredFee,
+		Log:         res.Log,
+		Data:        res.Data,
+	}
+	for _, t := range res.Tags {
+		s.Tags = append(s.Tags, tag{Key: string(t.Key), Value: string(t.Value)})
+	}
+	return s
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iov-one/weave-starter-kit/cmd/customd/client"
+	"github.com/iov-one/weave/coin"
+	cmn "github.com/tendermint/tendermint/libs/common"
+)
+
+func TestSimulationOutput(t *testing.T) {
+	res := &client.SimulateResponse{
+		Height:      7,
+		GasUsed:     12,
+		RequiredFee: coin.NewCoin(0, 10000000, "CSTM"),
+		Tags: []cmn.KVPair{
+			{Key: []byte("636173683A"), Value: []byte("s")},
+		},
+	}
+	var b bytes.Buffer
+	if err := writeFormatted(&b, "table", newSimulation(res)); err != nil {
+		t.Fatalf("cannot write: %s", err)
+	}
+	const want = `height        7
+gas_wanted    0
+gas_used      12
+required_fee  0.01 CSTM
+tags.0.key    636173683A
+tags.0.value  s
+`
+	if got := b.String(); got != want {
+		t.Logf("want: %q", want)
+		t.Logf(" got: %q", got)
+		t.Fatal("unexpected output")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -26,7 +27,7 @@ Make sure to collect enough signatures before submitting the transaction.
 	}
 	var (
 		tmAddrFl = fl.String("tm", env("CUSTOMCLI_TM_ADDR", "https://custom.NETWORK.iov.one:443"),
-			"Tendermint node address. Use proper NETWORK name. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
+			"Tendermint node address. Use proper NETWORK name. Separate several addresses with a comma to fail over between them. You can use CUSTOMCLI_TM_ADDR environment variable to set it.")
 	)
 	fl.Parse(args)
 
@@ -37,7 +38,7 @@ Make sure to collect enough signatures before submitting the transaction.
 
 	customClient := client.NewClient(client.NewHTTPConnection(*tmAddrFl))
 
-	resp := customClient.BroadcastTx(tx)
+	resp := customClient.BroadcastTxContext(context.Background(), tx)
 	if resp.IsError(); err != nil {
 		return fmt.Errorf("cannot broadcast transaction: %s", err)
 	}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -18,19 +17,18 @@ kind of operation are you authorizing.
 `)
 		fl.PrintDefaults()
 	}
+	var (
+		formatFl = flFormat(fl, "format", "json", "Output format.")
+	)
 	fl.Parse(args)
 
 	for {
 		var buf bytes.Buffer
 		tx, _, err := readTx(io.TeeReader(input, &buf))
 		if err == nil {
-			// Protobuf compiler is exposing all attributes as JSON as
-			// well. This will produce a beautiful summary.
-			pretty, err := json.MarshalIndent(tx, "", "\t")
-			if err != nil {
-				return fmt.Errorf("cannot JSON serialize: %s", err)
+			if err := writeFormatted(output, *formatFl, tx); err != nil {
+				return err
 			}
-			_, _ = output.Write(pretty)
 
 			// if you want to print extra info from message you can extract
 			// and print additionally.
@@ -47,11 +45,6 @@ kind of operation are you authorizing.
 		// 	if err != nil {
 		//		return err
 		// 	}
-		// 	pretty, err := json.MarshalIndent(msg, "", "\t")
-		// 	if err != nil {
-		// 	 	return fmt.Errorf("cannot JSON serialize: %s", err)
-		// 	}
-		// 	_, _ = output.Write(pretty)
-		// 	return nil
+		// 	return writeFormatted(output, *formatFl, msg)
 	}
 }
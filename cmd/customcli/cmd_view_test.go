@@ -36,7 +36,7 @@ func TestCmdTransactionView(t *testing.T) {
 				"schema": 1
 			},
 			"memo": "a memo",
-			"ref": "MTIz"
+			"ref": "313233"
 		}
 	}
 }`
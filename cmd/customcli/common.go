@@ -15,6 +15,7 @@ import (
 	"github.com/iov-one/weave"
 	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
 	"github.com/iov-one/weave/app"
+	"github.com/iov-one/weave/x/sigs"
 	abci "github.com/tendermint/tendermint/abci/types"
 	rpcclient "github.com/tendermint/tendermint/rpc/client"
 )
@@ -160,6 +161,47 @@ func readTx(r io.Reader) (*customd.Tx, int, error) {
 
 const txHeaderSize = 4
 
+// writeSignature serialize a detached signature using a protocol buffer. The
+// same size header as for the transaction is used, so that signatures can be
+// streamed.
+func writeSignature(w io.Writer, sig *sigs.StdSignature) (int, error) {
+	b, err := sig.Marshal()
+	if err != nil {
+		return 0, err
+	}
+
+	var size [txHeaderSize]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(b)))
+
+	if n, err := w.Write(size[:]); err != nil {
+		return n, err
+	}
+	if n, err := w.Write(b); err != nil {
+		return n + txHeaderSize, err
+	}
+	return txHeaderSize + len(b), nil
+}
+
+// readSignature consumes data from given reader and unpack the serialized
+// detached signature. This function should be used together with
+// writeSignature.
+func readSignature(r io.Reader) (*sigs.StdSignature, error) {
+	var size [txHeaderSize]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	raw := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, err
+	}
+
+	var sig sigs.StdSignature
+	if err := sig.Unmarshal(raw); err != nil {
+		return nil, err
+	}
+	return &sig, nil
+}
+
 type stater interface {
 	Stat() (os.FileInfo, error)
 }
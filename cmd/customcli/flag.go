@@ -268,3 +268,30 @@ func (f *flagfraction) Fraction() *gov.Fraction {
 	frac := *f.frac
 	return &frac
 }
+
+// flFormat returns a value that is being initialized with given default value
+// and optionally overwritten by a command line argument if provided. This
+// function follows Go's flag package convention.
+// If given value is not a supported output format, process is terminated.
+func flFormat(fl *flag.FlagSet, name, defaultVal, usage string) *flagformat {
+	f := flagformat(defaultVal)
+	if _, ok := outputFormats[defaultVal]; !ok {
+		flagDie("Unsupported %q output format flag value. %s", name, defaultVal)
+	}
+	fl.Var(&f, name, usage+" Supported formats: "+strings.Join(availableFormats(), ", ")+".")
+	return &f
+}
+
+type flagformat string
+
+func (f flagformat) String() string {
+	return string(f)
+}
+
+func (f *flagformat) Set(raw string) error {
+	if _, ok := outputFormats[raw]; !ok {
+		return fmt.Errorf("unsupported format, use one of %s", strings.Join(availableFormats(), ", "))
+	}
+	*f = flagformat(raw)
+	return nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/crypto/bech32"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// bech32Prefix is the human readable part of the bech32 address
+// representation.
+const bech32Prefix = "custm"
+
+// outputFormats contains a mapping of a format name to a function that writes
+// a humanized value in that format. Each read-only command should accept a
+// -format flag and use writeFormatted to print its result.
+var outputFormats = map[string]func(w io.Writer, v interface{}) error{
+	"json":   writeJSON,
+	"yaml":   writeYAML,
+	"table":  writeTable,
+	"csv":    writeCSV,
+	"ndjson": writeNDJSON,
+}
+
+// streamFormat is the format that allows to write values one by one, as soon
+// as they are available. Each written value is a complete document.
+const streamFormat flagformat = "ndjson"
+
+func availableFormats() []string {
+	available := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		available = append(available, name)
+	}
+	sort.Strings(available)
+	return available
+}
+
+// writeFormatted writes a human friendly representation of given value using
+// requested format.
+func writeFormatted(w io.Writer, format flagformat, v interface{}) error {
+	write, ok := outputFormats[string(format)]
+	if !ok {
+		return fmt.Errorf("unsupported %q format", format)
+	}
+	return write(w, humanize(v))
+}
+
+// object is a humanized representation of a structure. Unlike a map, it
+// preserves the order of attributes.
+type object []field
+
+type field struct {
+	Name  string
+	Value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func (o object) MarshalYAML() (interface{}, error) {
+	ms := make(yaml.MapSlice, len(o))
+	for i, f := range o {
+		ms[i] = yaml.MapItem{Key: f.Name, Value: f.Value}
+	}
+	return ms, nil
+}
+
+// humanize transforms given value into a tree of objects, lists and scalar
+// values that is easy to read by a human. Known weave types are represented
+// in their human friendly format:
+// - weave.Address as a hex and bech32 encoded string
+// - weave.UnixTime as an RFC3339 formatted date
+// - coin.Coin as a human readable amount (ie "1.5 CSTM")
+// - sequence IDs as decimal numbers
+// - any other binary data as a hex encoded string
+// Zero values of attributes declared with the omitempty option are omitted.
+func humanize(v interface{}) interface{} {
+	return humanizeValue(reflect.ValueOf(v), "")
+}
+
+var (
+	addressType  = reflect.TypeOf(weave.Address{})
+	unixTimeType = reflect.TypeOf(weave.UnixTime(0))
+	coinType     = reflect.TypeOf(coin.Coin{})
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+func humanizeValue(v reflect.Value, name string) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	switch v.Type() {
+	case addressType:
+		return humanAddress(weave.Address(v.Bytes()))
+	case unixTimeType:
+		return weave.UnixTime(v.Int()).Time().UTC().Format(time.RFC3339)
+	case coinType:
+		return v.Interface().(coin.Coin).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return humanizeValue(v.Elem(), name)
+	case reflect.Struct:
+		return humanizeStruct(v)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return humanBytes(v.Bytes(), name)
+		}
+		fallthrough
+	case reflect.Array:
+		list := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			list = append(list, humanizeValue(v.Index(i), name))
+		}
+		return list
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		obj := make(object, 0, len(keys))
+		for _, k := range keys {
+			obj = append(obj, field{Name: fmt.Sprint(k.Interface()), Value: humanizeValue(v.MapIndex(k), "")})
+		}
+		return obj
+	case reflect.Int32:
+		// Protobuf enums are int32 values implementing the stringer
+		// interface.
+		if v.Type().Implements(stringerType) {
+			return v.Interface().(fmt.Stringer).String()
+		}
+	}
+	return v.Interface()
+}
+
+func humanizeStruct(v reflect.Value) object {
+	obj := make(object, 0, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if sf.PkgPath != "" || strings.HasPrefix(sf.Name, "XXX_") {
+			continue
+		}
+		tag := strings.Split(sf.Tag.Get("json"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if isNil(fv) || (hasOption(tag[1:], "omitempty") && isZero(fv)) {
+			continue
+		}
+		name := sf.Name
+		if tag[0] != "" {
+			name = tag[0]
+		}
+		obj = append(obj, field{Name: name, Value: humanizeValue(fv, sf.Name)})
+	}
+	return obj
+}
+
+func hasOption(options []string, name string) bool {
+	for _, o := range options {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return v.IsNil() || (v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface && v.Len() == 0)
+	case reflect.Struct:
+		return false
+	}
+	return v.Interface() == reflect.Zero(v.Type()).Interface()
+}
+
+func humanAddress(a weave.Address) object {
+	obj := object{{Name: "hex", Value: a.String()}}
+	if bech, err := bech32.Encode(bech32Prefix, a); err == nil {
+		obj = append(obj, field{Name: "bech32", Value: string(bech)})
+	}
+	return obj
+}
+
+// humanBytes returns a decimal representation of a sequence ID if the field
+// name indicates that it is holding one. Otherwise hex encoded data is
+// returned.
+func humanBytes(b []byte, name string) interface{} {
+	if isSequenceField(name) {
+		if n, err := fromSequence(b); err == nil {
+			return n
+		}
+	}
+	return hex.EncodeToString(b)
+}
+
+func isSequenceField(name string) bool {
+	return strings.HasSuffix(name, "ID") || name == "Multisig"
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	pretty, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return fmt.Errorf("cannot JSON serialize: %s", err)
+	}
+	_, err = w.Write(pretty)
+	return err
+}
+
+// writeNDJSON writes a newline delimited JSON. Each element of a list is
+// written in a separate line.
+func writeNDJSON(w io.Writer, v interface{}) error {
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+	enc := json.NewEncoder(w)
+	for _, el := range list {
+		if err := enc.Encode(el); err != nil {
+			return fmt.Errorf("cannot JSON serialize: %s", err)
+		}
+	}
+	return nil
+}
+
+func writeYAML(w io.Writer, v interface{}) error {
+	raw, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("cannot YAML serialize: %s", err)
+	}
+	_, err = w.Write(raw)
+	return err
+}
+
+// writeTable writes a list of values as a table with a row for each value.
+// A single value is written as a two column, name and value table.
+func writeTable(w io.Writer, v interface{}) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if list, ok := v.([]interface{}); ok {
+		header, rows := tabulate(list)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+	} else {
+		for _, f := range flatten(v, "") {
+			fmt.Fprintf(tw, "%s\t%v\n", f.Name, f.Value)
+		}
+	}
+	return tw.Flush()
+}
+
+// writeCSV writes values as comma separated values. The first row is the
+// header.
+func writeCSV(w io.Writer, v interface{}) error {
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+	header, rows := tabulate(list)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// tabulate flattens all values and returns a header containing all columns
+// together with a row for each value.
+func tabulate(list []interface{}) ([]string, [][]string) {
+	var (
+		header  []string
+		columns = make(map[string]int)
+		flat    = make([]object, len(list))
+	)
+	for i, v := range list {
+		flat[i] = flatten(v, "")
+		for _, f := range flat[i] {
+			if _, ok := columns[f.Name]; !ok {
+				columns[f.Name] = len(header)
+				header = append(header, f.Name)
+			}
+		}
+	}
+	rows := make([][]string, len(list))
+	for i, obj := range flat {
+		rows[i] = make([]string, len(header))
+		for _, f := range obj {
+			rows[i][columns[f.Name]] = fmt.Sprint(f.Value)
+		}
+	}
+	return header, rows
+}
+
+// flatten returns a single level representation of a humanized value. Nested
+// attribute names are dot separated.
+func flatten(v interface{}, prefix string) object {
+	join := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+
+	switch v := v.(type) {
+	case object:
+		var res object
+		for _, f := range v {
+			res = append(res, flatten(f.Value, join(f.Name))...)
+		}
+		return res
+	case []interface{}:
+		var res object
+		for i, el := range v {
+			res = append(res, flatten(el, join(fmt.Sprint(i)))...)
+		}
+		return res
+	case nil:
+		return nil
+	default:
+		return object{{Name: prefix, Value: v}}
+	}
+}
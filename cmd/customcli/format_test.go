@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave-starter-kit/x/custom"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/cash"
+)
+
+func TestHumanize(t *testing.T) {
+	cases := map[string]struct {
+		Value interface{}
+		Want  interface{}
+	}{
+		"address": {
+			Value: weave.Address(fromHex(t, addr)),
+			Want: object{
+				{Name: "hex", Value: addr},
+				{Name: "bech32", Value: "custm1u29wnfhtjn7g3de7kl9adwrmlyltn0hskfmvc5"},
+			},
+		},
+		"unix time": {
+			Value: weave.UnixTime(1563000000),
+			Want:  "2019-07-13T06:40:00Z",
+		},
+		"coin": {
+			Value: coin.NewCoinp(1, 500000000, "CSTM"),
+			Want:  "1.5 CSTM",
+		},
+		"enum": {
+			Value: custom.InnerStateEnum_CaseTwo,
+			Want:  "INNER_STATE_ENUM_CASE_2",
+		},
+		"sequence ID and binary data": {
+			Value: &custom.DeleteTimedStateMsg{
+				TimedStateID: sequenceID(42),
+			},
+			Want: object{
+				{Name: "timed_state_id", Value: uint64(42)},
+			},
+		},
+		"empty attributes are omitted": {
+			Value: &custom.TimedState{
+				Str:  "cstm",
+				Byte: []byte{0xca, 0xfe},
+			},
+			Want: object{
+				{Name: "str", Value: "cstm"},
+				{Name: "byte", Value: "cafe"},
+			},
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, tc.Want, humanize(tc.Value))
+		})
+	}
+}
+
+func TestWriteFormatted(t *testing.T) {
+	tx := &customd.Tx{
+		Sum: &customd.Tx_CashSendMsg{
+			CashSendMsg: &cash.SendMsg{
+				Metadata: &weave.Metadata{Schema: 1},
+				Amount:   coin.NewCoinp(5, 0, "CSTM"),
+				Memo:     "a memo",
+			},
+		},
+	}
+	list := []keyval{
+		{Key: "1", Value: &custom.TimedState{Str: "cstm1"}},
+		{Key: "2", Value: &custom.TimedState{Str: "cstm2", Byte: []byte{1}}},
+	}
+
+	cases := map[string]struct {
+		Format flagformat
+		Value  interface{}
+		Want   string
+	}{
+		"yaml": {
+			Format: "yaml",
+			Value:  tx,
+			Want: `Sum:
+  CashSendMsg:
+    metadata:
+      schema: 1
+    amount: 5 CSTM
+    memo: a memo
+`,
+		},
+		"table of a single value": {
+			Format: "table",
+			Value:  tx,
+			Want: `Sum.CashSendMsg.metadata.schema  1
+Sum.CashSendMsg.amount           5 CSTM
+Sum.CashSendMsg.memo             a memo
+`,
+		},
+		"table of a list": {
+			Format: "table",
+			Value:  list,
+			Want: `KEY  VALUE.STR  VALUE.BYTE
+1    cstm1      
+2    cstm2      01
+`,
+		},
+		"csv": {
+			Format: "csv",
+			Value:  list,
+			Want: `Key,Value.str,Value.byte
+1,cstm1,
+2,cstm2,01
+`,
+		},
+		"ndjson of a list": {
+			Format: "ndjson",
+			Value:  list,
+			Want: `{"Key":"1","Value":{"str":"cstm1"}}
+{"Key":"2","Value":{"str":"cstm2","byte":"01"}}
+`,
+		},
+		"ndjson of a single value": {
+			Format: "ndjson",
+			Value:  list[0],
+			Want: `{"Key":"1","Value":{"str":"cstm1"}}
+`,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := writeFormatted(&b, tc.Format, tc.Value); err != nil {
+				t.Fatalf("cannot write: %s", err)
+			}
+			if got := b.String(); got != tc.Want {
+				t.Logf("want: %q", tc.Want)
+				t.Logf(" got: %q", got)
+				t.Fatal("unexpected output")
+			}
+		})
+	}
+}
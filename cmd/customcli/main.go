@@ -37,17 +37,23 @@ var commands = map[string]func(input io.Reader, output io.Writer, args []string)
 	"as-batch":                  cmdAsBatch,
 	"as-sequence":               cmdAsSequence,
 	"from-sequence":             cmdFromSequence,
+	"history":                   cmdHistory,
 	"keyaddr":                   cmdKeyaddr,
 	"keygen":                    cmdKeygen,
 	"mnemonic":                  cmdMnemonic,
 	"multisig":                  cmdMultisig,
+	"multisig-combine":          cmdMultisigCombine,
+	"multisig-sign":             cmdMultisigSign,
+	"multisig-status":           cmdMultisigStatus,
 	"query":                     cmdQuery,
 	"send-tokens":               cmdSendTokens,
 	"set-validators":            cmdSetValidators,
 	"sign":                      cmdSignTransaction,
+	"simulate":                  cmdSimulate,
 	"submit":                    cmdSubmitTransaction,
 	"version":                   cmdVersion,
 	"view":                      cmdTransactionView,
+	"with-expiry":               cmdWithExpiry,
 	"with-fee":                  cmdWithFee,
 	"with-multisig":             cmdWithMultisig,
 	"with-multisig-participant": cmdWithMultisigParticipant,
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
+	"sync"
+	"syscall"
 	"time"
 
 	tmtest "github.com/iov-one/weave/tmtest"
@@ -23,7 +26,9 @@ func RunCustomd(ctx context.Context, t tmtest.TestReporter, home string) (cleanu
 		}
 	}
 
-	cmd := exec.CommandContext(ctx, appPath, "-home", home, "start")
+	// The process is not bound to the context, as it would be killed
+	// when the context is done. It is stopped gracefully instead.
+	cmd := exec.Command(appPath, "-home", home, "start")
 	// log tendermint output for verbose debugging....
 	if os.Getenv("TM_DEBUG") != "" {
 		cmd.Stdout = os.Stderr
@@ -38,11 +43,15 @@ func RunCustomd(ctx context.Context, t tmtest.TestReporter, home string) (cleanu
 	t.Logf("Running %s pid=%d", appPath, cmd.Process.Pid)
 
 	// Return a cleanup function, that will wait for app to stop.
-	// We also auto-kill when the context is Done
+	// We also auto-stop when the context is Done
+	var once sync.Once
 	cleanup = func() {
-		t.Logf("%s cleanup called", "customd")
-		_ = cmd.Process.Kill()
-		_ = cmd.Wait()
+		once.Do(func() {
+			t.Logf("%s cleanup called", "customd")
+			if err := StopCustomd(cmd, 10*time.Second); err != nil {
+				t.Logf("%s did not stop cleanly: %s", "customd", err)
+			}
+		})
 	}
 	go func() {
 		<-ctx.Done()
@@ -50,3 +59,22 @@ func RunCustomd(ctx context.Context, t tmtest.TestReporter, home string) (cleanu
 	}()
 	return cleanup
 }
+
+// StopCustomd stops the customd process gracefully with SIGTERM, and waits
+// for it to exit. The process is killed if it does not exit within the
+// timeout. An error is returned unless the process exited with success.
+func StopCustomd(cmd *exec.Cmd, timeout time.Duration) error {
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return fmt.Errorf("cannot signal process: %s", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(timeout):
+		_ = cmd.Process.Kill()
+		<-exited
+		return fmt.Errorf("killed after %s", timeout)
+	}
+}
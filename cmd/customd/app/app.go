@@ -2,8 +2,6 @@ package customd
 
 import (
 	"context"
-	"path/filepath"
-	"strings"
 
 	"github.com/iov-one/weave"
 	"github.com/iov-one/weave-starter-kit/x/custom"
@@ -17,10 +15,13 @@ import (
 	"github.com/iov-one/weave/x/batch"
 	"github.com/iov-one/weave/x/cash"
 	"github.com/iov-one/weave/x/cron"
+	"github.com/iov-one/weave/x/gov"
 	"github.com/iov-one/weave/x/multisig"
 	"github.com/iov-one/weave/x/sigs"
 	"github.com/iov-one/weave/x/utils"
 	"github.com/iov-one/weave/x/validators"
+	tmiavl "github.com/tendermint/iavl"
+	dbm "github.com/tendermint/tendermint/libs/db"
 )
 
 // Authenticator returns authentication with multisigs
@@ -35,17 +36,22 @@ func CashControl() cash.Controller {
 }
 
 // Chain returns a chain of decorators, to handle authentication,
-// fees, logging, and recovery
+// expiry, mempool admission, fees, logging, metrics and recovery
 func Chain(authFn x.Authenticator, minFee coin.Coin) app.Decorators {
 
 	return app.ChainDecorators(
-		utils.NewLogging(),
+		NewLogging(),
+		NewMetrics(),
 		utils.NewRecovery(),
 		utils.NewKeyTagger(),
 		// on CheckTx, bad tx don't affect state
 		utils.NewSavepoint().OnCheck(),
+		// reject expired tx before their signature sequence is used
+		NewExpiry(),
 		sigs.NewDecorator(),
 		multisig.NewDecorator(authFn),
+		// on CheckTx, reject tx not allowed to the mempool
+		NewAdmission(authFn),
 		cash.NewFeeDecorator(authFn, CashControl()),
 		batch.NewDecorator(),
 		utils.NewSavepoint().OnDeliver(),
@@ -68,6 +74,7 @@ func Router(authFn x.Authenticator, issuer weave.Address) *app.Router {
 
 // QueryRouter returns a default query router,
 // allowing access to "/custom", "/auth", "/contracts", "/wallets", "/validators" and "/"
+// Application registers "/simulate" path as it depends on the handler.
 func QueryRouter() weave.QueryRouter {
 	r := weave.NewQueryRouter()
 	r.RegisterAll(
@@ -77,7 +84,9 @@ func QueryRouter() weave.QueryRouter {
 		migration.RegisterQuery,
 		orm.RegisterQuery,
 		validators.RegisterQuery,
+		gov.RegisterQuery,
 		custom.RegisterQuery,
+		RegisterRangeQuery,
 	)
 	return r
 }
@@ -103,7 +112,8 @@ func CronStack() weave.Handler {
 	custom.RegisterCronRoutes(rt, authFn)
 
 	decorators := app.ChainDecorators(
-		utils.NewLogging(),
+		NewCronLogging(),
+		NewCronMetrics(),
 		utils.NewRecovery(),
 		utils.NewKeyTagger(),
 		utils.NewActionTagger(),
@@ -113,26 +123,38 @@ func CronStack() weave.Handler {
 }
 
 // CommitKVStore returns an initialized KVStore that persists
-// the data to the named path.
+// the data to the named path, using the default database backend.
 func CommitKVStore(dbPath string) (weave.CommitKVStore, error) {
-	// memory backed case, just for testing
-	if dbPath == "" {
-		return iavl.MockCommitStore(), nil
-	}
-
-	// Expand the path fully
-	path, err := filepath.Abs(dbPath)
+	tree, err := CommitTree(GoLevelDBBackend, dbPath)
 	if err != nil {
-		return nil, errors.Wrapf(errors.ErrDatabase, "invalid database name: %s", path)
+		return nil, err
 	}
+	return iavl.NewCommitStoreFromTree(tree), nil
+}
 
-	// Some external calls accidentally add a ".db", which is now removed
-	path = strings.TrimSuffix(path, filepath.Ext(path))
+// CommitTree returns the IAVL tree that persists the data to the
+// named path using the given database backend, loaded at its latest
+// version. Use it instead of CommitKVStore when direct access to the
+// tree is needed, for example to read older versions of the state or to
+// generate proofs.
+func CommitTree(backend DBBackend, dbPath string) (*tmiavl.MutableTree, error) {
+	_, tree, err := openCommitTree(backend, dbPath)
+	return tree, err
+}
 
-	// Split the database name into it's components (dir, name)
-	dir := filepath.Dir(path)
-	name := filepath.Base(path)
-	return iavl.NewCommitStore(dir, name), nil
+// openCommitTree is like CommitTree, but returns the database too, so that
+// it can be closed.
+func openCommitTree(backend DBBackend, dbPath string) (dbm.DB, *tmiavl.MutableTree, error) {
+	db, err := OpenDB(backend, dbPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree := tmiavl.NewMutableTree(db, iavl.DefaultCacheSize)
+	if _, err := tree.Load(); err != nil {
+		db.Close()
+		return nil, nil, errors.Wrapf(errors.ErrDatabase, "cannot load database: %s", err)
+	}
+	return db, tree, nil
 }
 
 // Application constructs a basic ABCI application with
@@ -140,13 +162,56 @@ func CommitKVStore(dbPath string) (weave.CommitKVStore, error) {
 func Application(name string, h weave.Handler,
 	tx weave.TxDecoder, dbPath string, debug bool) (app.BaseApp, error) {
 
-	ctx := context.Background()
 	kv, err := CommitKVStore(dbPath)
 	if err != nil {
 		return app.BaseApp{}, errors.Wrap(err, "cannot create database instance")
 	}
-	store := app.NewStoreApp(name, kv, QueryRouter(), ctx)
-	ticker := cron.NewTicker(CronStack(), CronTaskMarshaler)
-	base := app.NewBaseApp(store, tx, h, ticker, debug)
-	return base, nil
+	return storeApplication(name, h, tx, kv, QueryRouter(), debug), nil
+}
+
+// HistoricalApplication constructs an ABCI application like Application
+// does, that additionally serves queries of older heights. The state is
+// stored according to the store options.
+func HistoricalApplication(name string, h weave.Handler,
+	tx weave.TxDecoder, dbPath string, opts StoreOptions, debug bool) (HistoricalApp, error) {
+
+	tree, err := CommitTree(opts.Backend, dbPath)
+	if err != nil {
+		return HistoricalApp{}, errors.Wrap(err, "cannot create database instance")
+	}
+	qr := QueryRouter()
+	base := storeApplication(name, h, tx, NewCommitStore(tree, opts.Pruning), qr, debug)
+	return NewHistoricalApp(base, tree, qr), nil
+}
+
+// ProvingApplication constructs an ABCI application like
+// HistoricalApplication does, that additionally proves raw key queries.
+// Close the application to close its database.
+func ProvingApplication(name string, h weave.Handler,
+	tx weave.TxDecoder, dbPath string, opts StoreOptions, debug bool) (ProvingApp, error) {
+
+	db, tree, err := openCommitTree(opts.Backend, dbPath)
+	if err != nil {
+		return ProvingApp{}, errors.Wrap(err, "cannot create database instance")
+	}
+	qr := QueryRouter()
+	base := storeApplication(name, h, tx, NewCommitStore(tree, opts.Pruning), qr, debug)
+	application := NewProvingApp(NewHistoricalApp(base, tree, qr))
+	application.db = db
+	return application, nil
+}
+
+func storeApplication(name string, h weave.Handler,
+	tx weave.TxDecoder, kv weave.CommitKVStore, qr weave.QueryRouter, debug bool) app.BaseApp {
+
+	ctx := context.Background()
+	store := app.NewStoreApp(name, kv, qr, ctx)
+	RegisterSimulateQuery(qr, h, tx, store)
+	// The gauges are counted before the node starts, so that the state is
+	// not iterated while processing blocks.
+	cache := kv.CacheWrap()
+	initGauges(cache)
+	cache.Discard()
+	ticker := metricsTicker{Ticker: cron.NewTicker(CronStack(), CronTaskMarshaler)}
+	return app.NewBaseApp(store, tx, h, ticker, debug)
 }
@@ -0,0 +1,346 @@
+package customd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/iov-one/weave/errors"
+	dbm "github.com/tendermint/tendermint/libs/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBucket is the name of the BoltDB bucket that holds all the keys.
+var boltBucket = []byte("customd")
+
+// boltLockTimeout is how long opening a database waits for the file lock.
+// The lock is held by the process that has the database open for writing.
+const boltLockTimeout = time.Second
+
+// boltDB implements the tendermint database interface on top of a BoltDB
+// file.
+//
+// Each write is a BoltDB transaction that is synced to disk, so there is no
+// difference between the sync and non sync methods. Batches are written in
+// a single transaction. BoltDB does not support empty keys, so they are
+// never found and cannot be set.
+type boltDB struct {
+	db *bolt.DB
+}
+
+var _ dbm.DB = (*boltDB)(nil)
+
+// openBoltDB opens the database file at the given path. A read only
+// database must exist and is opened without taking the write lock.
+func openBoltDB(path string, readOnly bool) (*boltDB, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil, errors.Wrapf(errors.ErrDatabase, "%s is not a %s database", path, BoltDBBackend)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltLockTimeout, ReadOnly: readOnly})
+	if err != nil {
+		return nil, errors.Wrapf(errors.ErrDatabase, "cannot open database: %s", err)
+	}
+	if readOnly {
+		err = db.View(func(tx *bolt.Tx) error {
+			if tx.Bucket(boltBucket) == nil {
+				return errors.Wrapf(errors.ErrDatabase, "%s is not a %s database", path, BoltDBBackend)
+			}
+			return nil
+		})
+	} else {
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(boltBucket)
+			return err
+		})
+	}
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrapf(errors.ErrDatabase, "cannot open database: %s", err)
+	}
+	return &boltDB{db: db}, nil
+}
+
+// Get implements dbm.DB.
+func (d *boltDB) Get(key []byte) []byte {
+	if len(key) == 0 {
+		return nil
+	}
+	var value []byte
+	err := d.db.View(func(tx *bolt.Tx) error {
+		// The value is only valid during the transaction.
+		if v := tx.Bucket(boltBucket).Get(key); v != nil {
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// Has implements dbm.DB.
+func (d *boltDB) Has(key []byte) bool {
+	return d.Get(key) != nil
+}
+
+// Set implements dbm.DB.
+func (d *boltDB) Set(key, value []byte) {
+	d.update(func(b *bolt.Bucket) error {
+		return b.Put(key, nonNilBytes(value))
+	})
+}
+
+// SetSync implements dbm.DB.
+func (d *boltDB) SetSync(key, value []byte) {
+	d.Set(key, value)
+}
+
+// Delete implements dbm.DB.
+func (d *boltDB) Delete(key []byte) {
+	d.update(func(b *bolt.Bucket) error {
+		return b.Delete(key)
+	})
+}
+
+// DeleteSync implements dbm.DB.
+func (d *boltDB) DeleteSync(key []byte) {
+	d.Delete(key)
+}
+
+// update executes fn in a write transaction and panics on failure, as the
+// tendermint database interface does not return errors.
+func (d *boltDB) update(fn func(*bolt.Bucket) error) {
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(boltBucket))
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Iterator implements dbm.DB.
+func (d *boltDB) Iterator(start, end []byte) dbm.Iterator {
+	return newBoltIterator(d.db, start, end, true)
+}
+
+// ReverseIterator implements dbm.DB.
+func (d *boltDB) ReverseIterator(start, end []byte) dbm.Iterator {
+	return newBoltIterator(d.db, start, end, false)
+}
+
+// Close implements dbm.DB.
+func (d *boltDB) Close() {
+	d.db.Close()
+}
+
+// NewBatch implements dbm.DB.
+func (d *boltDB) NewBatch() dbm.Batch {
+	return &boltBatch{db: d}
+}
+
+// Print implements dbm.DB.
+func (d *boltDB) Print() {
+	it := d.Iterator(nil, nil)
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		fmt.Printf("[%X]:\t[%X]\n", it.Key(), it.Value())
+	}
+}
+
+// Stats implements dbm.DB.
+func (d *boltDB) Stats() map[string]string {
+	stats := d.db.Stats()
+	return map[string]string{
+		"boltdb.tx":          fmt.Sprint(stats.TxN),
+		"boltdb.open_tx":     fmt.Sprint(stats.OpenTxN),
+		"boltdb.free_pages":  fmt.Sprint(stats.FreePageN),
+		"boltdb.freelist_kb": fmt.Sprint(stats.FreelistInuse / 1024),
+	}
+}
+
+func nonNilBytes(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+// boltBatch collects the changes and writes them in a single transaction.
+type boltBatch struct {
+	db  *boltDB
+	ops []boltOp
+}
+
+type boltOp struct {
+	key, value []byte
+	delete     bool
+}
+
+// Set implements dbm.Batch.
+func (b *boltBatch) Set(key, value []byte) {
+	b.ops = append(b.ops, boltOp{key: key, value: nonNilBytes(value)})
+}
+
+// Delete implements dbm.Batch.
+func (b *boltBatch) Delete(key []byte) {
+	b.ops = append(b.ops, boltOp{key: key, delete: true})
+}
+
+// Write implements dbm.Batch.
+func (b *boltBatch) Write() {
+	b.db.update(func(bucket *bolt.Bucket) error {
+		for _, op := range b.ops {
+			var err error
+			if op.delete {
+				err = bucket.Delete(op.key)
+			} else {
+				err = bucket.Put(op.key, op.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// WriteSync implements dbm.Batch.
+func (b *boltBatch) WriteSync() {
+	b.Write()
+}
+
+// Close implements dbm.Batch.
+func (b *boltBatch) Close() {
+	b.ops = nil
+}
+
+// boltIteratorBatch is the number of entries read from the database at once.
+const boltIteratorBatch = 100
+
+// boltIterator reads entries from the database in batches, as they are
+// requested. Each batch is read in a new read transaction starting after the
+// last returned key, so no transaction is left open between the calls and
+// writes are never blocked by an iterator.
+type boltIterator struct {
+	db         *bolt.DB
+	start, end []byte
+	ascending  bool
+	// from and to is the range of keys that were not read yet.
+	from, to []byte
+
+	batch []boltOp
+	// done is set once the last batch is read from the database.
+	done bool
+}
+
+var _ dbm.Iterator = (*boltIterator)(nil)
+
+func newBoltIterator(db *bolt.DB, start, end []byte, ascending bool) *boltIterator {
+	it := &boltIterator{
+		db:        db,
+		start:     start,
+		end:       end,
+		ascending: ascending,
+		from:      start,
+		to:        end,
+	}
+	it.read()
+	return it
+}
+
+// read loads the next batch of entries and narrows the range to the keys
+// that were not read yet.
+func (it *boltIterator) read() {
+	err := it.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		var k, v []byte
+		if it.ascending {
+			if len(it.from) == 0 {
+				k, v = c.First()
+			} else {
+				k, v = c.Seek(it.from)
+			}
+			for ; k != nil && len(it.batch) < boltIteratorBatch; k, v = c.Next() {
+				if it.to != nil && bytes.Compare(k, it.to) >= 0 {
+					break
+				}
+				it.batch = append(it.batch, boltOp{key: append([]byte{}, k...), value: append([]byte{}, v...)})
+			}
+		} else {
+			if it.to == nil {
+				k, v = c.Last()
+			} else if k, v = c.Seek(it.to); k == nil {
+				// All keys are before the end of the range.
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+			for ; k != nil && len(it.batch) < boltIteratorBatch; k, v = c.Prev() {
+				if it.from != nil && bytes.Compare(k, it.from) < 0 {
+					break
+				}
+				it.batch = append(it.batch, boltOp{key: append([]byte{}, k...), value: append([]byte{}, v...)})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	if len(it.batch) < boltIteratorBatch {
+		it.done = true
+		return
+	}
+	last := it.batch[len(it.batch)-1].key
+	if it.ascending {
+		// The smallest key greater than the last one.
+		it.from = append(append([]byte{}, last...), 0)
+	} else {
+		it.to = last
+	}
+}
+
+// Domain implements dbm.Iterator.
+func (it *boltIterator) Domain() ([]byte, []byte) {
+	return it.start, it.end
+}
+
+// Valid implements dbm.Iterator.
+func (it *boltIterator) Valid() bool {
+	return len(it.batch) > 0
+}
+
+// Next implements dbm.Iterator.
+func (it *boltIterator) Next() {
+	it.assertValid()
+	it.batch = it.batch[1:]
+	if len(it.batch) == 0 && !it.done {
+		it.read()
+	}
+}
+
+// Key implements dbm.Iterator.
+func (it *boltIterator) Key() []byte {
+	it.assertValid()
+	return it.batch[0].key
+}
+
+// Value implements dbm.Iterator.
+func (it *boltIterator) Value() []byte {
+	it.assertValid()
+	return it.batch[0].value
+}
+
+// Close implements dbm.Iterator.
+func (it *boltIterator) Close() {
+	it.batch = nil
+	it.done = true
+}
+
+func (it *boltIterator) assertValid() {
+	if !it.Valid() {
+		panic("iterator is invalid")
+	}
+}
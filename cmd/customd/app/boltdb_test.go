@@ -0,0 +1,80 @@
+package customd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iov-one/weave/weavetest/assert"
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+func TestBoltDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltdb")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := openBoltDB(filepath.Join(dir, "state.db"), false)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	// More keys than a single batch, so that the iterators read them in
+	// several transactions.
+	const n = boltIteratorBatch*2 + 5
+	batch := db.NewBatch()
+	for i := 0; i < n; i++ {
+		batch.Set([]byte(fmt.Sprintf("key-%04d", i)), []byte{byte(i)})
+	}
+	batch.Set([]byte("other"), nil)
+	batch.Delete([]byte("key-0000"))
+	batch.Write()
+	batch.Close()
+
+	assert.Equal(t, []byte{1}, db.Get([]byte("key-0001")))
+	assert.Equal(t, []byte{}, db.Get([]byte("other")))
+	assert.Equal(t, false, db.Has([]byte("key-0000")))
+	assert.Equal(t, false, db.Has(nil))
+	db.Delete([]byte("key-0001"))
+	assert.Equal(t, false, db.Has([]byte("key-0001")))
+
+	assert.Equal(t, keyRange(2, n), iteratorKeys(db.Iterator([]byte("key-"), []byte("key."))))
+	assert.Equal(t, keyRange(2, 150), iteratorKeys(db.Iterator(nil, []byte("key-0150"))))
+	assert.Equal(t, reverse(keyRange(2, 150)), iteratorKeys(db.ReverseIterator(nil, []byte("key-0150"))))
+	assert.Equal(t, reverse(keyRange(2, n)), iteratorKeys(db.ReverseIterator([]byte("key-"), []byte("key."))))
+	assert.Equal(t, append(keyRange(2, n), "other"), iteratorKeys(db.Iterator(nil, nil)))
+	assert.Equal(t, append([]string{"other"}, reverse(keyRange(2, n))...), iteratorKeys(db.ReverseIterator(nil, nil)))
+
+	// Writes are not blocked by an open iterator.
+	it := db.Iterator(nil, nil)
+	db.SetSync([]byte("key-0000"), []byte{0})
+	assert.Equal(t, "key-0002", string(it.Key()))
+	it.Close()
+	assert.Equal(t, false, it.Valid())
+}
+
+func iteratorKeys(it dbm.Iterator) []string {
+	defer it.Close()
+	var keys []string
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	return keys
+}
+
+func keyRange(from, to int) []string {
+	var keys []string
+	for i := from; i < to; i++ {
+		keys = append(keys, fmt.Sprintf("key-%04d", i))
+	}
+	return keys
+}
+
+func reverse(keys []string) []string {
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[len(keys)-1-i] = k
+	}
+	return out
+}
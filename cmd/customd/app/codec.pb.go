@@ -11,7 +11,9 @@ import (
 	_ "github.com/gogo/protobuf/gogoproto"
 	proto "github.com/gogo/protobuf/proto"
 	github_com_iov_one_weave "github.com/iov-one/weave"
+	weave "github.com/iov-one/weave"
 	custom "github.com/iov-one/weave-starter-kit/x/custom"
+	coin "github.com/iov-one/weave/coin"
 	migration "github.com/iov-one/weave/migration"
 	cash "github.com/iov-one/weave/x/cash"
 	multisig "github.com/iov-one/weave/x/multisig"
@@ -48,6 +50,8 @@ type Tx struct {
 	Signatures []*sigs.StdSignature `protobuf:"bytes,2,rep,name=signatures,proto3" json:"signatures,omitempty"`
 	// ID of a multisig contract.
 	Multisig [][]byte `protobuf:"bytes,4,rep,name=multisig,proto3" json:"multisig,omitempty"`
+	// Optional limit of the blocks that can include the transaction.
+	ValidUntil *ValidUntil `protobuf:"bytes,5,opt,name=valid_until,json=validUntil,proto3" json:"valid_until,omitempty"`
 	// sum defines over all allowed messages on this chain.
 	//
 	// Types that are valid to be assigned to Sum:
@@ -163,6 +167,13 @@ func (m *Tx) GetMultisig() [][]byte {
 	return nil
 }
 
+func (m *Tx) GetValidUntil() *ValidUntil {
+	if m != nil {
+		return m.ValidUntil
+	}
+	return nil
+}
+
 func (m *Tx) GetCashSendMsg() *cash.SendMsg {
 	if x, ok := m.GetSum().(*Tx_CashSendMsg); ok {
 		return x.CashSendMsg
@@ -407,6 +418,64 @@ func _Tx_OneofSizer(msg proto.Message) (n int) {
 	return n
 }
 
+// ValidUntil limits the blocks that can include a transaction, so that a
+// signed transaction cannot be submitted long after it was created. At least
+// one attribute must be set. If both are set, the transaction expires as soon
+// as either one is reached.
+type ValidUntil struct {
+	// Time is the block time from which the transaction is expired.
+	Time github_com_iov_one_weave.UnixTime `protobuf:"varint,1,opt,name=time,proto3,casttype=github.com/iov-one/weave.UnixTime" json:"time,omitempty"`
+	// Height is the last block height that can include the transaction.
+	Height int64 `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+}
+
+func (m *ValidUntil) Reset()         { *m = ValidUntil{} }
+func (m *ValidUntil) String() string { return proto.CompactTextString(m) }
+func (*ValidUntil) ProtoMessage()    {}
+func (*ValidUntil) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f41b5febe5f4cdb9, []int{1}
+}
+func (m *ValidUntil) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ValidUntil) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ValidUntil.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ValidUntil) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ValidUntil.Merge(m, src)
+}
+func (m *ValidUntil) XXX_Size() int {
+	return m.Size()
+}
+func (m *ValidUntil) XXX_DiscardUnknown() {
+	xxx_messageInfo_ValidUntil.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ValidUntil proto.InternalMessageInfo
+
+func (m *ValidUntil) GetTime() github_com_iov_one_weave.UnixTime {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *ValidUntil) GetHeight() int64 {
+	if m != nil {
+		return m.Height
+	}
+	return 0
+}
+
 // ExecuteBatchMsg encapsulates multiple messages to support batch transaction
 type ExecuteBatchMsg struct {
 	Messages []ExecuteBatchMsg_Union `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages"`
@@ -416,7 +485,7 @@ func (m *ExecuteBatchMsg) Reset()         { *m = ExecuteBatchMsg{} }
 func (m *ExecuteBatchMsg) String() string { return proto.CompactTextString(m) }
 func (*ExecuteBatchMsg) ProtoMessage()    {}
 func (*ExecuteBatchMsg) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f41b5febe5f4cdb9, []int{1}
+	return fileDescriptor_f41b5febe5f4cdb9, []int{2}
 }
 func (m *ExecuteBatchMsg) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -466,7 +535,7 @@ func (m *ExecuteBatchMsg_Union) Reset()         { *m = ExecuteBatchMsg_Union{} }
 func (m *ExecuteBatchMsg_Union) String() string { return proto.CompactTextString(m) }
 func (*ExecuteBatchMsg_Union) ProtoMessage()    {}
 func (*ExecuteBatchMsg_Union) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f41b5febe5f4cdb9, []int{1, 0}
+	return fileDescriptor_f41b5febe5f4cdb9, []int{2, 0}
 }
 func (m *ExecuteBatchMsg_Union) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -661,7 +730,7 @@ func (m *CronTask) Reset()         { *m = CronTask{} }
 func (m *CronTask) String() string { return proto.CompactTextString(m) }
 func (*CronTask) ProtoMessage()    {}
 func (*CronTask) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f41b5febe5f4cdb9, []int{2}
+	return fileDescriptor_f41b5febe5f4cdb9, []int{3}
 }
 func (m *CronTask) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -778,57 +847,160 @@ func _CronTask_OneofSizer(msg proto.Message) (n int) {
 	return n
 }
 
+// MempoolConfiguration is the admission policy of transactions to the
+// mempool, stored under the "mempool" package. It is applied on CheckTx only,
+// so a block proposer can still include any valid transaction. A zero value
+// disables the corresponding limit.
+type MempoolConfiguration struct {
+	Metadata *weave.Metadata `protobuf:"bytes,1,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	// MaxTxSize is the maximum size of a transaction in bytes.
+	MaxTxSize int32 `protobuf:"varint,2,opt,name=max_tx_size,json=maxTxSize,proto3" json:"max_tx_size,omitempty"`
+	// MaxPendingPerSender is the maximum number of transactions of a single
+	// signer waiting in the mempool.
+	MaxPendingPerSender int32 `protobuf:"varint,3,opt,name=max_pending_per_sender,json=maxPendingPerSender,proto3" json:"max_pending_per_sender,omitempty"`
+	// MinFeePerByte is the minimal fee paid for each byte of a transaction.
+	MinFeePerByte coin.Coin `protobuf:"bytes,4,opt,name=min_fee_per_byte,json=minFeePerByte,proto3" json:"min_fee_per_byte"`
+	// BlockedPaths are the message paths that are not accepted, for example
+	// during a maintenance.
+	BlockedPaths []string `protobuf:"bytes,5,rep,name=blocked_paths,json=blockedPaths,proto3" json:"blocked_paths,omitempty"`
+}
+
+func (m *MempoolConfiguration) Reset()         { *m = MempoolConfiguration{} }
+func (m *MempoolConfiguration) String() string { return proto.CompactTextString(m) }
+func (*MempoolConfiguration) ProtoMessage()    {}
+func (*MempoolConfiguration) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f41b5febe5f4cdb9, []int{4}
+}
+func (m *MempoolConfiguration) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *MempoolConfiguration) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_MempoolConfiguration.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalTo(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *MempoolConfiguration) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MempoolConfiguration.Merge(m, src)
+}
+func (m *MempoolConfiguration) XXX_Size() int {
+	return m.Size()
+}
+func (m *MempoolConfiguration) XXX_DiscardUnknown() {
+	xxx_messageInfo_MempoolConfiguration.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MempoolConfiguration proto.InternalMessageInfo
+
+func (m *MempoolConfiguration) GetMetadata() *weave.Metadata {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+func (m *MempoolConfiguration) GetMaxTxSize() int32 {
+	if m != nil {
+		return m.MaxTxSize
+	}
+	return 0
+}
+
+func (m *MempoolConfiguration) GetMaxPendingPerSender() int32 {
+	if m != nil {
+		return m.MaxPendingPerSender
+	}
+	return 0
+}
+
+func (m *MempoolConfiguration) GetMinFeePerByte() coin.Coin {
+	if m != nil {
+		return m.MinFeePerByte
+	}
+	return coin.Coin{}
+}
+
+func (m *MempoolConfiguration) GetBlockedPaths() []string {
+	if m != nil {
+		return m.BlockedPaths
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Tx)(nil), "customd.Tx")
+	proto.RegisterType((*ValidUntil)(nil), "customd.ValidUntil")
 	proto.RegisterType((*ExecuteBatchMsg)(nil), "customd.ExecuteBatchMsg")
 	proto.RegisterType((*ExecuteBatchMsg_Union)(nil), "customd.ExecuteBatchMsg.Union")
 	proto.RegisterType((*CronTask)(nil), "customd.CronTask")
+	proto.RegisterType((*MempoolConfiguration)(nil), "customd.MempoolConfiguration")
 }
 
 func init() { proto.RegisterFile("cmd/customd/app/codec.proto", fileDescriptor_f41b5febe5f4cdb9) }
 
 var fileDescriptor_f41b5febe5f4cdb9 = []byte{
-	// 637 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xdc, 0x94, 0xcb, 0x6e, 0xd4, 0x3e,
-	0x14, 0xc6, 0x27, 0xbd, 0xfc, 0xff, 0x95, 0xdb, 0x52, 0xd5, 0xad, 0x4a, 0x3a, 0x85, 0xb4, 0x74,
-	0x81, 0x2a, 0x21, 0x1c, 0xd1, 0x6e, 0x00, 0xb1, 0x80, 0xe9, 0x45, 0xb0, 0x00, 0xa4, 0x4c, 0x67,
-	0x4b, 0xe4, 0xc6, 0x27, 0x19, 0x8b, 0x49, 0x1c, 0xc5, 0x4e, 0x19, 0xde, 0x82, 0xb7, 0xe0, 0x3d,
-	0x58, 0x75, 0x59, 0x76, 0xac, 0x2a, 0xd4, 0xbe, 0x01, 0x4b, 0x56, 0x28, 0xce, 0x65, 0x92, 0xd1,
-	0x4c, 0xc5, 0x9a, 0x5d, 0x7c, 0xbe, 0xef, 0xfc, 0x9c, 0x1c, 0x7f, 0x31, 0xda, 0xf2, 0x42, 0x66,
-	0x7b, 0xa9, 0x54, 0x22, 0x64, 0x36, 0x8d, 0x63, 0xdb, 0x13, 0x0c, 0x3c, 0x12, 0x27, 0x42, 0x09,
-	0xfc, 0x7f, 0x21, 0xb4, 0x49, 0xc0, 0x55, 0x3f, 0x3d, 0x23, 0x9e, 0x08, 0x6d, 0x2e, 0xce, 0x1f,
-	0x8b, 0x08, 0xec, 0x4f, 0x40, 0xcf, 0xc1, 0x0e, 0x79, 0x90, 0x50, 0xc5, 0x45, 0x54, 0x6f, 0x6c,
-	0x3f, 0x9a, 0xea, 0x1f, 0xda, 0x1e, 0x95, 0xfd, 0x86, 0xd9, 0xbe, 0xc5, 0x1c, 0xa6, 0x03, 0xc5,
-	0x25, 0x0f, 0xfe, 0x9a, 0x2e, 0x79, 0x20, 0x1b, 0xe6, 0x27, 0xb7, 0x98, 0xcf, 0xe9, 0x80, 0x33,
-	0xaa, 0x44, 0xd2, 0x6c, 0x59, 0x0f, 0x44, 0x20, 0xf4, 0xa3, 0x9d, 0x3d, 0x95, 0xd5, 0x61, 0x31,
-	0xa7, 0xba, 0x77, 0xf7, 0xd7, 0x3c, 0x9a, 0x39, 0x1d, 0xe2, 0x07, 0x68, 0xce, 0x07, 0x90, 0xa6,
-	0xb1, 0x63, 0xec, 0x2d, 0xee, 0x2f, 0x93, 0xec, 0x23, 0xc9, 0x09, 0xc0, 0x9b, 0xc8, 0x17, 0x8e,
-	0x96, 0xf0, 0x3e, 0x42, 0x92, 0x07, 0x11, 0x55, 0x69, 0x02, 0xd2, 0x9c, 0xd9, 0x99, 0xdd, 0x5b,
-	0xdc, 0xc7, 0x24, 0x7b, 0x5f, 0xd2, 0x55, 0xac, 0x5b, 0x4a, 0x4e, 0xcd, 0x85, 0xdb, 0x68, 0xa1,
-	0x9c, 0x80, 0x39, 0xb7, 0x33, 0xbb, 0xb7, 0xe4, 0x54, 0x6b, 0x7c, 0x80, 0x96, 0xb3, 0x5d, 0x5c,
-	0x09, 0x11, 0x73, 0x43, 0x19, 0x98, 0x07, 0xf5, 0xbd, 0xbb, 0x10, 0xb1, 0xb7, 0x32, 0x78, 0xdd,
-	0x72, 0x16, 0xb3, 0x75, 0xb1, 0xc4, 0xc7, 0x68, 0xad, 0x04, 0xb8, 0x5e, 0x02, 0x54, 0x81, 0x6e,
-	0x7d, 0xaa, 0x5b, 0xd7, 0x48, 0xa9, 0x91, 0x43, 0xad, 0xe5, 0x80, 0xd5, 0xb2, 0x5a, 0x15, 0x1b,
-	0x98, 0x34, 0x66, 0x25, 0xe6, 0xd9, 0x38, 0xa6, 0xa7, 0xb5, 0x31, 0x4c, 0x55, 0xc4, 0x3d, 0xb4,
-	0x39, 0x3a, 0x02, 0x97, 0xc6, 0xf1, 0xe0, 0xb3, 0xcb, 0xb8, 0xef, 0x6b, 0xd8, 0x73, 0x0d, 0x33,
-	0xc9, 0xc8, 0x41, 0x5e, 0x65, 0x8e, 0x23, 0xee, 0xfb, 0x39, 0x71, 0x63, 0x24, 0xd5, 0x15, 0x7c,
-	0x82, 0x56, 0x61, 0x08, 0x5e, 0xaa, 0xc0, 0x3d, 0xa3, 0xca, 0xeb, 0x6b, 0xdc, 0x8b, 0x02, 0x57,
-	0x44, 0x9a, 0x1c, 0xe7, 0x8e, 0x4e, 0x66, 0xc8, 0x71, 0x2b, 0xd0, 0x2c, 0xe1, 0x0f, 0xe8, 0x5e,
-	0x15, 0x6f, 0x37, 0x8d, 0x83, 0x84, 0x32, 0x70, 0xa5, 0xd7, 0x87, 0x90, 0x6a, 0xe4, 0xb1, 0x46,
-	0x6e, 0x91, 0xca, 0x44, 0x7a, 0xb9, 0xa9, 0xab, 0x3d, 0x39, 0x75, 0xb3, 0x52, 0xc7, 0x45, 0xec,
-	0xa2, 0xfb, 0xf9, 0xdb, 0x94, 0x47, 0xa1, 0x78, 0x08, 0xcc, 0x95, 0xaa, 0x9c, 0x27, 0x2b, 0x36,
-	0xc8, 0x5d, 0xc5, 0xa1, 0x9c, 0x66, 0xa6, 0xae, 0xaa, 0xe6, 0xba, 0x99, 0xab, 0x13, 0x44, 0xfc,
-	0x1e, 0xdd, 0x6d, 0x6e, 0x30, 0x42, 0xfb, 0x1a, 0xbd, 0xd1, 0x44, 0xd7, 0xa8, 0xeb, 0x75, 0x6a,
-	0x59, 0xef, 0xcc, 0xa3, 0x59, 0x99, 0x86, 0xbb, 0x5f, 0x67, 0xd0, 0xca, 0xd8, 0xfc, 0xf0, 0x4b,
-	0xb4, 0x10, 0x82, 0x94, 0x34, 0xd0, 0x7f, 0x41, 0x16, 0x6e, 0x6b, 0xda, 0xac, 0x49, 0x2f, 0xe2,
-	0x22, 0xea, 0xcc, 0x5d, 0x5c, 0x6d, 0xb7, 0x9c, 0xaa, 0xab, 0xfd, 0xdd, 0x40, 0xf3, 0x5a, 0xf9,
-	0x07, 0xa2, 0x5d, 0x4e, 0xea, 0x9b, 0x81, 0x16, 0x0e, 0x13, 0x11, 0x9d, 0x52, 0xf9, 0x11, 0xbf,
-	0x43, 0x77, 0x68, 0xaa, 0xfa, 0x10, 0x29, 0xee, 0xe9, 0xd4, 0xea, 0x41, 0x2d, 0x75, 0x1e, 0xfe,
-	0xbe, 0xda, 0xde, 0x9d, 0x76, 0x4d, 0x91, 0x43, 0x11, 0x31, 0x9e, 0xe5, 0xc7, 0x19, 0xeb, 0xae,
-	0xe5, 0x87, 0xc1, 0x00, 0x26, 0xe4, 0x07, 0x9a, 0xf9, 0x39, 0xd2, 0xae, 0x29, 0xf9, 0x99, 0x20,
-	0x16, 0x1f, 0xd1, 0x31, 0x2f, 0xae, 0x2d, 0xe3, 0xf2, 0xda, 0x32, 0x7e, 0x5e, 0x5b, 0xc6, 0x97,
-	0x1b, 0xab, 0x75, 0x79, 0x63, 0xb5, 0x7e, 0xdc, 0x58, 0xad, 0xb3, 0xff, 0xf4, 0x25, 0x78, 0xf0,
-	0x27, 0x00, 0x00, 0xff, 0xff, 0xac, 0x1c, 0xc1, 0x0c, 0x46, 0x06, 0x00, 0x00,
+	// 866 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xdc, 0x55, 0x4f, 0x6f, 0xe3, 0xc4,
+	0x1b, 0x4e, 0x9a, 0xa4, 0xbf, 0xee, 0xa4, 0xfd, 0x75, 0x77, 0x5a, 0x15, 0x37, 0x0b, 0x69, 0xb7,
+	0x08, 0x54, 0x69, 0xc5, 0x44, 0xb4, 0x1c, 0x28, 0xe2, 0x00, 0xc9, 0xb6, 0x82, 0x43, 0xa1, 0x72,
+	0x1a, 0x8e, 0x58, 0x13, 0xcf, 0x6b, 0x67, 0xb4, 0xb1, 0xc7, 0xf2, 0x8c, 0x8b, 0xbb, 0x9f, 0x82,
+	0x6f, 0x01, 0x9f, 0x83, 0xd3, 0x1e, 0x97, 0x1b, 0xa7, 0x0a, 0xb5, 0x5f, 0x02, 0xed, 0x09, 0xcd,
+	0xf8, 0x4f, 0xec, 0xd2, 0xac, 0x38, 0x73, 0x9b, 0x79, 0x9f, 0xe7, 0x7d, 0xde, 0xd7, 0xef, 0x1f,
+	0x0f, 0x7a, 0xea, 0x06, 0x6c, 0xe0, 0x26, 0x52, 0x89, 0x80, 0x0d, 0x68, 0x14, 0x0d, 0x5c, 0xc1,
+	0xc0, 0x25, 0x51, 0x2c, 0x94, 0xc0, 0xff, 0xcb, 0x81, 0x5e, 0xb7, 0x62, 0xed, 0x3d, 0x76, 0x05,
+	0x0f, 0xab, 0xbc, 0x1e, 0xf1, 0xb9, 0x9a, 0x25, 0x53, 0xe2, 0x8a, 0x60, 0xc0, 0xc5, 0xd5, 0x27,
+	0x22, 0x84, 0xc1, 0x4f, 0x40, 0xaf, 0x60, 0x10, 0x70, 0x3f, 0xa6, 0x8a, 0x8b, 0x3a, 0xff, 0xf9,
+	0x52, 0x7e, 0x3a, 0x70, 0xa9, 0x9c, 0xd5, 0xc8, 0x83, 0x77, 0x90, 0x83, 0x64, 0xae, 0xb8, 0xe4,
+	0xfe, 0xbf, 0x56, 0x97, 0xdc, 0x97, 0x35, 0xf2, 0xa7, 0xef, 0x20, 0x5f, 0xd1, 0x39, 0x67, 0x54,
+	0x89, 0xb8, 0xee, 0xb2, 0xed, 0x0b, 0x5f, 0x98, 0xe3, 0x40, 0x9f, 0x0a, 0x6b, 0x9a, 0x97, 0xb1,
+	0xca, 0x3d, 0xf8, 0x75, 0x15, 0xad, 0x5c, 0xa6, 0xf8, 0x19, 0x6a, 0x7b, 0x00, 0xd2, 0x6a, 0xee,
+	0x37, 0x0f, 0xbb, 0x47, 0x1b, 0x44, 0x7f, 0x24, 0x39, 0x03, 0xf8, 0x36, 0xf4, 0x84, 0x6d, 0x20,
+	0x7c, 0x84, 0x90, 0xe4, 0x7e, 0x48, 0x55, 0x12, 0x83, 0xb4, 0x56, 0xf6, 0x5b, 0x87, 0xdd, 0x23,
+	0x4c, 0x74, 0xbe, 0x64, 0xac, 0xd8, 0xb8, 0x80, 0xec, 0x0a, 0x0b, 0xf7, 0xd0, 0x5a, 0x51, 0x01,
+	0xab, 0xbd, 0xdf, 0x3a, 0x5c, 0xb7, 0xcb, 0x3b, 0xfe, 0x0c, 0x75, 0x4d, 0xfe, 0x4e, 0x12, 0x2a,
+	0x3e, 0xb7, 0x3a, 0x26, 0xf2, 0x16, 0xc9, 0x3b, 0x4a, 0x7e, 0xd0, 0xd8, 0x44, 0x43, 0x36, 0xba,
+	0x2a, 0xcf, 0xf8, 0x18, 0x6d, 0xe8, 0xdc, 0x1c, 0x09, 0x21, 0x73, 0x02, 0xe9, 0x5b, 0xc7, 0xd5,
+	0x8c, 0xc7, 0x10, 0xb2, 0x73, 0xe9, 0x7f, 0xd3, 0xb0, 0xbb, 0xfa, 0x9e, 0x5f, 0xf1, 0x29, 0xda,
+	0x2a, 0xc2, 0x3a, 0x6e, 0x0c, 0x54, 0x81, 0x71, 0xfd, 0x3c, 0x0f, 0x59, 0x60, 0x64, 0x64, 0xb0,
+	0x4c, 0xe0, 0x49, 0x61, 0x2d, 0x8d, 0x35, 0x99, 0x24, 0x62, 0x85, 0xcc, 0xc9, 0x7d, 0x99, 0x49,
+	0xc4, 0xfe, 0x29, 0x53, 0x1a, 0xf1, 0x04, 0xed, 0x2e, 0x1a, 0xe7, 0xd0, 0x28, 0x9a, 0x5f, 0x3b,
+	0x8c, 0x7b, 0x9e, 0x11, 0xfb, 0xc2, 0x88, 0x59, 0x64, 0xc1, 0x20, 0x5f, 0x6b, 0xc6, 0x0b, 0xee,
+	0x79, 0x99, 0xe2, 0xce, 0x02, 0xaa, 0x22, 0xf8, 0x0c, 0x3d, 0x81, 0x14, 0xdc, 0x44, 0x81, 0x33,
+	0xa5, 0xca, 0x9d, 0x19, 0xb9, 0x2f, 0x73, 0xb9, 0xa2, 0xaa, 0xa7, 0x19, 0x63, 0xa8, 0x09, 0x99,
+	0xdc, 0x26, 0xd4, 0x4d, 0xf8, 0x47, 0xf4, 0x7e, 0xb9, 0x14, 0x4e, 0x12, 0xf9, 0x31, 0x65, 0xe0,
+	0x48, 0x77, 0x06, 0x01, 0x35, 0x92, 0xa7, 0x46, 0xf2, 0x29, 0x29, 0x49, 0x64, 0x92, 0x91, 0xc6,
+	0x86, 0x93, 0xa9, 0xee, 0x96, 0xe8, 0x7d, 0x10, 0x3b, 0xe8, 0x83, 0x2c, 0x9b, 0xa2, 0x15, 0x8a,
+	0x07, 0xc0, 0x1c, 0xa9, 0x8a, 0x7a, 0xb2, 0x3c, 0x40, 0xc6, 0xca, 0x9b, 0x72, 0xa9, 0x49, 0x63,
+	0x55, 0xd6, 0x75, 0x37, 0x43, 0x1f, 0x00, 0xf1, 0xf7, 0xe8, 0xbd, 0x7a, 0x80, 0x85, 0xb4, 0x67,
+	0xa4, 0x77, 0xea, 0xd2, 0x15, 0xd5, 0xed, 0xaa, 0x6a, 0x61, 0x1f, 0x76, 0x50, 0x4b, 0x26, 0xc1,
+	0x81, 0x83, 0xd0, 0x62, 0x28, 0xf1, 0x09, 0x6a, 0xeb, 0xc4, 0xcd, 0xc6, 0xb4, 0x86, 0x1f, 0xbd,
+	0xbd, 0xd9, 0x7b, 0xb6, 0x6c, 0x53, 0xc9, 0x24, 0xe4, 0xa9, 0xce, 0xd1, 0x36, 0x2e, 0x78, 0x07,
+	0xad, 0xce, 0x80, 0xfb, 0x33, 0x65, 0xad, 0x68, 0x67, 0x3b, 0xbf, 0x1d, 0xfc, 0xb2, 0x82, 0x36,
+	0xef, 0x35, 0x08, 0x7f, 0x85, 0xd6, 0x02, 0x90, 0x92, 0xfa, 0x66, 0x39, 0xf5, 0xce, 0xf5, 0x97,
+	0x35, 0x53, 0x87, 0x11, 0xe1, 0xb0, 0xfd, 0xfa, 0x66, 0xaf, 0x61, 0x97, 0x5e, 0xbd, 0xdf, 0x9b,
+	0xa8, 0x63, 0x90, 0xff, 0xc0, 0xee, 0x14, 0xad, 0xf8, 0xad, 0x89, 0xd6, 0x46, 0xb1, 0x08, 0x2f,
+	0xa9, 0x7c, 0x89, 0xbf, 0x43, 0xff, 0xa7, 0x89, 0x9a, 0x41, 0xa8, 0xb8, 0x6b, 0xd6, 0xc2, 0x14,
+	0x6a, 0x7d, 0xf8, 0xf1, 0xdb, 0x9b, 0xbd, 0x83, 0xa5, 0x3d, 0x19, 0x89, 0x90, 0x71, 0x3d, 0xa0,
+	0xf6, 0x3d, 0xef, 0xca, 0x80, 0x32, 0x98, 0xc3, 0x03, 0x03, 0x0a, 0xf5, 0x01, 0x7d, 0x61, 0x58,
+	0x4b, 0x06, 0xf4, 0x01, 0xb0, 0xf8, 0x88, 0xbf, 0x9a, 0x68, 0xfb, 0x1c, 0x82, 0x48, 0x88, 0xf9,
+	0x48, 0x84, 0x1e, 0xf7, 0x93, 0x6c, 0x63, 0xf0, 0x73, 0xdd, 0x73, 0x45, 0x19, 0x55, 0x34, 0xff,
+	0x21, 0x6f, 0x92, 0x2c, 0xe9, 0xf3, 0xdc, 0x6c, 0x97, 0x04, 0xdc, 0x47, 0xdd, 0x80, 0xa6, 0x8e,
+	0x4a, 0x1d, 0xc9, 0x5f, 0x81, 0x99, 0xa8, 0x8e, 0xfd, 0x28, 0xa0, 0xe9, 0x65, 0x3a, 0xe6, 0xaf,
+	0x00, 0x1f, 0xa3, 0x1d, 0x8d, 0x47, 0x10, 0x32, 0x1e, 0xfa, 0x4e, 0x04, 0xb1, 0xe9, 0x3f, 0xc4,
+	0x56, 0xcb, 0x50, 0xb7, 0x02, 0x9a, 0x5e, 0x64, 0xe0, 0x05, 0xc4, 0x63, 0x03, 0xe1, 0x13, 0xf4,
+	0x38, 0xe0, 0xa1, 0xe3, 0x01, 0x18, 0x87, 0xe9, 0xb5, 0x02, 0xab, 0x6d, 0x32, 0x41, 0x44, 0x3f,
+	0xae, 0x64, 0x24, 0x78, 0x31, 0x69, 0x1b, 0x01, 0x0f, 0xcf, 0x00, 0x2e, 0x20, 0x1e, 0x5e, 0x2b,
+	0xc0, 0x1f, 0xa2, 0x8d, 0xe9, 0x5c, 0xb8, 0x2f, 0x81, 0x39, 0x11, 0x55, 0x33, 0x69, 0x75, 0xf6,
+	0x5b, 0x87, 0x8f, 0xec, 0xf5, 0xdc, 0x78, 0xa1, 0x6d, 0x43, 0xeb, 0xf5, 0x6d, 0xbf, 0xf9, 0xe6,
+	0xb6, 0xdf, 0xfc, 0xf3, 0xb6, 0xdf, 0xfc, 0xf9, 0xae, 0xdf, 0x78, 0x73, 0xd7, 0x6f, 0xfc, 0x71,
+	0xd7, 0x6f, 0x4c, 0x57, 0xcd, 0xb3, 0x74, 0xfc, 0xf7, 0x00, 0xe0, 0x2a, 0xe5, 0x19, 0xf7, 0x07,
+	0x00, 0x00,
 }
 
 func (m *Tx) Marshal() (dAtA []byte, err error) {
@@ -876,12 +1048,22 @@ func (m *Tx) MarshalTo(dAtA []byte) (int, error) {
 			i += copy(dAtA[i:], b)
 		}
 	}
+	if m.ValidUntil != nil {
+		dAtA[i] = 0x2a
+		i++
+		i = encodeVarintCodec(dAtA, i, uint64(m.ValidUntil.Size()))
+		n2, err := m.ValidUntil.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n2
+	}
 	if m.Sum != nil {
-		nn2, err := m.Sum.MarshalTo(dAtA[i:])
+		nn3, err := m.Sum.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += nn2
+		i += nn3
 	}
 	return i, nil
 }
@@ -894,11 +1076,11 @@ func (m *Tx_CashSendMsg) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x3
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.CashSendMsg.Size()))
-		n3, err := m.CashSendMsg.MarshalTo(dAtA[i:])
+		n4, err := m.CashSendMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n3
+		i += n4
 	}
 	return i, nil
 }
@@ -910,11 +1092,11 @@ func (m *Tx_MultisigCreateMsg) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x3
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.MultisigCreateMsg.Size()))
-		n4, err := m.MultisigCreateMsg.MarshalTo(dAtA[i:])
+		n5, err := m.MultisigCreateMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n4
+		i += n5
 	}
 	return i, nil
 }
@@ -926,11 +1108,11 @@ func (m *Tx_MultisigUpdateMsg) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x3
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.MultisigUpdateMsg.Size()))
-		n5, err := m.MultisigUpdateMsg.MarshalTo(dAtA[i:])
+		n6, err := m.MultisigUpdateMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n5
+		i += n6
 	}
 	return i, nil
 }
@@ -942,11 +1124,11 @@ func (m *Tx_ValidatorsApplyDiffMsg) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x3
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.ValidatorsApplyDiffMsg.Size()))
-		n6, err := m.ValidatorsApplyDiffMsg.MarshalTo(dAtA[i:])
+		n7, err := m.ValidatorsApplyDiffMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n6
+		i += n7
 	}
 	return i, nil
 }
@@ -958,11 +1140,11 @@ func (m *Tx_ExecuteBatchMsg) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x3
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.ExecuteBatchMsg.Size()))
-		n7, err := m.ExecuteBatchMsg.MarshalTo(dAtA[i:])
+		n8, err := m.ExecuteBatchMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n7
+		i += n8
 	}
 	return i, nil
 }
@@ -974,11 +1156,11 @@ func (m *Tx_MigrationUpgradeSchemaMsg) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x4
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.MigrationUpgradeSchemaMsg.Size()))
-		n8, err := m.MigrationUpgradeSchemaMsg.MarshalTo(dAtA[i:])
+		n9, err := m.MigrationUpgradeSchemaMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n8
+		i += n9
 	}
 	return i, nil
 }
@@ -990,11 +1172,11 @@ func (m *Tx_CustomCreateTimedStateMsg) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x6
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.CustomCreateTimedStateMsg.Size()))
-		n9, err := m.CustomCreateTimedStateMsg.MarshalTo(dAtA[i:])
+		n10, err := m.CustomCreateTimedStateMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n9
+		i += n10
 	}
 	return i, nil
 }
@@ -1006,14 +1188,42 @@ func (m *Tx_CustomCreateStateMsg) MarshalTo(dAtA []byte) (int, error) {
 		dAtA[i] = 0x6
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.CustomCreateStateMsg.Size()))
-		n10, err := m.CustomCreateStateMsg.MarshalTo(dAtA[i:])
+		n11, err := m.CustomCreateStateMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n10
+		i += n11
+	}
+	return i, nil
+}
+func (m *ValidUntil) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ValidUntil) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Time != 0 {
+		dAtA[i] = 0x8
+		i++
+		i = encodeVarintCodec(dAtA, i, uint64(m.Time))
+	}
+	if m.Height != 0 {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintCodec(dAtA, i, uint64(m.Height))
 	}
 	return i, nil
 }
+
 func (m *ExecuteBatchMsg) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -1060,11 +1270,11 @@ func (m *ExecuteBatchMsg_Union) MarshalTo(dAtA []byte) (int, error) {
 	var l int
 	_ = l
 	if m.Sum != nil {
-		nn11, err := m.Sum.MarshalTo(dAtA[i:])
+		nn12, err := m.Sum.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += nn11
+		i += nn12
 	}
 	return i, nil
 }
@@ -1077,11 +1287,11 @@ func (m *ExecuteBatchMsg_Union_CashSendMsg) MarshalTo(dAtA []byte) (int, error)
 		dAtA[i] = 0x3
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.CashSendMsg.Size()))
-		n12, err := m.CashSendMsg.MarshalTo(dAtA[i:])
+		n13, err := m.CashSendMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n12
+		i += n13
 	}
 	return i, nil
 }
@@ -1093,11 +1303,11 @@ func (m *ExecuteBatchMsg_Union_MultisigCreateMsg) MarshalTo(dAtA []byte) (int, e
 		dAtA[i] = 0x3
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.MultisigCreateMsg.Size()))
-		n13, err := m.MultisigCreateMsg.MarshalTo(dAtA[i:])
+		n14, err := m.MultisigCreateMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n13
+		i += n14
 	}
 	return i, nil
 }
@@ -1109,11 +1319,11 @@ func (m *ExecuteBatchMsg_Union_MultisigUpdateMsg) MarshalTo(dAtA []byte) (int, e
 		dAtA[i] = 0x3
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.MultisigUpdateMsg.Size()))
-		n14, err := m.MultisigUpdateMsg.MarshalTo(dAtA[i:])
+		n15, err := m.MultisigUpdateMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n14
+		i += n15
 	}
 	return i, nil
 }
@@ -1141,11 +1351,11 @@ func (m *CronTask) MarshalTo(dAtA []byte) (int, error) {
 		}
 	}
 	if m.Sum != nil {
-		nn15, err := m.Sum.MarshalTo(dAtA[i:])
+		nn16, err := m.Sum.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += nn15
+		i += nn16
 	}
 	return i, nil
 }
@@ -1158,14 +1368,75 @@ func (m *CronTask_CustomDeleteTimedStateMsg) MarshalTo(dAtA []byte) (int, error)
 		dAtA[i] = 0x6
 		i++
 		i = encodeVarintCodec(dAtA, i, uint64(m.CustomDeleteTimedStateMsg.Size()))
-		n16, err := m.CustomDeleteTimedStateMsg.MarshalTo(dAtA[i:])
+		n17, err := m.CustomDeleteTimedStateMsg.MarshalTo(dAtA[i:])
 		if err != nil {
 			return 0, err
 		}
-		i += n16
+		i += n17
+	}
+	return i, nil
+}
+func (m *MempoolConfiguration) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *MempoolConfiguration) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Metadata != nil {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintCodec(dAtA, i, uint64(m.Metadata.Size()))
+		n18, err := m.Metadata.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n18
+	}
+	if m.MaxTxSize != 0 {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintCodec(dAtA, i, uint64(m.MaxTxSize))
+	}
+	if m.MaxPendingPerSender != 0 {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintCodec(dAtA, i, uint64(m.MaxPendingPerSender))
+	}
+	dAtA[i] = 0x22
+	i++
+	i = encodeVarintCodec(dAtA, i, uint64(m.MinFeePerByte.Size()))
+	n19, err := m.MinFeePerByte.MarshalTo(dAtA[i:])
+	if err != nil {
+		return 0, err
+	}
+	i += n19
+	if len(m.BlockedPaths) > 0 {
+		for _, s := range m.BlockedPaths {
+			dAtA[i] = 0x2a
+			i++
+			l = len(s)
+			for l >= 1<<7 {
+				dAtA[i] = uint8(uint64(l)&0x7f | 0x80)
+				l >>= 7
+				i++
+			}
+			dAtA[i] = uint8(l)
+			i++
+			i += copy(dAtA[i:], s)
+		}
 	}
 	return i, nil
 }
+
 func encodeVarintCodec(dAtA []byte, offset int, v uint64) int {
 	for v >= 1<<7 {
 		dAtA[offset] = uint8(v&0x7f | 0x80)
@@ -1197,6 +1468,10 @@ func (m *Tx) Size() (n int) {
 			n += 1 + l + sovCodec(uint64(l))
 		}
 	}
+	if m.ValidUntil != nil {
+		l = m.ValidUntil.Size()
+		n += 1 + l + sovCodec(uint64(l))
+	}
 	if m.Sum != nil {
 		n += m.Sum.Size()
 	}
@@ -1299,6 +1574,21 @@ func (m *Tx_CustomCreateStateMsg) Size() (n int) {
 	}
 	return n
 }
+func (m *ValidUntil) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Time != 0 {
+		n += 1 + sovCodec(uint64(m.Time))
+	}
+	if m.Height != 0 {
+		n += 1 + sovCodec(uint64(m.Height))
+	}
+	return n
+}
+
 func (m *ExecuteBatchMsg) Size() (n int) {
 	if m == nil {
 		return 0
@@ -1392,6 +1682,32 @@ func (m *CronTask_CustomDeleteTimedStateMsg) Size() (n int) {
 	}
 	return n
 }
+func (m *MempoolConfiguration) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Metadata != nil {
+		l = m.Metadata.Size()
+		n += 1 + l + sovCodec(uint64(l))
+	}
+	if m.MaxTxSize != 0 {
+		n += 1 + sovCodec(uint64(m.MaxTxSize))
+	}
+	if m.MaxPendingPerSender != 0 {
+		n += 1 + sovCodec(uint64(m.MaxPendingPerSender))
+	}
+	l = m.MinFeePerByte.Size()
+	n += 1 + l + sovCodec(uint64(l))
+	if len(m.BlockedPaths) > 0 {
+		for _, s := range m.BlockedPaths {
+			l = len(s)
+			n += 1 + l + sovCodec(uint64(l))
+		}
+	}
+	return n
+}
 
 func sovCodec(x uint64) (n int) {
 	for {
@@ -1537,6 +1853,42 @@ func (m *Tx) Unmarshal(dAtA []byte) error {
 			m.Multisig = append(m.Multisig, make([]byte, postIndex-iNdEx))
 			copy(m.Multisig[len(m.Multisig)-1], dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ValidUntil", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCodec
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthCodec
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthCodec
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.ValidUntil == nil {
+				m.ValidUntil = &ValidUntil{}
+			}
+			if err := m.ValidUntil.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		case 51:
 			if wireType != 2 {
 				return fmt.Errorf("proto: wrong wireType = %d for field CashSendMsg", wireType)
@@ -1841,6 +2193,97 @@ func (m *Tx) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *ValidUntil) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCodec
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ValidUntil: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ValidUntil: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Time", wireType)
+			}
+			m.Time = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCodec
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Time |= github_com_iov_one_weave.UnixTime(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Height", wireType)
+			}
+			m.Height = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCodec
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Height |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCodec(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCodec
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthCodec
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func (m *ExecuteBatchMsg) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
@@ -2206,6 +2649,198 @@ func (m *CronTask) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *MempoolConfiguration) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCodec
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: MempoolConfiguration: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: MempoolConfiguration: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Metadata", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCodec
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthCodec
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthCodec
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Metadata == nil {
+				m.Metadata = &weave.Metadata{}
+			}
+			if err := m.Metadata.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxTxSize", wireType)
+			}
+			m.MaxTxSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCodec
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MaxTxSize |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxPendingPerSender", wireType)
+			}
+			m.MaxPendingPerSender = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCodec
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MaxPendingPerSender |= int32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MinFeePerByte", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCodec
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthCodec
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthCodec
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.MinFeePerByte.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockedPaths", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCodec
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCodec
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthCodec
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.BlockedPaths = append(m.BlockedPaths, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCodec(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCodec
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthCodec
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipCodec(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
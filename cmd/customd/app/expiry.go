@@ -0,0 +1,91 @@
+package customd
+
+import (
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+)
+
+// ExpiringTx is implemented by transactions that can declare until when they
+// are valid.
+type ExpiringTx interface {
+	GetValidUntil() *ValidUntil
+}
+
+// Validate returns an error if no limit is set or a limit is invalid.
+func (v *ValidUntil) Validate() error {
+	if v.Time == 0 && v.Height == 0 {
+		return errors.Wrap(errors.ErrEmpty, "time or height required")
+	}
+	if v.Time != 0 {
+		if err := v.Time.Validate(); err != nil {
+			return errors.Wrap(err, "time")
+		}
+	}
+	if v.Height < 0 {
+		return errors.Wrap(errors.ErrInput, "height cannot be negative")
+	}
+	return nil
+}
+
+// Expiry is a decorator that rejects transactions, that cannot be included
+// in the block anymore according to their ValidUntil. Transactions without
+// it never expire.
+type Expiry struct{}
+
+var _ weave.Decorator = Expiry{}
+
+// NewExpiry creates an Expiry decorator.
+func NewExpiry() Expiry {
+	return Expiry{}
+}
+
+// Check rejects transactions that cannot be included in the next block. The
+// time of the next block is not known, so the time of the latest block is
+// used instead.
+func (Expiry) Check(ctx weave.Context, store weave.KVStore, tx weave.Tx, next weave.Checker) (*weave.CheckResult, error) {
+	height, _ := weave.GetHeight(ctx)
+	if err := checkExpiry(ctx, tx, height+1); err != nil {
+		return nil, err
+	}
+	return next.Check(ctx, store, tx)
+}
+
+// Deliver rejects transactions that cannot be included in the current block.
+func (Expiry) Deliver(ctx weave.Context, store weave.KVStore, tx weave.Tx, next weave.Deliverer) (*weave.DeliverResult, error) {
+	height, _ := weave.GetHeight(ctx)
+	if err := checkExpiry(ctx, tx, height); err != nil {
+		return nil, err
+	}
+	return next.Deliver(ctx, store, tx)
+}
+
+// checkExpiry returns an error if the transaction is expired at the block
+// height, or at the time of the context.
+func checkExpiry(ctx weave.Context, tx weave.Tx, height int64) error {
+	etx, ok := tx.(ExpiringTx)
+	if !ok {
+		return nil
+	}
+	until := etx.GetValidUntil()
+	if until == nil {
+		return nil
+	}
+	if err := until.Validate(); err != nil {
+		return errors.Wrap(err, "valid until")
+	}
+	if until.Height != 0 && height > until.Height {
+		return errors.Wrapf(errors.ErrExpired, "valid until height %d", until.Height)
+	}
+	if until.Time == 0 {
+		return nil
+	}
+	// Like weave.IsExpired, without panicking when no block time is set.
+	now, err := weave.BlockTime(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot check valid until time")
+	}
+	if until.Time <= weave.AsUnixTime(now) {
+		return errors.Wrapf(errors.ErrExpired, "valid until %s", until.Time)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package customd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store"
+	"github.com/iov-one/weave/weavetest"
+	"github.com/iov-one/weave/weavetest/assert"
+)
+
+func TestExpiry(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	cases := map[string]struct {
+		Tx          weave.Tx
+		Height      int64
+		WantCheck   *errors.Error
+		WantDeliver *errors.Error
+	}{
+		"not an expiring transaction": {
+			Tx:     &weavetest.Tx{},
+			Height: 10,
+		},
+		"no expiry": {
+			Tx:     &Tx{},
+			Height: 10,
+		},
+		"empty expiry": {
+			Tx:          &Tx{ValidUntil: &ValidUntil{}},
+			Height:      10,
+			WantCheck:   errors.ErrEmpty,
+			WantDeliver: errors.ErrEmpty,
+		},
+		"height not reached": {
+			Tx:     &Tx{ValidUntil: &ValidUntil{Height: 20}},
+			Height: 10,
+		},
+		"last height": {
+			Tx:        &Tx{ValidUntil: &ValidUntil{Height: 10}},
+			Height:    10,
+			WantCheck: errors.ErrExpired,
+		},
+		"height passed": {
+			Tx:          &Tx{ValidUntil: &ValidUntil{Height: 9}},
+			Height:      10,
+			WantCheck:   errors.ErrExpired,
+			WantDeliver: errors.ErrExpired,
+		},
+		"time not reached": {
+			Tx:     &Tx{ValidUntil: &ValidUntil{Time: weave.AsUnixTime(now.Add(time.Second))}},
+			Height: 10,
+		},
+		"time reached": {
+			Tx:          &Tx{ValidUntil: &ValidUntil{Time: weave.AsUnixTime(now)}},
+			Height:      10,
+			WantCheck:   errors.ErrExpired,
+			WantDeliver: errors.ErrExpired,
+		},
+		"time reached before height": {
+			Tx:          &Tx{ValidUntil: &ValidUntil{Time: weave.AsUnixTime(now), Height: 20}},
+			Height:      10,
+			WantCheck:   errors.ErrExpired,
+			WantDeliver: errors.ErrExpired,
+		},
+	}
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			ctx := weave.WithHeight(context.Background(), tc.Height)
+			ctx = weave.WithBlockTime(ctx, now)
+			db := store.MemStore()
+			handler := &weavetest.Handler{}
+
+			if _, err := NewExpiry().Check(ctx, db, tc.Tx, handler); !tc.WantCheck.Is(err) {
+				t.Fatalf("unexpected check error: %+v", err)
+			}
+			if _, err := NewExpiry().Deliver(ctx, db, tc.Tx, handler); !tc.WantDeliver.Is(err) {
+				t.Fatalf("unexpected deliver error: %+v", err)
+			}
+		})
+	}
+}
+
+func TestExpiryWithoutBlockTime(t *testing.T) {
+	tx := &Tx{ValidUntil: &ValidUntil{Time: weave.AsUnixTime(time.Now())}}
+	_, err := NewExpiry().Check(context.Background(), store.MemStore(), tx, &weavetest.Handler{})
+	assert.IsErr(t, errors.ErrHuman, err)
+}
@@ -0,0 +1,204 @@
+package customd
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// GracefulApp wraps an application so that it can be stopped between
+// blocks. Once Shutdown is called, new transactions are rejected, the
+// current block is finished and no new block is started.
+type GracefulApp struct {
+	app abci.Application
+
+	// mu guards inBlock and shutdown.
+	mu sync.Mutex
+	// inBlock is set from the beginning of a block until it is committed.
+	// A block that is not committed, because tendermint reconnected in the
+	// middle of it, is replaced by the next one.
+	inBlock  bool
+	shutdown bool
+	// idle is closed once the shutdown started and no block is in
+	// progress.
+	idle chan struct{}
+	// call is held by each call of the application and by Close.
+	call     sync.Mutex
+	closed   bool
+	stopping int32
+}
+
+var _ abci.Application = (*GracefulApp)(nil)
+
+// NewGracefulApp returns the application wrapped for graceful shutdown.
+func NewGracefulApp(app abci.Application) *GracefulApp {
+	return &GracefulApp{app: app, idle: make(chan struct{})}
+}
+
+// Shutdown stops accepting transactions and waits until the current block
+// is committed. No block is started afterwards. An error is returned if the
+// block is not committed within the timeout, for example because
+// tendermint stopped in the middle of it.
+func (a *GracefulApp) Shutdown(timeout time.Duration) error {
+	atomic.StoreInt32(&a.stopping, 1)
+
+	a.mu.Lock()
+	if !a.shutdown {
+		a.shutdown = true
+		if !a.inBlock {
+			close(a.idle)
+		}
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.idle:
+		return nil
+	case <-time.After(timeout):
+		return errors.Wrapf(errors.ErrState, "block not committed within %s", timeout)
+	}
+}
+
+// Close waits for the current call of the application to return, and
+// closes the application if it is an io.Closer. Later calls are rejected.
+// Changes of a block that is not committed are lost.
+func (a *GracefulApp) Close() error {
+	atomic.StoreInt32(&a.stopping, 1)
+	a.call.Lock()
+	defer a.call.Unlock()
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	if c, ok := a.app.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+var errShutdown = errors.Wrap(errors.ErrState, "node is shutting down")
+
+// shutdownInfo returns the ABCI code and log of errShutdown.
+func shutdownInfo() (uint32, string) {
+	return errors.ABCIInfo(errShutdown, false)
+}
+
+// Info implements abci.Application.
+func (a *GracefulApp) Info(req abci.RequestInfo) abci.ResponseInfo {
+	a.call.Lock()
+	defer a.call.Unlock()
+	if a.closed {
+		return abci.ResponseInfo{}
+	}
+	return a.app.Info(req)
+}
+
+// SetOption implements abci.Application.
+func (a *GracefulApp) SetOption(req abci.RequestSetOption) abci.ResponseSetOption {
+	a.call.Lock()
+	defer a.call.Unlock()
+	if a.closed {
+		code, log := shutdownInfo()
+		return abci.ResponseSetOption{Code: code, Log: log}
+	}
+	return a.app.SetOption(req)
+}
+
+// Query implements abci.Application.
+func (a *GracefulApp) Query(req abci.RequestQuery) abci.ResponseQuery {
+	a.call.Lock()
+	defer a.call.Unlock()
+	if a.closed {
+		code, log := shutdownInfo()
+		return abci.ResponseQuery{Code: code, Log: log}
+	}
+	return a.app.Query(req)
+}
+
+// CheckTx implements abci.Application. Transactions are rejected once the
+// shutdown started.
+func (a *GracefulApp) CheckTx(tx []byte) abci.ResponseCheckTx {
+	a.call.Lock()
+	defer a.call.Unlock()
+	if a.closed || atomic.LoadInt32(&a.stopping) != 0 {
+		return weave.CheckTxError(errShutdown, false)
+	}
+	return a.app.CheckTx(tx)
+}
+
+// InitChain implements abci.Application.
+func (a *GracefulApp) InitChain(req abci.RequestInitChain) abci.ResponseInitChain {
+	a.call.Lock()
+	defer a.call.Unlock()
+	if a.closed {
+		return abci.ResponseInitChain{}
+	}
+	return a.app.InitChain(req)
+}
+
+// BeginBlock implements abci.Application. It blocks once the shutdown
+// started, so that no new block is processed.
+func (a *GracefulApp) BeginBlock(req abci.RequestBeginBlock) abci.ResponseBeginBlock {
+	a.mu.Lock()
+	if a.shutdown {
+		a.mu.Unlock()
+		select {}
+	}
+	a.inBlock = true
+	a.mu.Unlock()
+
+	a.call.Lock()
+	defer a.call.Unlock()
+	if a.closed {
+		return abci.ResponseBeginBlock{}
+	}
+	return a.app.BeginBlock(req)
+}
+
+// DeliverTx implements abci.Application. Transactions of the current block
+// are delivered during the shutdown.
+func (a *GracefulApp) DeliverTx(tx []byte) abci.ResponseDeliverTx {
+	a.call.Lock()
+	defer a.call.Unlock()
+	if a.closed {
+		return weave.DeliverTxError(errShutdown, false)
+	}
+	return a.app.DeliverTx(tx)
+}
+
+// EndBlock implements abci.Application.
+func (a *GracefulApp) EndBlock(req abci.RequestEndBlock) abci.ResponseEndBlock {
+	a.call.Lock()
+	defer a.call.Unlock()
+	if a.closed {
+		return abci.ResponseEndBlock{}
+	}
+	return a.app.EndBlock(req)
+}
+
+// Commit implements abci.Application. It finishes the block.
+func (a *GracefulApp) Commit() abci.ResponseCommit {
+	defer a.endBlock()
+	a.call.Lock()
+	defer a.call.Unlock()
+	if a.closed {
+		return abci.ResponseCommit{}
+	}
+	return a.app.Commit()
+}
+
+// endBlock marks the current block as finished and completes a pending
+// shutdown.
+func (a *GracefulApp) endBlock() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.inBlock && a.shutdown {
+		close(a.idle)
+	}
+	a.inBlock = false
+}
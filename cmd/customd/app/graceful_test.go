@@ -0,0 +1,112 @@
+package customd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/weavetest/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestGracefulAppShutdown(t *testing.T) {
+	app := &closingApp{}
+	graceful := NewGracefulApp(app)
+	shutdownCode, _ := errors.ABCIInfo(errShutdown, false)
+
+	assert.Equal(t, uint32(0), graceful.CheckTx([]byte("tx")).Code)
+	graceful.BeginBlock(abci.RequestBeginBlock{})
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- graceful.Shutdown(time.Second) }()
+
+	// The current block is finished before the shutdown completes.
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case err := <-stopped:
+		t.Fatalf("shutdown completed within a block: %v", err)
+	default:
+	}
+	assert.Equal(t, shutdownCode, graceful.CheckTx([]byte("tx")).Code)
+	assert.Equal(t, uint32(0), graceful.DeliverTx([]byte("tx")).Code)
+	graceful.EndBlock(abci.RequestEndBlock{})
+	graceful.Commit()
+	assert.Nil(t, <-stopped)
+	assert.Equal(t, 1, app.commits)
+
+	// No other block is started.
+	started := make(chan struct{})
+	go func() {
+		graceful.BeginBlock(abci.RequestBeginBlock{})
+		close(started)
+	}()
+	select {
+	case <-started:
+		t.Fatal("block started after the shutdown")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	assert.Nil(t, graceful.Close())
+	assert.Equal(t, true, app.closed)
+	assert.Equal(t, shutdownCode, graceful.DeliverTx([]byte("tx")).Code)
+	assert.Equal(t, shutdownCode, graceful.Query(abci.RequestQuery{}).Code)
+	graceful.Commit()
+	assert.Equal(t, 1, app.commits)
+
+	// Closing again has no effect.
+	assert.Nil(t, graceful.Close())
+}
+
+func TestGracefulAppShutdownTimeout(t *testing.T) {
+	graceful := NewGracefulApp(&closingApp{})
+	graceful.BeginBlock(abci.RequestBeginBlock{})
+
+	err := graceful.Shutdown(10 * time.Millisecond)
+	assert.IsErr(t, errors.ErrState, err)
+
+	// The store is closed even though the block is not finished.
+	assert.Nil(t, graceful.Close())
+}
+
+func TestGracefulAppReconnect(t *testing.T) {
+	app := &closingApp{}
+	graceful := NewGracefulApp(app)
+
+	// Tendermint reconnects in the middle of a block and starts it
+	// again.
+	graceful.BeginBlock(abci.RequestBeginBlock{})
+	graceful.Info(abci.RequestInfo{})
+	started := make(chan struct{})
+	go func() {
+		graceful.BeginBlock(abci.RequestBeginBlock{})
+		close(started)
+	}()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("block not started after a reconnect")
+	}
+	graceful.Commit()
+	assert.Equal(t, 1, app.commits)
+
+	// Without a block in progress, the shutdown completes at once.
+	assert.Nil(t, graceful.Shutdown(time.Second))
+	assert.Nil(t, graceful.Close())
+}
+
+// closingApp is an application that counts commits and can be closed.
+type closingApp struct {
+	abci.BaseApplication
+	commits int
+	closed  bool
+}
+
+func (a *closingApp) Commit() abci.ResponseCommit {
+	a.commits++
+	return abci.ResponseCommit{}
+}
+
+func (a *closingApp) Close() error {
+	a.closed = true
+	return nil
+}
@@ -0,0 +1,173 @@
+package customd
+
+import (
+	"strings"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/app"
+	"github.com/iov-one/weave/errors"
+	tmiavl "github.com/tendermint/iavl"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// HistoricalApp extends an application with queries of older heights.
+//
+// Weave queries ignore the requested height and always return the latest
+// state. HistoricalApp executes queries of older heights against the
+// committed versions kept in the IAVL tree. Queries of the latest height are
+// passed to the application unchanged.
+type HistoricalApp struct {
+	app.BaseApp
+	tree *tmiavl.MutableTree
+	// queries is the router of the application, used to execute
+	// queries of older heights.
+	queries weave.QueryRouter
+}
+
+var _ abci.Application = HistoricalApp{}
+
+// NewHistoricalApp returns an application that serves queries of older
+// heights. The tree and the query router must be the ones used by the
+// application.
+func NewHistoricalApp(base app.BaseApp, tree *tmiavl.MutableTree, qr weave.QueryRouter) HistoricalApp {
+	return HistoricalApp{BaseApp: base, tree: tree, queries: qr}
+}
+
+// Query implements abci.Application. Queries are served for the requested
+// height or, if not set, for the latest committed version.
+func (a HistoricalApp) Query(req abci.RequestQuery) abci.ResponseQuery {
+	if req.Height == 0 || req.Height == a.tree.Version() {
+		return a.BaseApp.Query(req)
+	}
+	return a.queryVersion(req)
+}
+
+// queryVersion executes the query against a committed version of the state,
+// that is not the latest one.
+func (a HistoricalApp) queryVersion(req abci.RequestQuery) abci.ResponseQuery {
+	path, mod := req.Path, ""
+	if chunks := strings.SplitN(req.Path, "?", 2); len(chunks) == 2 {
+		path, mod = chunks[0], chunks[1]
+	}
+	// Transactions are always simulated in the context of the latest
+	// block.
+	if path == SimulatePath {
+		return queryError(errors.Wrap(errors.ErrInput, "simulation is only supported at the latest height"))
+	}
+	qh := a.queries.Handler(path)
+	if qh == nil {
+		return queryError(errors.Wrapf(errors.ErrNotFound, "unexpected query path: %v", req.Path))
+	}
+	tree, err := a.tree.GetImmutable(req.Height)
+	if err != nil {
+		return queryError(errors.Wrapf(errors.ErrNotFound, "version %d is not available", req.Height))
+	}
+
+	models, err := qh.Query(historicalStore{tree: tree}, mod, req.Data)
+	if err != nil {
+		return queryError(err)
+	}
+	res := abci.ResponseQuery{Height: req.Height}
+	res.Key, err = app.ResultsFromKeys(models).Marshal()
+	if err != nil {
+		return queryError(err)
+	}
+	res.Value, err = app.ResultsFromValues(models).Marshal()
+	if err != nil {
+		return queryError(err)
+	}
+	return res
+}
+
+func queryError(err error) abci.ResponseQuery {
+	code, log := errors.ABCIInfo(err, false)
+	return abci.ResponseQuery{Code: code, Log: log}
+}
+
+// historicalStore is a read only view of a committed version of the tree.
+type historicalStore struct {
+	tree *tmiavl.ImmutableTree
+}
+
+var _ weave.ReadOnlyKVStore = historicalStore{}
+
+// Get returns nil if the key does not exist.
+func (s historicalStore) Get(key []byte) ([]byte, error) {
+	_, value := s.tree.Get(key)
+	return value, nil
+}
+
+// Has returns true if the key exists.
+func (s historicalStore) Has(key []byte) (bool, error) {
+	return s.tree.Has(key), nil
+}
+
+// Iterator returns models within the range in ascending key order. End is
+// exclusive.
+func (s historicalStore) Iterator(start, end []byte) (weave.Iterator, error) {
+	return &treeIterator{tree: s.tree, start: start, end: end, ascending: true}, nil
+}
+
+// ReverseIterator returns models within the range in descending key order.
+// End is exclusive.
+func (s historicalStore) ReverseIterator(start, end []byte) (weave.Iterator, error) {
+	return &treeIterator{tree: s.tree, start: start, end: end}, nil
+}
+
+// treeIteratorBatch is the number of models read from the tree at once.
+const treeIteratorBatch = 100
+
+// treeIterator reads models from the tree in batches, as they are
+// requested. Each batch is read by a new traversal of the tree starting
+// after the last returned key, so no traversal is left open between the
+// calls.
+type treeIterator struct {
+	tree       *tmiavl.ImmutableTree
+	start, end []byte
+	ascending  bool
+
+	batch []weave.Model
+	// done is set once the last batch is read from the tree.
+	done bool
+}
+
+var _ weave.Iterator = (*treeIterator)(nil)
+
+// Next returns the next model or ErrIteratorDone if there are no more.
+func (it *treeIterator) Next() ([]byte, []byte, error) {
+	if len(it.batch) == 0 && !it.done {
+		it.read()
+	}
+	if len(it.batch) == 0 {
+		return nil, nil, errors.ErrIteratorDone
+	}
+	m := it.batch[0]
+	it.batch = it.batch[1:]
+	return m.Key, m.Value, nil
+}
+
+// read loads the next batch of models and narrows the range to the keys
+// that were not read yet.
+func (it *treeIterator) read() {
+	it.tree.IterateRange(it.start, it.end, it.ascending, func(key, value []byte) bool {
+		it.batch = append(it.batch, weave.Model{Key: key, Value: value})
+		return len(it.batch) == treeIteratorBatch
+	})
+	if len(it.batch) < treeIteratorBatch {
+		it.done = true
+		return
+	}
+	last := it.batch[len(it.batch)-1].Key
+	if it.ascending {
+		// The smallest key greater than the last one.
+		it.start = append(append([]byte{}, last...), 0)
+	} else {
+		it.end = last
+	}
+}
+
+// Release drops the models that were not read.
+func (it *treeIterator) Release() {
+	it.batch = nil
+	it.done = true
+}
@@ -0,0 +1,110 @@
+package customd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/iov-one/weave/app"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store/iavl"
+	"github.com/iov-one/weave/weavetest/assert"
+	tmiavl "github.com/tendermint/iavl"
+	abci "github.com/tendermint/tendermint/abci/types"
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+func TestHistoricalAppQuery(t *testing.T) {
+	tree := tmiavl.NewMutableTree(dbm.NewMemDB(), iavl.DefaultCacheSize)
+	kv := iavl.NewCommitStoreFromTree(tree)
+	qr := QueryRouter()
+	a := NewHistoricalApp(storeApplication("customd", Stack(nil, coin.Coin{}), TxDecoder, kv, qr, false), tree, qr)
+
+	// Each version overwrites the "key" and adds a new "item:" key.
+	for v := 1; v <= 3; v++ {
+		adapter := kv.Adapter()
+		assert.Nil(t, adapter.Set([]byte("key"), []byte(fmt.Sprint(v))))
+		assert.Nil(t, adapter.Set([]byte(fmt.Sprintf("item:%d", v)), []byte("x")))
+		_, err := kv.Commit()
+		assert.Nil(t, err)
+	}
+
+	cases := map[string]struct {
+		Height     int64
+		WantHeight int64
+		WantValue  string
+	}{
+		"latest":        {Height: 0, WantHeight: 3, WantValue: "3"},
+		"latest height": {Height: 3, WantHeight: 3, WantValue: "3"},
+		"first version": {Height: 1, WantHeight: 1, WantValue: "1"},
+		"older version": {Height: 2, WantHeight: 2, WantValue: "2"},
+	}
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			res := a.Query(abci.RequestQuery{Path: "/", Data: []byte("key"), Height: tc.Height})
+			assert.Equal(t, uint32(0), res.Code)
+			assert.Equal(t, tc.WantHeight, res.Height)
+			var values app.ResultSet
+			assert.Nil(t, values.Unmarshal(res.Value))
+			assert.Equal(t, [][]byte{[]byte(tc.WantValue)}, values.Results)
+
+			res = a.Query(abci.RequestQuery{Path: "/?prefix", Data: []byte("item:"), Height: tc.Height})
+			assert.Equal(t, uint32(0), res.Code)
+			var keys app.ResultSet
+			assert.Nil(t, keys.Unmarshal(res.Key))
+			assert.Equal(t, int(tc.WantHeight), len(keys.Results))
+		})
+	}
+
+	res := a.Query(abci.RequestQuery{Path: "/", Data: []byte("key"), Height: 10})
+	assert.Equal(t, errors.ErrNotFound.ABCICode(), res.Code)
+
+	res = a.Query(abci.RequestQuery{Path: SimulatePath, Height: 1})
+	assert.Equal(t, errors.ErrInput.ABCICode(), res.Code)
+}
+
+func TestTreeIterator(t *testing.T) {
+	// More keys than a single batch, so that the range is read in
+	// several traversals.
+	const n = treeIteratorBatch*2 + 5
+	tree := tmiavl.NewMutableTree(dbm.NewMemDB(), iavl.DefaultCacheSize)
+	for i := 0; i < n; i++ {
+		tree.Set([]byte(fmt.Sprintf("key-%04d", i)), []byte("x"))
+	}
+	tree.Set([]byte("other"), []byte("x"))
+	_, _, err := tree.SaveVersion()
+	assert.Nil(t, err)
+	immutable, err := tree.GetImmutable(1)
+	assert.Nil(t, err)
+	store := historicalStore{tree: immutable}
+
+	it, err := store.Iterator([]byte("key-"), []byte("key."))
+	assert.Nil(t, err)
+	for i := 0; i < n; i++ {
+		key, _, err := it.Next()
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("key-%04d", i), string(key))
+	}
+	_, _, err = it.Next()
+	assert.IsErr(t, errors.ErrIteratorDone, err)
+	it.Release()
+
+	it, err = store.ReverseIterator(nil, []byte("key-0150"))
+	assert.Nil(t, err)
+	for i := 149; i >= 0; i-- {
+		key, _, err := it.Next()
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("key-%04d", i), string(key))
+	}
+	_, _, err = it.Next()
+	assert.IsErr(t, errors.ErrIteratorDone, err)
+
+	// Released iterator returns no more models.
+	it, err = store.Iterator(nil, nil)
+	assert.Nil(t, err)
+	_, _, err = it.Next()
+	assert.Nil(t, err)
+	it.Release()
+	_, _, err = it.Next()
+	assert.IsErr(t, errors.ErrIteratorDone, err)
+}
@@ -1,10 +1,11 @@
 package customd
 
 import (
+	"bytes"
 	"context"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
 
 	"github.com/iov-one/weave"
@@ -12,16 +13,23 @@ import (
 	"github.com/iov-one/weave/coin"
 	"github.com/iov-one/weave/commands/server"
 	"github.com/iov-one/weave/crypto"
+	"github.com/iov-one/weave/errors"
 	"github.com/iov-one/weave/migration"
 	"github.com/iov-one/weave/x/cash"
 	"github.com/iov-one/weave/x/multisig"
 	"github.com/iov-one/weave/x/validators"
 	abci "github.com/tendermint/tendermint/abci/types"
 	"github.com/tendermint/tendermint/libs/log"
+	yaml "gopkg.in/yaml.v2"
 )
 
+// defaultAccountCoins is the amount of tokens the account of the dev mode
+// options is funded with.
+const defaultAccountCoins = 123456789
+
 // GenInitOptions will produce some basic options for one rich
-// account, to use for dev mode
+// account, to use for dev mode. It expects the ticker and the address of
+// the account, which also administrates the chain and collects the fees.
 func GenInitOptions(args []string) (json.RawMessage, error) {
 	// Your coins ticker code
 	ticker := "CSTM"
@@ -31,53 +39,199 @@ func GenInitOptions(args []string) (json.RawMessage, error) {
 			return nil, fmt.Errorf("Invalid ticker %s", ticker)
 		}
 	}
+	if len(args) < 2 {
+		return nil, fmt.Errorf("Missing account address")
+	}
+	addr, err := weave.ParseAddress(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid address %s: %s", args[1], err)
+	}
+	return DevGenesisTemplate(ticker, addr).AppState()
+}
 
-	var addr string
-	if len(args) > 1 {
-		addr = args[1]
-	} else {
-		// if no address provided, auto-generate one
-		// and print out a recovery phrase
-		bz, phrase, err := GenerateCoinKey()
-		if err != nil {
-			return nil, err
-		}
-		addr = hex.EncodeToString(bz)
-		fmt.Println(phrase)
-	}
-
-	type (
-		dict  map[string]interface{}
-		array []interface{}
-	)
-
-	cond1 := weave.NewCondition("sigs", "ed25519", []byte{1, 2, 3})
-	// collectorAddr is the address where all tx fee's will be
-	// stashed and then distributed to stakeholders
-	collectorAddr := cond1.Address()
-
-	return json.Marshal(dict{
-		"cash": array{
-			dict{
-				"address": addr,
-				"coins": array{
-					dict{
-						"whole":  123456789,
-						"ticker": ticker,
-					},
-				},
+// DevGenesisTemplate returns a template of a chain with one rich account,
+// that also administrates the chain and collects the fees.
+func DevGenesisTemplate(ticker string, addr weave.Address) *GenesisTemplate {
+	return &GenesisTemplate{
+		Accounts: []cash.GenesisAccount{
+			{
+				Address: addr,
+				Set:     cash.Set{Coins: []*coin.Coin{{Whole: defaultAccountCoins, Ticker: ticker}}},
 			},
 		},
-		"conf": dict{
-			"cash": dict{
-				"collector_address": collectorAddr,
-				"minimal_fee":       coin.Coin{Whole: 0}, // no fee
-			},
-			"migration": dict{
-				// admin is who can change this redistribution address to other address
-				"admin": addr,
-			},
+		MigrationAdmin: addr,
+	}
+}
+
+// GenesisTemplate describes the application state of a new chain.
+type GenesisTemplate struct {
+	// Accounts are funded when the chain starts.
+	Accounts []cash.GenesisAccount `json:"accounts"`
+	// Collector is the address receiving transaction fees. It defaults to
+	// the migration admin.
+	Collector weave.Address `json:"collector"`
+	// MinimalFee is the fee required by each transaction. Zero means no
+	// fee.
+	MinimalFee coin.Coin `json:"minimal_fee"`
+	// MigrationAdmin is the address allowed to upgrade schema versions.
+	MigrationAdmin weave.Address `json:"migration_admin"`
+	// Validators are the addresses allowed to update the validator set.
+	Validators []weave.Address `json:"validators"`
+	// Conf holds module configurations by package name. A configuration
+	// given here replaces the one built of the fields above.
+	Conf map[string]json.RawMessage `json:"conf"`
+}
+
+// genesisConfigurations returns an empty configuration for each package
+// that reads it from the genesis.
+var genesisConfigurations = map[string]func() genesisConfiguration{
+	"cash":      func() genesisConfiguration { return &cash.Configuration{} },
+	"migration": func() genesisConfiguration { return &migration.Configuration{} },
+	"mempool":   func() genesisConfiguration { return &MempoolConfiguration{} },
+}
+
+type genesisConfiguration interface {
+	Validate() error
+}
+
+// LoadGenesisTemplate reads a template from a JSON or a YAML file. Unknown
+// attributes are rejected.
+func LoadGenesisTemplate(filename string) (*GenesisTemplate, error) {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read template")
+	}
+	// JSON is valid YAML. Decoded YAML is converted to JSON, so that
+	// weave types are decoded the same way as in the genesis.
+	var doc interface{}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, errors.Wrapf(errors.ErrInput, "cannot decode template: %s", err)
+	}
+	if raw, err = json.Marshal(jsonCompatible(doc)); err != nil {
+		return nil, errors.Wrapf(errors.ErrInput, "cannot decode template: %s", err)
+	}
+	var t GenesisTemplate
+	if err := decodeStrict(raw, &t); err != nil {
+		return nil, errors.Wrapf(errors.ErrInput, "cannot decode template: %s", err)
+	}
+	return &t, nil
+}
+
+// jsonCompatible replaces YAML maps, that can have keys of any type, with
+// maps that can be encoded as JSON.
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range v {
+			v[i] = jsonCompatible(val)
+		}
+	}
+	return v
+}
+
+func decodeStrict(raw []byte, dest interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(dest)
+}
+
+// Validate returns an error if the template would not initialize the
+// application. Accounts must have distinct addresses and valid coins,
+// module configurations are validated by their packages.
+func (t *GenesisTemplate) Validate() error {
+	var errs error
+	seen := make(map[string]int, len(t.Accounts))
+	for i, acct := range t.Accounts {
+		field := fmt.Sprintf("Accounts.%d", i)
+		if err := acct.Address.Validate(); err != nil {
+			errs = errors.AppendField(errs, field+".Address", err)
+		} else if j, ok := seen[acct.Address.String()]; ok {
+			errs = errors.AppendField(errs, field+".Address",
+				errors.Wrapf(errors.ErrDuplicate, "same as account %d", j))
+		} else {
+			seen[acct.Address.String()] = i
+		}
+		errs = errors.AppendField(errs, field+".Coins", cash.XCoins(&acct.Set).Validate())
+	}
+	errs = errors.AppendField(errs, "Validators", validators.WeaveAccounts{Addresses: t.Validators}.Validate())
+
+	conf, err := t.conf()
+	if err != nil {
+		return errors.Append(errs, err)
+	}
+	for pkg, raw := range conf {
+		field := "Conf." + pkg
+		newConf, ok := genesisConfigurations[pkg]
+		if !ok {
+			errs = errors.AppendField(errs, field, errors.Wrap(errors.ErrInput, "unknown package"))
+			continue
+		}
+		c := newConf()
+		if err := decodeStrict(raw, c); err != nil {
+			errs = errors.AppendField(errs, field, errors.Wrapf(errors.ErrInput, "cannot decode: %s", err))
+			continue
+		}
+		errs = errors.AppendField(errs, field, c.Validate())
+	}
+	return errs
+}
+
+// conf returns the module configurations, built of the template fields
+// and replaced by the ones given explicitly.
+func (t *GenesisTemplate) conf() (map[string]json.RawMessage, error) {
+	collector := t.Collector
+	if len(collector) == 0 {
+		collector = t.MigrationAdmin
+	}
+	built := map[string]interface{}{
+		"cash": &cash.Configuration{
+			CollectorAddress: collector,
+			MinimalFee:       t.MinimalFee,
 		},
+		"migration": &migration.Configuration{
+			Admin: t.MigrationAdmin,
+		},
+	}
+	conf := make(map[string]json.RawMessage, len(built)+len(t.Conf))
+	for pkg, c := range built {
+		raw, err := json.Marshal(c)
+		if err != nil {
+			return nil, errors.Wrapf(errors.ErrInput, "cannot encode %s configuration: %s", pkg, err)
+		}
+		conf[pkg] = raw
+	}
+	for pkg, raw := range t.Conf {
+		conf[pkg] = raw
+	}
+	return conf, nil
+}
+
+// AppState returns the application state of the genesis described by the
+// template, if it is valid.
+func (t *GenesisTemplate) AppState() (json.RawMessage, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	conf, err := t.conf()
+	if err != nil {
+		return nil, err
+	}
+
+	type dict map[string]interface{}
+
+	accounts := t.Accounts
+	if accounts == nil {
+		accounts = []cash.GenesisAccount{}
+	}
+	state := dict{
+		"cash": accounts,
+		"conf": conf,
 		"initialize_schema": []dict{
 			{"pkg": "migration", "ver": 1},
 			{"pkg": "custom", "ver": 1},
@@ -87,24 +241,43 @@ func GenInitOptions(args []string) (json.RawMessage, error) {
 			{"pkg": "utils", "ver": 1},
 			{"pkg": "validators", "ver": 1},
 		},
-	})
+	}
+	if len(t.Validators) != 0 {
+		state["update_validators"] = validators.WeaveAccounts{Addresses: t.Validators}
+	}
+	return json.Marshal(state)
 }
 
 // GenerateApp is used to create a stub for server/start.go command
 func GenerateApp(options *server.Options) (abci.Application, error) {
-	// db goes in a subdir, but "" -> "" for memdb
-	var dbPath string
-	if options.Home != "" {
-		dbPath = filepath.Join(options.Home, "custom.db")
-	}
+	return AppGenerator(DefaultStoreOptions())(options)
+}
 
-	stack := Stack(nil, options.MinFee)
-	application, err := Application("customd", stack, TxDecoder, dbPath, options.Debug)
-	if err != nil {
-		return nil, err
+// AppGenerator returns a generator of applications, that store the state
+// according to the store options.
+func AppGenerator(opts StoreOptions) server.AppGenerator {
+	return func(options *server.Options) (abci.Application, error) {
+		// db goes in a subdir, but "" -> "" for memdb
+		var dbPath string
+		if options.Home != "" {
+			dbPath = DBPath(options.Home)
+		}
+
+		stack := Stack(nil, options.MinFee)
+		application, err := ProvingApplication("customd", stack, TxDecoder, dbPath, opts, options.Debug)
+		if err != nil {
+			return nil, err
+		}
+
+		application.BaseApp = DecorateApp(application.BaseApp, options.Logger)
+		return application, nil
 	}
+}
 
-	return DecorateApp(application, options.Logger), nil
+// DBPath returns the path of the application database in the home
+// directory.
+func DBPath(home string) string {
+	return filepath.Join(home, "custom.db")
 }
 
 // DecorateApp adds initializers and Logger to an Application
@@ -114,6 +287,7 @@ func DecorateApp(application app.BaseApp, logger log.Logger) app.BaseApp {
 		&cash.Initializer{},
 		&multisig.Initializer{},
 		&validators.Initializer{},
+		MempoolInitializer{},
 	))
 	application.WithLogger(logger)
 	return application
@@ -124,7 +298,9 @@ func InlineApp(kv weave.CommitKVStore, logger log.Logger, debug bool) abci.Appli
 	minFee := coin.Coin{}
 	stack := Stack(nil, minFee)
 	ctx := context.Background()
-	store := app.NewStoreApp("customd", kv, QueryRouter(), ctx)
+	qr := QueryRouter()
+	store := app.NewStoreApp("customd", kv, qr, ctx)
+	RegisterSimulateQuery(qr, stack, TxDecoder, store)
 	base := app.NewBaseApp(store, TxDecoder, stack, nil, debug)
 	return DecorateApp(base, logger)
 }
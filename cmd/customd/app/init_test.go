@@ -0,0 +1,183 @@
+package customd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store/iavl"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/cash"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func TestLoadGenesisTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genesis-template")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"template.yaml": `
+accounts:
+  - address: "0011223344556677889900112233445566778899"
+    coins: ["100 CSTM", {whole: 5, ticker: ETH}]
+minimal_fee: 0.01 CSTM
+conf:
+  migration:
+    admin: "1111111111111111111111111111111111111111"
+`,
+		"template.json": `{
+	"accounts": [{"address": "0011223344556677889900112233445566778899", "coins": ["100 CSTM", {"whole": 5, "ticker": "ETH"}]}],
+	"minimal_fee": "0.01 CSTM",
+	"conf": {"migration": {"admin": "1111111111111111111111111111111111111111"}}
+}`,
+		"unknown.yaml": "accounts: []\nadmin: 00\n",
+	}
+	for name, content := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+
+	var states []string
+	for _, name := range []string{"template.yaml", "template.json"} {
+		template, err := LoadGenesisTemplate(filepath.Join(dir, name))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(template.Accounts))
+		assert.Equal(t, int64(5), template.Accounts[0].Coins[1].Whole)
+		assert.Equal(t, int64(10000000), template.MinimalFee.Fractional)
+
+		// The admin is given only by the migration configuration, so
+		// the collector has no default.
+		template.Collector = template.Accounts[0].Address
+		state, err := template.AppState()
+		assert.Nil(t, err)
+		states = append(states, string(state))
+	}
+	assert.Equal(t, states[0], states[1])
+
+	_, err = LoadGenesisTemplate(filepath.Join(dir, "unknown.yaml"))
+	assert.IsErr(t, errors.ErrInput, err)
+}
+
+func TestGenesisTemplateValidate(t *testing.T) {
+	addr := weave.NewCondition("sigs", "ed25519", []byte{1}).Address()
+	other := weave.NewCondition("sigs", "ed25519", []byte{2}).Address()
+
+	cases := map[string]struct {
+		Template *GenesisTemplate
+		WantErr  *errors.Error
+	}{
+		"dev mode": {
+			Template: DevGenesisTemplate("CSTM", addr),
+		},
+		"all fields": {
+			Template: &GenesisTemplate{
+				Accounts: []cash.GenesisAccount{
+					{Address: addr, Set: cash.Set{Coins: []*coin.Coin{{Whole: 1, Ticker: "CSTM"}}}},
+					{Address: other},
+				},
+				Collector:      other,
+				MinimalFee:     coin.Coin{Fractional: 1, Ticker: "CSTM"},
+				MigrationAdmin: addr,
+				Validators:     []weave.Address{addr, other},
+			},
+		},
+		"missing admin": {
+			Template: &GenesisTemplate{Collector: addr},
+			WantErr:  errors.ErrEmpty,
+		},
+		"duplicated account": {
+			Template: &GenesisTemplate{
+				Accounts:       []cash.GenesisAccount{{Address: addr}, {Address: addr}},
+				MigrationAdmin: addr,
+			},
+			WantErr: errors.ErrDuplicate,
+		},
+		"invalid coins": {
+			Template: &GenesisTemplate{
+				Accounts:       []cash.GenesisAccount{{Address: addr, Set: cash.Set{Coins: []*coin.Coin{{Ticker: "CSTM"}}}}},
+				MigrationAdmin: addr,
+			},
+			WantErr: errors.ErrState,
+		},
+		"invalid validator": {
+			Template: &GenesisTemplate{MigrationAdmin: addr, Validators: []weave.Address{{1, 2}}},
+			WantErr:  errors.ErrInput,
+		},
+		"unknown package configuration": {
+			Template: &GenesisTemplate{
+				MigrationAdmin: addr,
+				Conf:           map[string]json.RawMessage{"custom": json.RawMessage(`{}`)},
+			},
+			WantErr: errors.ErrInput,
+		},
+		"unknown configuration attribute": {
+			Template: &GenesisTemplate{
+				MigrationAdmin: addr,
+				Conf:           map[string]json.RawMessage{"migration": json.RawMessage(`{"owner": "` + addr.String() + `"}`)},
+			},
+			WantErr: errors.ErrInput,
+		},
+		"mempool configuration": {
+			Template: &GenesisTemplate{
+				MigrationAdmin: addr,
+				Conf:           map[string]json.RawMessage{"mempool": json.RawMessage(`{"max_tx_size": 1024, "blocked_paths": ["cash/send"]}`)},
+			},
+		},
+		"invalid mempool configuration": {
+			Template: &GenesisTemplate{
+				MigrationAdmin: addr,
+				Conf:           map[string]json.RawMessage{"mempool": json.RawMessage(`{"max_tx_size": -1}`)},
+			},
+			WantErr: errors.ErrInput,
+		},
+		"invalid configuration": {
+			Template: &GenesisTemplate{
+				MigrationAdmin: addr,
+				Conf:           map[string]json.RawMessage{"cash": json.RawMessage(`{}`)},
+			},
+			WantErr: errors.ErrState,
+		},
+	}
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			if err := tc.Template.Validate(); !tc.WantErr.Is(err) {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			state, err := tc.Template.AppState()
+			if !tc.WantErr.Is(err) {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			if tc.WantErr != nil {
+				return
+			}
+
+			// A valid template initializes the application.
+			app := InlineApp(iavl.MockCommitStore(), log.NewNopLogger(), false)
+			app.InitChain(abci.RequestInitChain{ChainId: "template-test", AppStateBytes: state})
+		})
+	}
+}
+
+func TestGenInitOptions(t *testing.T) {
+	addr := weave.NewCondition("sigs", "ed25519", []byte{1}).Address()
+
+	state, err := GenInitOptions([]string{"IOV", addr.String()})
+	assert.Nil(t, err)
+	want, err := DevGenesisTemplate("IOV", addr).AppState()
+	assert.Nil(t, err)
+	assert.Equal(t, string(want), string(state))
+
+	// A key is never generated, so that it is not printed.
+	if _, err := GenInitOptions([]string{"IOV"}); err == nil {
+		t.Fatal("missing address accepted")
+	}
+	if _, err := GenInitOptions([]string{"iov", addr.String()}); err == nil {
+		t.Fatal("invalid ticker accepted")
+	}
+}
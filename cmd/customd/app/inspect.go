@@ -0,0 +1,152 @@
+package customd
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave-starter-kit/x/custom"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/migration"
+	"github.com/iov-one/weave/x/cash"
+	"github.com/iov-one/weave/x/cron"
+	"github.com/iov-one/weave/x/multisig"
+	"github.com/iov-one/weave/x/sigs"
+	"github.com/iov-one/weave/x/validators"
+	tmiavl "github.com/tendermint/iavl"
+)
+
+// StateModel is a protobuf model stored in the application state.
+type StateModel interface {
+	Unmarshal([]byte) error
+}
+
+// stateModels maps the key prefixes of the application state to the models
+// stored under them. A key is decoded with the model of its longest
+// matching prefix.
+var stateModels = map[string]func() StateModel{
+	"cash:":                func() StateModel { return &cash.Set{} },
+	"sigs:":                func() StateModel { return &sigs.UserData{} },
+	"contracts:":           func() StateModel { return &multisig.Contract{} },
+	"trs:":                 func() StateModel { return &cron.TaskResult{} },
+	"schema:":              func() StateModel { return &migration.Schema{} },
+	"uvalid:":              func() StateModel { return &validators.Accounts{} },
+	"state:":               func() StateModel { return &custom.State{} },
+	"timedstate:":          func() StateModel { return &custom.TimedState{} },
+	"_crontask:":           func() StateModel { return &CronTask{} },
+	"_c:cash":              func() StateModel { return &cash.Configuration{} },
+	"_c:migration":         func() StateModel { return &migration.Configuration{} },
+	"_c:mempool":           func() StateModel { return &MempoolConfiguration{} },
+	"_1:update_validators": func() StateModel { return &weave.ValidatorUpdates{} },
+}
+
+// DecodeStateValue decodes a value of the application state with the model
+// registered for its key. It returns nil if no model is registered.
+func DecodeStateValue(key, value []byte) (StateModel, error) {
+	var match string
+	for prefix := range stateModels {
+		if len(prefix) > len(match) && bytes.HasPrefix(key, []byte(prefix)) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return nil, nil
+	}
+	model := stateModels[match]()
+	if err := model.Unmarshal(value); err != nil {
+		return nil, errors.Wrapf(errors.ErrInput, "cannot decode as %T: %s", model, err)
+	}
+	return model, nil
+}
+
+// StateBucket returns the name of the bucket that the key belongs to, that
+// is the part of the key before the first colon. Keys of indexes belong to
+// the index.
+func StateBucket(key []byte) string {
+	if i := bytes.IndexByte(key, ':'); i > 0 {
+		return string(key[:i])
+	}
+	return string(key)
+}
+
+// BucketStats describes the keys of a single bucket.
+type BucketStats struct {
+	Name string
+	Keys int64
+	// Size is the total size of keys and values in bytes.
+	Size int64
+}
+
+// StateBuckets returns the buckets of the state, ordered by name.
+func StateBuckets(tree *tmiavl.ImmutableTree) []BucketStats {
+	stats := make(map[string]*BucketStats)
+	tree.Iterate(func(key, value []byte) bool {
+		name := StateBucket(key)
+		s, ok := stats[name]
+		if !ok {
+			s = &BucketStats{Name: name}
+			stats[name] = s
+		}
+		s.Keys++
+		s.Size += int64(len(key) + len(value))
+		return false
+	})
+
+	buckets := make([]BucketStats, 0, len(stats))
+	for _, s := range stats {
+		buckets = append(buckets, *s)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return strings.Compare(buckets[i].Name, buckets[j].Name) < 0
+	})
+	return buckets
+}
+
+// IterateState calls fn for each key of the state with the given prefix, in
+// order, until fn returns true.
+func IterateState(tree *tmiavl.ImmutableTree, prefix []byte, fn func(key, value []byte) bool) {
+	tree.IterateRange(prefix, prefixEnd(prefix), true, fn)
+}
+
+// StateChange is a difference of a single key between two versions of the
+// state. Before is nil for an added key and After is nil for a removed one.
+type StateChange struct {
+	Key    []byte
+	Before []byte
+	After  []byte
+}
+
+// DiffState returns the keys with the given prefix that differ between two
+// versions of the state, ordered by key.
+func DiffState(from, to *tmiavl.ImmutableTree, prefix []byte) []StateChange {
+	var changes []StateChange
+	IterateState(from, prefix, func(key, value []byte) bool {
+		if _, after := to.Get(key); !bytes.Equal(value, after) {
+			changes = append(changes, StateChange{Key: key, Before: value, After: after})
+		}
+		return false
+	})
+	IterateState(to, prefix, func(key, value []byte) bool {
+		if !from.Has(key) {
+			changes = append(changes, StateChange{Key: key, After: value})
+		}
+		return false
+	})
+	sort.Slice(changes, func(i, j int) bool {
+		return bytes.Compare(changes[i].Key, changes[j].Key) < 0
+	})
+	return changes
+}
+
+// StoredVersions returns the versions of the state stored in the loaded
+// tree, in order. Only the versions kept by the pruning options are stored.
+func StoredVersions(tree *tmiavl.MutableTree) []int64 {
+	var versions []int64
+	for v := int64(1); v <= tree.Version(); v++ {
+		if tree.VersionExists(v) {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
@@ -0,0 +1,77 @@
+package customd
+
+import (
+	"testing"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store/iavl"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/cash"
+	tmiavl "github.com/tendermint/iavl"
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+func TestDecodeStateValue(t *testing.T) {
+	addr := weave.NewCondition("sigs", "ed25519", []byte{1}).Address()
+	wallet := &cash.Set{
+		Metadata: &weave.Metadata{Schema: 1},
+		Coins:    []*coin.Coin{{Whole: 5, Ticker: "CSTM"}},
+	}
+	raw, err := wallet.Marshal()
+	assert.Nil(t, err)
+
+	model, err := DecodeStateValue(append([]byte("cash:"), addr...), raw)
+	assert.Nil(t, err)
+	assert.Equal(t, wallet, model)
+
+	model, err = DecodeStateValue([]byte("unknown:key"), raw)
+	assert.Nil(t, err)
+	assert.Nil(t, model)
+
+	conf := &MempoolConfiguration{MaxTxSize: 1024, BlockedPaths: []string{"cash/send"}}
+	raw, err = conf.Marshal()
+	assert.Nil(t, err)
+	model, err = DecodeStateValue([]byte("_c:mempool"), raw)
+	assert.Nil(t, err)
+	assert.Equal(t, conf, model)
+
+	_, err = DecodeStateValue([]byte("_c:cash"), []byte{0xff})
+	assert.IsErr(t, errors.ErrInput, err)
+}
+
+func TestDiffState(t *testing.T) {
+	db := dbm.NewMemDB()
+	tree := tmiavl.NewMutableTree(db, iavl.DefaultCacheSize)
+	tree.Set([]byte("cash:a"), []byte("1"))
+	tree.Set([]byte("cash:b"), []byte("2"))
+	tree.Set([]byte("sigs:a"), []byte("3"))
+	_, _, err := tree.SaveVersion()
+	assert.Nil(t, err)
+	tree.Set([]byte("cash:a"), []byte("4"))
+	tree.Remove([]byte("cash:b"))
+	tree.Set([]byte("cash:c"), []byte("5"))
+	tree.Set([]byte("sigs:b"), []byte("6"))
+	_, _, err = tree.SaveVersion()
+	assert.Nil(t, err)
+
+	from, err := tree.GetImmutable(1)
+	assert.Nil(t, err)
+	to, err := tree.GetImmutable(2)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []StateChange{
+		{Key: []byte("cash:a"), Before: []byte("1"), After: []byte("4")},
+		{Key: []byte("cash:b"), Before: []byte("2")},
+		{Key: []byte("cash:c"), After: []byte("5")},
+	}, DiffState(from, to, []byte("cash:")))
+	assert.Equal(t, 4, len(DiffState(from, to, nil)))
+	assert.Equal(t, 0, len(DiffState(to, to, nil)))
+
+	assert.Equal(t, []BucketStats{
+		{Name: "cash", Keys: 2, Size: 14},
+		{Name: "sigs", Keys: 2, Size: 14},
+	}, StateBuckets(to))
+	assert.Equal(t, []int64{1, 2}, StoredVersions(tree))
+}
@@ -0,0 +1,101 @@
+package customd
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// checkLogSampling is the number of CheckTx calls that share a single log
+// entry. It is read atomically.
+var checkLogSampling uint64 = 1
+
+// SetCheckLogSampling logs only one in n CheckTx calls, to limit the logs of
+// high mempool traffic. DeliverTx calls are always logged. Zero or one logs
+// all calls. It applies to all applications of the process.
+func SetCheckLogSampling(n uint64) {
+	if n == 0 {
+		n = 1
+	}
+	atomic.StoreUint64(&checkLogSampling, n)
+}
+
+// Logging is a decorator that logs the result of each transaction, with its
+// height, hash and error code.
+type Logging struct {
+	cron   bool
+	checks *uint64
+}
+
+var _ weave.Decorator = Logging{}
+
+// NewLogging creates a Logging decorator for transactions.
+func NewLogging() Logging {
+	return Logging{checks: new(uint64)}
+}
+
+// NewCronLogging creates a Logging decorator for the cron tasks. Tasks have
+// no hash, so their message path is logged instead.
+func NewCronLogging() Logging {
+	return Logging{cron: true, checks: new(uint64)}
+}
+
+// Check logs error -> info, success -> debug. Only a sample of calls is
+// logged, see SetCheckLogSampling.
+func (l Logging) Check(ctx weave.Context, store weave.KVStore, tx weave.Tx, next weave.Checker) (*weave.CheckResult, error) {
+	start := time.Now()
+	res, err := next.Check(ctx, store, tx)
+
+	sampling := atomic.LoadUint64(&checkLogSampling)
+	if n := atomic.AddUint64(l.checks, 1); (n-1)%sampling != 0 {
+		return res, err
+	}
+	logger := l.logger(ctx, tx, start, err)
+	if sampling > 1 {
+		logger = logger.With("sampling", sampling)
+	}
+	if err != nil {
+		logger.Info("")
+	} else {
+		logger.Debug(res.Log)
+	}
+	return res, err
+}
+
+// Deliver logs error -> error, success -> info
+func (l Logging) Deliver(ctx weave.Context, store weave.KVStore, tx weave.Tx, next weave.Deliverer) (*weave.DeliverResult, error) {
+	start := time.Now()
+	res, err := next.Deliver(ctx, store, tx)
+
+	logger := l.logger(ctx, tx, start, err)
+	if err != nil {
+		logger.Error("")
+	} else {
+		logger.Info(res.Log)
+	}
+	return res, err
+}
+
+// logger returns the context logger with the fields of the transaction
+// result. The message path is set by the application for transactions.
+func (l Logging) logger(ctx weave.Context, tx weave.Tx, start time.Time, err error) log.Logger {
+	keyvals := []interface{}{"duration", time.Since(start) / time.Microsecond}
+	if height, ok := weave.GetHeight(ctx); ok {
+		keyvals = append(keyvals, "height", height)
+	}
+	if l.cron {
+		keyvals = append(keyvals, "path", weave.GetPath(tx))
+	} else if raw, merr := tx.Marshal(); merr == nil {
+		keyvals = append(keyvals, "tx", fmt.Sprintf("%X", tmhash.Sum(raw)))
+	}
+	if err != nil {
+		code, _ := errors.ABCIInfo(err, false)
+		keyvals = append(keyvals, "code", code, "err", err.Error())
+	}
+	return weave.GetLogger(ctx).With(keyvals...)
+}
@@ -0,0 +1,88 @@
+package customd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store"
+	"github.com/iov-one/weave/weavetest"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := weave.WithLogger(context.Background(), log.NewTMJSONLogger(&buf))
+	ctx = weave.WithHeight(ctx, 7)
+	db := store.MemStore()
+	tx := &weavetest.Tx{Msg: &weavetest.Msg{RoutePath: "logging/test", Serialized: []byte("tx")}}
+	failing := &weavetest.Handler{DeliverErr: errors.ErrUnauthorized}
+
+	_, err := NewLogging().Deliver(ctx, db, tx, failing)
+	assert.IsErr(t, errors.ErrUnauthorized, err)
+	_, err = NewCronLogging().Deliver(ctx, db, tx, &weavetest.Handler{})
+	assert.Nil(t, err)
+
+	entries := logEntries(t, &buf)
+	assert.Equal(t, 2, len(entries))
+	code, _ := errors.ABCIInfo(errors.ErrUnauthorized, false)
+	assert.Equal(t, "error", entries[0]["level"])
+	assert.Equal(t, float64(7), entries[0]["height"])
+	assert.Equal(t, fmt.Sprintf("%X", tmhash.Sum([]byte("tx"))), entries[0]["tx"])
+	assert.Equal(t, float64(code), entries[0]["code"])
+	assert.Equal(t, "info", entries[1]["level"])
+	assert.Equal(t, "logging/test", entries[1]["path"])
+	assert.Equal(t, nil, entries[1]["code"])
+}
+
+func TestLoggingCheckSampling(t *testing.T) {
+	SetCheckLogSampling(3)
+	defer SetCheckLogSampling(1)
+
+	var buf bytes.Buffer
+	ctx := weave.WithLogger(context.Background(), log.NewTMJSONLogger(&buf))
+	db := store.MemStore()
+	tx := &weavetest.Tx{Msg: &weavetest.Msg{RoutePath: "logging/test"}}
+
+	logging := NewLogging()
+	for i := 0; i < 7; i++ {
+		_, err := logging.Check(ctx, db, tx, &weavetest.Handler{})
+		assert.Nil(t, err)
+	}
+	entries := logEntries(t, &buf)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, float64(3), entries[0]["sampling"])
+
+	// Deliver calls are not sampled.
+	for i := 0; i < 2; i++ {
+		_, err := logging.Deliver(ctx, db, tx, &weavetest.Handler{})
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, len(logEntries(t, &buf)))
+}
+
+// logEntries returns the JSON log entries written to the buffer and resets
+// it.
+func logEntries(t testing.TB, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log entry %q: %s", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	buf.Reset()
+	return entries
+}
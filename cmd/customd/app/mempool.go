@@ -0,0 +1,190 @@
+package customd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/gconf"
+	"github.com/iov-one/weave/x"
+	"github.com/iov-one/weave/x/cash"
+)
+
+// MempoolConfPkg is the package name of the MempoolConfiguration. It is
+// optional, without it all valid transactions are accepted to the mempool.
+const MempoolConfPkg = "mempool"
+
+// Validate returns an error if any limit is invalid.
+func (c *MempoolConfiguration) Validate() error {
+	var errs error
+	if c.MaxTxSize < 0 {
+		errs = errors.AppendField(errs, "MaxTxSize", errors.Wrap(errors.ErrInput, "cannot be negative"))
+	}
+	if c.MaxPendingPerSender < 0 {
+		errs = errors.AppendField(errs, "MaxPendingPerSender", errors.Wrap(errors.ErrInput, "cannot be negative"))
+	}
+	if !c.MinFeePerByte.IsZero() {
+		if err := c.MinFeePerByte.Validate(); err != nil {
+			errs = errors.AppendField(errs, "MinFeePerByte", err)
+		} else if !c.MinFeePerByte.IsNonNegative() {
+			errs = errors.AppendField(errs, "MinFeePerByte", errors.Wrap(errors.ErrAmount, "cannot be negative"))
+		}
+	}
+	for i, path := range c.BlockedPaths {
+		if path == "" {
+			errs = errors.AppendField(errs, fmt.Sprintf("BlockedPaths.%d", i), errors.ErrEmpty)
+		}
+	}
+	return errs
+}
+
+// MempoolInitializer stores the MempoolConfiguration given in the genesis,
+// if any.
+type MempoolInitializer struct{}
+
+var _ weave.Initializer = MempoolInitializer{}
+
+// FromGenesis implements weave.Initializer.
+func (MempoolInitializer) FromGenesis(opts weave.Options, params weave.GenesisParams, kv weave.KVStore) error {
+	err := gconf.InitConfig(kv, opts, MempoolConfPkg, &MempoolConfiguration{})
+	if errors.ErrNotFound.Is(err) {
+		return nil
+	}
+	return err
+}
+
+// Admission is a decorator that rejects transactions, that are not allowed
+// to the mempool by the MempoolConfiguration. It applies on CheckTx only.
+//
+// Pending transactions of a sender are counted by the successful checks
+// since the last committed block. Tendermint checks the transactions left in
+// the mempool again after each block, so the count is accurate as long as
+// the mempool recheck is enabled.
+type Admission struct {
+	auth    x.Authenticator
+	pending *pendingTxs
+}
+
+var _ weave.Decorator = Admission{}
+
+// NewAdmission creates an Admission decorator. The main signer of a
+// transaction is its sender.
+func NewAdmission(auth x.Authenticator) Admission {
+	return Admission{auth: auth, pending: &pendingTxs{}}
+}
+
+// Check rejects transactions that exceed the limits of the configuration.
+func (a Admission) Check(ctx weave.Context, store weave.KVStore, tx weave.Tx, next weave.Checker) (*weave.CheckResult, error) {
+	var conf MempoolConfiguration
+	if err := gconf.Load(store, MempoolConfPkg, &conf); err != nil {
+		if errors.ErrNotFound.Is(err) {
+			return next.Check(ctx, store, tx)
+		}
+		return nil, errors.Wrap(err, "cannot load mempool configuration")
+	}
+	if err := admit(&conf, tx); err != nil {
+		return nil, err
+	}
+
+	// Simulated transactions never enter the mempool.
+	var sender string
+	if conf.MaxPendingPerSender > 0 && !isSimulation(ctx) {
+		if signer := x.MainSigner(ctx, a.auth); signer != nil {
+			sender = signer.Address().String()
+		}
+	}
+	height, _ := weave.GetHeight(ctx)
+	if sender != "" && a.pending.count(height, sender) >= conf.MaxPendingPerSender {
+		return nil, errors.Wrapf(errors.ErrState, "sender has %d pending transactions", conf.MaxPendingPerSender)
+	}
+
+	res, err := next.Check(ctx, store, tx)
+	if err == nil && sender != "" {
+		a.pending.add(height, sender)
+	}
+	return res, err
+}
+
+// Deliver does not apply any limit, as a block can include any valid
+// transaction.
+func (a Admission) Deliver(ctx weave.Context, store weave.KVStore, tx weave.Tx, next weave.Deliverer) (*weave.DeliverResult, error) {
+	return next.Deliver(ctx, store, tx)
+}
+
+// admit returns an error if the transaction size, fee or message path are not
+// accepted by the configuration.
+func admit(conf *MempoolConfiguration, tx weave.Tx) error {
+	if len(conf.BlockedPaths) != 0 {
+		path := weave.GetPath(tx)
+		for _, blocked := range conf.BlockedPaths {
+			if path == blocked {
+				return errors.Wrapf(errors.ErrUnauthorized, "message path %q is not accepted", path)
+			}
+		}
+	}
+	if conf.MaxTxSize == 0 && conf.MinFeePerByte.IsZero() {
+		return nil
+	}
+
+	raw, err := tx.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal transaction")
+	}
+	size := int64(len(raw))
+	if conf.MaxTxSize > 0 && size > int64(conf.MaxTxSize) {
+		return errors.Wrapf(errors.ErrInput, "transaction of %d bytes exceeds %d bytes", size, conf.MaxTxSize)
+	}
+	if conf.MinFeePerByte.IsZero() {
+		return nil
+	}
+
+	required, err := conf.MinFeePerByte.Multiply(size)
+	if err != nil {
+		return errors.Wrap(err, "cannot compute the fee")
+	}
+	var fee coin.Coin
+	if ftx, ok := tx.(cash.FeeTx); ok && ftx.GetFees().GetFees() != nil {
+		fee = *ftx.GetFees().GetFees()
+	}
+	if !fee.IsZero() && !fee.SameType(required) {
+		return errors.Wrapf(errors.ErrCurrency, "fee must be paid in %s", required.Ticker)
+	}
+	if !fee.IsGTE(required) {
+		return errors.Wrapf(errors.ErrAmount, "fee %s is below %s for %d bytes", fee, required, size)
+	}
+	return nil
+}
+
+// pendingTxs counts the checked transactions of each sender since the last
+// block.
+type pendingTxs struct {
+	mu      sync.Mutex
+	height  int64
+	senders map[string]int32
+}
+
+// count returns the number of pending transactions of the sender. Counts are
+// reset when a new block was committed.
+func (p *pendingTxs) count(height int64, sender string) int32 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reset(height)
+	return p.senders[sender]
+}
+
+// add counts a transaction of the sender as pending.
+func (p *pendingTxs) add(height int64, sender string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reset(height)
+	p.senders[sender]++
+}
+
+func (p *pendingTxs) reset(height int64) {
+	if p.senders == nil || p.height != height {
+		p.height = height
+		p.senders = make(map[string]int32)
+	}
+}
@@ -0,0 +1,168 @@
+package customd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/gconf"
+	"github.com/iov-one/weave/store"
+	"github.com/iov-one/weave/weavetest"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/cash"
+)
+
+func TestMempoolConfigurationValidate(t *testing.T) {
+	cases := map[string]struct {
+		Conf    MempoolConfiguration
+		WantErr *errors.Error
+	}{
+		"no limits": {},
+		"all limits": {
+			Conf: MempoolConfiguration{
+				MaxTxSize:           1024,
+				MaxPendingPerSender: 10,
+				MinFeePerByte:       coin.NewCoin(0, 1000, "CSTM"),
+				BlockedPaths:        []string{"custom/create_state"},
+			},
+		},
+		"negative size": {
+			Conf:    MempoolConfiguration{MaxTxSize: -1},
+			WantErr: errors.ErrInput,
+		},
+		"negative pending": {
+			Conf:    MempoolConfiguration{MaxPendingPerSender: -1},
+			WantErr: errors.ErrInput,
+		},
+		"negative fee": {
+			Conf:    MempoolConfiguration{MinFeePerByte: coin.NewCoin(-1, 0, "CSTM")},
+			WantErr: errors.ErrAmount,
+		},
+		"fee without ticker": {
+			Conf:    MempoolConfiguration{MinFeePerByte: coin.NewCoin(1, 0, "")},
+			WantErr: errors.ErrCurrency,
+		},
+		"empty path": {
+			Conf:    MempoolConfiguration{BlockedPaths: []string{""}},
+			WantErr: errors.ErrEmpty,
+		},
+	}
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			err := tc.Conf.Validate()
+			if tc.WantErr == nil {
+				assert.Nil(t, err)
+			} else if !tc.WantErr.Is(err) {
+				t.Fatalf("want %q error, got %v", tc.WantErr, err)
+			}
+		})
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	send := &Tx{
+		Fees: &cash.FeeInfo{Fees: coin.NewCoinp(0, 500, "CSTM")},
+		Sum:  &Tx_CashSendMsg{CashSendMsg: &cash.SendMsg{Memo: "admission"}},
+	}
+	raw, err := send.Marshal()
+	assert.Nil(t, err)
+	size := int32(len(raw))
+
+	cases := map[string]struct {
+		Conf    *MempoolConfiguration
+		Tx      weave.Tx
+		WantErr *errors.Error
+	}{
+		"no configuration": {
+			Tx: send,
+		},
+		"accepted": {
+			Conf: &MempoolConfiguration{
+				MaxTxSize:     size,
+				MinFeePerByte: coin.NewCoin(0, 500/int64(size), "CSTM"),
+				BlockedPaths:  []string{"custom/create_state"},
+			},
+			Tx: send,
+		},
+		"blocked path": {
+			Conf:    &MempoolConfiguration{BlockedPaths: []string{"cash/send"}},
+			Tx:      send,
+			WantErr: errors.ErrUnauthorized,
+		},
+		"too large": {
+			Conf:    &MempoolConfiguration{MaxTxSize: size - 1},
+			Tx:      send,
+			WantErr: errors.ErrInput,
+		},
+		"fee too low": {
+			Conf:    &MempoolConfiguration{MinFeePerByte: coin.NewCoin(0, 500/int64(size)+1, "CSTM")},
+			Tx:      send,
+			WantErr: errors.ErrAmount,
+		},
+		"fee in another currency": {
+			Conf:    &MempoolConfiguration{MinFeePerByte: coin.NewCoin(0, 1, "ETH")},
+			Tx:      send,
+			WantErr: errors.ErrCurrency,
+		},
+		"no fee": {
+			Conf:    &MempoolConfiguration{MinFeePerByte: coin.NewCoin(0, 1, "CSTM")},
+			Tx:      &Tx{Sum: send.Sum},
+			WantErr: errors.ErrAmount,
+		},
+	}
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			db := store.MemStore()
+			if tc.Conf != nil {
+				assert.Nil(t, gconf.Save(db, MempoolConfPkg, tc.Conf))
+			}
+			admission := NewAdmission(&weavetest.Auth{})
+			handler := &weavetest.Handler{}
+
+			_, err := admission.Check(context.Background(), db, tc.Tx, handler)
+			if tc.WantErr == nil {
+				assert.Nil(t, err)
+			} else if !tc.WantErr.Is(err) {
+				t.Fatalf("want %q error, got %v", tc.WantErr, err)
+			}
+			// Delivered transactions are never rejected.
+			_, err = admission.Deliver(context.Background(), db, tc.Tx, handler)
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestAdmissionPendingPerSender(t *testing.T) {
+	db := store.MemStore()
+	assert.Nil(t, gconf.Save(db, MempoolConfPkg, &MempoolConfiguration{MaxPendingPerSender: 2}))
+
+	auth := &weavetest.CtxAuth{Key: "admission"}
+	aliceCond, bobCond := weavetest.NewCondition(), weavetest.NewCondition()
+	alice := auth.SetConditions(weave.WithHeight(context.Background(), 5), aliceCond)
+	bob := auth.SetConditions(weave.WithHeight(context.Background(), 5), bobCond)
+	tx := &weavetest.Tx{Msg: &weavetest.Msg{RoutePath: "admission/test"}}
+	handler := &weavetest.Handler{}
+	admission := NewAdmission(auth)
+
+	// Failed checks and simulations are not pending.
+	_, err := admission.Check(alice, db, tx, &weavetest.Handler{CheckErr: errors.ErrState})
+	assert.IsErr(t, errors.ErrState, err)
+	_, err = admission.Check(context.WithValue(alice, simulationKey{}, true), db, tx, handler)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err := admission.Check(alice, db, tx, handler)
+		assert.Nil(t, err)
+	}
+	_, err = admission.Check(alice, db, tx, handler)
+	assert.IsErr(t, errors.ErrState, err)
+	_, err = admission.Check(bob, db, tx, handler)
+	assert.Nil(t, err)
+
+	// A committed block includes or rechecks the pending transactions.
+	next := auth.SetConditions(weave.WithHeight(context.Background(), 6), aliceCond)
+	_, err = admission.Check(next, db, tx, handler)
+	assert.Nil(t, err)
+}
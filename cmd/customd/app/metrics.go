@@ -0,0 +1,319 @@
+package customd
+
+import (
+	"bytes"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "customd"
+
+// The collectors of the application metrics. They are updated whether or not
+// they are registered, and served only once RegisterMetrics is called.
+var (
+	txCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "txs_total",
+		Help:      "Number of processed transactions by phase and message path.",
+	}, []string{"phase", "path"})
+	txFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tx_failures_total",
+		Help:      "Number of failed transactions by phase and ABCI error code.",
+	}, []string{"phase", "code"})
+	txGas = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tx_gas_total",
+		Help:      "Gas allocated on check and used on deliver by message path.",
+	}, []string{"phase", "path"})
+	txDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "tx_duration_seconds",
+		Help:      "Time spent processing a transaction by phase and message path.",
+		Buckets:   handlerDurationBuckets,
+	}, []string{"phase", "path"})
+
+	cronTasks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cron_tasks_total",
+		Help:      "Number of executed cron tasks by message path and ABCI error code, zero on success.",
+	}, []string{"path", "code"})
+	cronDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "cron_task_duration_seconds",
+		Help:      "Time spent executing a cron task by message path.",
+		Buckets:   handlerDurationBuckets,
+	}, []string{"path"})
+
+	customStates = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "custom",
+		Name:      "states",
+		Help:      "Number of custom states by bucket.",
+	}, []string{"bucket"})
+	customPendingDeletions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "custom",
+		Name:      "pending_deletions",
+		Help:      "Number of timed states scheduled for deletion.",
+	})
+)
+
+// handlerDurationBuckets range from 50µs to about 3s.
+var handlerDurationBuckets = prometheus.ExponentialBuckets(0.00005, 3, 11)
+
+// gaugesEnabled is set once the metrics are registered. Gauges are expensive
+// to update, so they are not updated unless served.
+var gaugesEnabled int32
+
+// gaugePrefixes are the key prefixes of the state counted by the gauges,
+// mapped to the gauge. Deletions of timed states are the only tasks
+// scheduled.
+var gaugePrefixes = map[string]prometheus.Gauge{
+	"state:":      customStates.WithLabelValues("state"),
+	"timedstate:": customStates.WithLabelValues("timedstate"),
+	"_crontask:":  customPendingDeletions,
+}
+
+// RegisterMetrics registers the application metrics with the registerer.
+func RegisterMetrics(reg prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		txCount, txFailures, txGas, txDuration,
+		cronTasks, cronDuration,
+		customStates, customPendingDeletions,
+	}
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return errors.Wrapf(errors.ErrState, "cannot register metrics: %s", err)
+		}
+	}
+	atomic.StoreInt32(&gaugesEnabled, 1)
+	return nil
+}
+
+// Metrics is a decorator that counts transactions and measures how long
+// they take to process.
+type Metrics struct {
+	cron bool
+}
+
+var _ weave.Decorator = Metrics{}
+
+// NewMetrics creates a Metrics decorator for transactions.
+func NewMetrics() Metrics {
+	return Metrics{}
+}
+
+// NewCronMetrics creates a Metrics decorator for the cron tasks, that are
+// only delivered.
+func NewCronMetrics() Metrics {
+	return Metrics{cron: true}
+}
+
+// Check counts the transaction and the gas it allocates.
+func (m Metrics) Check(ctx weave.Context, store weave.KVStore, tx weave.Tx, next weave.Checker) (*weave.CheckResult, error) {
+	start := time.Now()
+	res, err := next.Check(ctx, store, tx)
+	var gas int64
+	if err == nil {
+		gas = res.GasAllocated
+	}
+	m.observe("check", tx, start, gas, err)
+	return res, err
+}
+
+// Deliver counts the transaction and the gas it uses. The gauges are
+// updated with the keys created and deleted by a successful transaction.
+func (m Metrics) Deliver(ctx weave.Context, store weave.KVStore, tx weave.Tx, next weave.Deliverer) (*weave.DeliverResult, error) {
+	start := time.Now()
+	var counter *countingStore
+	if atomic.LoadInt32(&gaugesEnabled) == 1 && !isSimulation(ctx) {
+		counter = newCountingStore(store)
+		store = counter
+	}
+	res, err := next.Deliver(ctx, store, tx)
+	var gas int64
+	if err == nil {
+		gas = res.GasUsed
+		if counter != nil {
+			counter.apply()
+		}
+	}
+	m.observe("deliver", tx, start, gas, err)
+	return res, err
+}
+
+func (m Metrics) observe(phase string, tx weave.Tx, start time.Time, gas int64, err error) {
+	elapsed := time.Since(start).Seconds()
+	path := "unknown"
+	if msg, merr := tx.GetMsg(); merr == nil && msg != nil {
+		path = msg.Path()
+	}
+	var code uint32
+	if err != nil {
+		code, _ = errors.ABCIInfo(err, false)
+	}
+
+	if m.cron {
+		cronTasks.WithLabelValues(path, strconv.FormatUint(uint64(code), 10)).Inc()
+		cronDuration.WithLabelValues(path).Observe(elapsed)
+		return
+	}
+	txCount.WithLabelValues(phase, path).Inc()
+	txDuration.WithLabelValues(phase, path).Observe(elapsed)
+	if err != nil {
+		txFailures.WithLabelValues(phase, strconv.FormatUint(uint64(code), 10)).Inc()
+	}
+	if gas > 0 {
+		txGas.WithLabelValues(phase, path).Add(float64(gas))
+	}
+}
+
+// metricsTicker updates the pending deletions gauge with the tasks executed
+// by the wrapped ticker. The ticker deletes a task whether or not it
+// succeeds, outside of the deliver of the task.
+type metricsTicker struct {
+	weave.Ticker
+}
+
+func (t metricsTicker) Tick(ctx weave.Context, store weave.CacheableKVStore) weave.TickResult {
+	res := t.Ticker.Tick(ctx, store)
+	if atomic.LoadInt32(&gaugesEnabled) == 0 {
+		return res
+	}
+	for _, tag := range res.Tags {
+		if string(tag.Key) == "cron" {
+			customPendingDeletions.Dec()
+		}
+	}
+	return res
+}
+
+// initGauges sets the gauges to the number of keys in the state. It
+// iterates over all counted keys, so it is called once when the application
+// is created and the gauges are maintained with each transaction afterwards.
+// Errors are not reported, because the gauges are informative only.
+func initGauges(store weave.ReadOnlyKVStore) {
+	if atomic.LoadInt32(&gaugesEnabled) == 0 {
+		return
+	}
+	for prefix, gauge := range gaugePrefixes {
+		if n, err := countKeys(store, prefix); err == nil {
+			gauge.Set(float64(n))
+		}
+	}
+}
+
+// countKeys returns the number of keys with the given prefix.
+func countKeys(store weave.ReadOnlyKVStore, prefix string) (int64, error) {
+	it, err := store.Iterator([]byte(prefix), prefixEnd([]byte(prefix)))
+	if err != nil {
+		return 0, err
+	}
+	defer it.Release()
+	var n int64
+	for {
+		if _, _, err := it.Next(); err != nil {
+			if errors.ErrIteratorDone.Is(err) {
+				return n, nil
+			}
+			return 0, err
+		}
+		n++
+	}
+}
+
+// countingStore records the number of keys with a counted prefix that are
+// created and deleted through it. Writes of cache wraps, used for example by
+// the savepoints, go through its batch, so they are recorded when written.
+type countingStore struct {
+	weave.KVStore
+	deltas map[string]int64
+}
+
+var _ weave.CacheableKVStore = (*countingStore)(nil)
+
+func newCountingStore(store weave.KVStore) *countingStore {
+	return &countingStore{KVStore: store, deltas: make(map[string]int64)}
+}
+
+// record updates the delta of the key prefix, if the key is counted and the
+// write changes its existence.
+func (s *countingStore) record(key []byte, set bool) error {
+	for prefix := range gaugePrefixes {
+		if !bytes.HasPrefix(key, []byte(prefix)) {
+			continue
+		}
+		exists, err := s.KVStore.Has(key)
+		if err != nil {
+			return err
+		}
+		switch {
+		case set && !exists:
+			s.deltas[prefix]++
+		case !set && exists:
+			s.deltas[prefix]--
+		}
+		return nil
+	}
+	return nil
+}
+
+func (s *countingStore) Set(key, value []byte) error {
+	if err := s.record(key, true); err != nil {
+		return err
+	}
+	return s.KVStore.Set(key, value)
+}
+
+func (s *countingStore) Delete(key []byte) error {
+	if err := s.record(key, false); err != nil {
+		return err
+	}
+	return s.KVStore.Delete(key)
+}
+
+func (s *countingStore) NewBatch() weave.Batch {
+	return &countingBatch{Batch: s.KVStore.NewBatch(), store: s}
+}
+
+func (s *countingStore) CacheWrap() weave.KVCacheWrap {
+	return store.NewBTreeCacheWrap(s, s.NewBatch(), nil)
+}
+
+// apply adds the recorded deltas to the gauges.
+func (s *countingStore) apply() {
+	for prefix, n := range s.deltas {
+		if n != 0 {
+			gaugePrefixes[prefix].Add(float64(n))
+		}
+	}
+}
+
+// countingBatch records the writes of the batch in the counting store. A
+// cache wrap writes each key once, so checking the existence of a key when
+// it is added to the batch is accurate.
+type countingBatch struct {
+	weave.Batch
+	store *countingStore
+}
+
+func (b *countingBatch) Set(key, value []byte) error {
+	if err := b.store.record(key, true); err != nil {
+		return err
+	}
+	return b.Batch.Set(key, value)
+}
+
+func (b *countingBatch) Delete(key []byte) error {
+	if err := b.store.record(key, false); err != nil {
+		return err
+	}
+	return b.Batch.Delete(key)
+}
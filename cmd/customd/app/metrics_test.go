@@ -0,0 +1,164 @@
+package customd
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store"
+	"github.com/iov-one/weave/weavetest"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tendermint/tendermint/libs/common"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	db := store.MemStore()
+	ok := &weavetest.Tx{Msg: &weavetest.Msg{RoutePath: "metrics/ok"}}
+	failing := &weavetest.Tx{Msg: &weavetest.Msg{RoutePath: "metrics/failing"}}
+
+	handler := &weavetest.Handler{
+		CheckResult:   weave.CheckResult{GasAllocated: 10},
+		DeliverResult: weave.DeliverResult{GasUsed: 7},
+	}
+	failingHandler := &weavetest.Handler{
+		CheckErr:   errors.ErrUnauthorized,
+		DeliverErr: errors.ErrUnauthorized,
+	}
+	code, _ := errors.ABCIInfo(errors.ErrUnauthorized, false)
+	codeLabel := strconv.FormatUint(uint64(code), 10)
+
+	// Collectors are shared by all applications.
+	for _, c := range []*prometheus.CounterVec{txCount, txFailures, txGas, cronTasks} {
+		c.Reset()
+	}
+
+	m := NewMetrics()
+	for i := 0; i < 3; i++ {
+		_, err := m.Check(ctx, db, ok, handler)
+		assert.Nil(t, err)
+	}
+	_, err := m.Deliver(ctx, db, ok, handler)
+	assert.Nil(t, err)
+	_, err = m.Deliver(ctx, db, failing, failingHandler)
+	assert.IsErr(t, errors.ErrUnauthorized, err)
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(txCount.WithLabelValues("check", "metrics/ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(txCount.WithLabelValues("deliver", "metrics/ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(txCount.WithLabelValues("deliver", "metrics/failing")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(txFailures.WithLabelValues("deliver", codeLabel)))
+	assert.Equal(t, 30.0, testutil.ToFloat64(txGas.WithLabelValues("check", "metrics/ok")))
+	assert.Equal(t, 7.0, testutil.ToFloat64(txGas.WithLabelValues("deliver", "metrics/ok")))
+
+	// Cron tasks are counted separately.
+	cron := NewCronMetrics()
+	_, err = cron.Deliver(ctx, db, ok, handler)
+	assert.Nil(t, err)
+	_, err = cron.Deliver(ctx, db, failing, failingHandler)
+	assert.IsErr(t, errors.ErrUnauthorized, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(cronTasks.WithLabelValues("metrics/ok", "0")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(cronTasks.WithLabelValues("metrics/failing", codeLabel)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(txCount.WithLabelValues("deliver", "metrics/ok")))
+}
+
+func TestMetricsGauges(t *testing.T) {
+	assert.Nil(t, RegisterMetrics(prometheus.NewRegistry()))
+	gauge := func(bucket string) float64 {
+		return testutil.ToFloat64(customStates.WithLabelValues(bucket))
+	}
+
+	db := store.MemStore()
+	for _, key := range []string{"state:1", "state:2", "timedstate:1", "_crontask:runat:1", "cash:1"} {
+		assert.Nil(t, db.Set([]byte(key), []byte{1}))
+	}
+	initGauges(db)
+	assert.Equal(t, 2.0, gauge("state"))
+	assert.Equal(t, 1.0, gauge("timedstate"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(customPendingDeletions))
+
+	ctx := context.Background()
+	tx := &weavetest.Tx{Msg: &weavetest.Msg{RoutePath: "metrics/gauges"}}
+
+	// Keys written directly and through a cache wrap are counted. An
+	// overwritten key is not counted again.
+	h := &writingHandler{set: []string{"state:2", "state:3", "timedstate:2", "cash:2"}, del: []string{"timedstate:1", "state:4"}}
+	_, err := NewMetrics().Deliver(ctx, db, tx, h)
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, gauge("state"))
+	assert.Equal(t, 1.0, gauge("timedstate"))
+	cached := &writingHandler{set: []string{"state:4"}, del: []string{"state:1"}, cache: true}
+	_, err = NewCronMetrics().Deliver(ctx, db, tx, cached)
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, gauge("state"))
+	cached.set, cached.del = []string{"state:5"}, nil
+	_, err = NewMetrics().Deliver(ctx, db, tx, cached)
+	assert.Nil(t, err)
+	assert.Equal(t, 4.0, gauge("state"))
+
+	// Failed and simulated transactions are not counted.
+	failing := &writingHandler{set: []string{"state:6"}, cache: true, err: errors.ErrUnauthorized}
+	_, err = NewMetrics().Deliver(ctx, db, tx, failing)
+	assert.IsErr(t, errors.ErrUnauthorized, err)
+	simulated := &writingHandler{set: []string{"state:7"}, cache: true}
+	_, err = NewMetrics().Deliver(context.WithValue(ctx, simulationKey{}, true), db, tx, simulated)
+	assert.Nil(t, err)
+	assert.Equal(t, 4.0, gauge("state"))
+
+	// Each executed task is deleted by the ticker.
+	ticker := metricsTicker{Ticker: tickerFunc(func() weave.TickResult {
+		return weave.TickResult{Tags: []common.KVPair{{Key: []byte("cron"), Value: []byte("_crontask:runat:1")}}}
+	})}
+	ticker.Tick(ctx, db)
+	assert.Equal(t, 0.0, testutil.ToFloat64(customPendingDeletions))
+}
+
+// writingHandler sets and deletes the keys on deliver, directly or through
+// a cache wrap like a savepoint does.
+type writingHandler struct {
+	set   []string
+	del   []string
+	cache bool
+	err   error
+}
+
+func (h *writingHandler) Check(weave.Context, weave.KVStore, weave.Tx) (*weave.CheckResult, error) {
+	return &weave.CheckResult{}, nil
+}
+
+func (h *writingHandler) Deliver(ctx weave.Context, db weave.KVStore, tx weave.Tx) (*weave.DeliverResult, error) {
+	kv := db
+	var cache weave.KVCacheWrap
+	if h.cache {
+		cache = db.(weave.CacheableKVStore).CacheWrap()
+		kv = cache
+	}
+	for _, key := range h.set {
+		if err := kv.Set([]byte(key), []byte{1}); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range h.del {
+		if err := kv.Delete([]byte(key)); err != nil {
+			return nil, err
+		}
+	}
+	if h.err != nil {
+		return nil, h.err
+	}
+	if cache != nil {
+		if err := cache.Write(); err != nil {
+			return nil, err
+		}
+	}
+	return &weave.DeliverResult{}, nil
+}
+
+type tickerFunc func() weave.TickResult
+
+func (f tickerFunc) Tick(weave.Context, weave.CacheableKVStore) weave.TickResult {
+	return f()
+}
@@ -0,0 +1,96 @@
+package customd
+
+import (
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/app"
+	"github.com/iov-one/weave/errors"
+	tmiavl "github.com/tendermint/iavl"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/crypto/merkle"
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+// ProvePath is the only query path that supports proofs. Queries on it
+// return a single model stored under the raw database key.
+const ProvePath = "/"
+
+// ProvingApp extends an application with Merkle proofs for raw key queries.
+//
+// Weave queries ignore the Prove flag, as most query paths return results of
+// index or prefix scans that cannot be proven with a single IAVL proof.
+// ProvingApp answers queries on ProvePath that request a proof directly from
+// the IAVL tree, so that a light client can verify the returned value (or
+// its absence) against the app hash of a signed header. All other queries
+// are passed to the historical application unchanged.
+type ProvingApp struct {
+	HistoricalApp
+	// db is the database of the tree, if it is closed by the
+	// application.
+	db dbm.DB
+}
+
+var _ abci.Application = ProvingApp{}
+
+// NewProvingApp returns an application that proves queries using the tree
+// of the historical application.
+func NewProvingApp(base HistoricalApp) ProvingApp {
+	return ProvingApp{HistoricalApp: base}
+}
+
+// Close closes the database of the application state. Committed versions
+// are already persisted, so only the changes of an unfinished block are
+// lost.
+func (a ProvingApp) Close() error {
+	if a.db != nil {
+		a.db.Close()
+	}
+	return nil
+}
+
+// Query implements abci.Application. Proofs are generated for the requested
+// height or, if not set, for the latest committed version. The store keeps
+// only a limited number of recent versions, so older heights cannot be
+// proven.
+func (a ProvingApp) Query(req abci.RequestQuery) abci.ResponseQuery {
+	if !req.Prove {
+		return a.HistoricalApp.Query(req)
+	}
+	if req.Path != ProvePath {
+		return queryError(errors.Wrapf(errors.ErrInput, "proofs are only supported for %q path", ProvePath))
+	}
+	if len(req.Data) == 0 {
+		return queryError(errors.Wrap(errors.ErrEmpty, "key"))
+	}
+
+	version := req.Height
+	if version == 0 {
+		version = a.tree.Version()
+	}
+	value, proof, err := a.tree.GetVersionedWithProof(req.Data, version)
+	if err != nil {
+		return queryError(errors.Wrapf(errors.ErrNotFound, "cannot prove version %d: %s", version, err))
+	}
+
+	var models []weave.Model
+	var op merkle.ProofOp
+	if value != nil {
+		models = []weave.Model{{Key: req.Data, Value: value}}
+		op = tmiavl.NewIAVLValueOp(req.Data, proof).ProofOp()
+	} else {
+		op = tmiavl.NewIAVLAbsenceOp(req.Data, proof).ProofOp()
+	}
+
+	res := abci.ResponseQuery{
+		Height: version,
+		Proof:  &merkle.Proof{Ops: []merkle.ProofOp{op}},
+	}
+	res.Key, err = app.ResultsFromKeys(models).Marshal()
+	if err != nil {
+		return queryError(err)
+	}
+	res.Value, err = app.ResultsFromValues(models).Marshal()
+	if err != nil {
+		return queryError(err)
+	}
+	return res
+}
@@ -0,0 +1,147 @@
+package customd
+
+import (
+	"encoding/binary"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+)
+
+const (
+	// RangeQueryPath is the path of the query handler that returns a
+	// limited number of models stored within a key range. Unlike bucket
+	// prefix queries, it allows to iterate through large collections in
+	// pages.
+	RangeQueryPath = "/range"
+
+	// DefaultRangeQueryLimit is used when no limit is provided.
+	DefaultRangeQueryLimit = 100
+	// MaxRangeQueryLimit is the maximum number of models returned by a
+	// single range query.
+	MaxRangeQueryLimit = 1000
+)
+
+// RangeQuery describes a single page request of the range query. Keys are
+// full database keys, including the bucket prefix.
+type RangeQuery struct {
+	// Start is the first key of the range (inclusive).
+	Start []byte
+	// End is the end key of the range (exclusive). No end means that
+	// the range is not limited.
+	End []byte
+	// Limit is the maximum number of models returned. When zero,
+	// DefaultRangeQueryLimit is used.
+	Limit uint32
+}
+
+// NewPrefixRangeQuery returns a range query that covers all keys with given
+// prefix, starting from the start key. Start key is ignored if it does not
+// belong to the prefix range.
+func NewPrefixRangeQuery(prefix, start []byte, limit uint32) RangeQuery {
+	q := RangeQuery{Start: prefix, End: prefixEnd(prefix), Limit: limit}
+	if len(start) != 0 && string(start) > string(prefix) && (q.End == nil || string(start) < string(q.End)) {
+		q.Start = start
+	}
+	return q
+}
+
+// prefixEnd returns the smallest key that is greater than all keys with
+// given prefix. Nil is returned if such key does not exist.
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// Marshal serializes range query. Serialized format is:
+//
+//	limit (4 bytes) | start length (4 bytes) | start | end
+func (q RangeQuery) Marshal() []byte {
+	raw := make([]byte, 8, 8+len(q.Start)+len(q.End))
+	binary.BigEndian.PutUint32(raw[:4], q.Limit)
+	binary.BigEndian.PutUint32(raw[4:8], uint32(len(q.Start)))
+	raw = append(raw, q.Start...)
+	return append(raw, q.End...)
+}
+
+// Unmarshal deserializes range query created using Marshal method.
+func (q *RangeQuery) Unmarshal(raw []byte) error {
+	if len(raw) < 8 {
+		return errors.Wrap(errors.ErrInput, "range query too short")
+	}
+	startLen := binary.BigEndian.Uint32(raw[4:8])
+	if uint64(len(raw)-8) < uint64(startLen) {
+		return errors.Wrap(errors.ErrInput, "invalid start key length")
+	}
+	q.Limit = binary.BigEndian.Uint32(raw[:4])
+	q.Start = raw[8 : 8+startLen]
+	q.End = raw[8+startLen:]
+	if len(q.End) == 0 {
+		q.End = nil
+	}
+	return nil
+}
+
+// Validate returns an error if the range query is not valid.
+func (q RangeQuery) Validate() error {
+	if q.Limit > MaxRangeQueryLimit {
+		return errors.Wrapf(errors.ErrInput, "limit must not be greater than %d", MaxRangeQueryLimit)
+	}
+	if q.End != nil && string(q.Start) >= string(q.End) {
+		return errors.Wrap(errors.ErrInput, "start key must be before the end key")
+	}
+	return nil
+}
+
+// RegisterRangeQuery registers the range query handler.
+func RegisterRangeQuery(qr weave.QueryRouter) {
+	qr.Register(RangeQueryPath, rangeQueryHandler{})
+}
+
+type rangeQueryHandler struct{}
+
+var _ weave.QueryHandler = rangeQueryHandler{}
+
+// Query returns models within the requested range. Models are not decoded,
+// each value is returned as it is stored in the database.
+func (rangeQueryHandler) Query(db weave.ReadOnlyKVStore, mod string, data []byte) ([]weave.Model, error) {
+	if mod != weave.KeyQueryMod {
+		return nil, errors.Wrapf(errors.ErrInput, "unsupported query modifier %q", mod)
+	}
+	var q RangeQuery
+	if err := q.Unmarshal(data); err != nil {
+		return nil, errors.Wrap(err, "cannot unmarshal range query")
+	}
+	if err := q.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid range query")
+	}
+	limit := int(q.Limit)
+	if limit == 0 {
+		limit = DefaultRangeQueryLimit
+	}
+
+	it, err := db.Iterator(q.Start, q.End)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create iterator")
+	}
+	defer it.Release()
+
+	var models []weave.Model
+	for len(models) < limit {
+		key, value, err := it.Next()
+		if err != nil {
+			if errors.ErrIteratorDone.Is(err) {
+				break
+			}
+			return nil, errors.Wrap(err, "iterator")
+		}
+		models = append(models, weave.Pair(key, value))
+	}
+	return models, nil
+}
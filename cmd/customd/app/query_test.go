@@ -0,0 +1,101 @@
+package customd
+
+import (
+	"testing"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store"
+	"github.com/iov-one/weave/weavetest/assert"
+)
+
+func TestRangeQueryMarshal(t *testing.T) {
+	cases := map[string]RangeQuery{
+		"empty":       {},
+		"start only":  {Start: []byte("cash:"), Limit: 10},
+		"start, end":  {Start: []byte("cash:"), End: []byte("cash;"), Limit: 1},
+		"binary keys": {Start: []byte{0, 0, 0, 0}, End: []byte{0xff}},
+	}
+	for testName, q := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var got RangeQuery
+			assert.Nil(t, got.Unmarshal(q.Marshal()))
+			assert.Equal(t, q.Limit, got.Limit)
+			assert.Equal(t, string(q.Start), string(got.Start))
+			assert.Equal(t, q.End, got.End)
+		})
+	}
+
+	var q RangeQuery
+	assert.IsErr(t, errors.ErrInput, q.Unmarshal([]byte{0, 0, 0, 1}))
+	assert.IsErr(t, errors.ErrInput, q.Unmarshal([]byte{0, 0, 0, 1, 0, 0, 0, 3, 'a'}))
+}
+
+func TestPrefixEnd(t *testing.T) {
+	assert.Equal(t, []byte("cash;"), prefixEnd([]byte("cash:")))
+	assert.Equal(t, []byte{1}, prefixEnd([]byte{0, 0xff}))
+	assert.Nil(t, prefixEnd([]byte{0xff, 0xff}))
+	assert.Nil(t, prefixEnd(nil))
+}
+
+func TestRangeQueryHandler(t *testing.T) {
+	db := store.MemStore()
+	for _, k := range []string{"a:1", "b:1", "b:2", "b:3", "b:4", "c:1"} {
+		assert.Nil(t, db.Set([]byte(k), []byte("value "+k)))
+	}
+
+	cases := map[string]struct {
+		Mod      string
+		Query    RangeQuery
+		WantKeys []string
+		WantErr  *errors.Error
+	}{
+		"whole prefix": {
+			Query:    NewPrefixRangeQuery([]byte("b:"), nil, 0),
+			WantKeys: []string{"b:1", "b:2", "b:3", "b:4"},
+		},
+		"limited": {
+			Query:    NewPrefixRangeQuery([]byte("b:"), nil, 2),
+			WantKeys: []string{"b:1", "b:2"},
+		},
+		"from cursor": {
+			Query:    NewPrefixRangeQuery([]byte("b:"), []byte("b:2\x00"), 2),
+			WantKeys: []string{"b:3", "b:4"},
+		},
+		"cursor outside of the prefix is ignored": {
+			Query:    NewPrefixRangeQuery([]byte("b:"), []byte("c:1"), 1),
+			WantKeys: []string{"b:1"},
+		},
+		"no prefix": {
+			Query:    NewPrefixRangeQuery(nil, []byte("b:4"), 0),
+			WantKeys: []string{"b:4", "c:1"},
+		},
+		"limit too high": {
+			Query:   RangeQuery{Limit: MaxRangeQueryLimit + 1},
+			WantErr: errors.ErrInput,
+		},
+		"invalid range": {
+			Query:   RangeQuery{Start: []byte("b"), End: []byte("a")},
+			WantErr: errors.ErrInput,
+		},
+		"modifier not supported": {
+			Mod:     weave.PrefixQueryMod,
+			WantErr: errors.ErrInput,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			models, err := rangeQueryHandler{}.Query(db, tc.Mod, tc.Query.Marshal())
+			if !tc.WantErr.Is(err) {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+			var keys []string
+			for _, m := range models {
+				keys = append(keys, string(m.Key))
+				assert.Equal(t, "value "+string(m.Key), string(m.Value))
+			}
+			assert.Equal(t, tc.WantKeys, keys)
+		})
+	}
+}
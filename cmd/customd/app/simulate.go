@@ -0,0 +1,125 @@
+package customd
+
+import (
+	"context"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+)
+
+const (
+	// SimulatePath is the path of the query handler that executes a
+	// transaction against the latest committed state without persisting
+	// any change. Query data must be a serialized transaction.
+	SimulatePath = "/simulate"
+
+	// SimulateResultKey is the key of the model holding the serialized
+	// abci.ResponseDeliverTx of a successful simulation.
+	SimulateResultKey = "result"
+	// SimulateFeeKey is the key of the model holding the serialized
+	// coin.Coin that must be paid for the transaction to be processed.
+	SimulateFeeKey = "required_fee"
+)
+
+// BlockContexter is implemented by the application store. It provides the
+// context of the latest processed block.
+type BlockContexter interface {
+	BlockContext() weave.Context
+}
+
+// RegisterSimulateQuery registers the simulation query handler. Unlike other
+// query handlers, simulation needs access to the application handler and
+// therefore it is registered by the Application function.
+func RegisterSimulateQuery(qr weave.QueryRouter, h weave.Handler, decoder weave.TxDecoder, blocks BlockContexter) {
+	qr.Register(SimulatePath, &simulateQueryHandler{
+		handler: h,
+		decoder: decoder,
+		blocks:  blocks,
+	})
+}
+
+type simulateQueryHandler struct {
+	handler weave.Handler
+	decoder weave.TxDecoder
+	blocks  BlockContexter
+}
+
+var _ weave.QueryHandler = (*simulateQueryHandler)(nil)
+
+// Query executes the transaction provided as the query data. The transaction
+// is first checked and then delivered, as it would be when included in a
+// block. Each phase is using its own cache of the queried store that is
+// discarded afterwards. A transaction failure is returned as the query error.
+//
+// A transaction is executed in the context of the latest processed block.
+func (h *simulateQueryHandler) Query(db weave.ReadOnlyKVStore, mod string, data []byte) ([]weave.Model, error) {
+	if mod != weave.KeyQueryMod {
+		return nil, errors.Wrapf(errors.ErrInput, "unsupported query modifier %q", mod)
+	}
+	// Query store is a cache of the committed state. It is never
+	// written, so it is safe to use it as a base for any modifications.
+	kv, ok := db.(weave.CacheableKVStore)
+	if !ok {
+		return nil, errors.Wrapf(errors.ErrDatabase, "cannot write to %T store", db)
+	}
+	tx, err := h.decode(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode transaction")
+	}
+
+	ctx := h.blocks.BlockContext()
+	if ctx == nil {
+		return nil, errors.Wrap(errors.ErrState, "no block context")
+	}
+	ctx = weave.WithLogInfo(ctx, "call", "simulate", "path", weave.GetPath(tx))
+	ctx = context.WithValue(ctx, simulationKey{}, true)
+
+	checkStore := kv.CacheWrap()
+	defer checkStore.Discard()
+	check, err := h.handler.Check(ctx, checkStore, tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "check")
+	}
+
+	deliverStore := kv.CacheWrap()
+	defer deliverStore.Discard()
+	deliver, err := h.handler.Deliver(ctx, deliverStore, tx)
+	if err != nil {
+		return nil, errors.Wrap(err, "deliver")
+	}
+
+	res := deliver.ToABCI()
+	res.GasWanted = check.GasAllocated
+	rawRes, err := res.Marshal()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal result")
+	}
+	fee := check.RequiredFee
+	if fee.IsZero() {
+		fee = deliver.RequiredFee
+	}
+	rawFee, err := fee.Marshal()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal fee")
+	}
+	return []weave.Model{
+		weave.Pair([]byte(SimulateResultKey), rawRes),
+		weave.Pair([]byte(SimulateFeeKey), rawFee),
+	}, nil
+}
+
+// decode calls the decoder and captures any panics.
+func (h *simulateQueryHandler) decode(raw []byte) (tx weave.Tx, err error) {
+	defer errors.Recover(&err)
+	return h.decoder(raw)
+}
+
+// simulationKey is the context key marking a simulated transaction.
+type simulationKey struct{}
+
+// isSimulation returns true if the transaction of the context is simulated,
+// and therefore never included in the mempool or a block.
+func isSimulation(ctx weave.Context) bool {
+	simulated, _ := ctx.Value(simulationKey{}).(bool)
+	return simulated
+}
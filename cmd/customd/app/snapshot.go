@@ -0,0 +1,368 @@
+package customd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store/iavl"
+	tmiavl "github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+// A snapshot holds the state of the application at a single height. It
+// contains the IAVL nodes of that version, so that a store restored from it
+// has the same app hash as the one it was exported from. Nodes are written
+// parent first, each with its hash, and verified on restore.
+//
+// The app hash depends on the version of each node, which the public IAVL
+// API does not preserve: a tree rebuilt with Set and SaveVersion has a
+// different hash. Nodes are therefore copied in the database format of the
+// IAVL release the application is built with. That format is recorded in
+// the snapshot and both export and restore refuse to work with any other.
+//
+// The snapshot is gzip compressed and starts with snapshotMagic, followed by
+// the format, the height and the root hash. Each node is written as its hash
+// followed by its IAVL encoding, and an empty hash ends the snapshot.
+// Numbers are varints and byte slices are prefixed with their uvarint
+// length.
+const snapshotMagic = "CSTMSNP2"
+
+const (
+	// snapshotFormat is the IAVL database format of the snapshot nodes.
+	// It must be changed together with the IAVL dependency.
+	snapshotFormat = "iavl-0.12"
+	// snapshotIAVLRelease is the prefix of the IAVL releases that store
+	// nodes in snapshotFormat.
+	snapshotIAVLRelease = "0.12."
+
+	// IAVL database key prefixes of nodes and version roots in
+	// snapshotFormat.
+	snapshotNodePrefix = 'n'
+	snapshotRootPrefix = 'r'
+
+	// maxSnapshotField limits the size of a single value read from a
+	// snapshot.
+	maxSnapshotField = 64 << 20
+
+	// snapshotBatchSize is the number of nodes written to the database
+	// at once.
+	snapshotBatchSize = 10000
+)
+
+// SnapshotInfo describes the state stored in a snapshot.
+type SnapshotInfo struct {
+	Height int64
+	// Hash is the app hash of the state.
+	Hash []byte
+	// Nodes is the number of IAVL nodes in the snapshot.
+	Nodes int64
+}
+
+// ExportSnapshot writes the state stored in the database at the given
+// height. Zero height exports the latest version. Only the versions kept by
+// the pruning options can be exported.
+func ExportSnapshot(db dbm.DB, height int64, w io.Writer) (*SnapshotInfo, error) {
+	if err := checkSnapshotFormat(); err != nil {
+		return nil, err
+	}
+	if height < 0 {
+		return nil, errors.Wrap(errors.ErrInput, "height cannot be negative")
+	}
+	if height == 0 {
+		height = latestSnapshotVersion(db)
+		if height == 0 {
+			return nil, errors.Wrap(errors.ErrEmpty, "database has no versions")
+		}
+	}
+	root := db.Get(snapshotRootKey(height))
+	if root == nil {
+		return nil, errors.Wrapf(errors.ErrNotFound, "version %d is not stored", height)
+	}
+
+	gz := gzip.NewWriter(w)
+	var buf bytes.Buffer
+	buf.WriteString(snapshotMagic)
+	writeSnapshotBytes(&buf, []byte(snapshotFormat))
+	writeSnapshotVarint(&buf, height)
+	writeSnapshotBytes(&buf, root)
+
+	info := &SnapshotInfo{Height: height, Hash: root}
+	var pending [][]byte
+	if len(root) != 0 {
+		pending = append(pending, root)
+	}
+	for len(pending) != 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		raw := db.Get(snapshotNodeKey(hash))
+		if raw == nil {
+			return nil, errors.Wrapf(errors.ErrDatabase, "missing node %X", hash)
+		}
+		node, err := decodeSnapshotNode(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "node %X", hash)
+		}
+		// Right is pushed first, so that the left subtree is
+		// written first.
+		if !node.isLeaf() {
+			pending = append(pending, node.right, node.left)
+		}
+
+		writeSnapshotBytes(&buf, hash)
+		writeSnapshotBytes(&buf, raw)
+		info.Nodes++
+		if buf.Len() > 1<<20 {
+			if _, err := gz.Write(buf.Bytes()); err != nil {
+				return nil, errors.Wrapf(errors.ErrInput, "cannot write snapshot: %s", err)
+			}
+			buf.Reset()
+		}
+	}
+	writeSnapshotBytes(&buf, nil)
+
+	if _, err := gz.Write(buf.Bytes()); err != nil {
+		return nil, errors.Wrapf(errors.ErrInput, "cannot write snapshot: %s", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, errors.Wrapf(errors.ErrInput, "cannot write snapshot: %s", err)
+	}
+	return info, nil
+}
+
+// RestoreSnapshot writes the state stored in a snapshot into an empty
+// database. Each node is verified against its hash, and the restored tree
+// against the app hash of the snapshot.
+//
+// The version root is written last, so that a database of a failed
+// restore holds no version. It should be removed.
+func RestoreSnapshot(db dbm.DB, r io.Reader) (*SnapshotInfo, error) {
+	if err := checkSnapshotFormat(); err != nil {
+		return nil, err
+	}
+	it := db.Iterator(nil, nil)
+	empty := !it.Valid()
+	it.Close()
+	if !empty {
+		return nil, errors.Wrap(errors.ErrState, "database is not empty")
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrapf(errors.ErrInput, "cannot read snapshot: %s", err)
+	}
+	defer gz.Close()
+	br := bufio.NewReader(gz)
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapshotMagic {
+		return nil, errors.Wrap(errors.ErrInput, "not a snapshot")
+	}
+	format, err := readSnapshotBytes(br)
+	if err != nil {
+		return nil, errors.Wrap(err, "format")
+	}
+	if string(format) != snapshotFormat {
+		return nil, errors.Wrapf(errors.ErrInput, "unsupported snapshot format %q, want %q", format, snapshotFormat)
+	}
+	height, err := binary.ReadVarint(br)
+	if err != nil || height <= 0 {
+		return nil, errors.Wrap(errors.ErrInput, "invalid height")
+	}
+	root, err := readSnapshotBytes(br)
+	if err != nil {
+		return nil, errors.Wrap(err, "root hash")
+	}
+
+	info := &SnapshotInfo{Height: height, Hash: root}
+	expected := make(map[string]bool)
+	if len(root) != 0 {
+		expected[string(root)] = true
+	}
+	batch := db.NewBatch()
+	for {
+		hash, err := readSnapshotBytes(br)
+		if err != nil {
+			return nil, errors.Wrap(err, "node hash")
+		}
+		if len(hash) == 0 {
+			break
+		}
+		if !expected[string(hash)] {
+			return nil, errors.Wrapf(errors.ErrInput, "unexpected node %X", hash)
+		}
+		delete(expected, string(hash))
+
+		raw, err := readSnapshotBytes(br)
+		if err != nil {
+			return nil, errors.Wrapf(err, "node %X", hash)
+		}
+		node, err := decodeSnapshotNode(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "node %X", hash)
+		}
+		if !bytes.Equal(node.hash(), hash) {
+			return nil, errors.Wrapf(errors.ErrInput, "node %X does not match its hash", hash)
+		}
+		if !node.isLeaf() {
+			expected[string(node.left)] = true
+			expected[string(node.right)] = true
+		}
+
+		batch.Set(snapshotNodeKey(hash), raw)
+		info.Nodes++
+		if info.Nodes%snapshotBatchSize == 0 {
+			batch.Write()
+			batch = db.NewBatch()
+		}
+	}
+	if len(expected) != 0 {
+		return nil, errors.Wrapf(errors.ErrInput, "%d nodes missing", len(expected))
+	}
+	batch.Set(snapshotRootKey(height), root)
+	batch.WriteSync()
+
+	tree := tmiavl.NewMutableTree(db, iavl.DefaultCacheSize)
+	version, err := tree.Load()
+	if err != nil {
+		return nil, errors.Wrapf(errors.ErrDatabase, "cannot load restored tree: %s", err)
+	}
+	if version != height || !bytes.Equal(tree.Hash(), root) {
+		return nil, errors.Wrapf(errors.ErrDatabase, "restored version %d with hash %X", version, tree.Hash())
+	}
+	return info, nil
+}
+
+// checkSnapshotFormat returns an error if the application is built with an
+// IAVL release that does not store nodes in snapshotFormat.
+func checkSnapshotFormat() error {
+	if !strings.HasPrefix(tmiavl.Version, snapshotIAVLRelease) {
+		return errors.Wrapf(errors.ErrState, "snapshots of IAVL %s are not supported, only %s", tmiavl.Version, snapshotFormat)
+	}
+	return nil
+}
+
+// latestSnapshotVersion returns the latest version stored in the database,
+// or zero.
+func latestSnapshotVersion(db dbm.DB) int64 {
+	it := dbm.IteratePrefix(db, []byte{snapshotRootPrefix})
+	defer it.Close()
+	var version int64
+	for ; it.Valid(); it.Next() {
+		version = int64(binary.BigEndian.Uint64(it.Key()[1:]))
+	}
+	return version
+}
+
+func snapshotRootKey(version int64) []byte {
+	key := make([]byte, 9)
+	key[0] = snapshotRootPrefix
+	binary.BigEndian.PutUint64(key[1:], uint64(version))
+	return key
+}
+
+func snapshotNodeKey(hash []byte) []byte {
+	return append([]byte{snapshotNodePrefix}, hash...)
+}
+
+// snapshotNode is an IAVL node, decoded from its database encoding.
+type snapshotNode struct {
+	height  int64
+	size    int64
+	version int64
+	key     []byte
+	value   []byte
+	left    []byte
+	right   []byte
+}
+
+func (n *snapshotNode) isLeaf() bool {
+	return n.height == 0
+}
+
+// hash computes the hash of the node the way IAVL does.
+func (n *snapshotNode) hash() []byte {
+	var buf bytes.Buffer
+	writeSnapshotVarint(&buf, n.height)
+	writeSnapshotVarint(&buf, n.size)
+	writeSnapshotVarint(&buf, n.version)
+	if n.isLeaf() {
+		writeSnapshotBytes(&buf, n.key)
+		writeSnapshotBytes(&buf, tmhash.Sum(n.value))
+	} else {
+		writeSnapshotBytes(&buf, n.left)
+		writeSnapshotBytes(&buf, n.right)
+	}
+	return tmhash.Sum(buf.Bytes())
+}
+
+func decodeSnapshotNode(raw []byte) (*snapshotNode, error) {
+	r := bytes.NewReader(raw)
+	var (
+		n   snapshotNode
+		err error
+	)
+	if n.height, err = binary.ReadVarint(r); err != nil {
+		return nil, errors.Wrap(errors.ErrInput, "invalid node height")
+	}
+	if n.size, err = binary.ReadVarint(r); err != nil {
+		return nil, errors.Wrap(errors.ErrInput, "invalid node size")
+	}
+	if n.version, err = binary.ReadVarint(r); err != nil {
+		return nil, errors.Wrap(errors.ErrInput, "invalid node version")
+	}
+	if n.key, err = readSnapshotBytes(r); err != nil {
+		return nil, errors.Wrap(err, "node key")
+	}
+	if n.isLeaf() {
+		if n.value, err = readSnapshotBytes(r); err != nil {
+			return nil, errors.Wrap(err, "node value")
+		}
+		return &n, nil
+	}
+	if n.left, err = readSnapshotBytes(r); err != nil || len(n.left) != tmhash.Size {
+		return nil, errors.Wrap(errors.ErrInput, "invalid left node hash")
+	}
+	if n.right, err = readSnapshotBytes(r); err != nil || len(n.right) != tmhash.Size {
+		return nil, errors.Wrap(errors.ErrInput, "invalid right node hash")
+	}
+	return &n, nil
+}
+
+func writeSnapshotVarint(buf *bytes.Buffer, v int64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func writeSnapshotBytes(buf *bytes.Buffer, data []byte) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], uint64(len(data)))])
+	buf.Write(data)
+}
+
+// snapshotReader is a reader of snapshot fields.
+type snapshotReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func readSnapshotBytes(r snapshotReader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInput, "invalid length")
+	}
+	if size > maxSnapshotField {
+		return nil, errors.Wrapf(errors.ErrInput, "length %d too big", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errors.Wrap(errors.ErrInput, "unexpected end of snapshot")
+	}
+	return data, nil
+}
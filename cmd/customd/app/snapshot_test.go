@@ -0,0 +1,191 @@
+package customd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store/iavl"
+	"github.com/iov-one/weave/weavetest/assert"
+	tmiavl "github.com/tendermint/iavl"
+	abci "github.com/tendermint/tendermint/abci/types"
+	dbm "github.com/tendermint/tendermint/libs/db"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	db := dbm.NewMemDB()
+	store := NewCommitStore(tmiavl.NewMutableTree(db, iavl.DefaultCacheSize), PruningOptions{KeepRecent: 5})
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		writeRandom(t, rnd, store)
+	}
+
+	// Pruned versions cannot be exported.
+	_, err := ExportSnapshot(db, 10, ioutil.Discard)
+	assert.IsErr(t, errors.ErrNotFound, err)
+
+	for _, height := range []int64{0, 17} {
+		t.Run(fmt.Sprintf("height %d", height), func(t *testing.T) {
+			var snapshot bytes.Buffer
+			info, err := ExportSnapshot(db, height, &snapshot)
+			assert.Nil(t, err)
+			if height == 0 {
+				assert.Equal(t, int64(20), info.Height)
+			}
+
+			restoredDB := dbm.NewMemDB()
+			restoredInfo, err := RestoreSnapshot(restoredDB, bytes.NewReader(snapshot.Bytes()))
+			assert.Nil(t, err)
+			assert.Equal(t, info, restoredInfo)
+
+			// Both stores continue from the snapshot height with
+			// the same app hashes.
+			source := dbm.NewMemDB()
+			_, err = RestoreSnapshot(source, bytes.NewReader(snapshot.Bytes()))
+			assert.Nil(t, err)
+			stores := []CommitStore{
+				NewCommitStore(loadTree(t, source), PruningOptions{}),
+				NewCommitStore(loadTree(t, restoredDB), PruningOptions{KeepRecent: 1}),
+			}
+			for _, s := range stores {
+				id, err := s.LatestVersion()
+				assert.Nil(t, err)
+				assert.Equal(t, info.Height, id.Version)
+				assert.Equal(t, info.Hash, id.Hash)
+			}
+			for i := 0; i < 5; i++ {
+				seed := rnd.Int63()
+				first := writeRandom(t, rand.New(rand.NewSource(seed)), stores[0])
+				second := writeRandom(t, rand.New(rand.NewSource(seed)), stores[1])
+				assert.Equal(t, first, second)
+				assert.Equal(t, info.Height+int64(i)+1, second.Version)
+			}
+
+			// A snapshot is restored only into an empty database.
+			_, err = RestoreSnapshot(restoredDB, bytes.NewReader(snapshot.Bytes()))
+			assert.IsErr(t, errors.ErrState, err)
+		})
+	}
+}
+
+func TestSnapshotCorrupted(t *testing.T) {
+	db := dbm.NewMemDB()
+	store := NewCommitStore(tmiavl.NewMutableTree(db, iavl.DefaultCacheSize), DefaultPruningOptions())
+	rnd := rand.New(rand.NewSource(2))
+	for i := 0; i < 3; i++ {
+		writeRandom(t, rnd, store)
+	}
+	var snapshot bytes.Buffer
+	_, err := ExportSnapshot(db, 0, &snapshot)
+	assert.Nil(t, err)
+	gz, err := gzip.NewReader(&snapshot)
+	assert.Nil(t, err)
+	raw, err := ioutil.ReadAll(gz)
+	assert.Nil(t, err)
+
+	cases := map[string][]byte{
+		"truncated":      raw[:len(raw)/2],
+		"not a snapshot": append([]byte("SNAPSHOT"), raw[len(snapshotMagic):]...),
+		"unknown format": func() []byte {
+			rest := raw[len(snapshotMagic)+1+len(snapshotFormat):]
+			modified := append([]byte(snapshotMagic), byte(len("iavl-0.13")))
+			modified = append(modified, "iavl-0.13"...)
+			return append(modified, rest...)
+		}(),
+		"modified value": func() []byte {
+			modified := append([]byte{}, raw...)
+			// The last node is a leaf, followed by the end marker.
+			modified[len(modified)-2]++
+			return modified
+		}(),
+	}
+	for testName, content := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var compressed bytes.Buffer
+			gz := gzip.NewWriter(&compressed)
+			_, err := gz.Write(content)
+			assert.Nil(t, err)
+			assert.Nil(t, gz.Close())
+
+			restoredDB := dbm.NewMemDB()
+			_, err = RestoreSnapshot(restoredDB, &compressed)
+			assert.IsErr(t, errors.ErrInput, err)
+
+			// No version is restored.
+			tree := loadTree(t, restoredDB)
+			assert.Equal(t, int64(0), tree.Version())
+		})
+	}
+}
+
+func TestSnapshotApplication(t *testing.T) {
+	db := dbm.NewMemDB()
+	source := snapshotTestApp(NewCommitStore(tmiavl.NewMutableTree(db, iavl.DefaultCacheSize), DefaultPruningOptions()))
+	appState, err := DevGenesisTemplate("CSTM", weave.NewCondition("sigs", "ed25519", []byte{1}).Address()).AppState()
+	assert.Nil(t, err)
+	source.InitChain(abci.RequestInitChain{ChainId: "snapshot-test", AppStateBytes: appState})
+	commitBlock(source, 1)
+
+	var snapshot bytes.Buffer
+	_, err = ExportSnapshot(db, 0, &snapshot)
+	assert.Nil(t, err)
+	restoredDB := dbm.NewMemDB()
+	_, err = RestoreSnapshot(restoredDB, &snapshot)
+	assert.Nil(t, err)
+	restored := snapshotTestApp(NewCommitStore(loadTree(t, restoredDB), DefaultPruningOptions()))
+
+	assert.Equal(t, source.Info(abci.RequestInfo{}), restored.Info(abci.RequestInfo{}))
+	for h := int64(2); h < 5; h++ {
+		assert.Equal(t, commitBlock(source, h), commitBlock(restored, h))
+	}
+}
+
+func snapshotTestApp(kv weave.CommitKVStore) abci.Application {
+	base := storeApplication("customd", Stack(nil, coin.Coin{}), TxDecoder, kv, QueryRouter(), false)
+	return DecorateApp(base, log.NewNopLogger())
+}
+
+func commitBlock(app abci.Application, height int64) abci.ResponseCommit {
+	app.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{
+		Height:  height,
+		ChainID: "snapshot-test",
+		Time:    time.Unix(1500000000+height, 0).UTC(),
+	}})
+	app.EndBlock(abci.RequestEndBlock{Height: height})
+	return app.Commit()
+}
+
+func loadTree(t testing.TB, db dbm.DB) *tmiavl.MutableTree {
+	t.Helper()
+	tree := tmiavl.NewMutableTree(db, iavl.DefaultCacheSize)
+	_, err := tree.Load()
+	assert.Nil(t, err)
+	return tree
+}
+
+// writeRandom sets and deletes random keys and commits the next version.
+func writeRandom(t testing.TB, rnd *rand.Rand, store CommitStore) weave.CommitID {
+	t.Helper()
+	kv := store.Adapter()
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("key-%d", rnd.Intn(200)))
+		if rnd.Intn(4) == 0 {
+			assert.Nil(t, kv.Delete(key))
+			continue
+		}
+		value := make([]byte, rnd.Intn(64)+1)
+		rnd.Read(value)
+		assert.Nil(t, kv.Set(key, value))
+	}
+	id, err := store.Commit()
+	assert.Nil(t, err)
+	return id
+}
@@ -0,0 +1,266 @@
+package customd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store/iavl"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	tmiavl "github.com/tendermint/iavl"
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+// PruningOptions define which historical versions of the state are kept.
+// Older versions are needed to query or prove the state at past heights.
+type PruningOptions struct {
+	// KeepRecent is the number of most recent versions kept. Zero keeps
+	// all versions.
+	KeepRecent int64
+	// KeepEvery keeps, in addition to the recent ones, each version that
+	// is a multiple of it. Zero keeps no additional versions.
+	KeepEvery int64
+}
+
+// DefaultPruningOptions returns the options used by weave stores, that keep
+// a few recent versions only.
+func DefaultPruningOptions() PruningOptions {
+	return PruningOptions{KeepRecent: iavl.DefaultHistory}
+}
+
+// Validate returns an error if the options are not valid.
+func (o PruningOptions) Validate() error {
+	var errs error
+	if o.KeepRecent < 0 {
+		errs = errors.AppendField(errs, "KeepRecent", errors.Wrap(errors.ErrInput, "cannot be negative"))
+	}
+	if o.KeepEvery < 0 {
+		errs = errors.AppendField(errs, "KeepEvery", errors.Wrap(errors.ErrInput, "cannot be negative"))
+	}
+	return errs
+}
+
+// prunedVersion returns the version that is no longer kept once the given
+// version is committed, or zero.
+func (o PruningOptions) prunedVersion(committed int64) int64 {
+	if o.KeepRecent == 0 {
+		return 0
+	}
+	version := committed - o.KeepRecent
+	if version <= 0 {
+		return 0
+	}
+	if o.KeepEvery != 0 && version%o.KeepEvery == 0 {
+		return 0
+	}
+	return version
+}
+
+// CommitStore is an IAVL backed store, that releases historical versions
+// according to the pruning options.
+type CommitStore struct {
+	iavl.CommitStore
+	tree    *tmiavl.MutableTree
+	pruning PruningOptions
+}
+
+var _ weave.CommitKVStore = CommitStore{}
+
+// NewCommitStore returns a store backed by the given tree.
+func NewCommitStore(tree *tmiavl.MutableTree, pruning PruningOptions) CommitStore {
+	return CommitStore{
+		CommitStore: iavl.NewCommitStoreFromTree(tree),
+		tree:        tree,
+		pruning:     pruning,
+	}
+}
+
+// Commit saves the next version to disk and releases the version that is no
+// longer kept. A version that does not exist, for example because the
+// store was restored from a snapshot, is ignored.
+func (s CommitStore) Commit() (weave.CommitID, error) {
+	hash, version, err := s.tree.SaveVersion()
+	if err != nil {
+		return weave.CommitID{}, errors.Wrapf(errors.ErrDatabase, "cannot save version: %s", err)
+	}
+	if pruned := s.pruning.prunedVersion(version); pruned != 0 && s.tree.VersionExists(pruned) {
+		if err := s.tree.DeleteVersion(pruned); err != nil {
+			return weave.CommitID{}, errors.Wrapf(errors.ErrDatabase, "cannot delete version %d: %s", pruned, err)
+		}
+	}
+	return weave.CommitID{Version: version, Hash: hash}, nil
+}
+
+// DBBackend is the kind of database that persists the state.
+type DBBackend string
+
+const (
+	// GoLevelDBBackend persists the state in a LevelDB database. It is
+	// the default.
+	GoLevelDBBackend DBBackend = "goleveldb"
+	// BoltDBBackend persists the state in a single BoltDB file.
+	BoltDBBackend DBBackend = "boltdb"
+	// MemDBBackend keeps the state in memory. The state is lost when the
+	// application stops, so it is meant for testing.
+	MemDBBackend DBBackend = "memdb"
+)
+
+// DBBackends returns all supported database backends.
+//
+// Other databases of the tendermint db package are not offered. The
+// filesystem database cannot write batches atomically and does not lock its
+// directory, so a crash during a commit could corrupt the state.
+func DBBackends() []DBBackend {
+	return []DBBackend{GoLevelDBBackend, BoltDBBackend, MemDBBackend}
+}
+
+// Validate returns an error if the backend is not supported.
+func (b DBBackend) Validate() error {
+	for _, backend := range DBBackends() {
+		if b == backend {
+			return nil
+		}
+	}
+	return errors.Wrapf(errors.ErrInput, "unknown database backend %q", string(b))
+}
+
+// StoreOptions define how the state of the application is stored.
+type StoreOptions struct {
+	Backend DBBackend
+	Pruning PruningOptions
+}
+
+// DefaultStoreOptions returns options that store the state in a LevelDB
+// database with the default pruning.
+func DefaultStoreOptions() StoreOptions {
+	return StoreOptions{
+		Backend: GoLevelDBBackend,
+		Pruning: DefaultPruningOptions(),
+	}
+}
+
+// Validate returns an error if the options are not valid.
+func (o StoreOptions) Validate() error {
+	var errs error
+	errs = errors.AppendField(errs, "Backend", o.Backend.Validate())
+	errs = errors.AppendField(errs, "Pruning", o.Pruning.Validate())
+	return errs
+}
+
+// OpenDB opens the database of the given backend at the named path. An
+// empty path opens an in-memory database, for testing.
+//
+// A LevelDB database is a directory and a BoltDB database is a file, both
+// with a ".db" extension. A path that holds anything else is not opened, so
+// that a database of another backend is never overwritten.
+func OpenDB(backend DBBackend, dbPath string) (dbm.DB, error) {
+	if err := backend.Validate(); err != nil {
+		return nil, err
+	}
+
+	// memory backed case, just for testing
+	if dbPath == "" || backend == MemDBBackend {
+		return dbm.NewMemDB(), nil
+	}
+
+	// Expand the path fully
+	path, err := filepath.Abs(dbPath)
+	if err != nil {
+		return nil, errors.Wrapf(errors.ErrDatabase, "invalid database name: %s", path)
+	}
+
+	// Some external calls accidentally add a ".db", which is now removed
+	path = strings.TrimSuffix(path, filepath.Ext(path))
+
+	if backend == BoltDBBackend {
+		return openBoltDB(path+".db", false)
+	}
+
+	// The database is kept in a directory with a ".db" extension. Do not
+	// write into a directory that holds something else.
+	if exists, err := levelDBExists(path + ".db"); err != nil {
+		return nil, err
+	} else if !exists && !isEmptyDir(path+".db") {
+		return nil, errors.Wrapf(errors.ErrDatabase, "%s.db is not a %s database", path, GoLevelDBBackend)
+	}
+
+	// Split the database name into it's components (dir, name)
+	dir := filepath.Dir(path)
+	name := filepath.Base(path)
+	db, err := dbm.NewGoLevelDB(name, dir)
+	if err != nil {
+		return nil, errors.Wrapf(errors.ErrDatabase, "cannot open database: %s", err)
+	}
+	return db, nil
+}
+
+// OpenReadOnlyDB opens an existing database of the given backend at the
+// named path, without modifying it. The database of a running node cannot
+// be opened.
+func OpenReadOnlyDB(backend DBBackend, dbPath string) (dbm.DB, error) {
+	if err := backend.Validate(); err != nil {
+		return nil, err
+	}
+	if backend == MemDBBackend {
+		return nil, errors.Wrap(errors.ErrInput, "in-memory database cannot be opened")
+	}
+
+	path, err := filepath.Abs(dbPath)
+	if err != nil {
+		return nil, errors.Wrapf(errors.ErrDatabase, "invalid database name: %s", path)
+	}
+	path = strings.TrimSuffix(path, filepath.Ext(path))
+
+	if backend == BoltDBBackend {
+		if _, err := os.Stat(path + ".db"); os.IsNotExist(err) {
+			return nil, errors.Wrapf(errors.ErrNotFound, "no database at %s.db", path)
+		}
+		return openBoltDB(path+".db", true)
+	}
+
+	if isEmptyDir(path + ".db") {
+		return nil, errors.Wrapf(errors.ErrNotFound, "no database at %s.db", path)
+	}
+	if exists, err := levelDBExists(path + ".db"); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, errors.Wrapf(errors.ErrDatabase, "%s.db is not a %s database", path, GoLevelDBBackend)
+	}
+
+	dir := filepath.Dir(path)
+	name := filepath.Base(path)
+	db, err := dbm.NewGoLevelDBWithOpts(name, dir, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return nil, errors.Wrapf(errors.ErrDatabase, "cannot open database: %s", err)
+	}
+	return db, nil
+}
+
+// isEmptyDir returns true if the directory does not exist or has no files.
+// A file that is not a directory is never empty.
+func isEmptyDir(dir string) bool {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	return len(files) == 0
+}
+
+// levelDBExists returns true if the directory contains a LevelDB database.
+// LevelDB always keeps the name of its manifest in the CURRENT file.
+func levelDBExists(dir string) (bool, error) {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		return false, nil
+	}
+	switch _, err := os.Stat(filepath.Join(dir, "CURRENT")); {
+	case err == nil:
+		return true, nil
+	case os.IsNotExist(err):
+		return false, nil
+	default:
+		return false, errors.Wrapf(errors.ErrDatabase, "cannot read database: %s", err)
+	}
+}
@@ -0,0 +1,216 @@
+package customd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave-starter-kit/x/custom"
+	"github.com/iov-one/weave/crypto"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store/iavl"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/sigs"
+	tmiavl "github.com/tendermint/iavl"
+	abci "github.com/tendermint/tendermint/abci/types"
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+func TestCommitStorePruning(t *testing.T) {
+	cases := map[string]struct {
+		Pruning PruningOptions
+		Want    []int64
+	}{
+		"default": {
+			Pruning: DefaultPruningOptions(),
+			Want:    versionRange(30-iavl.DefaultHistory+1, 30),
+		},
+		"keep all": {
+			Pruning: PruningOptions{},
+			Want:    versionRange(1, 30),
+		},
+		"keep recent": {
+			Pruning: PruningOptions{KeepRecent: 3},
+			Want:    []int64{28, 29, 30},
+		},
+		"keep recent and every": {
+			Pruning: PruningOptions{KeepRecent: 3, KeepEvery: 10},
+			Want:    []int64{10, 20, 28, 29, 30},
+		},
+	}
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			tree := tmiavl.NewMutableTree(dbm.NewMemDB(), iavl.DefaultCacheSize)
+			store := NewCommitStore(tree, tc.Pruning)
+			for i := 1; i <= 30; i++ {
+				assert.Nil(t, store.Adapter().Set([]byte(fmt.Sprintf("key-%d", i%7)), []byte{byte(i)}))
+				id, err := store.Commit()
+				assert.Nil(t, err)
+				assert.Equal(t, int64(i), id.Version)
+			}
+
+			var kept []int64
+			for v := int64(1); v <= 30; v++ {
+				if tree.VersionExists(v) {
+					kept = append(kept, v)
+				}
+			}
+			assert.Equal(t, tc.Want, kept)
+		})
+	}
+}
+
+func TestPruningOptionsValidate(t *testing.T) {
+	assert.Nil(t, DefaultPruningOptions().Validate())
+	assert.IsErr(t, errors.ErrInput, PruningOptions{KeepRecent: -1}.Validate())
+	assert.IsErr(t, errors.ErrInput, PruningOptions{KeepEvery: -1}.Validate())
+}
+
+func TestOpenDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "open-db")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	dbPath := filepath.Join(dir, "state.db")
+	db, err := OpenDB(GoLevelDBBackend, dbPath)
+	assert.Nil(t, err)
+	db.SetSync([]byte("key"), []byte("value"))
+	db.Close()
+
+	db, err = OpenDB(GoLevelDBBackend, dbPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), db.Get([]byte("key")))
+	db.Close()
+
+	db, err = OpenReadOnlyDB(GoLevelDBBackend, dbPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), db.Get([]byte("key")))
+	db.Close()
+	_, err = OpenReadOnlyDB(GoLevelDBBackend, filepath.Join(dir, "missing.db"))
+	assert.IsErr(t, errors.ErrNotFound, err)
+
+	// A directory with other files, for example a database of the
+	// filesystem backend, is not opened.
+	otherPath := filepath.Join(dir, "other.db")
+	assert.Nil(t, os.MkdirAll(otherPath, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(otherPath, "key"), []byte("value"), 0644))
+	_, err = OpenDB(GoLevelDBBackend, otherPath)
+	assert.IsErr(t, errors.ErrDatabase, err)
+	_, err = OpenReadOnlyDB(GoLevelDBBackend, otherPath)
+	assert.IsErr(t, errors.ErrDatabase, err)
+
+	boltPath := filepath.Join(dir, "bolt.db")
+	db, err = OpenDB(BoltDBBackend, boltPath)
+	assert.Nil(t, err)
+	db.SetSync([]byte("key"), []byte("value"))
+	// The database of a running node cannot be opened.
+	_, err = OpenReadOnlyDB(BoltDBBackend, boltPath)
+	assert.IsErr(t, errors.ErrDatabase, err)
+	db.Close()
+
+	db, err = OpenReadOnlyDB(BoltDBBackend, boltPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), db.Get([]byte("key")))
+	db.Close()
+	_, err = OpenReadOnlyDB(BoltDBBackend, filepath.Join(dir, "missing.db"))
+	assert.IsErr(t, errors.ErrNotFound, err)
+
+	// A database is never opened with another backend.
+	_, err = OpenDB(GoLevelDBBackend, boltPath)
+	assert.IsErr(t, errors.ErrDatabase, err)
+	_, err = OpenReadOnlyDB(GoLevelDBBackend, boltPath)
+	assert.IsErr(t, errors.ErrDatabase, err)
+	_, err = OpenDB(BoltDBBackend, dbPath)
+	assert.IsErr(t, errors.ErrDatabase, err)
+	_, err = OpenReadOnlyDB(BoltDBBackend, dbPath)
+	assert.IsErr(t, errors.ErrDatabase, err)
+
+	db, err = OpenDB(MemDBBackend, filepath.Join(dir, "memory.db"))
+	assert.Nil(t, err)
+	db.Set([]byte("key"), []byte("value"))
+	if _, err := os.Stat(filepath.Join(dir, "memory.db")); !os.IsNotExist(err) {
+		t.Fatalf("in-memory database written to disk: %v", err)
+	}
+
+	_, err = OpenDB("fsdb", filepath.Join(dir, "fs.db"))
+	assert.IsErr(t, errors.ErrInput, err)
+}
+
+func TestStoreOptionsValidate(t *testing.T) {
+	assert.Nil(t, DefaultStoreOptions().Validate())
+	assert.IsErr(t, errors.ErrInput, StoreOptions{Backend: "fsdb", Pruning: DefaultPruningOptions()}.Validate())
+	assert.IsErr(t, errors.ErrInput, StoreOptions{Backend: MemDBBackend, Pruning: PruningOptions{KeepRecent: -1}}.Validate())
+}
+
+// BenchmarkCreateState compares the throughput of custom state creation on
+// each database backend. Each operation delivers a transaction, and blocks
+// of stateBlockSize transactions are committed.
+func BenchmarkCreateState(b *testing.B) {
+	const stateBlockSize = 100
+
+	key := crypto.GenPrivKeyEd25519()
+	addr := key.PublicKey().Address()
+	appState, err := DevGenesisTemplate("CSTM", addr).AppState()
+	assert.Nil(b, err)
+
+	for _, backend := range DBBackends() {
+		b.Run(string(backend), func(b *testing.B) {
+			dir, err := ioutil.TempDir("", "bench-"+string(backend))
+			assert.Nil(b, err)
+			defer os.RemoveAll(dir)
+
+			db, err := OpenDB(backend, DBPath(dir))
+			assert.Nil(b, err)
+			defer db.Close()
+			tree := tmiavl.NewMutableTree(db, iavl.DefaultCacheSize)
+			application := snapshotTestApp(NewCommitStore(tree, DefaultPruningOptions()))
+			application.InitChain(abci.RequestInitChain{ChainId: "snapshot-test", AppStateBytes: appState})
+			commitBlock(application, 1)
+
+			txs := make([][]byte, b.N)
+			for i := range txs {
+				tx := &Tx{Sum: &Tx_CustomCreateStateMsg{CustomCreateStateMsg: &custom.CreateStateMsg{
+					Metadata:   &weave.Metadata{Schema: 1},
+					InnerState: &custom.InnerState{St1: int64(i), St2: int64(i) * 2},
+					Address:    addr,
+				}}}
+				sig, err := sigs.SignTx(key, tx, "snapshot-test", int64(i))
+				assert.Nil(b, err)
+				tx.Signatures = append(tx.Signatures, sig)
+				txs[i], err = tx.Marshal()
+				assert.Nil(b, err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			height := int64(2)
+			for i := 0; i < b.N; i += stateBlockSize {
+				application.BeginBlock(abci.RequestBeginBlock{Header: abci.Header{
+					Height:  height,
+					ChainID: "snapshot-test",
+					Time:    time.Unix(1500000000+height, 0).UTC(),
+				}})
+				for j := i; j < i+stateBlockSize && j < b.N; j++ {
+					if res := application.DeliverTx(txs[j]); res.IsErr() {
+						b.Fatalf("cannot deliver transaction: %s", res.Log)
+					}
+				}
+				application.EndBlock(abci.RequestEndBlock{Height: height})
+				application.Commit()
+				height++
+			}
+		})
+	}
+}
+
+func versionRange(from, to int64) []int64 {
+	var versions []int64
+	for v := from; v <= to; v++ {
+		versions = append(versions, v)
+	}
+	return versions
+}
@@ -3,14 +3,23 @@ package client
 import (
 	"context"
 	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
 	"github.com/iov-one/weave/app"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/crypto"
 	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/orm"
 	"github.com/iov-one/weave/x/sigs"
+	abci "github.com/tendermint/tendermint/abci/types"
 	cmn "github.com/tendermint/tendermint/libs/common"
 	tmpubsub "github.com/tendermint/tendermint/libs/pubsub"
+	"github.com/tendermint/tendermint/lite"
 	"github.com/tendermint/tendermint/rpc/client"
 	ctypes "github.com/tendermint/tendermint/rpc/core/types"
 	tmtypes "github.com/tendermint/tendermint/types"
@@ -21,79 +30,262 @@ const BroadcastTxSyncDefaultTimeOut = 15 * time.Second
 
 var QueryNewBlockHeader = tmtypes.EventQueryNewBlockHeader
 
-// Client is an interface to interact with weave apps
+// Client is an interface to interact with weave apps.
+//
+// All methods accept a context as the first argument. Cancelling the context
+// stops waiting for the result. Methods without a context are deprecated and
+// kept only for backward compatibility.
 type Client interface {
 	// TendermintClient returns the underlying tendermint client
 	TendermintClient() client.Client
-	// GetUser will return nonce and public key registered
+	// StatusContext will return the raw status from the node
+	StatusContext(ctx context.Context) (*ctypes.ResultStatus, error)
+	// ChainIDContext returns the ID of the chain the client is connected to
+	ChainIDContext(ctx context.Context) (string, error)
+	// HeightContext returns the latest block height
+	HeightContext(ctx context.Context) (int64, error)
+	// GetUserContext will return nonce and public key registered
 	// for a given address if it was ever used.
+	GetUserContext(ctx context.Context, addr weave.Address) (*UserResponse, error)
+	// GetWalletContext will return a wallet given an address
+	GetWalletContext(ctx context.Context, addr weave.Address) (*WalletResponse, error)
+	// BroadcastTxContext serializes a signed transaction and writes to the
+	// blockchain. It returns when the tx is committed to the blockchain.
+	BroadcastTxContext(ctx context.Context, tx weave.Tx) BroadcastTxResponse
+	// BroadcastTxAsyncContext can be run in a goroutine and will output the
+	// result or error to the given channel.
+	BroadcastTxAsyncContext(ctx context.Context, tx weave.Tx, out chan<- BroadcastTxResponse)
+	// BroadcastTxSyncContext brodcasts transactions synchronously
+	BroadcastTxSyncContext(ctx context.Context, tx weave.Tx) BroadcastTxResponse
+	// SimulateContext executes a transaction without committing any change
+	SimulateContext(ctx context.Context, tx weave.Tx) (*SimulateResponse, error)
+	// AbciQueryContext calls abci query on tendermint rpc.
+	AbciQueryContext(ctx context.Context, path string, data []byte) (AbciResponse, error)
+	// AbciRangeQueryContext returns a single page of models stored under
+	// given database key prefix.
+	AbciRangeQueryContext(ctx context.Context, prefix, cursor []byte, limit int) (AbciResponse, error)
+	// NextNonceContext queries the blockchain for the next nonce
+	NextNonceContext(ctx context.Context, addr weave.Address) (int64, error)
+	// QueryModelContext queries a bucket path for a single model
+	QueryModelContext(ctx context.Context, path string, key []byte, dest orm.Model) (int64, error)
+	// QueryModelsContext queries a bucket or index path for all matching models
+	QueryModelsContext(ctx context.Context, path string, data []byte, dest orm.ModelSlicePtr) ([][]byte, int64, error)
+	// GetStateContext returns the state with given ID
+	GetStateContext(ctx context.Context, id []byte) (*StateResponse, error)
+	// GetTimedStateContext returns the timed state with given ID
+	GetTimedStateContext(ctx context.Context, id []byte) (*TimedStateResponse, error)
+	// GetContractContext returns the multisig contract with given ID
+	GetContractContext(ctx context.Context, id []byte) (*ContractResponse, error)
+	// ListStatesByAddressContext returns a page of states created for the
+	// given address
+	ListStatesByAddressContext(ctx context.Context, addr weave.Address, opts ListOptions) (*StatesPage, error)
+	// ListTimedStatesExpiringBeforeContext returns a page of timed states
+	// that are deleted before the given time
+	ListTimedStatesExpiringBeforeContext(ctx context.Context, t time.Time, opts ListOptions) (*TimedStatesPage, error)
+	// SignAndBroadcastContext signs the transaction using a nonce provided by the
+	// nonce manager and broadcasts it. It returns when the transaction is
+	// committed.
+	SignAndBroadcastContext(ctx context.Context, nonces *NonceManager, tx *customd.Tx, signer *crypto.PrivateKey) BroadcastTxResponse
+	// TxSearchContext searches for transactions matching given query
+	TxSearchContext(ctx context.Context, query string, prove bool, page, perPage int) (*ctypes.ResultTxSearch, error)
+	// TxHistoryContext returns a page of transactions that affected the
+	// address, starting with the newest one
+	TxHistoryContext(ctx context.Context, addr weave.Address, opts HistoryOptions) (*HistoryPage, error)
+	// SubscribeContext pushes all events matching given query to the
+	// returned channel until the context is done or the returned cancel
+	// function is called
+	SubscribeContext(ctx context.Context, query tmpubsub.Query) (<-chan ctypes.ResultEvent, func(), error)
+
+	// Deprecated: Use StatusContext.
+	Status() (*ctypes.ResultStatus, error)
+	// Deprecated: Use ChainIDContext.
+	ChainID() (string, error)
+	// Deprecated: Use HeightContext.
+	Height() (int64, error)
+	// Deprecated: Use GetUserContext.
 	GetUser(addr weave.Address) (*UserResponse, error)
-	// GetWallet will return a wallet given an address
+	// Deprecated: Use GetWalletContext.
 	GetWallet(addr weave.Address) (*WalletResponse, error)
-	// BroadcastTx serializes a signed transaction and writes to the
-	// blockchain. It returns when the tx is committed to the blockchain.
+	// Deprecated: Use BroadcastTxContext.
 	BroadcastTx(tx weave.Tx) BroadcastTxResponse
-	// BroadcastTxAsync can be run in a goroutine and will output the
-	// result or error to the given channel.
+	// Deprecated: Use BroadcastTxAsyncContext.
 	BroadcastTxAsync(tx weave.Tx, out chan<- BroadcastTxResponse)
-	// BroadcastTxSync brodcasts transactions synchronously
+	// Deprecated: Use BroadcastTxSyncContext.
 	BroadcastTxSync(tx weave.Tx, timeout time.Duration) BroadcastTxResponse
-	// AbciQuery calls abci query on tendermint rpc.
+	// Deprecated: Use SimulateContext.
+	Simulate(tx weave.Tx) (*SimulateResponse, error)
+	// Deprecated: Use AbciQueryContext.
 	AbciQuery(path string, data []byte) (AbciResponse, error)
-	// NextNonce queries the blockchain for the next nonce
-	NextNonce(client Client, addr weave.Address) (int64, error)
+	// Deprecated: Use AbciRangeQueryContext.
+	AbciRangeQuery(prefix, cursor []byte, limit int) (AbciResponse, error)
+	// Deprecated: Use NextNonceContext.
+	NextNonce(addr weave.Address) (int64, error)
+	// Deprecated: Use TxSearchContext.
+	TxSearch(query string, prove bool, page, perPage int) (*ctypes.ResultTxSearch, error)
+	// Deprecated: Use SubscribeContext.
+	Subscribe(query tmpubsub.Query) (<-chan ctypes.ResultEvent, func(), error)
 }
 
+var _ Client = (*CustomClient)(nil)
+
 // CustomClient is a tendermint client wrapped to provide
 // simple access to the data structures used in custom module.
 type CustomClient struct {
-	conn client.Client
-	// subscriber is a unique identifier for subscriptions
+	// conn shares subscriptions to the same query between all users of
+	// the client.
+	conn *muxConnection
+	// subscriber is the prefix of unique subscription identifiers.
 	subscriber string
+	// subscriptions counts subscriptions to make their identifiers
+	// unique. It must be accessed atomically.
+	subscriptions int64
+
+	mu sync.Mutex
+	// active holds queries of subscriptions created by SubscribeContext,
+	// by subscriber.
+	active map[string]string
+	// pipe is the transaction pipeline shared by all asynchronous
+	// broadcasts. It is created on first use.
+	pipe *Pipeline
+	// chainID is cached after the first successful query.
+	chainID string
+	// verifier certifies headers for verified queries. It is created
+	// on first use.
+	verifier lite.Verifier
 }
 
 // NewClient wraps a CustomClient around an existing
 // tendermint client connection.
 func NewClient(conn client.Client) *CustomClient {
 	return &CustomClient{
-		conn:       conn,
-		subscriber: "tools-client",
+		conn:       newMuxConnection(conn),
+		subscriber: "tools-client-" + hex.EncodeToString(cmn.RandBytes(4)),
+		active:     make(map[string]string),
 	}
 }
 
-// TendermintClient returns underlying tendermint client
+// TendermintClient returns underlying tendermint client. Subscriptions
+// created with it are shared with the subscriptions of the CustomClient.
 func (cc *CustomClient) TendermintClient() client.Client {
 	return cc.conn
 }
 
+// newSubscriber returns a unique subscriber identifier.
+func (cc *CustomClient) newSubscriber() string {
+	n := atomic.AddInt64(&cc.subscriptions, 1)
+	return fmt.Sprintf("%s-%d", cc.subscriber, n)
+}
+
+// Close releases resources acquired by the client, such as the transaction
+// pipeline used by asynchronous broadcasts. The connection is not closed.
+func (cc *CustomClient) Close() error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.pipe == nil {
+		return nil
+	}
+	err := cc.pipe.Close()
+	cc.pipe = nil
+	return err
+}
+
+// pipeline returns the shared transaction pipeline, creating it if needed.
+func (cc *CustomClient) pipeline() (*Pipeline, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.pipe == nil {
+		p, err := newPipeline(cc, PipelineOptions{})
+		if err != nil {
+			return nil, err
+		}
+		cc.pipe = p
+	}
+	return cc.pipe, nil
+}
+
 //************ generic (weave) functionality *************//
 
-// Status will return the raw status from the node
-func (cc *CustomClient) Status() (*ctypes.ResultStatus, error) {
-	return cc.conn.Status()
+// withContext executes given call with the connection bound to the context,
+// so that its request is cancelled when the context is done. Connections
+// that do not implement ContextBinder, such as the in-process local
+// connection, cannot be cancelled. For them the call is abandoned when the
+// context is done first and its result is ignored, but it keeps running
+// until the node responds.
+func withContext(ctx context.Context, conn client.Client, call func(client.Client) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if bound, ok := bindContext(ctx, conn); ok {
+		return call(bound)
+	}
+	return abandonOnDone(ctx, func() error { return call(conn) })
+}
+
+// abandonOnDone executes given call and waits until it returns or the
+// context is done. When the context is done first, the call is abandoned and
+// its result is ignored. Use it only for calls that cannot be cancelled.
+func abandonOnDone(ctx context.Context, call func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StatusContext will return the raw status from the node
+func (cc *CustomClient) StatusContext(ctx context.Context) (*ctypes.ResultStatus, error) {
+	var status *ctypes.ResultStatus
+	err := withContext(ctx, cc.conn, func(conn client.Client) (err error) {
+		status, err = conn.Status()
+		return err
+	})
+	return status, err
 }
 
-// Genesis will return the genesis directly from the node
-func (cc *CustomClient) Genesis() (*tmtypes.GenesisDoc, error) {
-	gen, err := cc.conn.Genesis()
+// GenesisContext will return the genesis directly from the node
+func (cc *CustomClient) GenesisContext(ctx context.Context) (*tmtypes.GenesisDoc, error) {
+	var gen *ctypes.ResultGenesis
+	err := withContext(ctx, cc.conn, func(conn client.Client) (err error) {
+		gen, err = conn.Genesis()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	return gen.Genesis, nil
 }
 
-// ChainID will parse out the chainID from the status result
-func (cc *CustomClient) ChainID() (string, error) {
-	gen, err := cc.Genesis()
+// ChainIDContext will parse out the chainID from the genesis. The result is
+// cached, as the chain ID never changes.
+func (cc *CustomClient) ChainIDContext(ctx context.Context) (string, error) {
+	cc.mu.Lock()
+	chainID := cc.chainID
+	cc.mu.Unlock()
+	if chainID != "" {
+		return chainID, nil
+	}
+
+	gen, err := cc.GenesisContext(ctx)
 	if err != nil {
 		return "", err
 	}
+	cc.mu.Lock()
+	cc.chainID = gen.ChainID
+	cc.mu.Unlock()
 	return gen.ChainID, nil
 }
 
-// Height will parse out the Height from the status result
-func (cc *CustomClient) Height() (int64, error) {
-	status, err := cc.conn.Status()
+// HeightContext will parse out the Height from the status result
+func (cc *CustomClient) HeightContext(ctx context.Context) (int64, error) {
+	status, err := cc.StatusContext(ctx)
 	if err != nil {
 		return -1, err
 	}
@@ -107,16 +299,29 @@ type AbciResponse struct {
 	// a list of key/value pairs
 	Models []weave.Model
 	Height int64
+	// Next is the cursor of the following page of a range query. It is
+	// nil if there are no more results.
+	Next []byte
 }
 
-// AbciQuery calls abci query on tendermint rpc,
+// AbciQueryContext calls abci query on tendermint rpc,
 // verifies if it is an error or empty, and if there is
 // data pulls out the ResultSets from keys and values into
 // a useful AbciResponse struct
-func (cc *CustomClient) AbciQuery(path string, data []byte) (AbciResponse, error) {
+func (cc *CustomClient) AbciQueryContext(ctx context.Context, path string, data []byte) (AbciResponse, error) {
+	return cc.AbciQueryWithOptionsContext(ctx, path, data, client.DefaultABCIQueryOptions)
+}
+
+// AbciQueryWithOptionsContext is like AbciQueryContext but allows to provide
+// query options, for example to query the state at a given height.
+func (cc *CustomClient) AbciQueryWithOptionsContext(ctx context.Context, path string, data []byte, opts client.ABCIQueryOptions) (AbciResponse, error) {
 	var out AbciResponse
 
-	q, err := cc.conn.ABCIQuery(path, data)
+	var q *ctypes.ResultABCIQuery
+	err := withContext(ctx, cc.conn, func(conn client.Client) (err error) {
+		q, err = conn.ABCIQueryWithOptions(path, data, opts)
+		return err
+	})
 	if err != nil {
 		return out, err
 	}
@@ -145,9 +350,109 @@ func (cc *CustomClient) AbciQuery(path string, data []byte) (AbciResponse, error
 	return out, err
 }
 
-// TxSearch searches transactions using underlying tendermint client
-func (cc *CustomClient) TxSearch(query string, prove bool, page, perPage int) (*ctypes.ResultTxSearch, error) {
-	return cc.conn.TxSearch(query, prove, page, perPage)
+// AbciRangeQueryContext returns a single page of models stored under given database
+// key prefix. Models are returned in key order, starting with the cursor key.
+// Use nil cursor to fetch the first page and the Next cursor of the response
+// to fetch the following ones. When limit is zero, the default page size is
+// used.
+//
+// Returned keys are full database keys and values are stored data, as
+// returned by the "/" path query.
+func (cc *CustomClient) AbciRangeQueryContext(ctx context.Context, prefix, cursor []byte, limit int) (AbciResponse, error) {
+	return cc.AbciRangeQueryWithOptionsContext(ctx, prefix, cursor, limit, client.DefaultABCIQueryOptions)
+}
+
+// AbciRangeQueryWithOptionsContext is like AbciRangeQueryContext but allows
+// to provide query options, for example to query the state at a given
+// height.
+func (cc *CustomClient) AbciRangeQueryWithOptionsContext(ctx context.Context, prefix, cursor []byte, limit int, opts client.ABCIQueryOptions) (AbciResponse, error) {
+	if limit < 0 || limit > customd.MaxRangeQueryLimit {
+		return AbciResponse{}, errors.Wrapf(errors.ErrInput, "limit must be between 0 and %d", customd.MaxRangeQueryLimit)
+	}
+	if limit == 0 {
+		limit = customd.DefaultRangeQueryLimit
+	}
+	q := customd.NewPrefixRangeQuery(prefix, cursor, uint32(limit))
+	resp, err := cc.AbciQueryWithOptionsContext(ctx, customd.RangeQueryPath, q.Marshal(), opts)
+	if err != nil {
+		return resp, err
+	}
+	// A full page means that more results might be available. The
+	// following page starts right after the last returned key.
+	if n := len(resp.Models); n == limit {
+		last := resp.Models[n-1].Key
+		resp.Next = append(append(make([]byte, 0, len(last)+1), last...), 0)
+	}
+	return resp, nil
+}
+
+// TxSearchContext searches transactions using underlying tendermint client
+func (cc *CustomClient) TxSearchContext(ctx context.Context, query string, prove bool, page, perPage int) (*ctypes.ResultTxSearch, error) {
+	var res *ctypes.ResultTxSearch
+	err := withContext(ctx, cc.conn, func(conn client.Client) (err error) {
+		res, err = conn.TxSearch(query, prove, page, perPage)
+		return err
+	})
+	return res, err
+}
+
+// SimulateResponse is the result of a transaction simulation.
+type SimulateResponse struct {
+	// GasWanted is the gas allocated by the transaction check.
+	GasWanted int64
+	// GasUsed is the gas used by the transaction delivery.
+	GasUsed int64
+	// RequiredFee is the fee that must be paid for the transaction to
+	// be processed.
+	RequiredFee coin.Coin
+	// Tags are events emitted by the transaction delivery.
+	Tags []cmn.KVPair
+	// Data is the transaction delivery result, as it would be returned
+	// by the node after committing the transaction.
+	Data []byte
+	Log  string
+	// Height is the height of the state that the simulation was executed
+	// against.
+	Height int64
+}
+
+// SimulateContext executes a transaction against the latest committed state of the
+// node, without broadcasting it and without committing any change. It
+// returns an error if the transaction would be rejected, either during the
+// check or delivery.
+//
+// Because the committed state is used, transactions that are waiting in the
+// mempool are not taken into account.
+func (cc *CustomClient) SimulateContext(ctx context.Context, tx weave.Tx) (*SimulateResponse, error) {
+	data, err := tx.Marshal()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal transaction")
+	}
+	resp, err := cc.AbciQueryContext(ctx, customd.SimulatePath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := SimulateResponse{Height: resp.Height}
+	for _, m := range resp.Models {
+		switch string(m.Key) {
+		case customd.SimulateResultKey:
+			var res abci.ResponseDeliverTx
+			if err := res.Unmarshal(m.Value); err != nil {
+				return nil, errors.Wrap(err, "cannot unmarshal result")
+			}
+			out.GasWanted = res.GasWanted
+			out.GasUsed = res.GasUsed
+			out.Tags = res.Tags
+			out.Data = res.Data
+			out.Log = res.Log
+		case customd.SimulateFeeKey:
+			if err := out.RequiredFee.Unmarshal(m.Value); err != nil {
+				return nil, errors.Wrap(err, "cannot unmarshal required fee")
+			}
+		}
+	}
+	return &out, nil
 }
 
 // BroadcastTxResponse is the result of submitting a transaction.
@@ -173,27 +478,43 @@ func (b BroadcastTxResponse) IsError() error {
 	return nil
 }
 
-// BroadcastTx serializes a signed transaction and writes to the
+// BroadcastTxContext serializes a signed transaction and writes to the
 // blockchain. It returns when the tx is committed to the
 // blockchain.
 //
-// If you want high-performance, parallel sending, use BroadcastTxAsync
-func (cc *CustomClient) BroadcastTx(tx weave.Tx) BroadcastTxResponse {
-	out := make(chan BroadcastTxResponse, 1)
-	defer close(out)
-	go cc.BroadcastTxAsync(tx, out)
-	res := <-out
-	return res
+// If you want high-performance, parallel sending, use BroadcastTxAsyncContext
+// or a Pipeline.
+func (cc *CustomClient) BroadcastTxContext(ctx context.Context, tx weave.Tx) BroadcastTxResponse {
+	data, err := tx.Marshal()
+	if err != nil {
+		return BroadcastTxResponse{Error: err}
+	}
+
+	var res *ctypes.ResultBroadcastTxCommit
+	err = withContext(ctx, cc.conn, func(conn client.Client) (err error) {
+		res, err = conn.BroadcastTxCommit(data)
+		return err
+	})
+	return BroadcastTxResponse{
+		Error:    err,
+		Response: res,
+	}
 }
 
-// BroadcastTxSync brodcasts transactions synchronously
-func (cc *CustomClient) BroadcastTxSync(tx weave.Tx, timeout time.Duration) BroadcastTxResponse {
+// BroadcastTxSyncContext brodcasts transactions synchronously. It waits for
+// the transaction to be committed until the context is done. Use a context
+// with a deadline to limit the waiting time.
+func (cc *CustomClient) BroadcastTxSyncContext(ctx context.Context, tx weave.Tx) BroadcastTxResponse {
 	data, err := tx.Marshal()
 	if err != nil {
 		return BroadcastTxResponse{Error: err}
 	}
 
-	res, err := cc.conn.BroadcastTxSync(data)
+	var res *ctypes.ResultBroadcastTx
+	err = withContext(ctx, cc.conn, func(conn client.Client) (err error) {
+		res, err = conn.BroadcastTxSync(data)
+		return err
+	})
 	if err != nil {
 		return BroadcastTxResponse{Error: err}
 	}
@@ -203,7 +524,7 @@ func (cc *CustomClient) BroadcastTxSync(tx weave.Tx, timeout time.Duration) Broa
 	}
 
 	// and wait for confirmation
-	evt, err := cc.WaitForTxEvent(data, tmtypes.EventTx, timeout)
+	evt, err := cc.WaitForTxEventContext(ctx, data, tmtypes.EventTx)
 	if err != nil {
 		return BroadcastTxResponse{Error: err}
 	}
@@ -225,105 +546,205 @@ func (cc *CustomClient) BroadcastTxSync(tx weave.Tx, timeout time.Duration) Broa
 	}
 }
 
-// WaitForTxEvent listens for and particular event type of evtTyp to be fired
-func (cc *CustomClient) WaitForTxEvent(tx tmtypes.Tx, evtTyp string, timeout time.Duration) (tmtypes.TMEventData, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-	query := tmtypes.EventQueryTxFor(tx)
+// SignAndBroadcastContext signs the transaction with the next nonce of the
+// signer, as provided by the nonce manager, and broadcasts it. Transactions
+// of the same signer are submitted one at a time and in the nonce order, but
+// the commit is awaited concurrently, so many transactions of the same
+// signer can be included in a single block.
+//
+// If the transaction is rejected because of an invalid nonce, the nonce is
+// fetched from the chain and the transaction is signed and broadcasted once
+// again. Signatures added to the transaction by previous attempts are
+// removed.
+func (cc *CustomClient) SignAndBroadcastContext(ctx context.Context, nonces *NonceManager, tx *customd.Tx, signer *crypto.PrivateKey) BroadcastTxResponse {
+	chainID, err := cc.ChainIDContext(ctx)
+	if err != nil {
+		return BroadcastTxResponse{Error: errors.Wrap(err, "cannot get chain ID")}
+	}
+	p, err := cc.pipeline()
+	if err != nil {
+		return BroadcastTxResponse{Error: err}
+	}
+	submit := func(ctx context.Context, tx weave.Tx) (*TxFuture, error) {
+		raw, err := tx.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		data := tmtypes.Tx(raw)
+		// Track before broadcasting so that the commit cannot be
+		// missed.
+		f := newTxFuture(data.Hash())
+		untrack := p.track(f)
+
+		var res *ctypes.ResultBroadcastTx
+		err = withContext(ctx, cc.conn, func(conn client.Client) (err error) {
+			res, err = conn.BroadcastTxSync(data)
+			return err
+		})
+		if err == nil && res.Code != 0 {
+			err = errors.Wrap(errors.ABCIError(res.Code, res.Log), "CheckTx error")
+		}
+		if err != nil {
+			untrack()
+			return nil, err
+		}
+		return f, nil
+	}
+	return signAndBroadcast(ctx, chainID, nonces, tx, signer, submit)
+}
 
-	uuid := hex.EncodeToString(append(tx.Hash(), cmn.RandBytes(2)...))
-	evts, err := cc.conn.Subscribe(ctx, uuid, query.String())
+// WaitForTxEventContext listens for and particular event type of evtTyp to be
+// fired. It returns ErrTimeout if the context deadline is exceeded.
+func (cc *CustomClient) WaitForTxEventContext(ctx context.Context, tx tmtypes.Tx, evtTyp string) (tmtypes.TMEventData, error) {
+	evts, cancel, err := cc.SubscribeContext(ctx, tmtypes.EventQueryTxFor(tx))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to subscribe")
 	}
-
-	// make sure to unregister after the test is over
-	defer cc.conn.UnsubscribeAll(ctx, uuid)
+	defer cancel()
 
 	select {
-	case evt := <-evts:
-		return evt.Data.(tmtypes.TMEventData), nil
+	case evt, ok := <-evts:
+		if !ok || evt.Data == nil {
+			return nil, errors.Wrap(errors.ErrState, "subscription cancelled")
+		}
+		return evt.Data, nil
 	case <-ctx.Done():
-		return nil, errors.Wrap(errors.ErrTimeout, "waiting for event timed out")
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, errors.Wrap(errors.ErrTimeout, "waiting for event timed out")
+		}
+		return nil, ctx.Err()
 	}
 }
 
-// BroadcastTxAsync can be run in a goroutine and will output
+// BroadcastTxAsyncContext can be run in a goroutine and will output
 // the result or error to the given channel.
 // Useful if you want to send many tx in parallel
-func (cc *CustomClient) BroadcastTxAsync(tx weave.Tx, out chan<- BroadcastTxResponse) {
-	data, err := tx.Marshal()
+//
+// The transaction is submitted by the pipeline shared by all calls, that
+// resolves it once it is included in a block. A transaction that fails the
+// check is reported at once with the check error. Use a Pipeline directly
+// to control the number of workers and to get a future for each
+// transaction.
+func (cc *CustomClient) BroadcastTxAsyncContext(ctx context.Context, tx weave.Tx, out chan<- BroadcastTxResponse) {
+	p, err := cc.pipeline()
 	if err != nil {
 		out <- BroadcastTxResponse{Error: err}
 		return
 	}
-
-	// TODO: make this async, maybe adjust return value
-	res, err := cc.conn.BroadcastTxCommit(data)
-	msg := BroadcastTxResponse{
-		Error:    err,
-		Response: res,
+	f, err := p.Submit(ctx, tx)
+	if err != nil {
+		out <- BroadcastTxResponse{Error: err}
+		return
 	}
-	out <- msg
+	out <- f.Wait(ctx)
 }
 
-// SubscribeHeaders queries for headers and starts a goroutine
-// to typecase the events into Headers. Returns a cancel
-// function. If you don't want the automatic goroutine, use
-// Subscribe(QueryNewBlockHeader, out)
-func (cc *CustomClient) SubscribeHeaders(out chan<- *tmtypes.Header) (func(), error) {
-	query := tmtypes.EventQueryNewBlockHeader
-	pipe, cancel, err := cc.Subscribe(query)
+// SubscribeHeadersContext streams headers of new blocks to the given
+// channel, which is closed when the subscription is cancelled. Headers are
+// delivered in the height order and without gaps, see
+// SubscribeBlocksContext. Returns a cancel function.
+func (cc *CustomClient) SubscribeHeadersContext(ctx context.Context, out chan<- *tmtypes.Header) (func(), error) {
+	ctx, cancel := context.WithCancel(ctx)
+	blocks, cancelBlocks, err := cc.SubscribeBlocksContext(ctx, SubscribeOptions{})
 	if err != nil {
+		cancel()
 		return nil, err
 	}
+	done := make(chan struct{})
 	go func() {
-		for msg := range pipe {
-			evt, ok := msg.Data.(tmtypes.EventDataNewBlockHeader)
-			if !ok {
-				// TODO: something else?
-				panic("Unexpected event type")
+		defer close(done)
+		defer close(out)
+		for block := range blocks {
+			header := block.Header
+			select {
+			case out <- &header:
+			case <-ctx.Done():
+				cancelBlocks()
+				return
 			}
-			out <- &evt.Header
 		}
-		close(out)
 	}()
-	return cancel, nil
+	return func() { cancel(); cancelBlocks(); <-done }, nil
 }
 
-// Subscribe will take an arbitrary query and push all events to
-// the given channel. If there is no error,
-// returns a cancel function that can be called to cancel
-// the subscription
-func (cc *CustomClient) Subscribe(query tmpubsub.Query) (<-chan ctypes.ResultEvent, func(), error) {
-	ctx := context.Background()
-	out, err := cc.conn.Subscribe(ctx, cc.subscriber, query.String())
+// SubscribeContext will take an arbitrary query and push all events to
+// the returned channel. If there is no error, returns a cancel function
+// that can be called to cancel the subscription. The subscription is
+// cancelled when the context is done. The channel is closed when the
+// subscription is cancelled.
+//
+// Events are dropped when the channel is full and no event is received
+// while the node connection is broken. Use the typed subscriptions, such
+// as SubscribeBlocksContext, to receive all events.
+func (cc *CustomClient) SubscribeContext(ctx context.Context, query tmpubsub.Query) (<-chan ctypes.ResultEvent, func(), error) {
+	subscriber := cc.newSubscriber()
+	out, err := cc.conn.Subscribe(ctx, subscriber, query.String(), DefaultSubscriptionBuffer)
 	if err != nil {
 		return out, nil, err
 	}
+	cc.mu.Lock()
+	cc.active[subscriber] = query.String()
+	cc.mu.Unlock()
+
+	cancel := cancelOnDone(ctx, func() {
+		cc.mu.Lock()
+		_, ok := cc.active[subscriber]
+		delete(cc.active, subscriber)
+		cc.mu.Unlock()
+		if ok {
+			cc.conn.Unsubscribe(context.Background(), subscriber, query.String())
+		}
+	})
+	return out, cancel, nil
+}
+
+// cancelOnDone returns a function that calls unsubscribe exactly once. It is
+// called either when the returned function is called or when the context is
+// done, whichever happens first.
+func cancelOnDone(ctx context.Context, unsubscribe func()) func() {
+	var once sync.Once
+	stop := make(chan struct{})
 	cancel := func() {
-		cc.conn.Unsubscribe(ctx, cc.subscriber, query.String())
+		once.Do(func() {
+			close(stop)
+			unsubscribe()
+		})
 	}
-	return out, cancel, nil
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-stop:
+		}
+	}()
+	return cancel
 }
 
-// UnsubscribeAll cancels all subscriptions
-func (cc *CustomClient) UnsubscribeAll() error {
-	ctx := context.Background()
-	return cc.conn.UnsubscribeAll(ctx, cc.subscriber)
+// UnsubscribeAllContext cancels all subscriptions
+func (cc *CustomClient) UnsubscribeAllContext(ctx context.Context) error {
+	cc.mu.Lock()
+	active := cc.active
+	cc.active = make(map[string]string)
+	cc.mu.Unlock()
+
+	var errs error
+	for subscriber, query := range active {
+		errs = errors.Append(errs, cc.conn.Unsubscribe(ctx, subscriber, query))
+	}
+	return errs
 }
 
-// GetWallet will return a wallet given an address
+// GetWalletContext will return a wallet given an address
 // If non wallet is present, it will return (nil, nil)
 // Error codes are used when the query failed on the server
-func (cc *CustomClient) GetWallet(addr weave.Address) (*WalletResponse, error) {
+func (cc *CustomClient) GetWalletContext(ctx context.Context, addr weave.Address) (*WalletResponse, error) {
 	// make sure we send a valid address to the server
 	err := addr.Validate()
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid address")
 	}
 
-	resp, err := cc.AbciQuery("/wallets", addr)
+	resp, err := cc.AbciQueryContext(ctx, "/wallets", addr)
 	if err != nil {
 		return nil, err
 	}
@@ -362,18 +783,18 @@ type UserResponse struct {
 	Height   int64
 }
 
-// GetUser will return nonce and public key registered
+// GetUserContext will return nonce and public key registered
 // for a given address if it was ever used.
 // If it returns (nil, nil), then this address never signed
 // a transaction before (and can use nonce = 0)
-func (cc *CustomClient) GetUser(addr weave.Address) (*UserResponse, error) {
+func (cc *CustomClient) GetUserContext(ctx context.Context, addr weave.Address) (*UserResponse, error) {
 	// make sure we send a valid address to the server
 	err := addr.Validate()
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid address")
 	}
 
-	resp, err := cc.AbciQuery("/auth", addr)
+	resp, err := cc.AbciQueryContext(ctx, "/auth", addr)
 	if err != nil {
 		return nil, err
 	}
@@ -406,10 +827,10 @@ func userKeyToAddr(key []byte) weave.Address {
 	return key[5:]
 }
 
-// NextNonce queries the blockchain for the next nonce
+// NextNonceContext queries the blockchain for the next nonce
 // returns 0 if the address never used
-func (cc *CustomClient) NextNonce(addr weave.Address) (int64, error) {
-	user, err := cc.GetUser(addr)
+func (cc *CustomClient) NextNonceContext(ctx context.Context, addr weave.Address) (int64, error) {
+	user, err := cc.GetUserContext(ctx, addr)
 	if err != nil {
 		return 0, err
 	}
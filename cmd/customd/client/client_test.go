@@ -1,10 +1,14 @@
 package client
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/iov-one/weave"
+	customdApp "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave-starter-kit/x/custom"
 	"github.com/iov-one/weave/coin"
 	"github.com/iov-one/weave/errors"
 	"github.com/iov-one/weave/weavetest/assert"
@@ -235,3 +239,326 @@ func TestSendMultipleTx(t *testing.T) {
 	assert.Equal(t, true, resp.Response.Height > prepH+1)
 	assert.Equal(t, true, resp2.Response.Height > prepH+1)
 }
+
+func TestRangeQuery(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+	client.WaitForHeight(conn, 2, fastWaiter)
+
+	prefix := []byte("schema:")
+	all, err := customd.AbciQuery("/?prefix", prefix)
+	assert.Nil(t, err)
+	// A schema is created for each package in the genesis.
+	assert.Equal(t, 7, len(all.Models))
+
+	page, err := customd.AbciRangeQuery(prefix, nil, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(page.Models))
+	assert.Equal(t, all.Models[:3], page.Models)
+	assert.Equal(t, true, page.Next != nil)
+
+	page, err = customd.AbciRangeQuery(prefix, page.Next, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, all.Models[3:], page.Models)
+	assert.Nil(t, page.Next)
+
+	_, err = customd.AbciRangeQuery(prefix, nil, -1)
+	assert.IsErr(t, errors.ErrInput, err)
+
+	// Page size must not change the result of an iteration.
+	for _, pageSize := range []int{1, 2, 7, 0} {
+		var models []weave.Model
+		it := customd.Iterate(prefix, pageSize)
+		for it.Next() {
+			models = append(models, it.Model())
+		}
+		assert.Nil(t, it.Err())
+		assert.Equal(t, all.Models, models)
+	}
+
+	// Iteration through an older state queries each page at its height.
+	client.WaitForHeight(conn, all.Height+1, fastWaiter)
+	opts := client.ABCIQueryOptions{Height: all.Height}
+	it := customd.IterateFromWithOptionsContext(context.Background(), prefix, nil, 2, opts)
+	var models []weave.Model
+	for it.Next() {
+		assert.Equal(t, all.Height, it.Height())
+		models = append(models, it.Model())
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, all.Models, models)
+}
+
+func TestSimulate(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+	client.WaitForHeight(conn, 2, fastWaiter)
+
+	src := faucet.PublicKey().Address()
+	rcpt := GenPrivateKey().PublicKey().Address()
+	chainID := getChainID()
+
+	amount := coin.Coin{Whole: 1000, Ticker: initBalance.Ticker}
+	tx := BuildSendTx(src, rcpt, amount, "Simulated")
+	n, err := customd.NextNonce(src)
+	assert.Nil(t, err)
+	SignTx(tx, faucet, chainID, n)
+
+	res, err := customd.Simulate(tx)
+	assert.Nil(t, err)
+	assert.Equal(t, true, res.Height > 0)
+	assert.Equal(t, true, len(res.Tags) > 0)
+	assert.Equal(t, true, res.RequiredFee.IsZero())
+
+	// Nothing was committed.
+	n2, err := customd.NextNonce(src)
+	assert.Nil(t, err)
+	assert.Equal(t, n, n2)
+	_, err = customd.GetWallet(rcpt)
+	assert.IsErr(t, errors.ErrNotFound, err)
+
+	// A transaction with an invalid nonce is rejected.
+	bad := BuildSendTx(src, rcpt, amount, "Invalid nonce")
+	SignTx(bad, faucet, chainID, n+10)
+	_, err = customd.Simulate(bad)
+	assert.Equal(t, true, err != nil)
+}
+
+func TestContextCancellation(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := customd.StatusContext(ctx); err != context.Canceled {
+		t.Fatalf("unexpected status error: %v", err)
+	}
+	if _, err := customd.AbciQueryContext(ctx, "/wallets", faucet.PublicKey().Address()); err != context.Canceled {
+		t.Fatalf("unexpected query error: %v", err)
+	}
+	rcpt := GenPrivateKey().PublicKey().Address()
+	tx := BuildSendTx(faucet.PublicKey().Address(), rcpt, coin.Coin{Whole: 1, Ticker: initBalance.Ticker}, "Cancelled")
+	if res := customd.BroadcastTxContext(ctx, tx); res.IsError() != context.Canceled {
+		t.Fatalf("unexpected broadcast error: %v", res.IsError())
+	}
+
+	// Waiting for a transaction that is never broadcasted times out.
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := customd.WaitForTxEventContext(ctx, tmtypes.Tx("never broadcasted"), tmtypes.EventTx)
+	assert.IsErr(t, errors.ErrTimeout, err)
+
+	// Subscription is cancelled together with the context.
+	ctx, cancel = context.WithCancel(context.Background())
+	headers := make(chan *tmtypes.Header, 4)
+	_, err = customd.SubscribeHeadersContext(ctx, headers)
+	assert.Nil(t, err)
+	<-headers
+	cancel()
+
+	// Headers published before the unsubscription was processed may still
+	// be received, then the channel is closed.
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-headers:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("headers channel not closed after cancellation")
+		}
+	}
+}
+
+func TestSignAndBroadcast(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+	defer customd.Close()
+
+	nonces := NewNonceManager(customd)
+	src := faucet.PublicKey().Address()
+	rcpt := GenPrivateKey().PublicKey().Address()
+	amount := coin.Coin{Whole: 1, Ticker: initBalance.Ticker}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Use up a nonce so that the cached value is out of sync and must
+	// be fetched again.
+	_, err := nonces.Next(ctx, src)
+	assert.Nil(t, err)
+
+	const senders = 5
+	results := make(chan BroadcastTxResponse, senders)
+	for i := 0; i < senders; i++ {
+		go func() {
+			tx := BuildSendTx(src, rcpt, amount, "Concurrent")
+			results <- customd.SignAndBroadcastContext(ctx, nonces, tx, faucet)
+		}()
+	}
+	for i := 0; i < senders; i++ {
+		res := <-results
+		assert.Nil(t, res.IsError())
+	}
+
+	wallet, err := customd.GetWalletContext(ctx, rcpt)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(senders), wallet.Wallet.Coins[0].Whole)
+}
+
+func TestModelQueries(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+	defer customd.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	owner := GenPrivateKey().PublicKey().Address()
+	tx := &customdApp.Tx{
+		Sum: &customdApp.Tx_CustomCreateStateMsg{
+			CustomCreateStateMsg: &custom.CreateStateMsg{
+				Metadata:   &weave.Metadata{Schema: 1},
+				InnerState: &custom.InnerState{St1: 1, St2: 2},
+				Address:    owner,
+			},
+		},
+	}
+	res := customd.SignAndBroadcastContext(ctx, NewNonceManager(customd), tx, faucet)
+	assert.Nil(t, res.IsError())
+	id := res.Response.DeliverTx.Data
+
+	state, err := customd.GetStateContext(ctx, id)
+	assert.Nil(t, err)
+	assert.Equal(t, id, state.ID)
+	assert.Equal(t, owner, state.State.Address)
+	assert.Equal(t, int64(2), state.State.InnerState.St2)
+	assert.Equal(t, true, state.Height >= res.Response.Height)
+
+	states, err := customd.ListStatesByAddressContext(ctx, owner, ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(states.States))
+	assert.Equal(t, id, states.States[0].ID)
+	assert.Nil(t, states.Next)
+
+	// An address without states returns an empty list.
+	states, err = customd.ListStatesByAddressContext(ctx, GenPrivateKey().PublicKey().Address(), ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(states.States))
+
+	_, err = customd.ListStatesByAddressContext(ctx, weave.Address{1, 2, 3}, ListOptions{})
+	assert.Equal(t, true, err != nil)
+	_, err = customd.ListStatesByAddressContext(ctx, owner, ListOptions{Limit: -1})
+	assert.IsErr(t, errors.ErrInput, err)
+
+	_, err = customd.GetTimedStateContext(ctx, []byte("missing"))
+	assert.IsErr(t, errors.ErrNotFound, err)
+	_, err = customd.GetContractContext(ctx, []byte("missing"))
+	assert.IsErr(t, errors.ErrNotFound, err)
+
+	timed, err := customd.ListTimedStatesExpiringBeforeContext(ctx, time.Now(), ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(timed.TimedStates))
+	assert.Nil(t, timed.Next)
+
+	var ptrs []*custom.State
+	keys, _, err := customd.QueryModelsContext(ctx, "/customStates", id, &ptrs)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{id}, keys)
+	assert.Equal(t, owner, ptrs[0].Address)
+
+	var notSlice custom.State
+	_, _, err = customd.QueryModelsContext(ctx, "/customStates", id, &notSlice)
+	assert.IsErr(t, errors.ErrType, err)
+}
+
+func TestTxHistoryNode(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+	defer customd.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rcpt := GenPrivateKey().PublicKey().Address()
+	tx := BuildSendTx(faucet.PublicKey().Address(), rcpt, coin.Coin{Whole: 1, Ticker: initBalance.Ticker}, "history")
+	res := customd.SignAndBroadcastContext(ctx, NewNonceManager(customd), tx, faucet)
+	assert.Nil(t, res.IsError())
+
+	// Transactions are indexed shortly after the block is committed.
+	var page *HistoryPage
+	for {
+		var err error
+		page, err = customd.TxHistoryContext(ctx, rcpt, HistoryOptions{})
+		assert.Nil(t, err)
+		if len(page.Entries) != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 1, len(page.Entries))
+	entry := page.Entries[0]
+	assert.Equal(t, res.Response.Height, entry.Height)
+	assert.Equal(t, []byte(res.Response.Hash), []byte(entry.Hash))
+	assert.Equal(t, true, !entry.Time.IsZero())
+	msg, err := entry.Tx.GetMsg()
+	assert.Nil(t, err)
+	assert.Equal(t, "cash/send", msg.Path())
+}
+
+func TestListStatesPagination(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+	defer customd.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	owner := GenPrivateKey().PublicKey().Address()
+	nonces := NewNonceManager(customd)
+	var ids [][]byte
+	for i := 0; i < 3; i++ {
+		tx := &customdApp.Tx{
+			Sum: &customdApp.Tx_CustomCreateStateMsg{
+				CustomCreateStateMsg: &custom.CreateStateMsg{
+					Metadata:   &weave.Metadata{Schema: 1},
+					InnerState: &custom.InnerState{St1: int64(i), St2: 2},
+					Address:    owner,
+				},
+			},
+		}
+		res := customd.SignAndBroadcastContext(ctx, nonces, tx, faucet)
+		assert.Nil(t, res.IsError())
+		ids = append(ids, res.Response.DeliverTx.Data)
+	}
+
+	cases := map[string]ListOptions{
+		"limit":      {Limit: 1},
+		"scan limit": {ScanLimit: 1},
+		"both":       {Limit: 2, ScanLimit: 2},
+	}
+	for testName, opts := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var got [][]byte
+			for pages := 0; ; pages++ {
+				if pages > 100 {
+					t.Fatal("listing does not end")
+				}
+				page, err := customd.ListStatesByAddressContext(ctx, owner, opts)
+				assert.Nil(t, err)
+				if opts.Limit > 0 && len(page.States) > opts.Limit {
+					t.Fatalf("want at most %d states, got %d", opts.Limit, len(page.States))
+				}
+				for _, s := range page.States {
+					got = append(got, s.ID)
+				}
+				if page.Next == nil {
+					break
+				}
+				opts.After = page.Next
+			}
+			assert.Equal(t, ids, got)
+		})
+	}
+}
@@ -3,8 +3,6 @@ package client
 import (
 	nm "github.com/tendermint/tendermint/node"
 	"github.com/tendermint/tendermint/rpc/client"
-
-	rpcclient "github.com/tendermint/tendermint/rpc/client"
 )
 
 /***
@@ -22,10 +20,17 @@ func NewLocalConnection(node *nm.Node) client.Client {
 	return client.NewLocal(node)
 }
 
-// NewHTTPConnection takes a URL and sends all requests to the remote node
+// NewHTTPConnection takes a URL and sends all requests to the remote node.
+// A comma separated list of URLs can be given to use several nodes, see
+// FailoverConnection.
 func NewHTTPConnection(remote string) client.Client {
+	if remotes := splitRemotes(remote); len(remotes) > 1 {
+		// Error is returned only when no remote is given.
+		conn, _ := NewFailoverHTTPConnection(remotes, FailoverOptions{})
+		return conn
+	}
 	// This uses a custom implementation with support for https/wss
-	// We can make local changes easily in tools, and add them back
-	// upstream as we just copied some classes over.
-	return rpcclient.NewHTTP(remote, "/websocket")
+	// and request cancellation. Subscriptions use the standard
+	// tendermint websocket client.
+	return newHTTPConnection(remote)
 }
@@ -0,0 +1,278 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/iov-one/weave"
+	tmpubsub "github.com/tendermint/tendermint/libs/pubsub"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// This file contains methods that were declared before the client API
+// accepted a context. They are kept for backward compatibility and will be
+// removed in a future release. Each of them calls its context aware
+// counterpart with a background context, so none of them can be cancelled.
+
+// Status will return the raw status from the node.
+//
+// Deprecated: Use StatusContext.
+func (cc *CustomClient) Status() (*ctypes.ResultStatus, error) {
+	return cc.StatusContext(context.Background())
+}
+
+// Genesis will return the genesis directly from the node.
+//
+// Deprecated: Use GenesisContext.
+func (cc *CustomClient) Genesis() (*tmtypes.GenesisDoc, error) {
+	return cc.GenesisContext(context.Background())
+}
+
+// ChainID will parse out the chainID from the status result.
+//
+// Deprecated: Use ChainIDContext.
+func (cc *CustomClient) ChainID() (string, error) {
+	return cc.ChainIDContext(context.Background())
+}
+
+// Height will parse out the Height from the status result.
+//
+// Deprecated: Use HeightContext.
+func (cc *CustomClient) Height() (int64, error) {
+	return cc.HeightContext(context.Background())
+}
+
+// AbciQuery calls abci query on tendermint rpc.
+//
+// Deprecated: Use AbciQueryContext.
+func (cc *CustomClient) AbciQuery(path string, data []byte) (AbciResponse, error) {
+	return cc.AbciQueryContext(context.Background(), path, data)
+}
+
+// AbciQueryWithOptions is like AbciQuery but allows to provide query options.
+//
+// Deprecated: Use AbciQueryWithOptionsContext.
+func (cc *CustomClient) AbciQueryWithOptions(path string, data []byte, opts client.ABCIQueryOptions) (AbciResponse, error) {
+	return cc.AbciQueryWithOptionsContext(context.Background(), path, data, opts)
+}
+
+// AbciRangeQuery returns a single page of models stored under given database
+// key prefix.
+//
+// Deprecated: Use AbciRangeQueryContext.
+func (cc *CustomClient) AbciRangeQuery(prefix, cursor []byte, limit int) (AbciResponse, error) {
+	return cc.AbciRangeQueryContext(context.Background(), prefix, cursor, limit)
+}
+
+// Iterate returns an iterator over all models stored under given database key
+// prefix.
+//
+// Deprecated: Use IterateContext.
+func (cc *CustomClient) Iterate(prefix []byte, pageSize int) *ModelIterator {
+	return cc.IterateContext(context.Background(), prefix, pageSize)
+}
+
+// IterateFrom is like Iterate, but the iteration starts with the cursor key.
+//
+// Deprecated: Use IterateFromContext.
+func (cc *CustomClient) IterateFrom(prefix, cursor []byte, pageSize int) *ModelIterator {
+	return cc.IterateFromContext(context.Background(), prefix, cursor, pageSize)
+}
+
+// TxSearch searches transactions using underlying tendermint client.
+//
+// Deprecated: Use TxSearchContext.
+func (cc *CustomClient) TxSearch(query string, prove bool, page, perPage int) (*ctypes.ResultTxSearch, error) {
+	return cc.TxSearchContext(context.Background(), query, prove, page, perPage)
+}
+
+// Simulate executes a transaction without committing any change.
+//
+// Deprecated: Use SimulateContext.
+func (cc *CustomClient) Simulate(tx weave.Tx) (*SimulateResponse, error) {
+	return cc.SimulateContext(context.Background(), tx)
+}
+
+// BroadcastTx serializes a signed transaction and writes to the blockchain.
+//
+// Deprecated: Use BroadcastTxContext.
+func (cc *CustomClient) BroadcastTx(tx weave.Tx) BroadcastTxResponse {
+	return cc.BroadcastTxContext(context.Background(), tx)
+}
+
+// BroadcastTxSync brodcasts transactions synchronously.
+//
+// Deprecated: Use BroadcastTxSyncContext with a context with a timeout.
+func (cc *CustomClient) BroadcastTxSync(tx weave.Tx, timeout time.Duration) BroadcastTxResponse {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return cc.BroadcastTxSyncContext(ctx, tx)
+}
+
+// BroadcastTxAsync will output the result or error to the given channel.
+//
+// Deprecated: Use BroadcastTxAsyncContext.
+func (cc *CustomClient) BroadcastTxAsync(tx weave.Tx, out chan<- BroadcastTxResponse) {
+	cc.BroadcastTxAsyncContext(context.Background(), tx, out)
+}
+
+// WaitForTxEvent listens for and particular event type of evtTyp to be fired.
+//
+// Deprecated: Use WaitForTxEventContext with a context with a timeout.
+func (cc *CustomClient) WaitForTxEvent(tx tmtypes.Tx, evtTyp string, timeout time.Duration) (tmtypes.TMEventData, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return cc.WaitForTxEventContext(ctx, tx, evtTyp)
+}
+
+// SubscribeHeaders queries for headers and starts a goroutine to typecase
+// the events into Headers.
+//
+// Deprecated: Use SubscribeHeadersContext.
+func (cc *CustomClient) SubscribeHeaders(out chan<- *tmtypes.Header) (func(), error) {
+	return cc.SubscribeHeadersContext(context.Background(), out)
+}
+
+// Subscribe will take an arbitrary query and push all events to the returned
+// channel.
+//
+// Deprecated: Use SubscribeContext.
+func (cc *CustomClient) Subscribe(query tmpubsub.Query) (<-chan ctypes.ResultEvent, func(), error) {
+	return cc.SubscribeContext(context.Background(), query)
+}
+
+// UnsubscribeAll cancels all subscriptions.
+//
+// Deprecated: Use UnsubscribeAllContext.
+func (cc *CustomClient) UnsubscribeAll() error {
+	return cc.UnsubscribeAllContext(context.Background())
+}
+
+// GetWallet will return a wallet given an address.
+//
+// Deprecated: Use GetWalletContext.
+func (cc *CustomClient) GetWallet(addr weave.Address) (*WalletResponse, error) {
+	return cc.GetWalletContext(context.Background(), addr)
+}
+
+// GetUser will return nonce and public key registered for a given address if
+// it was ever used.
+//
+// Deprecated: Use GetUserContext.
+func (cc *CustomClient) GetUser(addr weave.Address) (*UserResponse, error) {
+	return cc.GetUserContext(context.Background(), addr)
+}
+
+// NextNonce queries the blockchain for the next nonce.
+//
+// Deprecated: Use NextNonceContext.
+func (cc *CustomClient) NextNonce(addr weave.Address) (int64, error) {
+	return cc.NextNonceContext(context.Background(), addr)
+}
+
+// Status returns the status of the in memory node.
+//
+// Deprecated: Use StatusContext.
+func (c *InMemoryClient) Status() (*ctypes.ResultStatus, error) {
+	return c.StatusContext(context.Background())
+}
+
+// ChainID returns the chain ID used to initialize the application.
+//
+// Deprecated: Use ChainIDContext.
+func (c *InMemoryClient) ChainID() (string, error) {
+	return c.ChainIDContext(context.Background())
+}
+
+// Height returns the height of the latest committed block.
+//
+// Deprecated: Use HeightContext.
+func (c *InMemoryClient) Height() (int64, error) {
+	return c.HeightContext(context.Background())
+}
+
+// GetUser will return nonce and public key registered for a given address if
+// it was ever used.
+//
+// Deprecated: Use GetUserContext.
+func (c *InMemoryClient) GetUser(addr weave.Address) (*UserResponse, error) {
+	return c.GetUserContext(context.Background(), addr)
+}
+
+// GetWallet will return a wallet given an address.
+//
+// Deprecated: Use GetWalletContext.
+func (c *InMemoryClient) GetWallet(addr weave.Address) (*WalletResponse, error) {
+	return c.GetWalletContext(context.Background(), addr)
+}
+
+// NextNonce returns the next nonce of the given address.
+//
+// Deprecated: Use NextNonceContext.
+func (c *InMemoryClient) NextNonce(addr weave.Address) (int64, error) {
+	return c.NextNonceContext(context.Background(), addr)
+}
+
+// AbciQuery queries the application state.
+//
+// Deprecated: Use AbciQueryContext.
+func (c *InMemoryClient) AbciQuery(path string, data []byte) (AbciResponse, error) {
+	return c.AbciQueryContext(context.Background(), path, data)
+}
+
+// AbciRangeQuery returns a single page of models stored under given database
+// key prefix.
+//
+// Deprecated: Use AbciRangeQueryContext.
+func (c *InMemoryClient) AbciRangeQuery(prefix, cursor []byte, limit int) (AbciResponse, error) {
+	return c.AbciRangeQueryContext(context.Background(), prefix, cursor, limit)
+}
+
+// Simulate executes a transaction without committing any change.
+//
+// Deprecated: Use SimulateContext.
+func (c *InMemoryClient) Simulate(tx weave.Tx) (*SimulateResponse, error) {
+	return c.SimulateContext(context.Background(), tx)
+}
+
+// BroadcastTx includes the transaction in a new block, if it passes the
+// check.
+//
+// Deprecated: Use BroadcastTxContext.
+func (c *InMemoryClient) BroadcastTx(tx weave.Tx) BroadcastTxResponse {
+	return c.BroadcastTxContext(context.Background(), tx)
+}
+
+// BroadcastTxAsync writes the result of BroadcastTx to the given channel.
+//
+// Deprecated: Use BroadcastTxAsyncContext.
+func (c *InMemoryClient) BroadcastTxAsync(tx weave.Tx, out chan<- BroadcastTxResponse) {
+	c.BroadcastTxAsyncContext(context.Background(), tx, out)
+}
+
+// BroadcastTxSync is like BroadcastTx but a check failure is returned as an
+// error.
+//
+// Deprecated: Use BroadcastTxSyncContext.
+func (c *InMemoryClient) BroadcastTxSync(tx weave.Tx, timeout time.Duration) BroadcastTxResponse {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.BroadcastTxSyncContext(ctx, tx)
+}
+
+// TxSearch returns committed transactions matching given query.
+//
+// Deprecated: Use TxSearchContext.
+func (c *InMemoryClient) TxSearch(query string, prove bool, page, perPage int) (*ctypes.ResultTxSearch, error) {
+	return c.TxSearchContext(context.Background(), query, prove, page, perPage)
+}
+
+// Subscribe will take an arbitrary query and push all events to the returned
+// channel.
+//
+// Deprecated: Use SubscribeContext.
+func (c *InMemoryClient) Subscribe(query tmpubsub.Query) (<-chan ctypes.ResultEvent, func(), error) {
+	return c.SubscribeContext(context.Background(), query)
+}
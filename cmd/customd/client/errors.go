@@ -11,4 +11,10 @@ var (
 	ErrInvalid = errors.Register(122, "invalid")
 	// ErrPermission is returned when an action is not permitted
 	ErrPermission = errors.Register(123, "not permitted")
+	// ErrInvalidProof is returned when a query result or a header cannot
+	// be verified
+	ErrInvalidProof = errors.Register(124, "invalid proof")
+	// ErrRPC is returned when the node responds to a request with an
+	// error
+	ErrRPC = errors.Register(125, "rpc error")
 )
@@ -0,0 +1,615 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iov-one/weave/errors"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+const (
+	// DefaultFailoverRetries is the default number of times an idempotent
+	// request is retried after all endpoints failed.
+	DefaultFailoverRetries = 2
+	// DefaultFailoverBackoff is the default time to wait before the first
+	// retry.
+	DefaultFailoverBackoff = 100 * time.Millisecond
+	// DefaultRecheckInterval is the default time after which an unhealthy
+	// endpoint is checked again.
+	DefaultRecheckInterval = 10 * time.Second
+)
+
+// FailoverOptions configures a FailoverConnection. Zero values are replaced
+// with defaults.
+type FailoverOptions struct {
+	// Retries is the number of times an idempotent request is retried
+	// after all endpoints failed to serve it.
+	Retries int
+	// Backoff is the time to wait before the first retry. It is doubled
+	// with each following retry.
+	Backoff time.Duration
+	// RecheckInterval is the time after which an endpoint marked as
+	// unhealthy is checked again using the status request.
+	RecheckInterval time.Duration
+	// OnRequest, if set, is called after each request sent to an
+	// endpoint, with the endpoint name, the request method and its
+	// result. Use it to collect metrics or to log which node served a
+	// request.
+	OnRequest func(endpoint, method string, err error)
+}
+
+// Endpoint is a single node connection used by a FailoverConnection.
+type Endpoint struct {
+	// Name identifies the endpoint in the stats, usually the node address.
+	Name string
+	Conn client.Client
+}
+
+// EndpointStats describes the state of an endpoint.
+type EndpointStats struct {
+	Name    string
+	Healthy bool
+	// Served is the number of requests the endpoint responded to.
+	Served uint64
+	// Failed is the number of requests that failed because the
+	// endpoint could not be reached.
+	Failed uint64
+	// LastError is the last connection error, if any.
+	LastError error
+}
+
+// FailoverConnection is a tendermint client that is using several nodes.
+// Requests are sent to the first healthy endpoint, in the order the
+// endpoints were given. An endpoint that cannot be reached is marked as
+// unhealthy and is not used until it passes a status check again.
+//
+// Requests that do not change the state are retried with the following
+// endpoints and, after all of them failed, once again after a backoff.
+// Broadcasts are sent to another endpoint only if the connection could not
+// be established, so that a transaction is never sent twice. Only connection
+// errors cause a failover, errors returned by a node are returned as they
+// are.
+//
+// Subscriptions are bound to the endpoint that was used to create them.
+//
+// Requests can be bound to a context using WithContext. Requests to
+// endpoints that do not implement ContextBinder cannot be cancelled.
+type FailoverConnection struct {
+	cmn.BaseService
+
+	opts      FailoverOptions
+	endpoints []*endpoint
+	// ctx is the context requests are bound to.
+	ctx context.Context
+
+	// mu is shared by all copies returned by WithContext.
+	mu *sync.Mutex
+	// subscriptions maps a subscriber and query to the endpoint
+	// serving the subscription.
+	subscriptions map[subscription]*endpoint
+}
+
+var (
+	_ client.Client = (*FailoverConnection)(nil)
+	_ ContextBinder = (*FailoverConnection)(nil)
+)
+
+type endpoint struct {
+	Endpoint
+
+	healthy bool
+	// failedAt is the time of the last failure or health check.
+	failedAt time.Time
+	served   uint64
+	failed   uint64
+	lastErr  error
+}
+
+type subscription struct {
+	subscriber string
+	query      string
+}
+
+// NewFailoverConnection returns a connection using given endpoints. All
+// endpoints are assumed to be healthy until a request fails.
+func NewFailoverConnection(endpoints []Endpoint, opts FailoverOptions) (*FailoverConnection, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.Wrap(errors.ErrInput, "no endpoints")
+	}
+	if opts.Retries <= 0 {
+		opts.Retries = DefaultFailoverRetries
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultFailoverBackoff
+	}
+	if opts.RecheckInterval <= 0 {
+		opts.RecheckInterval = DefaultRecheckInterval
+	}
+	c := &FailoverConnection{
+		opts:          opts,
+		ctx:           context.Background(),
+		mu:            &sync.Mutex{},
+		subscriptions: make(map[subscription]*endpoint),
+	}
+	for _, e := range endpoints {
+		c.endpoints = append(c.endpoints, &endpoint{Endpoint: e, healthy: true})
+	}
+	c.BaseService = *cmn.NewBaseService(nil, "FailoverConnection", c)
+	return c, nil
+}
+
+// NewFailoverHTTPConnection returns a connection using a remote node at
+// each of the given addresses.
+func NewFailoverHTTPConnection(remotes []string, opts FailoverOptions) (*FailoverConnection, error) {
+	endpoints := make([]Endpoint, 0, len(remotes))
+	for _, r := range remotes {
+		endpoints = append(endpoints, Endpoint{Name: r, Conn: newHTTPConnection(r)})
+	}
+	return NewFailoverConnection(endpoints, opts)
+}
+
+// splitRemotes returns the addresses of a comma separated list.
+func splitRemotes(remote string) []string {
+	var remotes []string
+	for _, r := range strings.Split(remote, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			remotes = append(remotes, r)
+		}
+	}
+	return remotes
+}
+
+// WithContext implements ContextBinder. The returned connection shares the
+// endpoints and their state with the original one.
+func (c *FailoverConnection) WithContext(ctx context.Context) client.Client {
+	bound := *c
+	bound.ctx = ctx
+	return &bound
+}
+
+// OnStart starts all endpoints.
+func (c *FailoverConnection) OnStart() error {
+	for _, e := range c.endpoints {
+		if err := e.Conn.Start(); err != nil && err != cmn.ErrAlreadyStarted {
+			return errors.Wrapf(err, "cannot start %s", e.Name)
+		}
+	}
+	return nil
+}
+
+// OnStop stops all endpoints.
+func (c *FailoverConnection) OnStop() {
+	for _, e := range c.endpoints {
+		e.Conn.Stop()
+	}
+}
+
+// Stats returns the state of all endpoints.
+func (c *FailoverConnection) Stats() []EndpointStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make([]EndpointStats, len(c.endpoints))
+	for i, e := range c.endpoints {
+		stats[i] = EndpointStats{
+			Name:      e.Name,
+			Healthy:   e.healthy,
+			Served:    e.served,
+			Failed:    e.failed,
+			LastError: e.lastErr,
+		}
+	}
+	return stats
+}
+
+// CheckHealth sends a status request to all endpoints and updates their
+// state. A node that is catching up is considered unhealthy. It returns the
+// number of healthy endpoints.
+func (c *FailoverConnection) CheckHealth() int {
+	var healthy int
+	for _, e := range c.endpoints {
+		if c.check(e) == nil {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// check sends a status request to the endpoint and updates its state.
+func (c *FailoverConnection) check(e *endpoint) error {
+	conn, _ := bindContext(c.ctx, e.Conn)
+	status, err := conn.Status()
+	if err == nil && status.SyncInfo.CatchingUp {
+		err = errors.Wrap(errors.ErrState, "node is catching up")
+	}
+	c.report(e, "status", err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		e.healthy = false
+		e.failedAt = time.Now()
+		e.lastErr = err
+		return err
+	}
+	e.healthy = true
+	return nil
+}
+
+// pick returns the endpoint that should be used for the next request,
+// skipping those that were already tried. Healthy endpoints are preferred.
+// Unhealthy endpoints are checked again once the recheck interval passed.
+// If no endpoint is known to work, the one that failed the longest time ago
+// is returned. It returns nil if all endpoints were tried.
+func (c *FailoverConnection) pick(tried map[*endpoint]bool) *endpoint {
+	c.mu.Lock()
+	var recheck []*endpoint
+	var oldest *endpoint
+	for _, e := range c.endpoints {
+		if tried[e] {
+			continue
+		}
+		if e.healthy {
+			c.mu.Unlock()
+			return e
+		}
+		if time.Since(e.failedAt) >= c.opts.RecheckInterval {
+			recheck = append(recheck, e)
+		}
+		if oldest == nil || e.failedAt.Before(oldest.failedAt) {
+			oldest = e
+		}
+	}
+	c.mu.Unlock()
+
+	for _, e := range recheck {
+		if c.check(e) == nil {
+			return e
+		}
+	}
+	return oldest
+}
+
+// call sends a request to the endpoint and updates its state. Only
+// connection errors mark the endpoint as unhealthy.
+func (c *FailoverConnection) call(e *endpoint, method string, fn func(client.Client) error) error {
+	conn, _ := bindContext(c.ctx, e.Conn)
+	err := fn(conn)
+	c.report(e, method, err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if isConnectionError(err) {
+		e.failed++
+		e.healthy = false
+		e.failedAt = time.Now()
+		e.lastErr = err
+	} else {
+		e.served++
+		e.healthy = true
+	}
+	return err
+}
+
+func (c *FailoverConnection) report(e *endpoint, method string, err error) {
+	if c.opts.OnRequest != nil {
+		c.opts.OnRequest(e.Name, method, err)
+	}
+}
+
+// read sends an idempotent request. It fails over to the next endpoint on a
+// connection error and retries with a backoff after all endpoints failed.
+func (c *FailoverConnection) read(method string, fn func(client.Client) error) error {
+	backoff := c.opts.Backoff
+	for retry := 0; ; retry++ {
+		_, err := c.tryAll(method, isConnectionError, fn)
+		if !isConnectionError(err) || retry >= c.opts.Retries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// write sends a request that must not be repeated. It fails over to the next
+// endpoint only when the connection could not be established, which means
+// that the request was not sent.
+func (c *FailoverConnection) write(method string, fn func(client.Client) error) error {
+	_, err := c.tryAll(method, isDialError, fn)
+	return err
+}
+
+// tryAll sends the request to subsequent endpoints for as long as it fails
+// with an error accepted by the failover function. It returns the endpoint
+// that was used last.
+func (c *FailoverConnection) tryAll(method string, failover func(error) bool, fn func(client.Client) error) (*endpoint, error) {
+	tried := make(map[*endpoint]bool)
+	var (
+		used *endpoint
+		err  error
+	)
+	for e := c.pick(tried); e != nil; e = c.pick(tried) {
+		tried[e] = true
+		used = e
+		err = c.call(e, method, fn)
+		if !failover(err) {
+			return used, err
+		}
+	}
+	return used, err
+}
+
+// rootCause returns the original error, unwrapping errors created by the
+// tendermint RPC client.
+func rootCause(err error) error {
+	for {
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			if e.Cause() == nil || e.Cause() == err {
+				return err
+			}
+			err = e.Cause()
+		case *url.Error:
+			err = e.Err
+		default:
+			return err
+		}
+	}
+}
+
+// isConnectionError returns true if the error was caused by a network
+// failure and not returned by the node. A cancelled request is not a
+// connection failure, even though a context deadline is a net.Error.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	cause := rootCause(err)
+	if cause == context.Canceled || cause == context.DeadlineExceeded {
+		return false
+	}
+	switch cause.(type) {
+	case net.Error:
+		return true
+	default:
+		return cause == io.EOF || cause == io.ErrUnexpectedEOF
+	}
+}
+
+// isDialError returns true if the error was caused by a failure to connect,
+// before any data was sent.
+func isDialError(err error) bool {
+	if err == nil {
+		return false
+	}
+	op, ok := rootCause(err).(*net.OpError)
+	return ok && op.Op == "dial"
+}
+
+// ABCIInfo implements client.Client.
+func (c *FailoverConnection) ABCIInfo() (res *ctypes.ResultABCIInfo, err error) {
+	err = c.read("abci_info", func(conn client.Client) (err error) {
+		res, err = conn.ABCIInfo()
+		return err
+	})
+	return res, err
+}
+
+// ABCIQuery implements client.Client.
+func (c *FailoverConnection) ABCIQuery(path string, data cmn.HexBytes) (res *ctypes.ResultABCIQuery, err error) {
+	return c.ABCIQueryWithOptions(path, data, client.DefaultABCIQueryOptions)
+}
+
+// ABCIQueryWithOptions implements client.Client.
+func (c *FailoverConnection) ABCIQueryWithOptions(path string, data cmn.HexBytes, opts client.ABCIQueryOptions) (res *ctypes.ResultABCIQuery, err error) {
+	err = c.read("abci_query", func(conn client.Client) (err error) {
+		res, err = conn.ABCIQueryWithOptions(path, data, opts)
+		return err
+	})
+	return res, err
+}
+
+// BroadcastTxCommit implements client.Client.
+func (c *FailoverConnection) BroadcastTxCommit(tx tmtypes.Tx) (res *ctypes.ResultBroadcastTxCommit, err error) {
+	err = c.write("broadcast_tx_commit", func(conn client.Client) (err error) {
+		res, err = conn.BroadcastTxCommit(tx)
+		return err
+	})
+	return res, err
+}
+
+// BroadcastTxAsync implements client.Client.
+func (c *FailoverConnection) BroadcastTxAsync(tx tmtypes.Tx) (res *ctypes.ResultBroadcastTx, err error) {
+	err = c.write("broadcast_tx_async", func(conn client.Client) (err error) {
+		res, err = conn.BroadcastTxAsync(tx)
+		return err
+	})
+	return res, err
+}
+
+// BroadcastTxSync implements client.Client.
+func (c *FailoverConnection) BroadcastTxSync(tx tmtypes.Tx) (res *ctypes.ResultBroadcastTx, err error) {
+	err = c.write("broadcast_tx_sync", func(conn client.Client) (err error) {
+		res, err = conn.BroadcastTxSync(tx)
+		return err
+	})
+	return res, err
+}
+
+// Block implements client.Client.
+func (c *FailoverConnection) Block(height *int64) (res *ctypes.ResultBlock, err error) {
+	err = c.read("block", func(conn client.Client) (err error) {
+		res, err = conn.Block(height)
+		return err
+	})
+	return res, err
+}
+
+// BlockResults implements client.Client.
+func (c *FailoverConnection) BlockResults(height *int64) (res *ctypes.ResultBlockResults, err error) {
+	err = c.read("block_results", func(conn client.Client) (err error) {
+		res, err = conn.BlockResults(height)
+		return err
+	})
+	return res, err
+}
+
+// Commit implements client.Client.
+func (c *FailoverConnection) Commit(height *int64) (res *ctypes.ResultCommit, err error) {
+	err = c.read("commit", func(conn client.Client) (err error) {
+		res, err = conn.Commit(height)
+		return err
+	})
+	return res, err
+}
+
+// Validators implements client.Client.
+func (c *FailoverConnection) Validators(height *int64) (res *ctypes.ResultValidators, err error) {
+	err = c.read("validators", func(conn client.Client) (err error) {
+		res, err = conn.Validators(height)
+		return err
+	})
+	return res, err
+}
+
+// Tx implements client.Client.
+func (c *FailoverConnection) Tx(hash []byte, prove bool) (res *ctypes.ResultTx, err error) {
+	err = c.read("tx", func(conn client.Client) (err error) {
+		res, err = conn.Tx(hash, prove)
+		return err
+	})
+	return res, err
+}
+
+// TxSearch implements client.Client.
+func (c *FailoverConnection) TxSearch(query string, prove bool, page, perPage int) (res *ctypes.ResultTxSearch, err error) {
+	err = c.read("tx_search", func(conn client.Client) (err error) {
+		res, err = conn.TxSearch(query, prove, page, perPage)
+		return err
+	})
+	return res, err
+}
+
+// Genesis implements client.Client.
+func (c *FailoverConnection) Genesis() (res *ctypes.ResultGenesis, err error) {
+	err = c.read("genesis", func(conn client.Client) (err error) {
+		res, err = conn.Genesis()
+		return err
+	})
+	return res, err
+}
+
+// BlockchainInfo implements client.Client.
+func (c *FailoverConnection) BlockchainInfo(minHeight, maxHeight int64) (res *ctypes.ResultBlockchainInfo, err error) {
+	err = c.read("blockchain", func(conn client.Client) (err error) {
+		res, err = conn.BlockchainInfo(minHeight, maxHeight)
+		return err
+	})
+	return res, err
+}
+
+// Status implements client.Client.
+func (c *FailoverConnection) Status() (res *ctypes.ResultStatus, err error) {
+	err = c.read("status", func(conn client.Client) (err error) {
+		res, err = conn.Status()
+		return err
+	})
+	return res, err
+}
+
+// NetInfo implements client.Client.
+func (c *FailoverConnection) NetInfo() (res *ctypes.ResultNetInfo, err error) {
+	err = c.read("net_info", func(conn client.Client) (err error) {
+		res, err = conn.NetInfo()
+		return err
+	})
+	return res, err
+}
+
+// DumpConsensusState implements client.Client.
+func (c *FailoverConnection) DumpConsensusState() (res *ctypes.ResultDumpConsensusState, err error) {
+	err = c.read("dump_consensus_state", func(conn client.Client) (err error) {
+		res, err = conn.DumpConsensusState()
+		return err
+	})
+	return res, err
+}
+
+// ConsensusState implements client.Client.
+func (c *FailoverConnection) ConsensusState() (res *ctypes.ResultConsensusState, err error) {
+	err = c.read("consensus_state", func(conn client.Client) (err error) {
+		res, err = conn.ConsensusState()
+		return err
+	})
+	return res, err
+}
+
+// Health implements client.Client.
+func (c *FailoverConnection) Health() (res *ctypes.ResultHealth, err error) {
+	err = c.read("health", func(conn client.Client) (err error) {
+		res, err = conn.Health()
+		return err
+	})
+	return res, err
+}
+
+// Subscribe implements client.Client. The subscription is created using
+// the first healthy endpoint and is not moved to another endpoint if that
+// one fails.
+func (c *FailoverConnection) Subscribe(ctx context.Context, subscriber, query string, outCapacity ...int) (out <-chan ctypes.ResultEvent, err error) {
+	used, err := c.tryAll("subscribe", isConnectionError, func(conn client.Client) (err error) {
+		out, err = conn.Subscribe(ctx, subscriber, query, outCapacity...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.subscriptions[subscription{subscriber: subscriber, query: query}] = used
+	c.mu.Unlock()
+	return out, nil
+}
+
+// Unsubscribe implements client.Client.
+func (c *FailoverConnection) Unsubscribe(ctx context.Context, subscriber, query string) error {
+	key := subscription{subscriber: subscriber, query: query}
+	c.mu.Lock()
+	e, ok := c.subscriptions[key]
+	delete(c.subscriptions, key)
+	c.mu.Unlock()
+	if !ok {
+		return errors.Wrap(errors.ErrNotFound, "subscription")
+	}
+	return e.Conn.Unsubscribe(ctx, subscriber, query)
+}
+
+// UnsubscribeAll implements client.Client.
+func (c *FailoverConnection) UnsubscribeAll(ctx context.Context, subscriber string) error {
+	used := make(map[*endpoint]bool)
+	c.mu.Lock()
+	for key, e := range c.subscriptions {
+		if key.subscriber == subscriber {
+			used[e] = true
+			delete(c.subscriptions, key)
+		}
+	}
+	c.mu.Unlock()
+
+	var errs error
+	for e := range used {
+		errs = errors.Append(errs, e.Conn.UnsubscribeAll(ctx, subscriber))
+	}
+	return errs
+}
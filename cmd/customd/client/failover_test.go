@@ -0,0 +1,165 @@
+package client
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/weavetest/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// endpointMock implements the subset of client.Client used by the tests.
+// All methods fail with err, if set.
+type endpointMock struct {
+	client.Client
+
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (m *endpointMock) setErr(err error) {
+	m.mu.Lock()
+	m.err = err
+	m.mu.Unlock()
+}
+
+func (m *endpointMock) call() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	return m.err
+}
+
+func (m *endpointMock) Status() (*ctypes.ResultStatus, error) {
+	if err := m.call(); err != nil {
+		return nil, err
+	}
+	return &ctypes.ResultStatus{}, nil
+}
+
+func (m *endpointMock) ABCIQueryWithOptions(path string, data cmn.HexBytes, opts client.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	if err := m.call(); err != nil {
+		return nil, err
+	}
+	return &ctypes.ResultABCIQuery{Response: abci.ResponseQuery{Key: data}}, nil
+}
+
+func (m *endpointMock) BroadcastTxSync(tx tmtypes.Tx) (*ctypes.ResultBroadcastTx, error) {
+	if err := m.call(); err != nil {
+		return nil, err
+	}
+	return &ctypes.ResultBroadcastTx{Hash: tx.Hash()}, nil
+}
+
+func TestFailoverConnection(t *testing.T) {
+	// Errors are wrapped the same way the tendermint HTTP client does.
+	refused := errors.Wrap(&url.Error{
+		Op:  "Post",
+		URL: "http://localhost:26657",
+		Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED},
+	}, "ABCIQuery")
+	reset := errors.Wrap(io.ErrUnexpectedEOF, "BroadcastTxSync")
+	nodeErr := errors.Wrap(errors.ErrNotFound, "Response error")
+
+	first, second := &endpointMock{}, &endpointMock{}
+	var served []string
+	conn, err := NewFailoverConnection([]Endpoint{
+		{Name: "first", Conn: first},
+		{Name: "second", Conn: second},
+	}, FailoverOptions{
+		Backoff:         time.Millisecond,
+		RecheckInterval: time.Hour,
+		OnRequest: func(endpoint, method string, err error) {
+			if err == nil {
+				served = append(served, endpoint)
+			}
+		},
+	})
+	assert.Nil(t, err)
+
+	// Unreachable endpoint is skipped.
+	first.setErr(refused)
+	res, err := conn.ABCIQuery("/", []byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("key"), []byte(res.Response.Key))
+	assert.Equal(t, []string{"second"}, served)
+	stats := conn.Stats()
+	assert.Equal(t, false, stats[0].Healthy)
+	assert.Equal(t, uint64(1), stats[0].Failed)
+	assert.Equal(t, true, stats[1].Healthy)
+	assert.Equal(t, uint64(1), stats[1].Served)
+
+	// Node errors are returned without failover.
+	second.setErr(nodeErr)
+	_, err = conn.ABCIQuery("/", []byte("key"))
+	assert.IsErr(t, errors.ErrNotFound, err)
+	assert.Equal(t, true, conn.Stats()[1].Healthy)
+
+	// Endpoint is used again once it passes the health check.
+	first.setErr(nil)
+	second.setErr(nil)
+	assert.Equal(t, 2, conn.CheckHealth())
+	served = nil
+	_, err = conn.ABCIQuery("/", []byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first"}, served)
+
+	// Broadcast is not repeated if the request might have been sent.
+	first.setErr(reset)
+	served = nil
+	_, err = conn.BroadcastTxSync(tmtypes.Tx("tx"))
+	if !isConnectionError(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, 0, len(served))
+
+	// But it is sent to another endpoint if the connection failed.
+	first.setErr(nil)
+	assert.Equal(t, 2, conn.CheckHealth())
+	first.setErr(refused)
+	served = nil
+	_, err = conn.BroadcastTxSync(tmtypes.Tx("tx"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"second"}, served)
+
+	// When all endpoints are down, idempotent requests are retried.
+	first.setErr(refused)
+	second.setErr(refused)
+	first.calls, second.calls = 0, 0
+	_, err = conn.ABCIQuery("/", []byte("key"))
+	if !isDialError(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assert.Equal(t, 1+DefaultFailoverRetries, first.calls)
+	assert.Equal(t, 1+DefaultFailoverRetries, second.calls)
+}
+
+func TestFailoverClient(t *testing.T) {
+	conn, err := NewFailoverConnection([]Endpoint{
+		// Nothing is listening on this port.
+		{Name: "unreachable", Conn: client.NewHTTP("tcp://127.0.0.1:1", "/websocket")},
+		{Name: "local", Conn: NewLocalConnection(node)},
+	}, FailoverOptions{})
+	assert.Nil(t, err)
+	customd := NewClient(conn)
+
+	wallet, err := customd.GetWallet(faucet.PublicKey().Address())
+	assert.Nil(t, err)
+	assert.Equal(t, true, wallet != nil)
+
+	stats := conn.Stats()
+	assert.Equal(t, false, stats[0].Healthy)
+	assert.Equal(t, uint64(1), stats[0].Failed)
+	assert.Equal(t, uint64(1), stats[1].Served)
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/store/iavl"
+	"github.com/iov-one/weave/x/cash"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/log"
+	tmtype "github.com/tendermint/tendermint/types"
+)
+
+// genesisWalletsKey is the application state attribute holding the
+// genesis wallets.
+const genesisWalletsKey = "cash"
+
+// GenesisWallets returns the wallets declared in the application state of
+// the genesis. Unlike WalletStore.LoadFromGenesisFile, it does not generate
+// keys or default coins: a wallet without an address is an error and a
+// wallet without coins is empty.
+func GenesisWallets(genesis *tmtype.GenesisDoc) (WalletStore, error) {
+	var reqs WalletRequests
+	if len(genesis.AppState) != 0 {
+		if err := json.Unmarshal(genesis.AppState, &reqs); err != nil {
+			return WalletStore{}, errors.Wrapf(errors.ErrInput, "cannot decode wallets: %s", err)
+		}
+	}
+	var errs error
+	ws := WalletStore{Wallets: make([]cash.GenesisAccount, len(reqs.Wallets))}
+	for i, w := range reqs.Wallets {
+		if len(w.Address) == 0 {
+			errs = errors.AppendField(errs, fmt.Sprintf("Wallets.%d.Address", i), errors.ErrEmpty)
+		}
+		ws.Wallets[i] = cash.GenesisAccount{
+			Address: w.Address,
+			Set:     cash.Set{Coins: w.Coins},
+		}
+	}
+	return ws, errs
+}
+
+// Validate returns an error if any wallet has an invalid address or coins,
+// or if two wallets have the same address. The cash initializer would
+// silently keep only the last of them.
+func (w WalletStore) Validate() error {
+	var errs error
+	seen := make(map[string]int, len(w.Wallets))
+	for i, acct := range w.Wallets {
+		field := fmt.Sprintf("Wallets.%d", i)
+		if err := acct.Address.Validate(); err != nil {
+			errs = errors.AppendField(errs, field+".Address", err)
+		} else if j, ok := seen[acct.Address.String()]; ok {
+			errs = errors.AppendField(errs, field+".Address",
+				errors.Wrapf(errors.ErrDuplicate, "same as wallet %d", j))
+		} else {
+			seen[acct.Address.String()] = i
+		}
+		errs = errors.AppendField(errs, field+".Coins", cash.XCoins(&acct.Set).Validate())
+	}
+	return errs
+}
+
+// AddGenesisWallets appends the wallets to the application state of the
+// genesis. Existing wallets are kept unchanged, including any attributes
+// unknown to the cash initializer, such as comments. The combined wallets
+// must be valid.
+func AddGenesisWallets(genesis *tmtype.GenesisDoc, ws WalletStore) error {
+	existing, err := GenesisWallets(genesis)
+	if err != nil {
+		return errors.Wrap(err, "genesis")
+	}
+	if err := MergeWalletStore(existing, ws).Validate(); err != nil {
+		return err
+	}
+
+	state := make(map[string]json.RawMessage)
+	if len(genesis.AppState) != 0 {
+		if err := json.Unmarshal(genesis.AppState, &state); err != nil {
+			return errors.Wrapf(errors.ErrInput, "cannot decode application state: %s", err)
+		}
+	}
+	var wallets []json.RawMessage
+	if raw, ok := state[genesisWalletsKey]; ok {
+		if err := json.Unmarshal(raw, &wallets); err != nil {
+			return errors.Wrapf(errors.ErrInput, "cannot decode wallets: %s", err)
+		}
+	}
+	for _, acct := range ws.Wallets {
+		raw, err := json.Marshal(acct)
+		if err != nil {
+			return errors.Wrapf(errors.ErrInput, "cannot encode wallet: %s", err)
+		}
+		wallets = append(wallets, raw)
+	}
+	if state[genesisWalletsKey], err = json.Marshal(wallets); err != nil {
+		return errors.Wrapf(errors.ErrInput, "cannot encode wallets: %s", err)
+	}
+	if genesis.AppState, err = json.Marshal(state); err != nil {
+		return errors.Wrapf(errors.ErrInput, "cannot encode application state: %s", err)
+	}
+	return nil
+}
+
+// ValidateGenesis returns an error if the genesis wallets are not valid or
+// if the application cannot be initialized with the genesis.
+func ValidateGenesis(genesis *tmtype.GenesisDoc) (err error) {
+	ws, err := GenesisWallets(genesis)
+	if err != nil {
+		return err
+	}
+	if err := ws.Validate(); err != nil {
+		return err
+	}
+
+	// The application panics when the initialization fails.
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Wrapf(errors.ErrInput, "cannot initialize application: %v", r)
+		}
+	}()
+	app := customd.InlineApp(iavl.MockCommitStore(), log.NewNopLogger(), false)
+	app.InitChain(abci.RequestInitChain{
+		Time:          genesis.GenesisTime,
+		ChainId:       genesis.ChainID,
+		AppStateBytes: genesis.AppState,
+	})
+	return nil
+}
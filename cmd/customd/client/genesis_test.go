@@ -0,0 +1,93 @@
+package client
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/cash"
+	tmtype "github.com/tendermint/tendermint/types"
+)
+
+func TestGenesisWallets(t *testing.T) {
+	genesis, err := tmtype.GenesisDocFromFile("./testdata/genesis.json")
+	assert.Nil(t, err)
+
+	ws, err := GenesisWallets(genesis)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.Validate())
+	assert.Equal(t, 3, len(ws.Wallets))
+	assert.Equal(t, 0, len(ws.Keys))
+
+	// Generated wallets are appended and existing ones are kept as
+	// they are, including comments.
+	added := WalletRequests{Wallets: make([]WalletRequest, 2)}.Normalize(coin.NewCoin(10, 0, "CSTM"))
+	assert.Equal(t, 2, len(added.Keys))
+	assert.Nil(t, AddGenesisWallets(genesis, added))
+	assert.Equal(t, true, strings.Contains(string(genesis.AppState), `"//name":"admin"`))
+
+	ws, err = GenesisWallets(genesis)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(ws.Wallets))
+	assert.Equal(t, added.Keys[1].PublicKey().Address(), ws.Wallets[4].Address)
+	assert.Equal(t, int64(10), ws.Wallets[4].Coins[0].Whole)
+
+	// Adding an existing address fails and does not change the genesis.
+	state := string(genesis.AppState)
+	err = AddGenesisWallets(genesis, WalletStore{Wallets: ws.Wallets[:1]})
+	assert.IsErr(t, errors.ErrDuplicate, err)
+	assert.Equal(t, state, string(genesis.AppState))
+}
+
+func TestValidateGenesis(t *testing.T) {
+	addr := weave.NewCondition("sigs", "ed25519", []byte{1}).Address()
+	appState, err := genesisAppState(addr)
+	assert.Nil(t, err)
+	genesis := &tmtype.GenesisDoc{ChainID: "genesis-test", AppState: appState}
+	assert.Nil(t, genesis.ValidateAndComplete())
+	assert.Nil(t, ValidateGenesis(genesis))
+
+	added := WalletRequests{Wallets: make([]WalletRequest, 1)}.Normalize(coin.NewCoin(10, 0, "CSTM"))
+	assert.Nil(t, AddGenesisWallets(genesis, added))
+	assert.Nil(t, ValidateGenesis(genesis))
+
+	cases := map[string]struct {
+		AppState string
+		WantErr  *errors.Error
+	}{
+		"wallet without an address": {
+			AppState: `{"cash": [{"coins": [{"whole": 1, "ticker": "CSTM"}]}]}`,
+			WantErr:  errors.ErrEmpty,
+		},
+		"duplicated address": {
+			AppState: `{"cash": [{"address": "` + addr.String() + `"}, {"address": "` + addr.String() + `"}]}`,
+			WantErr:  errors.ErrDuplicate,
+		},
+		"zero coins": {
+			AppState: `{"cash": [{"address": "` + addr.String() + `", "coins": [{"ticker": "CSTM"}]}]}`,
+			WantErr:  errors.ErrState,
+		},
+		"application cannot be initialized": {
+			AppState: `{"cash": [{"address": "` + addr.String() + `"}], "initialize_schema": [{"pkg": "cash", "ver": 0}]}`,
+			WantErr:  errors.ErrInput,
+		},
+	}
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			genesis := &tmtype.GenesisDoc{ChainID: "genesis-test", AppState: json.RawMessage(tc.AppState)}
+			assert.Nil(t, genesis.ValidateAndComplete())
+			if err := ValidateGenesis(genesis); !tc.WantErr.Is(err) {
+				t.Fatalf("unexpected error: %+v", err)
+			}
+		})
+	}
+
+	ws := WalletStore{Wallets: []cash.GenesisAccount{{Address: weave.Address{1, 2}}}}
+	if err := ws.Validate(); err == nil {
+		t.Fatal("invalid address accepted")
+	}
+}
@@ -0,0 +1,296 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave-starter-kit/x/custom"
+	"github.com/iov-one/weave/errors"
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+const (
+	// DefaultHistoryLimit is the number of transactions returned by a
+	// history query if no limit is given.
+	DefaultHistoryLimit = 20
+	// MaxHistoryLimit is the highest allowed history query limit.
+	MaxHistoryLimit = historyPageSize
+
+	// historyPageSize is the number of transactions fetched with a single
+	// search request. It is the maximum allowed by tendermint.
+	historyPageSize = 100
+)
+
+// addressKeyPrefixes are database key prefixes of models that are written
+// by transactions affecting an address, followed by the address. These are
+// the cash wallet (receiving or sending tokens, including the wallet of a
+// multisig contract) and the nonce of a signer. Written keys are tagged by
+// the key tagger, so that they can be searched in the transaction index.
+// Custom states created for an address are found by their
+// custom.StateAddressTag instead.
+var addressKeyPrefixes = []string{"cash:", "sigs:"}
+
+// HistoryOptions configures a transaction history query.
+type HistoryOptions struct {
+	// BeforeHeight limits the history to transactions included in blocks
+	// below the height. Use the Next value of a previous page to continue
+	// listing. Zero means all blocks.
+	BeforeHeight int64
+	// Limit is the maximum number of returned transactions. A page never
+	// ends in the middle of a block, so it can contain more transactions
+	// if a single block has more. Zero means DefaultHistoryLimit.
+	Limit int
+}
+
+// HistoryEntry is a transaction that affected an address.
+type HistoryEntry struct {
+	Height int64
+	// Index is the position of the transaction in the block.
+	Index uint32
+	// Time is the creation time of the block.
+	Time time.Time
+	Hash cmn.HexBytes
+	// Tx is nil if the transaction cannot be parsed.
+	Tx     *customd.Tx
+	Result abci.ResponseDeliverTx
+}
+
+// HistoryPage is a single page of the transaction history of an address.
+type HistoryPage struct {
+	// Entries are ordered from the newest to the oldest.
+	Entries []HistoryEntry
+	// Next is the BeforeHeight of the following page. It is zero if
+	// there are no more transactions.
+	Next int64
+}
+
+// historySource provides transactions and block times for the history.
+type historySource interface {
+	HeightContext(ctx context.Context) (int64, error)
+	TxSearchContext(ctx context.Context, query string, prove bool, page, perPage int) (*ctypes.ResultTxSearch, error)
+	// blockTimes returns creation times of blocks at given heights.
+	blockTimes(ctx context.Context, heights []int64) (map[int64]time.Time, error)
+}
+
+// TxHistoryContext returns a page of transactions that affected the address,
+// starting with the newest one. Transactions are found using the tags of the
+// key tagger, so the node must index all tags. The node indexes transactions
+// shortly after their block is committed, so the latest transactions may be
+// missing.
+func (cc *CustomClient) TxHistoryContext(ctx context.Context, addr weave.Address, opts HistoryOptions) (*HistoryPage, error) {
+	return txHistory(ctx, cc, addr, opts)
+}
+
+// blockTimes returns creation times of blocks at given heights. Blocks are
+// fetched in ranges, so that heights that are close to each other require a
+// single request.
+func (cc *CustomClient) blockTimes(ctx context.Context, heights []int64) (map[int64]time.Time, error) {
+	times := make(map[int64]time.Time, len(heights))
+	for _, h := range heights {
+		if _, ok := times[h]; ok {
+			continue
+		}
+		var info *ctypes.ResultBlockchainInfo
+		err := withContext(ctx, cc.conn, func(conn client.Client) (err error) {
+			// Tendermint returns at most 20 blocks at once.
+			info, err = conn.BlockchainInfo(h, h+19)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot fetch block %d", h)
+		}
+		for _, meta := range info.BlockMetas {
+			times[meta.Header.Height] = meta.Header.Time
+		}
+		if _, ok := times[h]; !ok {
+			return nil, errors.Wrapf(errors.ErrNotFound, "block %d", h)
+		}
+	}
+	return times, nil
+}
+
+func txHistory(ctx context.Context, src historySource, addr weave.Address, opts HistoryOptions) (*HistoryPage, error) {
+	if err := addr.Validate(); err != nil {
+		return nil, errors.Wrap(err, "address")
+	}
+	limit := opts.Limit
+	switch {
+	case limit == 0:
+		limit = DefaultHistoryLimit
+	case limit < 0 || limit > MaxHistoryLimit:
+		return nil, errors.Wrapf(errors.ErrInput, "limit must be between 1 and %d", MaxHistoryLimit)
+	}
+	before := opts.BeforeHeight
+	switch {
+	case before < 0:
+		return nil, errors.Wrap(errors.ErrInput, "height cannot be negative")
+	case before == 0:
+		// Bound the search to committed blocks, so that the results do
+		// not change while they are fetched page by page.
+		height, err := src.HeightContext(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot fetch height")
+		}
+		before = height + 1
+	}
+
+	var (
+		found = make(map[string]*ctypes.ResultTx)
+		// complete is the height above which all transactions of the
+		// address were found.
+		complete int64
+		more     bool
+	)
+	for _, q := range addressTagQueries(addr) {
+		query := fmt.Sprintf("%s AND tx.height < %d", q, before)
+		txs, total, err := latestTxs(ctx, src, query, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range txs {
+			found[string(tx.Hash)] = tx
+		}
+		if len(txs) < total {
+			more = true
+			if h := txs[0].Height; h > complete {
+				complete = h
+			}
+		}
+	}
+
+	sorted := sortedTxs(found)
+	var page []*ctypes.ResultTx
+	for _, tx := range sorted {
+		if tx.Height <= complete {
+			break
+		}
+		if len(page) >= limit && tx.Height != page[len(page)-1].Height {
+			more = true
+			break
+		}
+		page = append(page, tx)
+	}
+	if len(page) == 0 && complete > 0 {
+		// A single block contains more transactions of the address
+		// than the limit.
+		var err error
+		if page, err = blockTxs(ctx, src, addr, complete); err != nil {
+			return nil, err
+		}
+	}
+
+	res := HistoryPage{Entries: make([]HistoryEntry, len(page))}
+	if len(page) == 0 {
+		return &res, nil
+	}
+	if more {
+		res.Next = page[len(page)-1].Height
+	}
+	heights := make([]int64, len(page))
+	for i, tx := range page {
+		heights[i] = tx.Height
+	}
+	times, err := src.blockTimes(ctx, heights)
+	if err != nil {
+		return nil, err
+	}
+	for i, tx := range page {
+		res.Entries[i] = HistoryEntry{
+			Height: tx.Height,
+			Index:  tx.Index,
+			Time:   times[tx.Height],
+			Hash:   tx.Hash,
+			Result: tx.TxResult,
+		}
+		if parsed, err := ParseCustomTx(tx.Tx); err == nil {
+			res.Entries[i].Tx = parsed
+		}
+	}
+	return &res, nil
+}
+
+// addressTagQueries returns queries matching transactions that affected the
+// address. These wrote a key with one of the address key prefixes, or created
+// a custom state for the address.
+func addressTagQueries(addr weave.Address) []string {
+	queries := make([]string, 0, len(addressKeyPrefixes)+1)
+	for _, prefix := range addressKeyPrefixes {
+		key := append([]byte(prefix), addr...)
+		queries = append(queries, fmt.Sprintf("%X='s'", key))
+	}
+	return append(queries, fmt.Sprintf("%s='%X'", custom.StateAddressTag, addr))
+}
+
+// latestTxs returns up to n latest transactions matching the query, ordered
+// from the oldest one, together with the number of all matching
+// transactions.
+func latestTxs(ctx context.Context, src historySource, query string, n int) ([]*ctypes.ResultTx, int, error) {
+	res, err := src.TxSearchContext(ctx, query, false, 1, historyPageSize)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "cannot search transactions")
+	}
+	total := res.TotalCount
+	txs := res.Txs
+	if total > historyPageSize {
+		// Search results are ordered by height, so the latest
+		// transactions are on the last pages.
+		first := total - n
+		txs = nil
+		for page := first/historyPageSize + 1; (page-1)*historyPageSize < total; page++ {
+			res, err := src.TxSearchContext(ctx, query, false, page, historyPageSize)
+			if err != nil {
+				return nil, 0, errors.Wrap(err, "cannot search transactions")
+			}
+			txs = append(txs, res.Txs...)
+		}
+		txs = txs[first%historyPageSize:]
+	}
+	if len(txs) > n {
+		txs = txs[len(txs)-n:]
+	}
+	return txs, total, nil
+}
+
+// blockTxs returns all transactions of the address included in the block at
+// given height.
+func blockTxs(ctx context.Context, src historySource, addr weave.Address, height int64) ([]*ctypes.ResultTx, error) {
+	found := make(map[string]*ctypes.ResultTx)
+	for _, q := range addressTagQueries(addr) {
+		query := fmt.Sprintf("%s AND tx.height = %d", q, height)
+		for page := 1; ; page++ {
+			res, err := src.TxSearchContext(ctx, query, false, page, historyPageSize)
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot search transactions")
+			}
+			for _, tx := range res.Txs {
+				found[string(tx.Hash)] = tx
+			}
+			if page*historyPageSize >= res.TotalCount {
+				break
+			}
+		}
+	}
+	return sortedTxs(found), nil
+}
+
+// sortedTxs returns transactions ordered from the newest one.
+func sortedTxs(txs map[string]*ctypes.ResultTx) []*ctypes.ResultTx {
+	sorted := make([]*ctypes.ResultTx, 0, len(txs))
+	for _, tx := range txs {
+		sorted = append(sorted, tx)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Height != sorted[j].Height {
+			return sorted[i].Height > sorted[j].Height
+		}
+		return sorted[i].Index > sorted[j].Index
+	})
+	return sorted
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave"
+	customdApp "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave-starter-kit/x/custom"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/crypto"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/weavetest/assert"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+func TestTxHistory(t *testing.T) {
+	owner := GenPrivateKey()
+	appState, err := genesisAppState(owner.PublicKey().Address())
+	assert.Nil(t, err)
+	genesis := &tmtypes.GenesisDoc{
+		ChainID:     "history-test",
+		GenesisTime: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		AppState:    appState,
+	}
+	c, err := NewInMemoryClient(genesis)
+	assert.Nil(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	nonces := NewNonceManager(c)
+	src := owner.PublicKey().Address()
+	rcpt := GenPrivateKey().PublicKey().Address()
+
+	send := func(signer *crypto.PrivateKey, to weave.Address, whole int64) int64 {
+		t.Helper()
+		tx := BuildSendTx(signer.PublicKey().Address(), to, coin.Coin{Whole: whole, Ticker: initBalance.Ticker}, "history")
+		res := c.SignAndBroadcastContext(ctx, nonces, tx, signer)
+		assert.Nil(t, res.IsError())
+		return res.Response.Height
+	}
+
+	var heights []int64
+	for i := int64(1); i <= 5; i++ {
+		heights = append(heights, send(owner, rcpt, i))
+	}
+	// A custom state created for the recipient by another signer.
+	create := &customdApp.Tx{
+		Sum: &customdApp.Tx_CustomCreateStateMsg{
+			CustomCreateStateMsg: &custom.CreateStateMsg{
+				Metadata:   &weave.Metadata{Schema: 1},
+				InnerState: &custom.InnerState{St1: 1, St2: 2},
+				Address:    rcpt,
+			},
+		},
+	}
+	res := c.SignAndBroadcastContext(ctx, nonces, create, owner)
+	assert.Nil(t, res.IsError())
+	heights = append(heights, res.Response.Height)
+	// A transaction that does not affect the recipient.
+	send(owner, GenPrivateKey().PublicKey().Address(), 1)
+
+	page, err := c.TxHistoryContext(ctx, rcpt, HistoryOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), page.Next)
+	assert.Equal(t, len(heights), len(page.Entries))
+	for i, e := range page.Entries {
+		h := heights[len(heights)-1-i]
+		assert.Equal(t, h, e.Height)
+		assert.Equal(t, genesis.GenesisTime.Add(time.Duration(h)*InMemoryBlockInterval), e.Time)
+	}
+	msg, err := page.Entries[0].Tx.GetMsg()
+	assert.Nil(t, err)
+	assert.Equal(t, rcpt, msg.(*custom.CreateStateMsg).Address)
+
+	// Pages are listed with the height cursor.
+	var listed []int64
+	opts := HistoryOptions{Limit: 4}
+	for {
+		page, err := c.TxHistoryContext(ctx, rcpt, opts)
+		assert.Nil(t, err)
+		if len(page.Entries) > opts.Limit {
+			t.Fatalf("page of %d entries", len(page.Entries))
+		}
+		for _, e := range page.Entries {
+			listed = append(listed, e.Height)
+		}
+		if page.Next == 0 {
+			break
+		}
+		opts.BeforeHeight = page.Next
+	}
+	assert.Equal(t, len(heights), len(listed))
+	for i, h := range listed {
+		assert.Equal(t, heights[len(heights)-1-i], h)
+	}
+
+	// The signer history is longer than a single search page.
+	for i := 0; i < 110; i++ {
+		send(owner, rcpt, 1)
+	}
+	total := 0
+	opts = HistoryOptions{Limit: MaxHistoryLimit}
+	for {
+		page, err := c.TxHistoryContext(ctx, src, opts)
+		assert.Nil(t, err)
+		total += len(page.Entries)
+		if page.Next == 0 {
+			break
+		}
+		opts.BeforeHeight = page.Next
+	}
+	assert.Equal(t, 5+1+1+110, total)
+
+	page, err = c.TxHistoryContext(ctx, GenPrivateKey().PublicKey().Address(), HistoryOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(page.Entries))
+	assert.Equal(t, int64(0), page.Next)
+
+	_, err = c.TxHistoryContext(ctx, rcpt, HistoryOptions{Limit: MaxHistoryLimit + 1})
+	assert.IsErr(t, errors.ErrInput, err)
+	_, err = c.TxHistoryContext(ctx, weave.Address{1, 2, 3}, HistoryOptions{})
+	assert.Equal(t, true, err != nil)
+}
@@ -0,0 +1,324 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iov-one/weave/errors"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	rpcclient "github.com/tendermint/tendermint/rpc/lib/client"
+	rpctypes "github.com/tendermint/tendermint/rpc/lib/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// DefaultRequestTimeout is the time after which a request to a remote node
+// is cancelled, if it is not bound to a context with a deadline.
+const DefaultRequestTimeout = time.Minute
+
+// ContextBinder is implemented by connections that can cancel their requests.
+type ContextBinder interface {
+	// WithContext returns a connection that sends requests bound to the
+	// context. A request is cancelled when the context is done. The
+	// returned connection shares subscriptions and the state with the
+	// original one, so it must not be started or stopped.
+	WithContext(ctx context.Context) client.Client
+}
+
+// bindContext returns a connection sending requests bound to the context and
+// true, if the connection supports it. Otherwise the connection is returned
+// unchanged with false.
+func bindContext(ctx context.Context, conn client.Client) (client.Client, bool) {
+	switch c := conn.(type) {
+	case *muxConnection:
+		// Requests are not multiplexed, only subscriptions are.
+		return bindContext(ctx, c.Client)
+	case ContextBinder:
+		return c.WithContext(ctx), true
+	default:
+		return conn, false
+	}
+}
+
+// HTTPConnection is a client of a remote node. It is like the tendermint HTTP
+// client, but its requests can be bound to a context using WithContext.
+// Requests that are not bound to a context with a deadline are cancelled
+// after DefaultRequestTimeout. Events are received using the websocket
+// connection of the tendermint client.
+type HTTPConnection struct {
+	*client.HTTP
+
+	ctx     context.Context
+	address string
+	http    *http.Client
+	// rpc provides the codec of the results. Its requests cannot be
+	// cancelled, so it is not used to send them.
+	rpc *rpcclient.JSONRPCClient
+}
+
+var (
+	_ client.Client = (*HTTPConnection)(nil)
+	_ ContextBinder = (*HTTPConnection)(nil)
+)
+
+// newHTTPConnection returns a connection to the remote node with given
+// address, for example "https://node.example.com:443" or
+// "tcp://localhost:26657".
+func newHTTPConnection(remote string) *HTTPConnection {
+	conn := client.NewHTTP(remote, "/websocket")
+	rpc := rpcclient.NewJSONRPCClient(remote)
+	ctypes.RegisterAmino(rpc.Codec())
+
+	// Like tendermint, accept http and https as aliases of the tcp
+	// protocol and connect to a unix socket if requested.
+	protocol, address := "tcp", remote
+	if chunks := strings.SplitN(remote, "://", 2); len(chunks) == 2 {
+		protocol, address = chunks[0], chunks[1]
+	}
+	scheme := "http"
+	switch protocol {
+	case "http", "https":
+		scheme, protocol = protocol, "tcp"
+	}
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, protocol, address)
+	}
+	return &HTTPConnection{
+		HTTP:    conn,
+		ctx:     context.Background(),
+		address: scheme + "://" + strings.Replace(address, "/", ".", -1),
+		http: &http.Client{
+			Transport: &http.Transport{
+				// Prevent GZIP bomb attacks, like tendermint does.
+				DisableCompression: true,
+				DialContext:        dial,
+			},
+		},
+		rpc: rpc,
+	}
+}
+
+// WithContext implements ContextBinder.
+func (c *HTTPConnection) WithContext(ctx context.Context) client.Client {
+	bound := *c
+	bound.ctx = ctx
+	return &bound
+}
+
+// call sends a JSON-RPC request and unmarshals its result. The request is
+// cancelled when the context of the connection is done, or after
+// DefaultRequestTimeout if the context has no deadline.
+func (c *HTTPConnection) call(method string, params map[string]interface{}, result interface{}) error {
+	ctx := c.ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultRequestTimeout)
+		defer cancel()
+	}
+
+	req, err := rpctypes.MapToRequest(c.rpc.Codec(), rpctypes.JSONRPCStringID("jsonrpc-client"), method, params)
+	if err != nil {
+		return errors.Wrap(err, "cannot create request")
+	}
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal request")
+	}
+	httpReq, err := http.NewRequest("POST", c.address, bytes.NewReader(raw))
+	if err != nil {
+		return errors.Wrap(err, "cannot create request")
+	}
+	httpReq.Header.Set("Content-Type", "text/json")
+
+	resp, err := c.http.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return c.requestError(ctx, method, err)
+	}
+	defer resp.Body.Close()
+	raw, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return c.requestError(ctx, method, err)
+	}
+
+	var rpcResp rpctypes.RPCResponse
+	if err := json.Unmarshal(raw, &rpcResp); err != nil {
+		return errors.Wrapf(err, "cannot unmarshal %s response", method)
+	}
+	if rpcResp.Error != nil {
+		return errors.Wrapf(ErrRPC, "%s response error: %v", method, rpcResp.Error)
+	}
+	if err := c.rpc.Codec().UnmarshalJSON(rpcResp.Result, result); err != nil {
+		return errors.Wrapf(err, "cannot unmarshal %s result", method)
+	}
+	return nil
+}
+
+// requestError returns the error of a request sent with the given context.
+// Cancellation of the connection context is reported as it is, so that it
+// is not confused with a connection failure. A request that was not
+// answered within DefaultRequestTimeout failed like a connection does.
+func (c *HTTPConnection) requestError(ctx context.Context, method string, err error) error {
+	if ctxErr := c.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if ctx.Err() != nil {
+		return timeoutError{method: method}
+	}
+	return err
+}
+
+// timeoutError is returned when a request is not answered within
+// DefaultRequestTimeout. It is a net.Error, so that the endpoint is
+// considered failed.
+type timeoutError struct {
+	method string
+}
+
+var _ net.Error = timeoutError{}
+
+func (e timeoutError) Error() string {
+	return fmt.Sprintf("%s request timed out after %s", e.method, DefaultRequestTimeout)
+}
+
+// Timeout implements net.Error.
+func (timeoutError) Timeout() bool { return true }
+
+// Temporary implements net.Error.
+func (timeoutError) Temporary() bool { return true }
+
+// ABCIInfo implements client.Client.
+func (c *HTTPConnection) ABCIInfo() (*ctypes.ResultABCIInfo, error) {
+	res := new(ctypes.ResultABCIInfo)
+	return res, c.call("abci_info", map[string]interface{}{}, res)
+}
+
+// ABCIQuery implements client.Client.
+func (c *HTTPConnection) ABCIQuery(path string, data cmn.HexBytes) (*ctypes.ResultABCIQuery, error) {
+	return c.ABCIQueryWithOptions(path, data, client.DefaultABCIQueryOptions)
+}
+
+// ABCIQueryWithOptions implements client.Client.
+func (c *HTTPConnection) ABCIQueryWithOptions(path string, data cmn.HexBytes, opts client.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	res := new(ctypes.ResultABCIQuery)
+	params := map[string]interface{}{"path": path, "data": data, "height": opts.Height, "prove": opts.Prove}
+	return res, c.call("abci_query", params, res)
+}
+
+// BroadcastTxCommit implements client.Client.
+func (c *HTTPConnection) BroadcastTxCommit(tx tmtypes.Tx) (*ctypes.ResultBroadcastTxCommit, error) {
+	res := new(ctypes.ResultBroadcastTxCommit)
+	return res, c.call("broadcast_tx_commit", map[string]interface{}{"tx": tx}, res)
+}
+
+// BroadcastTxAsync implements client.Client.
+func (c *HTTPConnection) BroadcastTxAsync(tx tmtypes.Tx) (*ctypes.ResultBroadcastTx, error) {
+	res := new(ctypes.ResultBroadcastTx)
+	return res, c.call("broadcast_tx_async", map[string]interface{}{"tx": tx}, res)
+}
+
+// BroadcastTxSync implements client.Client.
+func (c *HTTPConnection) BroadcastTxSync(tx tmtypes.Tx) (*ctypes.ResultBroadcastTx, error) {
+	res := new(ctypes.ResultBroadcastTx)
+	return res, c.call("broadcast_tx_sync", map[string]interface{}{"tx": tx}, res)
+}
+
+// UnconfirmedTxs implements client.Client.
+func (c *HTTPConnection) UnconfirmedTxs(limit int) (*ctypes.ResultUnconfirmedTxs, error) {
+	res := new(ctypes.ResultUnconfirmedTxs)
+	return res, c.call("unconfirmed_txs", map[string]interface{}{"limit": limit}, res)
+}
+
+// NumUnconfirmedTxs implements client.Client.
+func (c *HTTPConnection) NumUnconfirmedTxs() (*ctypes.ResultUnconfirmedTxs, error) {
+	res := new(ctypes.ResultUnconfirmedTxs)
+	return res, c.call("num_unconfirmed_txs", map[string]interface{}{}, res)
+}
+
+// NetInfo implements client.Client.
+func (c *HTTPConnection) NetInfo() (*ctypes.ResultNetInfo, error) {
+	res := new(ctypes.ResultNetInfo)
+	return res, c.call("net_info", map[string]interface{}{}, res)
+}
+
+// DumpConsensusState implements client.Client.
+func (c *HTTPConnection) DumpConsensusState() (*ctypes.ResultDumpConsensusState, error) {
+	res := new(ctypes.ResultDumpConsensusState)
+	return res, c.call("dump_consensus_state", map[string]interface{}{}, res)
+}
+
+// ConsensusState implements client.Client.
+func (c *HTTPConnection) ConsensusState() (*ctypes.ResultConsensusState, error) {
+	res := new(ctypes.ResultConsensusState)
+	return res, c.call("consensus_state", map[string]interface{}{}, res)
+}
+
+// Health implements client.Client.
+func (c *HTTPConnection) Health() (*ctypes.ResultHealth, error) {
+	res := new(ctypes.ResultHealth)
+	return res, c.call("health", map[string]interface{}{}, res)
+}
+
+// BlockchainInfo implements client.Client.
+func (c *HTTPConnection) BlockchainInfo(minHeight, maxHeight int64) (*ctypes.ResultBlockchainInfo, error) {
+	res := new(ctypes.ResultBlockchainInfo)
+	params := map[string]interface{}{"minHeight": minHeight, "maxHeight": maxHeight}
+	return res, c.call("blockchain", params, res)
+}
+
+// Genesis implements client.Client.
+func (c *HTTPConnection) Genesis() (*ctypes.ResultGenesis, error) {
+	res := new(ctypes.ResultGenesis)
+	return res, c.call("genesis", map[string]interface{}{}, res)
+}
+
+// Block implements client.Client.
+func (c *HTTPConnection) Block(height *int64) (*ctypes.ResultBlock, error) {
+	res := new(ctypes.ResultBlock)
+	return res, c.call("block", map[string]interface{}{"height": height}, res)
+}
+
+// BlockResults implements client.Client.
+func (c *HTTPConnection) BlockResults(height *int64) (*ctypes.ResultBlockResults, error) {
+	res := new(ctypes.ResultBlockResults)
+	return res, c.call("block_results", map[string]interface{}{"height": height}, res)
+}
+
+// Commit implements client.Client.
+func (c *HTTPConnection) Commit(height *int64) (*ctypes.ResultCommit, error) {
+	res := new(ctypes.ResultCommit)
+	return res, c.call("commit", map[string]interface{}{"height": height}, res)
+}
+
+// Tx implements client.Client.
+func (c *HTTPConnection) Tx(hash []byte, prove bool) (*ctypes.ResultTx, error) {
+	res := new(ctypes.ResultTx)
+	return res, c.call("tx", map[string]interface{}{"hash": hash, "prove": prove}, res)
+}
+
+// TxSearch implements client.Client.
+func (c *HTTPConnection) TxSearch(query string, prove bool, page, perPage int) (*ctypes.ResultTxSearch, error) {
+	res := new(ctypes.ResultTxSearch)
+	params := map[string]interface{}{"query": query, "prove": prove, "page": page, "per_page": perPage}
+	return res, c.call("tx_search", params, res)
+}
+
+// Validators implements client.Client.
+func (c *HTTPConnection) Validators(height *int64) (*ctypes.ResultValidators, error) {
+	res := new(ctypes.ResultValidators)
+	return res, c.call("validators", map[string]interface{}{"height": height}, res)
+}
+
+// Status implements client.Client.
+func (c *HTTPConnection) Status() (*ctypes.ResultStatus, error) {
+	res := new(ctypes.ResultStatus)
+	return res, c.call("status", map[string]interface{}{}, res)
+}
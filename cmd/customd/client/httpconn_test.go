@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave/weavetest/assert"
+)
+
+func TestHTTPConnectionCancel(t *testing.T) {
+	// The node responds to the health request and blocks all other
+	// requests until they are cancelled.
+	received := make(chan string, 1)
+	cancelled := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Method == "health" {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":"jsonrpc-client","result":{}}`))
+			return
+		}
+		received <- req.Method
+		select {
+		case <-r.Context().Done():
+			cancelled <- req.Method
+		case <-time.After(time.Minute):
+		}
+	}))
+	defer srv.Close()
+
+	conn := newHTTPConnection(srv.URL)
+	_, err := conn.Health()
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = NewClient(conn).StatusContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("want deadline exceeded error, got %+v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request returned after %s", elapsed)
+	}
+	select {
+	case method := <-cancelled:
+		assert.Equal(t, "status", method)
+		assert.Equal(t, "status", <-received)
+	case <-time.After(time.Second):
+		t.Fatal("request was not cancelled")
+	}
+
+	// A cancelled request must not mark the endpoint as unhealthy.
+	failover, err := NewFailoverConnection([]Endpoint{{Name: "node", Conn: conn}}, FailoverOptions{})
+	assert.Nil(t, err)
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	_, err = failover.WithContext(ctx).Block(nil)
+	if err != context.Canceled {
+		t.Fatalf("want cancelled error, got %+v", err)
+	}
+	<-cancelled
+	stats := failover.Stats()
+	assert.Equal(t, true, stats[0].Healthy)
+	assert.Equal(t, uint64(0), stats[0].Failed)
+}
+
+func TestHTTPConnectionRPCError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":"jsonrpc-client","error":{"code":-32603,"message":"Internal error","data":"height must be less than or equal to the current blockchain height"}}`))
+	}))
+	defer srv.Close()
+
+	conn := newHTTPConnection(srv.URL)
+	h := int64(100)
+	_, err := conn.Block(&h)
+	assert.IsErr(t, ErrRPC, err)
+	// The node is reachable, so the error must not trigger a failover.
+	assert.Equal(t, false, isConnectionError(err))
+
+	assert.Equal(t, true, isConnectionError(timeoutError{method: "block"}))
+}
@@ -0,0 +1,450 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave/crypto"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/orm"
+	"github.com/iov-one/weave/store/iavl"
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/tendermint/tendermint/libs/log"
+	tmpubsub "github.com/tendermint/tendermint/libs/pubsub"
+	tmquery "github.com/tendermint/tendermint/libs/pubsub/query"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// InMemoryBlockInterval is the time difference between two consecutive blocks
+// created by the InMemoryClient.
+const InMemoryBlockInterval = 5 * time.Second
+
+// InMemoryClient is a Client implementation that is running the application
+// in memory, without tendermint. It is meant to be used in tests of services
+// that depend on the Client interface.
+//
+// Each broadcasted transaction is included in a new block that is immediately
+// committed. There is no mempool and no consensus.
+type InMemoryClient struct {
+	mu      sync.Mutex
+	app     abci.Application
+	chainID string
+	height  int64
+	now     time.Time
+	appHash []byte
+	txs     []*indexedTx
+	// times holds the creation time of each block, by height starting
+	// with 1.
+	times []time.Time
+
+	events      *tmtypes.EventBus
+	subscribers int
+
+	// queries is a client used to reuse the query functionality. Its
+	// connection supports only ABCI queries.
+	queries *CustomClient
+}
+
+var _ Client = (*InMemoryClient)(nil)
+
+type indexedTx struct {
+	result *ctypes.ResultTx
+	tags   map[string]string
+}
+
+// NewInMemoryClient returns a client connected to a fresh application
+// instance. The application is initialized using the chain ID, genesis time
+// and application state of the given genesis. The genesis block is
+// committed before returning.
+func NewInMemoryClient(genesis *tmtypes.GenesisDoc) (*InMemoryClient, error) {
+	if err := genesis.ValidateAndComplete(); err != nil {
+		return nil, errors.Wrap(err, "invalid genesis")
+	}
+	events := tmtypes.NewEventBus()
+	if err := events.Start(); err != nil {
+		return nil, errors.Wrap(err, "cannot start event bus")
+	}
+
+	app := customd.InlineApp(iavl.MockCommitStore(), log.NewNopLogger(), false)
+	app.InitChain(abci.RequestInitChain{
+		Time:          genesis.GenesisTime,
+		ChainId:       genesis.ChainID,
+		AppStateBytes: genesis.AppState,
+	})
+
+	c := &InMemoryClient{
+		app:     app,
+		chainID: genesis.ChainID,
+		now:     genesis.GenesisTime,
+		events:  events,
+	}
+	c.queries = NewClient(appConnection{app: app, mu: &c.mu})
+	c.mu.Lock()
+	c.commitBlock(nil)
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Close releases all resources. All subscriptions are cancelled.
+func (c *InMemoryClient) Close() error {
+	return c.events.Stop()
+}
+
+// AdvanceTime commits a new empty block, created the given (positive)
+// duration after the previous one. Use it to test time dependent
+// functionality.
+func (c *InMemoryClient) AdvanceTime(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d - InMemoryBlockInterval)
+	c.commitBlock(nil)
+}
+
+// commitBlock creates a new block with given transactions and commits it.
+// Results of all transactions are returned. Caller must hold the lock.
+func (c *InMemoryClient) commitBlock(txs []tmtypes.Tx) []abci.ResponseDeliverTx {
+	c.height++
+	c.now = c.now.Add(InMemoryBlockInterval)
+	header := tmtypes.Header{
+		ChainID: c.chainID,
+		Height:  c.height,
+		Time:    c.now,
+		NumTxs:  int64(len(txs)),
+		AppHash: c.appHash,
+	}
+	c.times = append(c.times, c.now)
+	c.app.BeginBlock(abci.RequestBeginBlock{
+		Header: tmtypes.TM2PB.Header(&header),
+	})
+	results := make([]abci.ResponseDeliverTx, len(txs))
+	for i, tx := range txs {
+		results[i] = c.app.DeliverTx(tx)
+	}
+	c.app.EndBlock(abci.RequestEndBlock{Height: c.height})
+	c.appHash = c.app.Commit().Data
+
+	c.events.PublishEventNewBlockHeader(tmtypes.EventDataNewBlockHeader{Header: header})
+	for i, tx := range txs {
+		res := &ctypes.ResultTx{
+			Hash:     tx.Hash(),
+			Height:   c.height,
+			Index:    uint32(i),
+			TxResult: results[i],
+			Tx:       tx,
+		}
+		tags := map[string]string{
+			tmtypes.TxHashKey:   fmt.Sprintf("%X", res.Hash),
+			tmtypes.TxHeightKey: fmt.Sprint(res.Height),
+		}
+		for _, t := range results[i].Tags {
+			tags[string(t.Key)] = string(t.Value)
+		}
+		c.txs = append(c.txs, &indexedTx{result: res, tags: tags})
+		c.events.PublishEventTx(tmtypes.EventDataTx{TxResult: tmtypes.TxResult{
+			Height: c.height,
+			Index:  uint32(i),
+			Tx:     tx,
+			Result: results[i],
+		}})
+	}
+	return results
+}
+
+// TendermintClient returns nil as there is no tendermint node.
+func (c *InMemoryClient) TendermintClient() client.Client {
+	return nil
+}
+
+// StatusContext returns the status of the in memory node.
+func (c *InMemoryClient) StatusContext(ctx context.Context) (*ctypes.ResultStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var status ctypes.ResultStatus
+	status.NodeInfo.Network = c.chainID
+	status.NodeInfo.Moniker = "inmemory"
+	status.NodeInfo.Other.TxIndex = "on"
+	status.SyncInfo = ctypes.SyncInfo{
+		LatestAppHash:     c.appHash,
+		LatestBlockHeight: c.height,
+		LatestBlockTime:   c.now,
+	}
+	return &status, nil
+}
+
+// ChainIDContext returns the chain ID used to initialize the application.
+func (c *InMemoryClient) ChainIDContext(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.chainID, nil
+}
+
+// HeightContext returns the height of the latest committed block.
+func (c *InMemoryClient) HeightContext(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.height, nil
+}
+
+// GetUserContext will return nonce and public key registered for a given
+// address if it was ever used.
+func (c *InMemoryClient) GetUserContext(ctx context.Context, addr weave.Address) (*UserResponse, error) {
+	return c.queries.GetUserContext(ctx, addr)
+}
+
+// GetWalletContext will return a wallet given an address.
+func (c *InMemoryClient) GetWalletContext(ctx context.Context, addr weave.Address) (*WalletResponse, error) {
+	return c.queries.GetWalletContext(ctx, addr)
+}
+
+// NextNonceContext returns the next nonce of the given address.
+func (c *InMemoryClient) NextNonceContext(ctx context.Context, addr weave.Address) (int64, error) {
+	return c.queries.NextNonceContext(ctx, addr)
+}
+
+// AbciQueryContext queries the application state.
+func (c *InMemoryClient) AbciQueryContext(ctx context.Context, path string, data []byte) (AbciResponse, error) {
+	return c.queries.AbciQueryContext(ctx, path, data)
+}
+
+// AbciRangeQueryContext returns a single page of models stored under given
+// database key prefix.
+func (c *InMemoryClient) AbciRangeQueryContext(ctx context.Context, prefix, cursor []byte, limit int) (AbciResponse, error) {
+	return c.queries.AbciRangeQueryContext(ctx, prefix, cursor, limit)
+}
+
+// QueryModelContext queries a bucket path for a single model.
+func (c *InMemoryClient) QueryModelContext(ctx context.Context, path string, key []byte, dest orm.Model) (int64, error) {
+	return c.queries.QueryModelContext(ctx, path, key, dest)
+}
+
+// QueryModelsContext queries a bucket or index path for all matching models.
+func (c *InMemoryClient) QueryModelsContext(ctx context.Context, path string, data []byte, dest orm.ModelSlicePtr) ([][]byte, int64, error) {
+	return c.queries.QueryModelsContext(ctx, path, data, dest)
+}
+
+// GetStateContext returns the state with given ID.
+func (c *InMemoryClient) GetStateContext(ctx context.Context, id []byte) (*StateResponse, error) {
+	return c.queries.GetStateContext(ctx, id)
+}
+
+// GetTimedStateContext returns the timed state with given ID.
+func (c *InMemoryClient) GetTimedStateContext(ctx context.Context, id []byte) (*TimedStateResponse, error) {
+	return c.queries.GetTimedStateContext(ctx, id)
+}
+
+// GetContractContext returns the multisig contract with given ID.
+func (c *InMemoryClient) GetContractContext(ctx context.Context, id []byte) (*ContractResponse, error) {
+	return c.queries.GetContractContext(ctx, id)
+}
+
+// ListStatesByAddressContext returns a page of states created for the given
+// address.
+func (c *InMemoryClient) ListStatesByAddressContext(ctx context.Context, addr weave.Address, opts ListOptions) (*StatesPage, error) {
+	return c.queries.ListStatesByAddressContext(ctx, addr, opts)
+}
+
+// ListTimedStatesExpiringBeforeContext returns a page of timed states that are
+// deleted before the given time.
+func (c *InMemoryClient) ListTimedStatesExpiringBeforeContext(ctx context.Context, t time.Time, opts ListOptions) (*TimedStatesPage, error) {
+	return c.queries.ListTimedStatesExpiringBeforeContext(ctx, t, opts)
+}
+
+// SimulateContext executes a transaction without committing any change.
+func (c *InMemoryClient) SimulateContext(ctx context.Context, tx weave.Tx) (*SimulateResponse, error) {
+	return c.queries.SimulateContext(ctx, tx)
+}
+
+// BroadcastTxContext includes the transaction in a new block, if it passes
+// the check.
+func (c *InMemoryClient) BroadcastTxContext(ctx context.Context, tx weave.Tx) BroadcastTxResponse {
+	if err := ctx.Err(); err != nil {
+		return BroadcastTxResponse{Error: err}
+	}
+	data, err := tx.Marshal()
+	if err != nil {
+		return BroadcastTxResponse{Error: err}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	raw := tmtypes.Tx(data)
+	res := &ctypes.ResultBroadcastTxCommit{
+		CheckTx: c.app.CheckTx(raw),
+		Hash:    raw.Hash(),
+	}
+	if res.CheckTx.IsErr() {
+		return BroadcastTxResponse{Response: res}
+	}
+	res.DeliverTx = c.commitBlock([]tmtypes.Tx{raw})[0]
+	res.Height = c.height
+	return BroadcastTxResponse{Response: res}
+}
+
+// BroadcastTxAsyncContext writes the result of BroadcastTxContext to the
+// given channel.
+func (c *InMemoryClient) BroadcastTxAsyncContext(ctx context.Context, tx weave.Tx, out chan<- BroadcastTxResponse) {
+	out <- c.BroadcastTxContext(ctx, tx)
+}
+
+// BroadcastTxSyncContext is like BroadcastTxContext but a check failure is
+// returned as an error. The transaction is committed immediately.
+func (c *InMemoryClient) BroadcastTxSyncContext(ctx context.Context, tx weave.Tx) BroadcastTxResponse {
+	res := c.BroadcastTxContext(ctx, tx)
+	if res.Error == nil && res.Response.CheckTx.IsErr() {
+		check := res.Response.CheckTx
+		return BroadcastTxResponse{
+			Error: errors.Wrap(errors.ABCIError(check.Code, check.Log), "CheckTx error"),
+		}
+	}
+	return res
+}
+
+// SignAndBroadcastContext signs the transaction with the next nonce of the
+// signer, as provided by the nonce manager, and includes it in a new block.
+func (c *InMemoryClient) SignAndBroadcastContext(ctx context.Context, nonces *NonceManager, tx *customd.Tx, signer *crypto.PrivateKey) BroadcastTxResponse {
+	submit := func(ctx context.Context, tx weave.Tx) (*TxFuture, error) {
+		res := c.BroadcastTxSyncContext(ctx, tx)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		f := newTxFuture(res.Response.Hash)
+		f.resolve(res)
+		return f, nil
+	}
+	return signAndBroadcast(ctx, c.chainID, nonces, tx, signer, submit)
+}
+
+// TxSearchContext returns committed transactions matching given query.
+// Proofs are not supported.
+func (c *InMemoryClient) TxSearchContext(ctx context.Context, query string, prove bool, page, perPage int) (*ctypes.ResultTxSearch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if prove {
+		return nil, errors.Wrap(errors.ErrInput, "proofs are not supported")
+	}
+	q, err := tmquery.New(query)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInput, err.Error())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var found []*ctypes.ResultTx
+	for _, tx := range c.txs {
+		if q.Matches(tx.tags) {
+			found = append(found, tx.result)
+		}
+	}
+
+	if perPage <= 0 {
+		perPage = 30
+	}
+	if page <= 0 {
+		page = 1
+	}
+	start := (page - 1) * perPage
+	if start > len(found) {
+		start = len(found)
+	}
+	end := start + perPage
+	if end > len(found) {
+		end = len(found)
+	}
+	return &ctypes.ResultTxSearch{Txs: found[start:end], TotalCount: len(found)}, nil
+}
+
+// TxHistoryContext returns a page of transactions that affected the address,
+// starting with the newest one.
+func (c *InMemoryClient) TxHistoryContext(ctx context.Context, addr weave.Address, opts HistoryOptions) (*HistoryPage, error) {
+	return txHistory(ctx, c, addr, opts)
+}
+
+// blockTimes returns creation times of blocks at given heights.
+func (c *InMemoryClient) blockTimes(ctx context.Context, heights []int64) (map[int64]time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	times := make(map[int64]time.Time, len(heights))
+	for _, h := range heights {
+		if h < 1 || h > int64(len(c.times)) {
+			return nil, errors.Wrapf(errors.ErrNotFound, "block %d", h)
+		}
+		times[h] = c.times[h-1]
+	}
+	return times, nil
+}
+
+// SubscribeContext will take an arbitrary query and push all events to the
+// returned channel. Call the returned cancel function or cancel the context to
+// cancel the subscription.
+func (c *InMemoryClient) SubscribeContext(ctx context.Context, query tmpubsub.Query) (<-chan ctypes.ResultEvent, func(), error) {
+	c.mu.Lock()
+	c.subscribers++
+	subscriber := fmt.Sprintf("inmemory-%d", c.subscribers)
+	c.mu.Unlock()
+
+	sub, err := c.events.Subscribe(ctx, subscriber, query, 100)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot subscribe")
+	}
+	out := make(chan ctypes.ResultEvent, 100)
+	go func() {
+		for {
+			select {
+			case msg := <-sub.Out():
+				evt := ctypes.ResultEvent{Query: query.String(), Data: msg.Data(), Tags: msg.Tags()}
+				select {
+				case out <- evt:
+				case <-sub.Cancelled():
+					return
+				}
+			case <-sub.Cancelled():
+				return
+			}
+		}
+	}()
+	cancel := cancelOnDone(ctx, func() {
+		c.events.Unsubscribe(context.Background(), subscriber, query)
+	})
+	return out, cancel, nil
+}
+
+// appConnection is a tendermint client that supports only ABCI queries. All
+// other methods panic.
+type appConnection struct {
+	client.Client
+
+	mu  *sync.Mutex
+	app abci.Application
+}
+
+func (c appConnection) ABCIQueryWithOptions(path string, data cmn.HexBytes, opts client.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp := c.app.Query(abci.RequestQuery{
+		Path:   path,
+		Data:   data,
+		Height: opts.Height,
+		Prove:  opts.Prove,
+	})
+	return &ctypes.ResultABCIQuery{Response: resp}, nil
+}
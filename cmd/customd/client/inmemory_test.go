@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/sigs"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+func TestInMemoryClient(t *testing.T) {
+	owner := GenPrivateKey()
+	appState, err := genesisAppState(owner.PublicKey().Address())
+	assert.Nil(t, err)
+	genesis := &tmtypes.GenesisDoc{
+		ChainID:     "inmemory-test",
+		GenesisTime: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		AppState:    appState,
+	}
+	c, err := NewInMemoryClient(genesis)
+	assert.Nil(t, err)
+	defer c.Close()
+
+	chainID, err := c.ChainID()
+	assert.Nil(t, err)
+	assert.Equal(t, "inmemory-test", chainID)
+	height, err := c.Height()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), height)
+
+	src := owner.PublicKey().Address()
+	wallet, err := c.GetWallet(src)
+	assert.Nil(t, err)
+	assert.Equal(t, initBalance.Whole, wallet.Wallet.Coins[0].Whole)
+
+	headers, cancel, err := c.Subscribe(tmtypes.EventQueryNewBlockHeader)
+	assert.Nil(t, err)
+	defer cancel()
+
+	rcpt := GenPrivateKey().PublicKey().Address()
+	amount := coin.Coin{Whole: 1000, Ticker: initBalance.Ticker}
+	tx := BuildSendTx(src, rcpt, amount, "In memory")
+	n, err := c.NextNonce(src)
+	assert.Nil(t, err)
+	SignTx(tx, owner, chainID, n)
+
+	res := c.BroadcastTxSync(tx, time.Second)
+	assert.Nil(t, res.IsError())
+	assert.Equal(t, int64(2), res.Response.Height)
+
+	select {
+	case evt := <-headers:
+		header := evt.Data.(tmtypes.EventDataNewBlockHeader).Header
+		assert.Equal(t, int64(2), header.Height)
+		assert.Equal(t, genesis.GenesisTime.Add(2*InMemoryBlockInterval), header.Time)
+	case <-time.After(time.Second):
+		t.Fatal("no new block header event")
+	}
+
+	wallet, err = c.GetWallet(rcpt)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1000), wallet.Wallet.Coins[0].Whole)
+	n2, err := c.NextNonce(src)
+	assert.Nil(t, err)
+	assert.Equal(t, n+1, n2)
+
+	found, err := c.TxSearch("tx.height=2", false, 1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, found.TotalCount)
+	assert.Equal(t, res.Response.Hash, found.Txs[0].Hash)
+
+	// Replaying the same transaction fails the check.
+	res = c.BroadcastTxSync(tx, time.Second)
+	if !sigs.ErrInvalidSequence.Is(res.IsError()) {
+		t.Fatalf("unexpected error: %v", res.IsError())
+	}
+
+	c.AdvanceTime(time.Hour)
+	status, err := c.Status()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), status.SyncInfo.LatestBlockHeight)
+	assert.Equal(t, genesis.GenesisTime.Add(2*InMemoryBlockInterval+time.Hour), status.SyncInfo.LatestBlockTime)
+}
+
+func TestInMemoryClientContext(t *testing.T) {
+	owner := GenPrivateKey()
+	appState, err := genesisAppState(owner.PublicKey().Address())
+	assert.Nil(t, err)
+	c, err := NewInMemoryClient(&tmtypes.GenesisDoc{ChainID: "inmemory-test", AppState: appState})
+	assert.Nil(t, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	headers, _, err := c.SubscribeContext(ctx, tmtypes.EventQueryNewBlockHeader)
+	assert.Nil(t, err)
+	cancel()
+	if _, err := c.HeightContext(ctx); err != context.Canceled {
+		t.Fatalf("unexpected height error: %v", err)
+	}
+
+	// Wait for the subscription to be cancelled.
+	time.Sleep(50 * time.Millisecond)
+	c.AdvanceTime(time.Minute)
+	select {
+	case <-headers:
+		t.Fatal("subscription not cancelled")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
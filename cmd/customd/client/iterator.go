@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+
+	"github.com/iov-one/weave"
+	"github.com/tendermint/tendermint/rpc/client"
+)
+
+// ModelIterator iterates through all models stored under a database key
+// prefix. Models are fetched from the node in pages, using range queries, so
+// that collections of any size can be processed without loading them into
+// memory at once.
+//
+// Unless a height is provided in the query options, each page is queried at
+// the latest height. Results of a long iteration might therefore reflect
+// different states if new blocks are committed meanwhile. Height method
+// returns the height of the current model's page.
+// Iteration stops with an error when the context is done.
+//
+//	it := cc.IterateContext(ctx, []byte("cash:"), 100)
+//	for it.Next() {
+//	    m := it.Model()
+//	    ...
+//	}
+//	if err := it.Err(); err != nil {
+//	    ...
+//	}
+type ModelIterator struct {
+	ctx      context.Context
+	cc       *CustomClient
+	prefix   []byte
+	cursor   []byte
+	pageSize int
+	opts     client.ABCIQueryOptions
+
+	page   []weave.Model
+	height int64
+	model  weave.Model
+	done   bool
+	err    error
+}
+
+// IterateContext returns an iterator over all models stored under given
+// database key prefix. When pageSize is zero, the default page size is used.
+func (cc *CustomClient) IterateContext(ctx context.Context, prefix []byte, pageSize int) *ModelIterator {
+	return cc.IterateFromContext(ctx, prefix, nil, pageSize)
+}
+
+// IterateFromContext is like IterateContext, but the iteration starts with
+// the cursor key. Use it to continue an iteration that was previously
+// interrupted.
+func (cc *CustomClient) IterateFromContext(ctx context.Context, prefix, cursor []byte, pageSize int) *ModelIterator {
+	return cc.IterateFromWithOptionsContext(ctx, prefix, cursor, pageSize, client.DefaultABCIQueryOptions)
+}
+
+// IterateFromWithOptionsContext is like IterateFromContext but allows to
+// provide query options used for each page, for example to iterate through
+// the state at a given height.
+func (cc *CustomClient) IterateFromWithOptionsContext(ctx context.Context, prefix, cursor []byte, pageSize int, opts client.ABCIQueryOptions) *ModelIterator {
+	return &ModelIterator{
+		ctx:      ctx,
+		cc:       cc,
+		prefix:   prefix,
+		cursor:   cursor,
+		pageSize: pageSize,
+		opts:     opts,
+	}
+}
+
+// Next moves the iterator to the next model, fetching the next page if
+// necessary. It returns false when there are no more models or an error
+// occurred. Use Err method to distinguish between the two.
+func (it *ModelIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		resp, err := it.cc.AbciRangeQueryWithOptionsContext(it.ctx, it.prefix, it.cursor, it.pageSize, it.opts)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page = resp.Models
+		it.height = resp.Height
+		it.cursor = resp.Next
+		it.done = resp.Next == nil
+	}
+	it.model = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// Model returns the current model.
+func (it *ModelIterator) Model() weave.Model {
+	return it.model
+}
+
+// Height returns the height at which the current model was queried.
+func (it *ModelIterator) Height() int64 {
+	return it.height
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ModelIterator) Err() error {
+	return it.err
+}
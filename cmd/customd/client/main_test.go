@@ -44,6 +44,9 @@ func TestMain(m *testing.M) {
 
 	config := rpctest.GetConfig()
 	config.Moniker = "SetInTestMain"
+	// History queries search transactions by the key tagger tags.
+	config.TxIndex.IndexTags = ""
+	config.TxIndex.IndexAllTags = true
 
 	// set up our application
 	admin := faucet.PublicKey().Address()
@@ -81,6 +84,16 @@ func initGenesis(filename string, addr weave.Address) error {
 	if err != nil {
 		return err
 	}
+	appState, err := genesisAppState(addr)
+	if err != nil {
+		return err
+	}
+	doc.AppState = appState
+	return doc.SaveAs(filename)
+}
+
+// genesisAppState returns the application state that funds given address.
+func genesisAppState(addr weave.Address) ([]byte, error) {
 	appState, err := json.Marshal(map[string]interface{}{
 		"cash": []interface{}{
 			dict{
@@ -108,10 +121,9 @@ func initGenesis(filename string, addr weave.Address) error {
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("serialize state: %s", err)
+		return nil, fmt.Errorf("serialize state: %s", err)
 	}
-	doc.AppState = appState
-	return doc.SaveAs(filename)
+	return appState, nil
 }
 
 type dict map[string]interface{}
@@ -0,0 +1,299 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave-starter-kit/x/custom"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/orm"
+	"github.com/iov-one/weave/x/multisig"
+)
+
+// Query paths of the buckets used by the typed helpers.
+const (
+	statesPath      = "/customStates"
+	timedStatesPath = "/customTimedStates"
+	contractsPath   = "/contracts"
+
+	// statesPrefix is the database key prefix of all states.
+	statesPrefix = "state:"
+	// timedStatesPrefix is the database key prefix of all timed states.
+	timedStatesPrefix = "timedstate:"
+)
+
+// QueryModelContext queries a path registered by an orm.ModelBucket for a single
+// model stored under the given key and unmarshals it into dest. It returns
+// the height of the state that was queried and ErrNotFound if there is no
+// such model.
+func (cc *CustomClient) QueryModelContext(ctx context.Context, path string, key []byte, dest orm.Model) (int64, error) {
+	resp, err := cc.AbciQueryContext(ctx, path, key)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Models) == 0 {
+		return resp.Height, errors.Wrap(errors.ErrNotFound, "model not found")
+	}
+	if err := dest.Unmarshal(resp.Models[0].Value); err != nil {
+		return resp.Height, errors.Wrap(err, "cannot unmarshal model")
+	}
+	return resp.Height, nil
+}
+
+// QueryModelsContext queries a path registered by an orm.ModelBucket, or by
+// one of its indexes, and unmarshals all returned models into dest. Dest must
+// be a pointer to a slice of models, for example *[]custom.State or
+// *[]*custom.State. Keys of the returned models, without the bucket prefix,
+// are returned in the same order as the models.
+func (cc *CustomClient) QueryModelsContext(ctx context.Context, path string, data []byte, dest orm.ModelSlicePtr) ([][]byte, int64, error) {
+	resp, err := cc.AbciQueryContext(ctx, path, data)
+	if err != nil {
+		return nil, 0, err
+	}
+	keys, err := unmarshalModels(resp.Models, dest)
+	return keys, resp.Height, err
+}
+
+// unmarshalModels appends all models to the dest slice and returns their
+// keys without the bucket prefix.
+func unmarshalModels(models []weave.Model, dest orm.ModelSlicePtr) ([][]byte, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return nil, errors.Wrapf(errors.ErrType, "destination must be a pointer to a slice, got %T", dest)
+	}
+	slice := v.Elem()
+	elem := slice.Type().Elem()
+	isPtr := elem.Kind() == reflect.Ptr
+	if isPtr {
+		elem = elem.Elem()
+	}
+
+	keys := make([][]byte, 0, len(models))
+	for _, m := range models {
+		ptr := reflect.New(elem)
+		model, ok := ptr.Interface().(orm.Model)
+		if !ok {
+			return nil, errors.Wrapf(errors.ErrType, "%T is not a model", ptr.Interface())
+		}
+		if err := model.Unmarshal(m.Value); err != nil {
+			return nil, errors.Wrap(err, "cannot unmarshal model")
+		}
+		if isPtr {
+			slice = reflect.Append(slice, ptr)
+		} else {
+			slice = reflect.Append(slice, ptr.Elem())
+		}
+		keys = append(keys, stripBucketPrefix(m.Key))
+	}
+	v.Elem().Set(slice)
+	return keys, nil
+}
+
+// stripBucketPrefix returns the model key without the "<bucket>:" prefix.
+func stripBucketPrefix(key []byte) []byte {
+	if i := bytes.IndexByte(key, ':'); i >= 0 {
+		return key[i+1:]
+	}
+	return key
+}
+
+// StateResponse is a response on a query for a State
+type StateResponse struct {
+	ID     []byte
+	State  custom.State
+	Height int64
+}
+
+// TimedStateResponse is a response on a query for a TimedState
+type TimedStateResponse struct {
+	ID         []byte
+	TimedState custom.TimedState
+	Height     int64
+}
+
+// ContractResponse is a response on a query for a multisig Contract
+type ContractResponse struct {
+	ID       []byte
+	Contract multisig.Contract
+	Height   int64
+}
+
+// GetStateContext returns the state with given ID or ErrNotFound.
+func (cc *CustomClient) GetStateContext(ctx context.Context, id []byte) (*StateResponse, error) {
+	out := StateResponse{ID: id}
+	height, err := cc.QueryModelContext(ctx, statesPath, id, &out.State)
+	if err != nil {
+		return nil, err
+	}
+	out.Height = height
+	return &out, nil
+}
+
+// GetTimedStateContext returns the timed state with given ID or ErrNotFound.
+func (cc *CustomClient) GetTimedStateContext(ctx context.Context, id []byte) (*TimedStateResponse, error) {
+	out := TimedStateResponse{ID: id}
+	height, err := cc.QueryModelContext(ctx, timedStatesPath, id, &out.TimedState)
+	if err != nil {
+		return nil, err
+	}
+	out.Height = height
+	return &out, nil
+}
+
+// GetContractContext returns the multisig contract with given ID or ErrNotFound.
+func (cc *CustomClient) GetContractContext(ctx context.Context, id []byte) (*ContractResponse, error) {
+	out := ContractResponse{ID: id}
+	height, err := cc.QueryModelContext(ctx, contractsPath, id, &out.Contract)
+	if err != nil {
+		return nil, err
+	}
+	out.Height = height
+	return &out, nil
+}
+
+// DefaultListScanLimit is the number of stored models examined by a listing
+// if no scan limit is given.
+const DefaultListScanLimit = 1000
+
+// ListOptions configures a listing of models that are not indexed by the
+// listed property.
+//
+// Such a listing fetches the models of the bucket in key order and filters
+// them in the client, so the cost of a page is proportional to the number of
+// examined models, not to the number of returned ones. ScanLimit bounds that
+// cost. A page can be empty while more models remain to be examined.
+type ListOptions struct {
+	// After is the ID of the last examined model. The listing continues
+	// with the following one. Use the Next value of a previous page to
+	// continue listing. Nil means the first model.
+	After []byte
+	// Limit is the maximum number of returned models. Zero means no limit.
+	Limit int
+	// ScanLimit is the maximum number of examined models. Zero means
+	// DefaultListScanLimit.
+	ScanLimit int
+}
+
+// StatesPage is a page of states.
+type StatesPage struct {
+	States []StateResponse
+	// Next is the After value of the following page. It is nil if all
+	// states were examined.
+	Next []byte
+}
+
+// TimedStatesPage is a page of timed states.
+type TimedStatesPage struct {
+	TimedStates []TimedStateResponse
+	// Next is the After value of the following page. It is nil if all
+	// timed states were examined.
+	Next []byte
+}
+
+// ListStatesByAddressContext returns a page of states created for the given
+// address. States are not indexed by the address, so they are fetched and
+// filtered by the client. See ListOptions for the cost.
+func (cc *CustomClient) ListStatesByAddressContext(ctx context.Context, addr weave.Address, opts ListOptions) (*StatesPage, error) {
+	if err := addr.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid address")
+	}
+	var page StatesPage
+	next, err := cc.scanModels(ctx, statesPrefix, opts, func(id, value []byte, height int64) (bool, error) {
+		var s custom.State
+		if err := s.Unmarshal(value); err != nil {
+			return false, errors.Wrap(err, "cannot unmarshal state")
+		}
+		if !s.Address.Equals(addr) {
+			return false, nil
+		}
+		page.States = append(page.States, StateResponse{ID: id, State: s, Height: height})
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	page.Next = next
+	return &page, nil
+}
+
+// ListTimedStatesExpiringBeforeContext returns a page of timed states that
+// are deleted before the given time. Timed states are not indexed by the
+// deletion time, so they are fetched and filtered by the client. See
+// ListOptions for the cost. Expired timed states are deleted by the cron, so
+// the bucket holds only pending ones.
+func (cc *CustomClient) ListTimedStatesExpiringBeforeContext(ctx context.Context, t time.Time, opts ListOptions) (*TimedStatesPage, error) {
+	before := weave.AsUnixTime(t)
+	var page TimedStatesPage
+	next, err := cc.scanModels(ctx, timedStatesPrefix, opts, func(id, value []byte, height int64) (bool, error) {
+		var ts custom.TimedState
+		if err := ts.Unmarshal(value); err != nil {
+			return false, errors.Wrap(err, "cannot unmarshal timed state")
+		}
+		if ts.DeleteAt >= before {
+			return false, nil
+		}
+		page.TimedStates = append(page.TimedStates, TimedStateResponse{ID: id, TimedState: ts, Height: height})
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	page.Next = next
+	return &page, nil
+}
+
+// scanModels passes models stored under the prefix to fn, in key order, until
+// the limits of the options are reached. fn reports whether the model was
+// added to the page. It returns the ID of the last examined model if the scan
+// stopped before all models were examined.
+func (cc *CustomClient) scanModels(ctx context.Context, prefix string, opts ListOptions, fn func(id, value []byte, height int64) (bool, error)) ([]byte, error) {
+	if opts.Limit < 0 || opts.ScanLimit < 0 {
+		return nil, errors.Wrap(errors.ErrInput, "limits must not be negative")
+	}
+	scanLimit := opts.ScanLimit
+	if scanLimit == 0 {
+		scanLimit = DefaultListScanLimit
+	}
+	// Fetch one model more than the limit, to learn whether the scan is
+	// complete.
+	pageSize := scanLimit + 1
+	if pageSize > customd.MaxRangeQueryLimit {
+		pageSize = customd.MaxRangeQueryLimit
+	}
+	var cursor []byte
+	if opts.After != nil {
+		// The smallest key greater than the last examined one.
+		cursor = append(append([]byte(prefix), opts.After...), 0)
+	}
+
+	var (
+		last    []byte
+		scanned int
+		matched int
+	)
+	it := cc.IterateFromContext(ctx, []byte(prefix), cursor, pageSize)
+	for it.Next() {
+		// More models remain, so the scan is continued by the next page.
+		if scanned == scanLimit || (opts.Limit > 0 && matched == opts.Limit) {
+			return last, nil
+		}
+		m := it.Model()
+		last = stripBucketPrefix(m.Key)
+		ok, err := fn(last, m.Value, it.Height())
+		if err != nil {
+			return nil, err
+		}
+		scanned++
+		if ok {
+			matched++
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
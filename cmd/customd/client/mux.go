@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/iov-one/weave/errors"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// DefaultSubscriptionBuffer is the default number of events that a
+// subscription can hold before new events are dropped.
+const DefaultSubscriptionBuffer = 100
+
+// muxConnection is a connection that shares a single subscription of the
+// wrapped connection between all subscribers of the same query.
+//
+// The tendermint HTTP connection keeps one channel per query and ignores
+// the subscriber, so two subscriptions to the same query steal events from
+// each other and cancelling one of them cancels both. muxConnection
+// subscribes once per query, using its own unique subscriber ID, and
+// forwards every event to all subscribers of that query. A subscriber that
+// does not keep up with the events loses them, as with the tendermint local
+// connection.
+//
+// Unlike the tendermint connections, the channel of a subscription is
+// closed when it is cancelled.
+type muxConnection struct {
+	client.Client
+
+	prefix string
+
+	mu     sync.Mutex
+	seq    int
+	topics map[string]*muxTopic
+}
+
+var _ client.Client = (*muxConnection)(nil)
+
+// muxTopic is a subscription of the wrapped connection to a single query.
+type muxTopic struct {
+	// subscriber is the ID used with the wrapped connection.
+	subscriber string
+	// stop is closed to stop forwarding events. It is nil when the topic
+	// is not subscribed.
+	stop chan struct{}
+	outs map[string]chan ctypes.ResultEvent
+}
+
+func newMuxConnection(conn client.Client) *muxConnection {
+	return &muxConnection{
+		Client: conn,
+		prefix: "mux-" + hex.EncodeToString(cmn.RandBytes(4)),
+		topics: make(map[string]*muxTopic),
+	}
+}
+
+// Subscribe implements client.Client.
+func (m *muxConnection) Subscribe(ctx context.Context, subscriber, query string, outCapacity ...int) (<-chan ctypes.ResultEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.topics[query]
+	if !ok {
+		t = &muxTopic{outs: make(map[string]chan ctypes.ResultEvent)}
+		if err := m.connect(ctx, query, t); err != nil {
+			return nil, err
+		}
+		m.topics[query] = t
+	}
+	if _, ok := t.outs[subscriber]; ok {
+		return nil, errors.Wrapf(errors.ErrDuplicate, "%s is already subscribed to %q", subscriber, query)
+	}
+	outCap := 1
+	if len(outCapacity) > 0 {
+		outCap = outCapacity[0]
+	}
+	out := make(chan ctypes.ResultEvent, outCap)
+	t.outs[subscriber] = out
+	return out, nil
+}
+
+// Unsubscribe implements client.Client.
+func (m *muxConnection) Unsubscribe(ctx context.Context, subscriber, query string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.topics[query]
+	if !ok {
+		return errors.Wrap(errors.ErrNotFound, "subscription")
+	}
+	if _, ok := t.outs[subscriber]; !ok {
+		return errors.Wrap(errors.ErrNotFound, "subscription")
+	}
+	return m.remove(ctx, query, t, subscriber)
+}
+
+// UnsubscribeAll implements client.Client.
+func (m *muxConnection) UnsubscribeAll(ctx context.Context, subscriber string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs error
+	for query, t := range m.topics {
+		if _, ok := t.outs[subscriber]; ok {
+			errs = errors.Append(errs, m.remove(ctx, query, t, subscriber))
+		}
+	}
+	return errs
+}
+
+// Resubscribe renews the subscription of the wrapped connection to the
+// query, without affecting its subscribers. Use it when events stop arriving,
+// for example because the websocket connection was dropped.
+func (m *muxConnection) Resubscribe(ctx context.Context, query string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.topics[query]
+	if !ok {
+		return errors.Wrap(errors.ErrNotFound, "subscription")
+	}
+	// The old subscription is most likely broken, so failing to cancel
+	// it is not an error.
+	_ = m.disconnect(ctx, query, t)
+	return m.connect(ctx, query, t)
+}
+
+// remove cancels the subscription of the subscriber and closes its channel.
+// The subscription of the wrapped connection is cancelled together with the
+// last subscriber. Caller must hold the lock.
+func (m *muxConnection) remove(ctx context.Context, query string, t *muxTopic, subscriber string) error {
+	close(t.outs[subscriber])
+	delete(t.outs, subscriber)
+	if len(t.outs) != 0 {
+		return nil
+	}
+	delete(m.topics, query)
+	return m.disconnect(ctx, query, t)
+}
+
+// connect subscribes the wrapped connection to the query and starts
+// forwarding events. Caller must hold the lock.
+func (m *muxConnection) connect(ctx context.Context, query string, t *muxTopic) error {
+	m.seq++
+	subscriber := fmt.Sprintf("%s-%d", m.prefix, m.seq)
+	in, err := m.Client.Subscribe(ctx, subscriber, query, DefaultSubscriptionBuffer)
+	if err != nil {
+		return err
+	}
+	t.subscriber = subscriber
+	t.stop = make(chan struct{})
+	go m.forward(t, in, t.stop)
+	return nil
+}
+
+// disconnect stops forwarding events and cancels the subscription of the
+// wrapped connection. Caller must hold the lock.
+func (m *muxConnection) disconnect(ctx context.Context, query string, t *muxTopic) error {
+	if t.stop == nil {
+		return nil
+	}
+	close(t.stop)
+	t.stop = nil
+	return m.Client.Unsubscribe(ctx, t.subscriber, query)
+}
+
+// forward passes events to all subscribers of the topic until stopped.
+func (m *muxConnection) forward(t *muxTopic, in <-chan ctypes.ResultEvent, stop <-chan struct{}) {
+	for {
+		select {
+		case evt, ok := <-in:
+			if !ok {
+				return
+			}
+			m.mu.Lock()
+			select {
+			case <-stop:
+				// Stopped while waiting for the lock.
+				m.mu.Unlock()
+				return
+			default:
+			}
+			for _, out := range t.outs {
+				select {
+				case out <- evt:
+				default:
+				}
+			}
+			m.mu.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
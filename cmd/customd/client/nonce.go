@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave/crypto"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/x/sigs"
+)
+
+// NonceSource provides the next nonce of an address, as stored on the chain.
+// Both CustomClient and InMemoryClient implement it.
+type NonceSource interface {
+	NextNonceContext(ctx context.Context, addr weave.Address) (int64, error)
+}
+
+// NonceManager caches the next nonce of each address, so that many
+// transactions signed by the same key can be submitted without waiting for
+// the previous one to be committed. The nonce is fetched from the chain on
+// the first use and whenever the cached value is found to be out of sync.
+//
+// NonceManager is safe for concurrent use.
+type NonceManager struct {
+	source NonceSource
+
+	mu       sync.Mutex
+	accounts map[string]*accountNonce
+}
+
+// accountNonce holds the cached nonce of a single address. Its lock is held
+// while the nonce is being used, so that transactions of the same address
+// are signed and submitted one at a time, in the nonce order.
+type accountNonce struct {
+	mu     sync.Mutex
+	next   int64
+	synced bool
+}
+
+// NewNonceManager returns a nonce manager that fetches nonces from the
+// given source.
+func NewNonceManager(source NonceSource) *NonceManager {
+	return &NonceManager{
+		source:   source,
+		accounts: make(map[string]*accountNonce),
+	}
+}
+
+func (m *NonceManager) account(addr weave.Address) *accountNonce {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	acc, ok := m.accounts[addr.String()]
+	if !ok {
+		acc = &accountNonce{}
+		m.accounts[addr.String()] = acc
+	}
+	return acc
+}
+
+// Do calls fn with the next nonce of the address. No other call for the same
+// address is made until fn returns, so fn should sign the transaction and
+// submit it to the mempool, but it should not wait for the commit.
+//
+// The nonce is used up only if fn returns no error. If fn returns
+// sigs.ErrInvalidSequence, the cached value is dropped and the next call
+// fetches the nonce from the chain again. The nonce on the chain does not
+// account for transactions waiting in the mempool, so fetching it while
+// transactions of the address are pending might return a used nonce.
+func (m *NonceManager) Do(ctx context.Context, addr weave.Address, fn func(nonce int64) error) error {
+	acc := m.account(addr)
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+
+	if !acc.synced {
+		n, err := m.source.NextNonceContext(ctx, addr)
+		if err != nil {
+			return errors.Wrap(err, "cannot fetch nonce")
+		}
+		acc.next = n
+		acc.synced = true
+	}
+
+	if err := fn(acc.next); err != nil {
+		if sigs.ErrInvalidSequence.Is(err) {
+			acc.synced = false
+		}
+		return err
+	}
+	acc.next++
+	return nil
+}
+
+// Next returns the next nonce of the address and marks it as used. Use Do
+// instead, if the nonce might remain unused because the transaction is
+// rejected.
+func (m *NonceManager) Next(ctx context.Context, addr weave.Address) (int64, error) {
+	var nonce int64
+	err := m.Do(ctx, addr, func(n int64) error {
+		nonce = n
+		return nil
+	})
+	return nonce, err
+}
+
+// Reset drops the cached nonce of the address. The next call fetches the
+// nonce from the chain.
+func (m *NonceManager) Reset(addr weave.Address) {
+	acc := m.account(addr)
+	acc.mu.Lock()
+	acc.synced = false
+	acc.mu.Unlock()
+}
+
+// submitFunc submits a signed transaction to the mempool and returns a
+// future resolved when the transaction is committed.
+type submitFunc func(ctx context.Context, tx weave.Tx) (*TxFuture, error)
+
+// signAndBroadcast signs the transaction with the next nonce of the signer
+// and submits it. When the submission fails because of the nonce, the nonce
+// is fetched from the chain and the transaction is signed and submitted once
+// again.
+func signAndBroadcast(ctx context.Context, chainID string, nonces *NonceManager, tx *customd.Tx, signer *crypto.PrivateKey, submit submitFunc) BroadcastTxResponse {
+	addr := signer.PublicKey().Address()
+	signed := len(tx.Signatures)
+
+	var future *TxFuture
+	for attempt := 0; ; attempt++ {
+		err := nonces.Do(ctx, addr, func(nonce int64) error {
+			tx.Signatures = tx.Signatures[:signed]
+			if err := SignTx(tx, signer, chainID, nonce); err != nil {
+				return errors.Wrap(err, "cannot sign")
+			}
+			f, err := submit(ctx, tx)
+			future = f
+			return err
+		})
+		if err == nil {
+			break
+		}
+		if attempt > 0 || !sigs.ErrInvalidSequence.Is(err) {
+			return BroadcastTxResponse{Error: err}
+		}
+	}
+	return future.Wait(ctx)
+}
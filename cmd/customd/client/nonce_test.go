@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/sigs"
+)
+
+type nonceSourceMock struct {
+	mu    sync.Mutex
+	next  int64
+	calls int
+}
+
+func (s *nonceSourceMock) NextNonceContext(ctx context.Context, addr weave.Address) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	return s.next, nil
+}
+
+func TestNonceManager(t *testing.T) {
+	source := &nonceSourceMock{next: 7}
+	nonces := NewNonceManager(source)
+	addr := GenPrivateKey().PublicKey().Address()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	used := make(map[int64]bool)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := nonces.Next(ctx, addr)
+			assert.Nil(t, err)
+			mu.Lock()
+			used[n] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	for n := int64(7); n < 17; n++ {
+		if !used[n] {
+			t.Fatalf("nonce %d not used", n)
+		}
+	}
+	assert.Equal(t, 1, source.calls)
+
+	// A failed call does not use up the nonce.
+	err := nonces.Do(ctx, addr, func(n int64) error {
+		assert.Equal(t, int64(17), n)
+		return errors.ErrInput
+	})
+	assert.IsErr(t, errors.ErrInput, err)
+	n, err := nonces.Next(ctx, addr)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(17), n)
+	assert.Equal(t, 1, source.calls)
+
+	// An invalid sequence error forces a resync.
+	source.next = 3
+	err = nonces.Do(ctx, addr, func(n int64) error {
+		return errors.Wrap(sigs.ErrInvalidSequence, "rejected")
+	})
+	assert.IsErr(t, sigs.ErrInvalidSequence, err)
+	n, err = nonces.Next(ctx, addr)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, 2, source.calls)
+
+	nonces.Reset(addr)
+	n, err = nonces.Next(ctx, addr)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, 3, source.calls)
+}
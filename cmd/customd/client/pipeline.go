@@ -0,0 +1,379 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+const (
+	// DefaultPipelineWorkers is the default number of goroutines submitting
+	// transactions to the node.
+	DefaultPipelineWorkers = 4
+	// DefaultPipelineQueueSize is the default number of transactions that
+	// can wait for a free worker.
+	DefaultPipelineQueueSize = 100
+	// DefaultMaxPendingBlocks is the default number of blocks a submitted
+	// transaction can be waiting for before it is considered lost.
+	DefaultMaxPendingBlocks = 10
+)
+
+// PipelineOptions configures a Pipeline. Zero values are replaced with
+// defaults.
+type PipelineOptions struct {
+	// Workers is the number of goroutines submitting transactions
+	// concurrently. Order of submission is preserved only when using a
+	// single worker.
+	Workers int
+	// QueueSize is the number of transactions that can wait for a free
+	// worker. Submit blocks when the queue is full.
+	QueueSize int
+	// MaxPendingBlocks is the number of blocks after which a submitted
+	// transaction that was not included in any of them fails with
+	// ErrTimeout. A transaction that passed the check can still be
+	// dropped by the node, for example when the mempool is full or
+	// rechecked, so this is the only way to learn about it.
+	MaxPendingBlocks int
+}
+
+// Pipeline submits transactions using synchronous broadcast and tracks them
+// until they are included in a block. A single stream of new blocks is used
+// to resolve all pending transactions, which allows to submit many
+// transactions at once without keeping a connection or a subscription per
+// transaction. The stream has no gaps, see SubscribeBlocksContext, so a
+// transaction is not reported as lost because a block event was missed.
+//
+//	p, err := NewPipeline(conn, PipelineOptions{})
+//	...
+//	defer p.Close()
+//	f, err := p.Submit(ctx, tx)
+//	...
+//	res := f.Wait(ctx)
+//
+// A worker waits for the check result of each transaction it submits, so a
+// transaction rejected by the check is resolved at once with the check
+// error.
+type Pipeline struct {
+	conn       client.Client
+	maxPending int
+	// unsubscribe cancels the stream of new blocks.
+	unsubscribe func()
+
+	queue chan *queuedTx
+	stop  chan struct{}
+	once  sync.Once
+	wg    sync.WaitGroup
+
+	// closing is write locked by Close, so that no transaction is
+	// queued after the queue is drained.
+	closing sync.RWMutex
+	closed  bool
+
+	mu      sync.Mutex
+	pending map[string][]*pendingTx
+}
+
+type queuedTx struct {
+	ctx    context.Context
+	data   tmtypes.Tx
+	future *TxFuture
+}
+
+type pendingTx struct {
+	future *TxFuture
+	// blocks is the number of blocks created since the transaction
+	// was submitted.
+	blocks int
+}
+
+// NewPipeline subscribes to new blocks and starts the workers. Call Close to
+// release all resources.
+func NewPipeline(conn client.Client, opts PipelineOptions) (*Pipeline, error) {
+	return newPipeline(NewClient(conn), opts)
+}
+
+// newPipeline returns a pipeline using the connection of the client.
+func newPipeline(cc *CustomClient, opts PipelineOptions) (*Pipeline, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultPipelineWorkers
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultPipelineQueueSize
+	}
+	if opts.MaxPendingBlocks <= 0 {
+		opts.MaxPendingBlocks = DefaultMaxPendingBlocks
+	}
+	blocks, unsubscribe, err := cc.SubscribeBlocksContext(context.Background(), SubscribeOptions{Buffer: opts.QueueSize})
+	if err != nil {
+		return nil, err
+	}
+	p := &Pipeline{
+		conn:        cc.conn,
+		maxPending:  opts.MaxPendingBlocks,
+		unsubscribe: unsubscribe,
+		queue:       make(chan *queuedTx, opts.QueueSize),
+		stop:        make(chan struct{}),
+		pending:     make(map[string][]*pendingTx),
+	}
+
+	p.wg.Add(opts.Workers + 1)
+	go p.watch(blocks)
+	for i := 0; i < opts.Workers; i++ {
+		go p.work()
+	}
+	return p, nil
+}
+
+// Submit queues the transaction for broadcasting and returns a future
+// resolved with the result once the transaction is included in a block. The
+// context limits the time spent waiting for a free place in the queue. When
+// it is done before the transaction is submitted, the future is resolved with
+// the context error.
+func (p *Pipeline) Submit(ctx context.Context, tx weave.Tx) (*TxFuture, error) {
+	raw, err := tx.Marshal()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot marshal transaction")
+	}
+	data := tmtypes.Tx(raw)
+	f := newTxFuture(data.Hash())
+
+	p.closing.RLock()
+	defer p.closing.RUnlock()
+	if p.closed {
+		return nil, errors.Wrap(errors.ErrState, "pipeline closed")
+	}
+	select {
+	case p.queue <- &queuedTx{ctx: ctx, data: data, future: f}:
+		return f, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-p.stop:
+		return nil, errors.Wrap(errors.ErrState, "pipeline closed")
+	}
+}
+
+// Close stops all workers and cancels the subscription. All transactions
+// that are not resolved yet fail with ErrState. It is safe to call Close
+// multiple times.
+func (p *Pipeline) Close() error {
+	p.once.Do(func() {
+		close(p.stop)
+
+		p.closing.Lock()
+		p.closed = true
+		p.closing.Unlock()
+
+		p.wg.Wait()
+		p.unsubscribe()
+
+		closedErr := errors.Wrap(errors.ErrState, "pipeline closed")
+		for drained := false; !drained; {
+			select {
+			case q := <-p.queue:
+				q.future.resolve(BroadcastTxResponse{Error: closedErr})
+			default:
+				drained = true
+			}
+		}
+		p.mu.Lock()
+		for key, txs := range p.pending {
+			for _, ptx := range txs {
+				ptx.future.resolve(BroadcastTxResponse{Error: closedErr})
+			}
+			delete(p.pending, key)
+		}
+		p.mu.Unlock()
+	})
+	return nil
+}
+
+// work broadcasts queued transactions until the pipeline is closed.
+func (p *Pipeline) work() {
+	defer p.wg.Done()
+	for {
+		select {
+		case q := <-p.queue:
+			p.broadcast(q)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// broadcast submits a single transaction. It is registered as pending
+// before broadcasting, so that it cannot be included in a block before it is
+// tracked.
+func (p *Pipeline) broadcast(q *queuedTx) {
+	if err := q.ctx.Err(); err != nil {
+		q.future.resolve(BroadcastTxResponse{Error: err})
+		return
+	}
+	untrack := p.track(q.future)
+	res, err := p.conn.BroadcastTxSync(q.data)
+	if err == nil && res.Code != 0 {
+		err = errors.Wrap(errors.ABCIError(res.Code, res.Log), "CheckTx error")
+	}
+	if err != nil {
+		untrack()
+		q.future.resolve(BroadcastTxResponse{Error: err})
+	}
+}
+
+// track registers the future as pending, so that it is resolved when a
+// transaction with the same hash is included in a block. The returned
+// function removes the registration.
+func (p *Pipeline) track(f *TxFuture) func() {
+	ptx := &pendingTx{future: f}
+	key := string(f.hash)
+
+	p.mu.Lock()
+	p.pending[key] = append(p.pending[key], ptx)
+	p.mu.Unlock()
+
+	return func() {
+		p.mu.Lock()
+		p.removePending(key, ptx)
+		p.mu.Unlock()
+	}
+}
+
+// removePending removes given transaction from the pending register. Caller
+// must hold the lock.
+func (p *Pipeline) removePending(key string, ptx *pendingTx) {
+	txs := p.pending[key]
+	for i, t := range txs {
+		if t == ptx {
+			txs = append(txs[:i], txs[i+1:]...)
+			break
+		}
+	}
+	if len(txs) == 0 {
+		delete(p.pending, key)
+	} else {
+		p.pending[key] = txs
+	}
+}
+
+// watch resolves pending transactions with each new block until the
+// pipeline is closed.
+func (p *Pipeline) watch(blocks <-chan *tmtypes.Block) {
+	defer p.wg.Done()
+	for {
+		select {
+		case block, ok := <-blocks:
+			if !ok {
+				return
+			}
+			p.resolveBlock(block)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// resolveBlock resolves all pending transactions included in the block and
+// expires those that were waiting for too long.
+func (p *Pipeline) resolveBlock(block *tmtypes.Block) {
+	p.mu.Lock()
+	included := make(map[int][]*pendingTx)
+	for i, tx := range block.Data.Txs {
+		key := string(tx.Hash())
+		if txs, ok := p.pending[key]; ok {
+			included[i] = txs
+			delete(p.pending, key)
+		}
+	}
+	var expired []*pendingTx
+	for key, txs := range p.pending {
+		var waiting []*pendingTx
+		for _, ptx := range txs {
+			ptx.blocks++
+			if ptx.blocks > p.maxPending {
+				expired = append(expired, ptx)
+			} else {
+				waiting = append(waiting, ptx)
+			}
+		}
+		if len(waiting) == 0 {
+			delete(p.pending, key)
+		} else {
+			p.pending[key] = waiting
+		}
+	}
+	p.mu.Unlock()
+
+	for _, ptx := range expired {
+		ptx.future.resolve(BroadcastTxResponse{
+			Error: errors.Wrapf(errors.ErrTimeout, "transaction not included in %d blocks", p.maxPending),
+		})
+	}
+	if len(included) == 0 {
+		return
+	}
+
+	height := block.Height
+	results, err := p.conn.BlockResults(&height)
+	if err == nil && (results.Results == nil || len(results.Results.DeliverTx) != len(block.Data.Txs)) {
+		err = errors.Wrapf(errors.ErrState, "incomplete results of block %d", height)
+	}
+	for i, txs := range included {
+		res := BroadcastTxResponse{Error: err}
+		if err == nil {
+			res.Response = &ctypes.ResultBroadcastTxCommit{
+				DeliverTx: *results.Results.DeliverTx[i],
+				Hash:      block.Data.Txs[i].Hash(),
+				Height:    height,
+			}
+		}
+		for _, ptx := range txs {
+			ptx.future.resolve(res)
+		}
+	}
+}
+
+// TxFuture is the result of a submitted transaction that is available once
+// the transaction is included in a block.
+type TxFuture struct {
+	hash []byte
+	done chan struct{}
+	once sync.Once
+	res  BroadcastTxResponse
+}
+
+func newTxFuture(hash []byte) *TxFuture {
+	return &TxFuture{hash: hash, done: make(chan struct{})}
+}
+
+// Hash returns the hash of the submitted transaction.
+func (f *TxFuture) Hash() []byte {
+	return f.hash
+}
+
+// Done returns a channel that is closed when the result is available.
+func (f *TxFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the result is available or the context is done. A
+// transaction rejected by the check fails with the check error, otherwise
+// only the deliver result is set.
+func (f *TxFuture) Wait(ctx context.Context) BroadcastTxResponse {
+	select {
+	case <-f.done:
+		return f.res
+	case <-ctx.Done():
+		return BroadcastTxResponse{Error: ctx.Err()}
+	}
+}
+
+func (f *TxFuture) resolve(res BroadcastTxResponse) {
+	f.once.Do(func() {
+		f.res = res
+		close(f.done)
+	})
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/sigs"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+func TestPipeline(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+
+	// A single worker preserves the order, so consecutive nonces can be
+	// used.
+	p, err := NewPipeline(conn, PipelineOptions{Workers: 1, MaxPendingBlocks: 3})
+	assert.Nil(t, err)
+	defer p.Close()
+
+	chainID := getChainID()
+	src := faucet.PublicKey().Address()
+	rcpt := GenPrivateKey().PublicKey().Address()
+	amount := coin.Coin{Whole: 1, Ticker: initBalance.Ticker}
+	n, err := customd.NextNonce(src)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var futures []*TxFuture
+	for i := int64(0); i < 5; i++ {
+		tx := BuildSendTx(src, rcpt, amount, "Pipeline")
+		SignTx(tx, faucet, chainID, n+i)
+		f, err := p.Submit(ctx, tx)
+		assert.Nil(t, err)
+		futures = append(futures, f)
+	}
+	for _, f := range futures {
+		res := f.Wait(ctx)
+		assert.Nil(t, res.IsError())
+		assert.Equal(t, f.Hash(), []byte(res.Response.Hash))
+		assert.Equal(t, true, res.Response.Height > 0)
+	}
+	wallet, err := customd.GetWallet(rcpt)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), wallet.Wallet.Coins[0].Whole)
+
+	// A transaction rejected by the check fails with the check error,
+	// without waiting for blocks.
+	bad := BuildSendTx(src, rcpt, amount, "Bad nonce")
+	SignTx(bad, faucet, chainID, n+1000)
+	f, err := p.Submit(ctx, bad)
+	assert.Nil(t, err)
+	res := f.Wait(ctx)
+	assert.IsErr(t, sigs.ErrInvalidSequence, res.IsError())
+
+	// Closing fails all unresolved transactions and new submissions.
+	assert.Nil(t, p.Close())
+	_, err = p.Submit(ctx, bad)
+	assert.IsErr(t, errors.ErrState, err)
+}
+
+// droppingConn drops the new block events of even heights, as a connection
+// does when events are not read fast enough.
+type droppingConn struct {
+	client.Client
+}
+
+func (c droppingConn) Subscribe(ctx context.Context, subscriber, query string, outCapacity ...int) (<-chan ctypes.ResultEvent, error) {
+	in, err := c.Client.Subscribe(ctx, subscriber, query, outCapacity...)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan ctypes.ResultEvent, cap(in))
+	go func() {
+		defer close(out)
+		for evt := range in {
+			if data, ok := evt.Data.(tmtypes.EventDataNewBlock); ok && data.Block.Height%2 == 0 {
+				continue
+			}
+			out <- evt
+		}
+	}()
+	return out, nil
+}
+
+func TestPipelineMissedBlocks(t *testing.T) {
+	conn := droppingConn{Client: NewLocalConnection(node)}
+	customd := NewClient(conn)
+
+	p, err := NewPipeline(conn, PipelineOptions{Workers: 1, MaxPendingBlocks: 1})
+	assert.Nil(t, err)
+	defer p.Close()
+
+	chainID := getChainID()
+	src := faucet.PublicKey().Address()
+	rcpt := GenPrivateKey().PublicKey().Address()
+	amount := coin.Coin{Whole: 1, Ticker: initBalance.Ticker}
+	n, err := customd.NextNonce(src)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Half of the transactions are included in blocks with a dropped
+	// event, yet all of them are resolved.
+	for i := int64(0); i < 4; i++ {
+		tx := BuildSendTx(src, rcpt, amount, "Missed blocks")
+		SignTx(tx, faucet, chainID, n+i)
+		f, err := p.Submit(ctx, tx)
+		assert.Nil(t, err)
+		res := f.Wait(ctx)
+		assert.Nil(t, res.IsError())
+	}
+	wallet, err := customd.GetWallet(rcpt)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), wallet.Wallet.Coins[0].Whole)
+}
+
+// losingConn accepts all transactions, but never sends them to the node, as
+// a node does when the transaction is dropped from its mempool.
+type losingConn struct {
+	client.Client
+}
+
+func (losingConn) BroadcastTxSync(tx tmtypes.Tx) (*ctypes.ResultBroadcastTx, error) {
+	return &ctypes.ResultBroadcastTx{Hash: tx.Hash()}, nil
+}
+
+func TestPipelineLostTx(t *testing.T) {
+	conn := losingConn{Client: NewLocalConnection(node)}
+	p, err := NewPipeline(conn, PipelineOptions{MaxPendingBlocks: 2})
+	assert.Nil(t, err)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx := BuildSendTx(faucet.PublicKey().Address(), GenPrivateKey().PublicKey().Address(), coin.Coin{Whole: 1, Ticker: initBalance.Ticker}, "Lost")
+	SignTx(tx, faucet, getChainID(), 0)
+	f, err := p.Submit(ctx, tx)
+	assert.Nil(t, err)
+	res := f.Wait(ctx)
+	assert.IsErr(t, errors.ErrTimeout, res.IsError())
+}
@@ -0,0 +1,413 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave/errors"
+	abci "github.com/tendermint/tendermint/abci/types"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	tmpubsub "github.com/tendermint/tendermint/libs/pubsub"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+const (
+	// DefaultStallTimeout is the default time without a new block after
+	// which a subscription checks whether the chain advanced.
+	DefaultStallTimeout = 30 * time.Second
+
+	// subscriptionRetryInterval is the time to wait before fetching
+	// block results again after a failure.
+	subscriptionRetryInterval = time.Second
+)
+
+// customBuckets are names of the buckets of the custom module.
+var customBuckets = []string{"state", "timedstate"}
+
+// SubscribeOptions configures typed subscriptions. Zero values are replaced
+// with defaults.
+type SubscribeOptions struct {
+	// FromHeight is the height of the first streamed block. Blocks created
+	// before the subscription are fetched from the block history. If not
+	// set, streaming starts with the next block.
+	FromHeight int64
+	// Buffer is the capacity of the returned channel.
+	Buffer int
+	// StallTimeout is the time without a new block after which the node
+	// is asked for its height. If the chain advanced, missed blocks are
+	// fetched and the subscription is renewed.
+	StallTimeout time.Duration
+	// OnError is called with errors that the subscription recovers from,
+	// for example when a block cannot be fetched. Failed operations are
+	// retried until the subscription is cancelled.
+	OnError func(error)
+}
+
+func (o SubscribeOptions) withDefaults() SubscribeOptions {
+	if o.Buffer <= 0 {
+		o.Buffer = DefaultSubscriptionBuffer
+	}
+	if o.StallTimeout <= 0 {
+		o.StallTimeout = DefaultStallTimeout
+	}
+	if o.OnError == nil {
+		o.OnError = func(error) {}
+	}
+	return o
+}
+
+// SubscribeBlocksContext streams new blocks in the height order and without
+// gaps. Blocks missed by the subscription, for example because the
+// websocket connection was dropped or the events were not read fast enough,
+// are fetched from the block history. When no block arrives for
+// StallTimeout while the chain advances, the subscription is renewed.
+//
+// The returned channel is closed when the subscription is cancelled, either
+// by calling the returned function or when the context is done.
+func (cc *CustomClient) SubscribeBlocksContext(ctx context.Context, opts SubscribeOptions) (<-chan *tmtypes.Block, func(), error) {
+	opts = opts.withDefaults()
+	next := opts.FromHeight
+	if next <= 0 {
+		// Query the height before subscribing, so that any block
+		// created meanwhile is fetched from the history.
+		height, err := cc.HeightContext(ctx)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "cannot fetch height")
+		}
+		next = height + 1
+	}
+
+	query := tmtypes.EventQueryNewBlock.String()
+	subscriber := cc.newSubscriber()
+	events, err := cc.conn.Subscribe(ctx, subscriber, query, opts.Buffer)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot subscribe to new blocks")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &blockStream{
+		cc:    cc,
+		opts:  opts,
+		query: query,
+		next:  next,
+		out:   make(chan *tmtypes.Block, opts.Buffer),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.run(ctx, events)
+		cc.conn.Unsubscribe(context.Background(), subscriber, query)
+		close(s.out)
+	}()
+	return s.out, func() { cancel(); <-done }, nil
+}
+
+// blockStream delivers blocks of a subscription.
+type blockStream struct {
+	cc    *CustomClient
+	opts  SubscribeOptions
+	query string
+	// next is the height of the next block to deliver.
+	next int64
+	out  chan *tmtypes.Block
+}
+
+func (s *blockStream) run(ctx context.Context, events <-chan ctypes.ResultEvent) {
+	s.catchUp(ctx)
+
+	stall := time.NewTimer(s.opts.StallTimeout)
+	defer stall.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-events:
+			if !ok {
+				return
+			}
+			data, ok := evt.Data.(tmtypes.EventDataNewBlock)
+			if !ok || data.Block == nil {
+				continue
+			}
+			if !stall.Stop() {
+				<-stall.C
+			}
+			stall.Reset(s.opts.StallTimeout)
+			if height := data.Block.Height; height >= s.next {
+				if s.backfill(ctx, height-1) {
+					s.send(ctx, data.Block)
+				}
+			}
+		case <-stall.C:
+			if s.catchUp(ctx) {
+				// The chain advanced, but no event was received.
+				if err := s.cc.conn.Resubscribe(ctx, s.query); err != nil {
+					s.opts.OnError(errors.Wrap(err, "cannot resubscribe"))
+				}
+			}
+			stall.Reset(s.opts.StallTimeout)
+		}
+	}
+}
+
+// catchUp delivers all blocks up to the latest one. It returns true if any
+// block was missing.
+func (s *blockStream) catchUp(ctx context.Context) bool {
+	height, err := s.cc.HeightContext(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.opts.OnError(errors.Wrap(err, "cannot fetch height"))
+		}
+		return false
+	}
+	if height < s.next {
+		return false
+	}
+	s.backfill(ctx, height)
+	return true
+}
+
+// backfill fetches and delivers all blocks up to given height. It returns
+// false if not all of them were delivered.
+func (s *blockStream) backfill(ctx context.Context, height int64) bool {
+	for s.next <= height {
+		h := s.next
+		var res *ctypes.ResultBlock
+		err := withContext(ctx, s.cc.conn, func(conn client.Client) (err error) {
+			res, err = conn.Block(&h)
+			return err
+		})
+		if err == nil && (res.Block == nil || res.Block.Height != h) {
+			err = errors.Wrap(errors.ErrState, "unexpected block")
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				s.opts.OnError(errors.Wrapf(err, "cannot fetch block %d", h))
+			}
+			return false
+		}
+		if !s.send(ctx, res.Block) {
+			return false
+		}
+	}
+	return true
+}
+
+// send delivers the block. It returns false if the context is done first.
+func (s *blockStream) send(ctx context.Context, block *tmtypes.Block) bool {
+	select {
+	case s.out <- block:
+		s.next = block.Height + 1
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// TxEvent is a transaction included in a block.
+type TxEvent struct {
+	Height int64
+	// Index is the position of the transaction in the block.
+	Index  uint32
+	Tx     tmtypes.Tx
+	Result abci.ResponseDeliverTx
+}
+
+// Hash returns the hash of the transaction.
+func (e TxEvent) Hash() []byte {
+	return e.Tx.Hash()
+}
+
+// SubscribeTxsContext streams transactions matching the query in the order
+// they were executed, including those that failed. Use nil query to stream
+// all transactions. The query is matched against the transaction tags, the
+// same way as for the tendermint Tx events, for example
+//
+//	tmquery.MustParse("tx.height > 100")
+//
+// Transactions are read from the blocks streamed by SubscribeBlocksContext,
+// so that none of them is missed.
+func (cc *CustomClient) SubscribeTxsContext(ctx context.Context, query tmpubsub.Query, opts SubscribeOptions) (<-chan TxEvent, func(), error) {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithCancel(ctx)
+	blocks, cancelBlocks, err := cc.SubscribeBlocksContext(ctx, opts)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	out := make(chan TxEvent, opts.Buffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(out)
+		defer cancelBlocks()
+		for block := range blocks {
+			if !cc.sendTxs(ctx, block, query, opts, out) {
+				return
+			}
+		}
+	}()
+	return out, func() { cancel(); <-done }, nil
+}
+
+// sendTxs delivers all transactions of the block that match the query. It
+// returns false if the context is done first.
+func (cc *CustomClient) sendTxs(ctx context.Context, block *tmtypes.Block, query tmpubsub.Query, opts SubscribeOptions, out chan<- TxEvent) bool {
+	txs := block.Data.Txs
+	if len(txs) == 0 {
+		return true
+	}
+	height := block.Height
+
+	var results *ctypes.ResultBlockResults
+	for {
+		err := withContext(ctx, cc.conn, func(conn client.Client) (err error) {
+			results, err = conn.BlockResults(&height)
+			return err
+		})
+		if err == nil && (results.Results == nil || len(results.Results.DeliverTx) != len(txs)) {
+			err = errors.Wrap(errors.ErrState, "incomplete results")
+		}
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		opts.OnError(errors.Wrapf(err, "cannot fetch results of block %d", height))
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(subscriptionRetryInterval):
+		}
+	}
+
+	for i, tx := range txs {
+		evt := TxEvent{
+			Height: height,
+			Index:  uint32(i),
+			Tx:     tx,
+			Result: *results.Results.DeliverTx[i],
+		}
+		if query != nil && !query.Matches(txTags(evt)) {
+			continue
+		}
+		select {
+		case out <- evt:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// txTags returns tags of the transaction, as they are matched by the
+// tendermint Tx event queries.
+func txTags(evt TxEvent) map[string]string {
+	tags := map[string]string{
+		tmtypes.EventTypeKey: tmtypes.EventTx,
+		tmtypes.TxHashKey:    fmt.Sprintf("%X", evt.Hash()),
+		tmtypes.TxHeightKey:  fmt.Sprint(evt.Height),
+	}
+	for _, t := range evt.Result.Tags {
+		tags[string(t.Key)] = string(t.Value)
+	}
+	return tags
+}
+
+// CustomEvent is a transaction that changed models of the custom module.
+type CustomEvent struct {
+	TxEvent
+	// Msg is the message of the transaction.
+	Msg weave.Msg
+	// Changes lists models of the custom module written by the
+	// transaction.
+	Changes []ModelChange
+}
+
+// ModelChange is a model written by a transaction, as tagged by the key
+// tagger.
+type ModelChange struct {
+	// Bucket is the name of the bucket, for example "state".
+	Bucket string
+	ID     []byte
+	// Deleted is true if the model was deleted.
+	Deleted bool
+}
+
+// SubscribeCustomContext streams successful transactions that changed any
+// state or timed state of the custom module. Timed states deleted by the
+// cron are not included, as they are not deleted by a transaction.
+func (cc *CustomClient) SubscribeCustomContext(ctx context.Context, opts SubscribeOptions) (<-chan CustomEvent, func(), error) {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithCancel(ctx)
+	txs, cancelTxs, err := cc.SubscribeTxsContext(ctx, nil, opts)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	out := make(chan CustomEvent, opts.Buffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer close(out)
+		defer cancelTxs()
+		for evt := range txs {
+			if evt.Result.IsErr() {
+				continue
+			}
+			changes := modelChanges(evt.Result.Tags, customBuckets)
+			if len(changes) == 0 {
+				continue
+			}
+			ce := CustomEvent{TxEvent: evt, Changes: changes}
+			if tx, err := ParseCustomTx(evt.Tx); err != nil {
+				opts.OnError(errors.Wrapf(err, "cannot parse transaction %X", evt.Hash()))
+			} else if ce.Msg, err = tx.GetMsg(); err != nil {
+				opts.OnError(errors.Wrapf(err, "cannot read message of transaction %X", evt.Hash()))
+			}
+			select {
+			case out <- ce:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, func() { cancel(); <-done }, nil
+}
+
+// modelChanges returns changes of models stored in given buckets, read from
+// the tags of the key tagger. Index entries and unknown buckets are ignored.
+func modelChanges(tags []cmn.KVPair, buckets []string) []ModelChange {
+	var changes []ModelChange
+	for _, t := range tags {
+		key, err := hex.DecodeString(string(t.Key))
+		if err != nil {
+			continue
+		}
+		i := bytes.IndexByte(key, ':')
+		if i < 0 {
+			continue
+		}
+		bucket := string(key[:i])
+		for _, b := range buckets {
+			if b == bucket {
+				changes = append(changes, ModelChange{
+					Bucket:  bucket,
+					ID:      key[i+1:],
+					Deleted: string(t.Value) == "d",
+				})
+				break
+			}
+		}
+	}
+	return changes
+}
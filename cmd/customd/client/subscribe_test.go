@@ -0,0 +1,281 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave"
+	customdApp "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave-starter-kit/x/custom"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/tendermint/tendermint/libs/common"
+	tmquery "github.com/tendermint/tendermint/libs/pubsub/query"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// subscribeMock is a connection that remembers subscriptions, so that
+// events can be published to them.
+type subscribeMock struct {
+	client.Client
+
+	mu   sync.Mutex
+	subs map[string]chan ctypes.ResultEvent
+}
+
+func (m *subscribeMock) Subscribe(ctx context.Context, subscriber, query string, outCapacity ...int) (<-chan ctypes.ResultEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(chan ctypes.ResultEvent, 10)
+	m.subs[subscriber] = out
+	return out, nil
+}
+
+func (m *subscribeMock) Unsubscribe(ctx context.Context, subscriber, query string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.subs, subscriber)
+	return nil
+}
+
+func (m *subscribeMock) publish(evt ctypes.ResultEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, out := range m.subs {
+		out <- evt
+	}
+}
+
+func (m *subscribeMock) subscribers() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.subs)
+}
+
+func TestMuxConnection(t *testing.T) {
+	conn := &subscribeMock{subs: make(map[string]chan ctypes.ResultEvent)}
+	mux := newMuxConnection(conn)
+	ctx := context.Background()
+	query := tmtypes.EventQueryNewBlock.String()
+
+	a, err := mux.Subscribe(ctx, "a", query, 5)
+	assert.Nil(t, err)
+	b, err := mux.Subscribe(ctx, "b", query, 5)
+	assert.Nil(t, err)
+	_, err = mux.Subscribe(ctx, "a", query)
+	assert.IsErr(t, errors.ErrDuplicate, err)
+	// Both subscribers share a single subscription.
+	assert.Equal(t, 1, conn.subscribers())
+
+	conn.publish(ctypes.ResultEvent{Query: "first"})
+	assert.Equal(t, "first", receive(t, a).Query)
+	assert.Equal(t, "first", receive(t, b).Query)
+
+	// Resubscribing replaces the subscription and keeps subscribers.
+	assert.Nil(t, mux.Resubscribe(ctx, query))
+	assert.Equal(t, 1, conn.subscribers())
+	conn.publish(ctypes.ResultEvent{Query: "second"})
+	assert.Equal(t, "second", receive(t, a).Query)
+	assert.Equal(t, "second", receive(t, b).Query)
+
+	// Cancelled subscription is closed and does not affect the other.
+	assert.Nil(t, mux.Unsubscribe(ctx, "a", query))
+	_, ok := <-a
+	assert.Equal(t, false, ok)
+	assert.IsErr(t, errors.ErrNotFound, mux.Unsubscribe(ctx, "a", query))
+	conn.publish(ctypes.ResultEvent{Query: "third"})
+	assert.Equal(t, "third", receive(t, b).Query)
+
+	assert.Nil(t, mux.UnsubscribeAll(ctx, "b"))
+	_, ok = <-b
+	assert.Equal(t, false, ok)
+	assert.Equal(t, 0, conn.subscribers())
+}
+
+func receive(t testing.TB, events <-chan ctypes.ResultEvent) ctypes.ResultEvent {
+	t.Helper()
+	select {
+	case evt := <-events:
+		return evt
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return ctypes.ResultEvent{}
+	}
+}
+
+func TestModelChanges(t *testing.T) {
+	tag := func(key, value string) common.KVPair {
+		return common.KVPair{
+			Key:   []byte(strings.ToUpper(hex.EncodeToString([]byte(key)))),
+			Value: []byte(value),
+		}
+	}
+	tags := []common.KVPair{
+		tag("state:id1", "s"),
+		tag("_i.state_address:addr", "s"),
+		tag("timedstate:id2", "d"),
+		tag("cash:addr", "s"),
+		tag("nonce", "s"),
+		{Key: []byte("action"), Value: []byte("custom/create_state")},
+	}
+	changes := modelChanges(tags, customBuckets)
+	assert.Equal(t, []ModelChange{
+		{Bucket: "state", ID: []byte("id1")},
+		{Bucket: "timedstate", ID: []byte("id2"), Deleted: true},
+	}, changes)
+}
+
+func TestSubscribeUnique(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Subscriptions to the same query do not collide.
+	a, cancelA, err := customd.SubscribeContext(ctx, QueryNewBlockHeader)
+	assert.Nil(t, err)
+	b, cancelB, err := customd.SubscribeContext(ctx, QueryNewBlockHeader)
+	assert.Nil(t, err)
+	defer cancelB()
+	receive(t, a)
+	receive(t, b)
+
+	cancelA()
+	for range a {
+		// Drain events received before cancelling.
+	}
+	receive(t, b)
+
+	assert.Nil(t, customd.UnsubscribeAllContext(ctx))
+	for range b {
+	}
+}
+
+func TestSubscribeBlocks(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	height, err := customd.HeightContext(ctx)
+	assert.Nil(t, err)
+	from := height - 5
+	if from < 1 {
+		from = 1
+	}
+
+	// A short stall timeout makes the subscription recover from missed
+	// events faster, but must not produce duplicates.
+	blocks, cancelBlocks, err := customd.SubscribeBlocksContext(ctx, SubscribeOptions{
+		FromHeight:   from,
+		StallTimeout: 10 * time.Millisecond,
+		OnError:      func(err error) { t.Logf("subscription error: %s", err) },
+	})
+	assert.Nil(t, err)
+
+	// Past blocks are fetched from the history and new blocks follow
+	// without gaps.
+	want := from
+	for want <= height+3 {
+		select {
+		case block := <-blocks:
+			assert.Equal(t, want, block.Height)
+			want++
+		case <-ctx.Done():
+			t.Fatal("blocks not received")
+		}
+	}
+
+	cancelBlocks()
+	for range blocks {
+	}
+}
+
+func TestSubscribeTxs(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+	defer customd.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	src := faucet.PublicKey().Address()
+	rcpt := GenPrivateKey().PublicKey().Address()
+	amount := coin.Coin{Whole: 1, Ticker: initBalance.Ticker}
+	tx := BuildSendTx(src, rcpt, amount, "subscribed")
+	n, err := customd.NextNonceContext(ctx, src)
+	assert.Nil(t, err)
+	SignTx(tx, faucet, getChainID(), n)
+	raw, err := tx.Marshal()
+	assert.Nil(t, err)
+
+	query := tmquery.MustParse(fmt.Sprintf("tx.hash='%X'", tmtypes.Tx(raw).Hash()))
+	txs, cancelTxs, err := customd.SubscribeTxsContext(ctx, query, SubscribeOptions{})
+	assert.Nil(t, err)
+	defer cancelTxs()
+
+	res := customd.BroadcastTxSync(tx, time.Minute)
+	assert.Nil(t, res.IsError())
+
+	select {
+	case evt := <-txs:
+		assert.Equal(t, res.Response.Height, evt.Height)
+		assert.Equal(t, []byte(res.Response.Hash), evt.Hash())
+		assert.Equal(t, false, evt.Result.IsErr())
+	case <-ctx.Done():
+		t.Fatal("transaction not received")
+	}
+}
+
+func TestSubscribeCustom(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+	defer customd.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	events, cancelEvents, err := customd.SubscribeCustomContext(ctx, SubscribeOptions{})
+	assert.Nil(t, err)
+	defer cancelEvents()
+
+	owner := GenPrivateKey().PublicKey().Address()
+	tx := &customdApp.Tx{
+		Sum: &customdApp.Tx_CustomCreateStateMsg{
+			CustomCreateStateMsg: &custom.CreateStateMsg{
+				Metadata:   &weave.Metadata{Schema: 1},
+				InnerState: &custom.InnerState{St1: 1, St2: 2},
+				Address:    owner,
+			},
+		},
+	}
+	res := customd.SignAndBroadcastContext(ctx, NewNonceManager(customd), tx, faucet)
+	assert.Nil(t, res.IsError())
+	id := res.Response.DeliverTx.Data
+
+	for {
+		select {
+		case evt := <-events:
+			if evt.Height != res.Response.Height {
+				continue
+			}
+			assert.Equal(t, []ModelChange{{Bucket: "state", ID: id}}, evt.Changes)
+			msg, ok := evt.Msg.(*custom.CreateStateMsg)
+			assert.Equal(t, true, ok)
+			assert.Equal(t, owner, msg.Address)
+			return
+		case <-ctx.Done():
+			t.Fatal("custom event not received")
+		}
+	}
+}
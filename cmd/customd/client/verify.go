@@ -0,0 +1,227 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave/app"
+	"github.com/iov-one/weave/errors"
+	"github.com/tendermint/iavl"
+	"github.com/tendermint/tendermint/crypto/merkle"
+	dbm "github.com/tendermint/tendermint/libs/db"
+	"github.com/tendermint/tendermint/lite"
+	lclient "github.com/tendermint/tendermint/lite/client"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+// headerPollInterval is how often the node is asked for the header that
+// certifies a proven query result, until it is created.
+const headerPollInterval = 100 * time.Millisecond
+
+// NewLightVerifier returns a light client verifier of the chain headers
+// served by the connection.
+//
+// The validator set of the first block is trusted without verification and
+// every later header is verified by following the validator set changes
+// from there. Trusted headers are stored in a database in trustDir, so that
+// the trust does not have to be established again on the next start. If
+// trustDir is empty, they are kept in memory only.
+func NewLightVerifier(conn client.Client, chainID, trustDir string) (lite.Verifier, error) {
+	var db dbm.DB
+	if trustDir == "" {
+		db = dbm.NewMemDB()
+	} else {
+		var err error
+		db, err = dbm.NewGoLevelDB("trust-base", trustDir)
+		if err != nil {
+			return nil, errors.Wrapf(errors.ErrDatabase, "cannot open trust database: %s", err)
+		}
+	}
+	trusted := lite.NewDBProvider("trusted", db)
+	source := lclient.NewProvider(chainID, conn)
+
+	if _, err := trusted.LatestFullCommit(chainID, 1, 1<<63-1); err != nil {
+		fc, err := source.LatestFullCommit(chainID, 1, 1)
+		if err != nil {
+			return nil, errors.Wrapf(errors.ErrState, "cannot fetch the first commit: %s", err)
+		}
+		if err := trusted.SaveFullCommit(fc); err != nil {
+			return nil, errors.Wrapf(errors.ErrDatabase, "cannot save the first commit: %s", err)
+		}
+	}
+	return lite.NewDynamicVerifier(chainID, trusted, source), nil
+}
+
+// SetVerifier sets the light client verifier used by verified queries. By
+// default an in-memory verifier is created on first use, see
+// NewLightVerifier.
+func (cc *CustomClient) SetVerifier(v lite.Verifier) {
+	cc.mu.Lock()
+	cc.verifier = v
+	cc.mu.Unlock()
+}
+
+// lightVerifier returns the verifier, creating it if not set yet.
+func (cc *CustomClient) lightVerifier(ctx context.Context) (lite.Verifier, error) {
+	cc.mu.Lock()
+	v := cc.verifier
+	cc.mu.Unlock()
+	if v != nil {
+		return v, nil
+	}
+
+	chainID, err := cc.ChainIDContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The verifier keeps the connection for later use, so it cannot be
+	// bound to the context.
+	err = abandonOnDone(ctx, func() (err error) {
+		v, err = NewLightVerifier(cc.conn, chainID, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.verifier == nil {
+		cc.verifier = v
+	}
+	return cc.verifier, nil
+}
+
+// VerifiedQueryContext returns the model stored under given raw database
+// key, for example "cash:" followed by an address, without trusting the
+// node. The node must prove the result with a Merkle proof, which is
+// verified against the app hash of a header certified by the light client.
+// Models are empty if the node proves there is no such key.
+//
+// The app hash of the state at height H is included in the header H+1, so
+// the call waits for the next block when the latest state is queried. Use
+// zero height to query the latest state.
+func (cc *CustomClient) VerifiedQueryContext(ctx context.Context, key []byte, height int64) (AbciResponse, error) {
+	var out AbciResponse
+	if len(key) == 0 {
+		return out, errors.Wrap(errors.ErrEmpty, "key")
+	}
+	verifier, err := cc.lightVerifier(ctx)
+	if err != nil {
+		return out, errors.Wrap(err, "cannot create light client verifier")
+	}
+
+	opts := client.ABCIQueryOptions{Height: height, Prove: true}
+	var q *ctypes.ResultABCIQuery
+	err = withContext(ctx, cc.conn, func(conn client.Client) (err error) {
+		q, err = conn.ABCIQueryWithOptions(customd.ProvePath, key, opts)
+		return err
+	})
+	if err != nil {
+		return out, err
+	}
+	resp := q.Response
+	if resp.IsErr() {
+		return out, errors.ABCIError(resp.Code, resp.Log)
+	}
+	if resp.Proof == nil {
+		return out, errors.Wrap(errors.ErrState, "node returned no proof")
+	}
+	if resp.Height <= 0 {
+		return out, errors.Wrap(errors.ErrState, "node returned no height")
+	}
+	if height != 0 && resp.Height != height {
+		return out, errors.Wrapf(errors.ErrState, "node returned state at height %d instead of %d", resp.Height, height)
+	}
+
+	var models []weave.Model
+	if len(resp.Key) != 0 {
+		var keys, vals app.ResultSet
+		if err := keys.Unmarshal(resp.Key); err != nil {
+			return out, errors.Wrap(err, "cannot unmarshal keys")
+		}
+		if err := vals.Unmarshal(resp.Value); err != nil {
+			return out, errors.Wrap(err, "cannot unmarshal values")
+		}
+		if models, err = app.JoinResults(&keys, &vals); err != nil {
+			return out, err
+		}
+	}
+	if len(models) > 1 || (len(models) == 1 && !bytes.Equal(models[0].Key, key)) {
+		return out, errors.Wrap(errors.ErrState, "node returned a model that was not requested")
+	}
+
+	header, err := cc.certifiedHeader(ctx, verifier, resp.Height+1)
+	if err != nil {
+		return out, errors.Wrap(err, "cannot certify header")
+	}
+	keypath := merkle.KeyPath{}.AppendKey(key, merkle.KeyEncodingHex).String()
+	if len(models) == 1 {
+		err = proofRuntime().VerifyValue(resp.Proof, header.AppHash, keypath, models[0].Value)
+	} else {
+		err = proofRuntime().VerifyAbsence(resp.Proof, header.AppHash, keypath)
+	}
+	if err != nil {
+		return out, errors.Wrapf(ErrInvalidProof, "%s", err)
+	}
+
+	out.Models = models
+	out.Height = resp.Height
+	return out, nil
+}
+
+// certifiedHeader waits until the header at given height is created and
+// returns it once verified.
+func (cc *CustomClient) certifiedHeader(ctx context.Context, verifier lite.Verifier, height int64) (*tmtypes.Header, error) {
+	for {
+		status, err := cc.StatusContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if status.SyncInfo.LatestBlockHeight >= height {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(headerPollInterval):
+		}
+	}
+
+	var commit *ctypes.ResultCommit
+	err := withContext(ctx, cc.conn, func(conn client.Client) (err error) {
+		commit, err = conn.Commit(&height)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sh := commit.SignedHeader
+	if sh.Header == nil || sh.Height != height {
+		return nil, errors.Wrapf(errors.ErrState, "node returned a header for another height than %d", height)
+	}
+	if sh.ChainID != verifier.ChainID() {
+		return nil, errors.Wrapf(errors.ErrState, "header of chain %q", sh.ChainID)
+	}
+	err = abandonOnDone(ctx, func() error {
+		return verifier.Verify(sh)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidProof, "header verification failed: %s", err)
+	}
+	return sh.Header, nil
+}
+
+// proofRuntime returns a runtime that can verify the IAVL proofs returned
+// by customd.ProvingApp.
+func proofRuntime() *merkle.ProofRuntime {
+	prt := merkle.NewProofRuntime()
+	prt.RegisterOpDecoder(iavl.ProofOpIAVLValue, iavl.IAVLValueOpDecoder)
+	prt.RegisterOpDecoder(iavl.ProofOpIAVLAbsence, iavl.IAVLAbsenceOpDecoder)
+	return prt
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave/app"
+	"github.com/iov-one/weave/errors"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/iov-one/weave/x/cash"
+	cmn "github.com/tendermint/tendermint/libs/common"
+	"github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// tamperingConn returns proven query results with the value changed.
+type tamperingConn struct {
+	client.Client
+}
+
+func (c tamperingConn) ABCIQueryWithOptions(path string, data cmn.HexBytes, opts client.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	res, err := c.Client.ABCIQueryWithOptions(path, data, opts)
+	if err != nil || !opts.Prove {
+		return res, err
+	}
+	var vals app.ResultSet
+	if err := vals.Unmarshal(res.Response.Value); err != nil {
+		return nil, err
+	}
+	for _, v := range vals.Results {
+		v[len(v)-1]++
+	}
+	res.Response.Value, err = vals.Marshal()
+	return res, err
+}
+
+func TestVerifiedQuery(t *testing.T) {
+	conn := NewLocalConnection(node)
+	customd := NewClient(conn)
+	defer customd.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	key := append([]byte("cash:"), faucet.PublicKey().Address()...)
+	res, err := customd.VerifiedQueryContext(ctx, key, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(res.Models))
+	assert.Equal(t, key, res.Models[0].Key)
+	var wallet cash.Set
+	assert.Nil(t, wallet.Unmarshal(res.Models[0].Value))
+	assert.Equal(t, initBalance.Ticker, wallet.Coins[0].Ticker)
+
+	// A recent state can be proven as well. Only a few latest versions
+	// are kept and blocks are created quickly, so use the current one.
+	status, err := customd.StatusContext(ctx)
+	assert.Nil(t, err)
+	height := status.SyncInfo.LatestBlockHeight
+	res, err = customd.VerifiedQueryContext(ctx, key, height)
+	assert.Nil(t, err)
+	assert.Equal(t, height, res.Height)
+	assert.Equal(t, 1, len(res.Models))
+
+	// Absence of a key is proven.
+	missing := append([]byte("cash:"), GenPrivateKey().PublicKey().Address()...)
+	res, err = customd.VerifiedQueryContext(ctx, missing, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(res.Models))
+
+	// A value changed by the node is rejected.
+	tampered := NewClient(tamperingConn{Client: conn})
+	defer tampered.Close()
+	_, err = tampered.VerifiedQueryContext(ctx, key, 0)
+	assert.IsErr(t, ErrInvalidProof, err)
+
+	// Only raw key queries can be proven.
+	opts := client.ABCIQueryOptions{Prove: true}
+	_, err = customd.AbciQueryWithOptionsContext(ctx, "/wallets", faucet.PublicKey().Address(), opts)
+	assert.IsErr(t, errors.ErrInput, err)
+}
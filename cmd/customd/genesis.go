@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave-starter-kit/cmd/customd/client"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/commands/server"
+	tmtype "github.com/tendermint/tendermint/types"
+)
+
+// genesisCmd dispatches the genesis file subcommands.
+func genesisCmd(home string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing genesis command: add-account, generate-accounts or validate")
+	}
+	cmd, rest := args[0], args[1:]
+	switch cmd {
+	case "add-account":
+		return genesisAddAccountCmd(home, rest)
+	case "generate-accounts":
+		return genesisGenerateAccountsCmd(home, rest)
+	case "validate":
+		return genesisValidateCmd(home, rest)
+	default:
+		return fmt.Errorf("unknown genesis command: %s", cmd)
+	}
+}
+
+func genesisAddAccountCmd(home string, args []string) error {
+	fl := flag.NewFlagSet("genesis add-account", flag.ExitOnError)
+	var (
+		genesisFl = flGenesis(fl, home)
+		coinsFl   = flCoins(fl, "coin", "Coins of the account, for example \"100 CSTM\". Repeat to add several currencies.")
+		addrFl    weave.Address
+	)
+	fl.Var(&addrFl, "addr", "Address of the account, hex or bech32 encoded.")
+	fl.Parse(args)
+
+	if len(addrFl) == 0 {
+		return errors.New("address is required")
+	}
+	coins, err := coinsFl.normalized()
+	if err != nil {
+		return err
+	}
+
+	reqs := client.WalletRequests{Wallets: []client.WalletRequest{{Address: addrFl, Coins: coins}}}
+	return addGenesisWallets(*genesisFl, reqs.Normalize(coin.Coin{}))
+}
+
+func genesisGenerateAccountsCmd(home string, args []string) error {
+	fl := flag.NewFlagSet("genesis generate-accounts", flag.ExitOnError)
+	var (
+		genesisFl = flGenesis(fl, home)
+		coinsFl   = flCoins(fl, "coin", "Coins of each account, for example \"100 CSTM\". Repeat to add several currencies.")
+		nFl       = fl.Int("n", 1, "Number of accounts to generate.")
+		keysFl    = fl.String("keys", filepath.Join(home, server.DirConfig, "genesis_keys.json"), "File to write private keys of the generated accounts to.")
+		forceFl   = fl.Bool("f", false, "Overwrite the keys file if it exists.")
+	)
+	fl.Parse(args)
+
+	if *nFl < 1 {
+		return errors.New("number of accounts must be positive")
+	}
+	coins, err := coinsFl.normalized()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(*keysFl); err == nil && !*forceFl {
+		return fmt.Errorf("keys file %s already exists, use -f to overwrite it", *keysFl)
+	}
+
+	reqs := client.WalletRequests{Wallets: make([]client.WalletRequest, *nFl)}
+	for i := range reqs.Wallets {
+		reqs.Wallets[i].Coins = coins
+	}
+	ws := reqs.Normalize(coin.Coin{})
+
+	genesis, err := loadGenesis(*genesisFl)
+	if err != nil {
+		return err
+	}
+	if err := client.AddGenesisWallets(genesis, ws); err != nil {
+		return fmt.Errorf("cannot add accounts: %s", err)
+	}
+	// Keys are written first, so that no account is created without a
+	// key to access it.
+	if err := client.SavePrivateKeys(ws.Keys, *keysFl, true); err != nil {
+		return fmt.Errorf("cannot save keys: %s", err)
+	}
+	if err := genesis.SaveAs(*genesisFl); err != nil {
+		return fmt.Errorf("cannot save genesis: %s", err)
+	}
+	fmt.Printf("Added %d accounts to %s, keys written to %s\n", len(ws.Wallets), *genesisFl, *keysFl)
+	return nil
+}
+
+func genesisValidateCmd(home string, args []string) error {
+	fl := flag.NewFlagSet("genesis validate", flag.ExitOnError)
+	genesisFl := flGenesis(fl, home)
+	fl.Parse(args)
+
+	genesis, err := loadGenesis(*genesisFl)
+	if err != nil {
+		return err
+	}
+	if err := client.ValidateGenesis(genesis); err != nil {
+		return fmt.Errorf("invalid genesis: %s", err)
+	}
+	ws, err := client.GenesisWallets(genesis)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid, %d accounts\n", *genesisFl, len(ws.Wallets))
+	return nil
+}
+
+// addGenesisWallets adds the wallets to the genesis file.
+func addGenesisWallets(file string, ws client.WalletStore) error {
+	genesis, err := loadGenesis(file)
+	if err != nil {
+		return err
+	}
+	if err := client.AddGenesisWallets(genesis, ws); err != nil {
+		return fmt.Errorf("cannot add accounts: %s", err)
+	}
+	if err := genesis.SaveAs(file); err != nil {
+		return fmt.Errorf("cannot save genesis: %s", err)
+	}
+	fmt.Printf("Added %d accounts to %s\n", len(ws.Wallets), file)
+	return nil
+}
+
+func loadGenesis(file string) (*tmtype.GenesisDoc, error) {
+	genesis, err := tmtype.GenesisDocFromFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load genesis: %s", err)
+	}
+	return genesis, nil
+}
+
+// flGenesis registers the flag of the genesis file path, which by default is
+// the genesis of the home directory.
+func flGenesis(fl *flag.FlagSet, home string) *string {
+	return fl.String("genesis", filepath.Join(home, server.DirConfig, "genesis.json"), "Genesis file to use.")
+}
+
+// flCoins registers a flag that can be repeated to collect coins.
+func flCoins(fl *flag.FlagSet, name, usage string) *coinsFlag {
+	var c coinsFlag
+	fl.Var(&c, name, usage)
+	return &c
+}
+
+// coinsFlag is a list of coins that implements flag.Value interface.
+type coinsFlag coin.Coins
+
+func (c coinsFlag) String() string {
+	s := make([]string, len(c))
+	for i, x := range c {
+		s[i] = x.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+func (c *coinsFlag) Set(raw string) error {
+	x, err := coin.ParseHumanFormat(raw)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, &x)
+	return nil
+}
+
+// normalized returns the coins merged by currency. At least one coin is
+// required.
+func (c coinsFlag) normalized() (coin.Coins, error) {
+	if len(c) == 0 {
+		return nil, errors.New("at least one coin is required")
+	}
+	// NormalizeCoins of weave cannot handle two coins in the wrong
+	// order, so they are sorted first.
+	sorted := append(coin.Coins{}, c...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Ticker < sorted[j].Ticker
+	})
+	coins, err := coin.NormalizeCoins(sorted)
+	if err != nil {
+		return nil, fmt.Errorf("invalid coins: %s", err)
+	}
+	return coins, nil
+}
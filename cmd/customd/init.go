@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave-starter-kit/cmd/customd/client"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/commands/server"
+	"github.com/iov-one/weave/crypto"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// initCmd writes the application state to the genesis file created by
+// tendermint init. The state is described by a template file and flags,
+// that take precedence over the template. Positional ticker and address
+// arguments are accepted as well.
+//
+// When no account is given, one is generated. Its private key is written
+// to a file and never printed.
+func initCmd(logger log.Logger, home string, args []string) error {
+	fl := flag.NewFlagSet("init", flag.ExitOnError)
+	var (
+		templateFl   = fl.String("template", "", "JSON or YAML file describing the application state. See customd.GenesisTemplate for the attributes.")
+		tickerFl     = fl.String("ticker", "CSTM", "Ticker of the token of the generated account.")
+		coinsFl      = flCoins(fl, "coin", "Coins of the account funded when no accounts are given, for example \"100 CSTM\". Repeat to add several currencies. Defaults to 123456789 of the ticker.")
+		minimalFeeFl = fl.String("minimal-fee", "", "Fee required by each transaction, for example \"0.01 CSTM\".")
+		keysFl       = fl.String("keys", filepath.Join(home, server.DirConfig, "genesis_keys.json"), "File to write the private key of the generated account to.")
+		adminFl      weave.Address
+		collectorFl  weave.Address
+		validatorsFl addressesFlag
+
+		// Flags of the tendermint configuration, passed to server.InitCmd.
+		indexAllFl  = fl.Bool("all", true, "Index all transaction tags.")
+		indexTagsFl = fl.String("tags", "", "Comma-separated list of transaction tags to index.")
+		forceFl     = fl.Bool(server.FlagForce, false, "Overwrite the application state of the genesis, and the keys file.")
+		ignoreFl    = fl.Bool(server.FlagIgnore, false, "Do nothing if the application state is already initialized.")
+	)
+	fl.Var(&adminFl, "admin", "Address allowed to upgrade schema versions. Defaults to the first account.")
+	fl.Var(&collectorFl, "collector", "Address receiving the transaction fees. Defaults to the admin.")
+	fl.Var(&validatorsFl, "validator", "Address allowed to update the validator set. Repeat to allow several addresses.")
+	fl.Parse(args)
+
+	// Positional arguments are kept for compatibility.
+	if fl.NArg() > 0 {
+		*tickerFl = fl.Arg(0)
+	}
+	if fl.NArg() > 1 {
+		addr, err := weave.ParseAddress(fl.Arg(1))
+		if err != nil {
+			return fmt.Errorf("invalid address: %s", err)
+		}
+		adminFl = addr
+	}
+	if !coin.IsCC(*tickerFl) {
+		return fmt.Errorf("invalid ticker %s", *tickerFl)
+	}
+
+	template := &customd.GenesisTemplate{}
+	if *templateFl != "" {
+		var err error
+		if template, err = customd.LoadGenesisTemplate(*templateFl); err != nil {
+			return fmt.Errorf("cannot load template: %s", err)
+		}
+	}
+	if len(adminFl) != 0 {
+		template.MigrationAdmin = adminFl
+	}
+	if len(collectorFl) != 0 {
+		template.Collector = collectorFl
+	}
+	if *minimalFeeFl != "" {
+		fee, err := coin.ParseHumanFormat(*minimalFeeFl)
+		if err != nil {
+			return fmt.Errorf("invalid minimal fee: %s", err)
+		}
+		template.MinimalFee = fee
+	}
+	if len(validatorsFl) != 0 {
+		template.Validators = validatorsFl
+	}
+
+	var keys []*crypto.PrivateKey
+	if len(template.Accounts) == 0 {
+		addr := template.MigrationAdmin
+		if len(addr) == 0 {
+			if _, err := os.Stat(*keysFl); err == nil && !*forceFl {
+				return fmt.Errorf("keys file %s already exists, use -f to overwrite it", *keysFl)
+			}
+			key := client.GenPrivateKey()
+			keys = append(keys, key)
+			addr = key.PublicKey().Address()
+		}
+		template.Accounts = customd.DevGenesisTemplate(*tickerFl, addr).Accounts
+		if len(*coinsFl) != 0 {
+			coins, err := coinsFl.normalized()
+			if err != nil {
+				return err
+			}
+			template.Accounts[0].Coins = coins
+		}
+	}
+	if len(template.MigrationAdmin) == 0 {
+		template.MigrationAdmin = template.Accounts[0].Address
+	}
+
+	gen := func([]string) (json.RawMessage, error) {
+		appState, err := template.AppState()
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %s", err)
+		}
+		genesis, err := loadGenesis(filepath.Join(home, server.DirConfig, "genesis.json"))
+		if err != nil {
+			return nil, err
+		}
+		genesis.AppState = appState
+		if err := client.ValidateGenesis(genesis); err != nil {
+			return nil, fmt.Errorf("invalid genesis: %s", err)
+		}
+		// The key is written first, so that no account is created
+		// without a key to access it.
+		if len(keys) != 0 {
+			if err := client.SavePrivateKeys(keys, *keysFl, true); err != nil {
+				return nil, fmt.Errorf("cannot save keys: %s", err)
+			}
+			fmt.Printf("Generated account %s, private key written to %s\n", template.Accounts[0].Address, *keysFl)
+		}
+		return appState, nil
+	}
+	initArgs := []string{
+		"-all=" + strconv.FormatBool(*indexAllFl),
+		"-tags=" + *indexTagsFl,
+		"-" + server.FlagForce + "=" + strconv.FormatBool(*forceFl),
+		"-" + server.FlagIgnore + "=" + strconv.FormatBool(*ignoreFl),
+	}
+	return server.InitCmd(gen, logger, home, initArgs)
+}
+
+// addressesFlag is a list of addresses that implements flag.Value interface.
+type addressesFlag []weave.Address
+
+func (a addressesFlag) String() string {
+	s := make([]string, len(a))
+	for i, addr := range a {
+		s[i] = addr.String()
+	}
+	return fmt.Sprint(s)
+}
+
+func (a *addressesFlag) Set(raw string) error {
+	addr, err := weave.ParseAddress(raw)
+	if err != nil {
+		return err
+	}
+	*a = append(*a, addr)
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave/store/iavl"
+	tmiavl "github.com/tendermint/iavl"
+	dbm "github.com/tendermint/tendermint/libs/db"
+)
+
+// inspectCmd dispatches the subcommands that read the application state
+// directly from the database, without a running node.
+func inspectCmd(home string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing inspect command: info, buckets, dump or diff")
+	}
+	cmd, rest := args[0], args[1:]
+	switch cmd {
+	case "info":
+		return inspectInfoCmd(home, rest)
+	case "buckets":
+		return inspectBucketsCmd(home, rest)
+	case "dump":
+		return inspectDumpCmd(home, rest)
+	case "diff":
+		return inspectDiffCmd(home, rest)
+	default:
+		return fmt.Errorf("unknown inspect command: %s", cmd)
+	}
+}
+
+func inspectInfoCmd(home string, args []string) error {
+	fl := flag.NewFlagSet("inspect info", flag.ExitOnError)
+	backendFl := fl.String("db-backend", string(customd.GoLevelDBBackend), dbBackendUsage)
+	fl.Parse(args)
+
+	db, tree, err := openInspectTree(home, *backendFl)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	versions := customd.StoredVersions(tree)
+	fmt.Printf("Height:   %d\n", tree.Version())
+	fmt.Printf("App hash: %X\n", tree.Hash())
+	if len(versions) != 0 {
+		fmt.Printf("Stored:   %d versions, from %d to %d\n", len(versions), versions[0], versions[len(versions)-1])
+	}
+	return nil
+}
+
+func inspectBucketsCmd(home string, args []string) error {
+	fl := flag.NewFlagSet("inspect buckets", flag.ExitOnError)
+	var (
+		backendFl = fl.String("db-backend", string(customd.GoLevelDBBackend), dbBackendUsage)
+		heightFl  = fl.Int64("height", 0, "Height of the state. Defaults to the latest one.")
+	)
+	fl.Parse(args)
+
+	db, tree, err := openInspectTree(home, *backendFl)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	state, err := inspectVersion(tree, *heightFl)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BUCKET\tKEYS\tBYTES")
+	for _, b := range customd.StateBuckets(state) {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", b.Name, b.Keys, b.Size)
+	}
+	return w.Flush()
+}
+
+func inspectDumpCmd(home string, args []string) error {
+	fl := flag.NewFlagSet("inspect dump", flag.ExitOnError)
+	var (
+		backendFl = fl.String("db-backend", string(customd.GoLevelDBBackend), dbBackendUsage)
+		heightFl  = fl.Int64("height", 0, "Height of the state. Defaults to the latest one.")
+		prefixFl  = fl.String("prefix", "", "Dump only the keys with this prefix, for example \"cash:\".")
+		rawFl     = fl.Bool("raw", false, "Print values hex encoded instead of decoding them.")
+		limitFl   = fl.Int("limit", 0, "Maximum number of keys to print. Zero prints all.")
+	)
+	fl.Parse(args)
+
+	db, tree, err := openInspectTree(home, *backendFl)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	state, err := inspectVersion(tree, *heightFl)
+	if err != nil {
+		return err
+	}
+
+	var n int
+	customd.IterateState(state, []byte(*prefixFl), func(key, value []byte) bool {
+		fmt.Printf("%s\t%s\n", formatStateKey(key), formatStateValue(key, value, *rawFl))
+		n++
+		return *limitFl > 0 && n >= *limitFl
+	})
+	return nil
+}
+
+func inspectDiffCmd(home string, args []string) error {
+	fl := flag.NewFlagSet("inspect diff", flag.ExitOnError)
+	var (
+		backendFl = fl.String("db-backend", string(customd.GoLevelDBBackend), dbBackendUsage)
+		fromFl    = fl.Int64("from", 0, "Height of the state to compare from.")
+		toFl      = fl.Int64("to", 0, "Height of the state to compare to. Defaults to the latest one.")
+		prefixFl  = fl.String("prefix", "", "Compare only the keys with this prefix.")
+		rawFl     = fl.Bool("raw", false, "Print values hex encoded instead of decoding them.")
+	)
+	fl.Parse(args)
+
+	if *fromFl <= 0 {
+		return errors.New("height to compare from is required")
+	}
+	db, tree, err := openInspectTree(home, *backendFl)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	from, err := inspectVersion(tree, *fromFl)
+	if err != nil {
+		return err
+	}
+	to, err := inspectVersion(tree, *toFl)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range customd.DiffState(from, to, []byte(*prefixFl)) {
+		key := formatStateKey(c.Key)
+		switch {
+		case c.Before == nil:
+			fmt.Printf("+ %s\t%s\n", key, formatStateValue(c.Key, c.After, *rawFl))
+		case c.After == nil:
+			fmt.Printf("- %s\t%s\n", key, formatStateValue(c.Key, c.Before, *rawFl))
+		default:
+			fmt.Printf("~ %s\t%s\n", key, formatStateValue(c.Key, c.Before, *rawFl))
+			fmt.Printf("  %s\t%s\n", key, formatStateValue(c.Key, c.After, *rawFl))
+		}
+	}
+	return nil
+}
+
+// openInspectTree opens the application database of the home directory
+// read-only, and loads its latest version.
+func openInspectTree(home, backend string) (dbm.DB, *tmiavl.MutableTree, error) {
+	db, err := customd.OpenReadOnlyDB(customd.DBBackend(backend), customd.DBPath(home))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open database, is the node running? %s", err)
+	}
+	tree := tmiavl.NewMutableTree(db, iavl.DefaultCacheSize)
+	if _, err := tree.Load(); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("cannot load database: %s", err)
+	}
+	return db, tree, nil
+}
+
+// inspectVersion returns the state at the given height. Zero height returns
+// the latest state.
+func inspectVersion(tree *tmiavl.MutableTree, height int64) (*tmiavl.ImmutableTree, error) {
+	if height == 0 {
+		height = tree.Version()
+	}
+	state, err := tree.GetImmutable(height)
+	if err != nil {
+		return nil, fmt.Errorf("height %d is not stored, see \"inspect info\" for stored heights", height)
+	}
+	return state, nil
+}
+
+// formatStateKey returns the key as text if it is printable. Otherwise the
+// part after the bucket name is hex encoded.
+func formatStateKey(key []byte) string {
+	if isPrintable(key) {
+		return string(key)
+	}
+	bucket := customd.StateBucket(key)
+	if len(bucket) < len(key) && isPrintable([]byte(bucket)) {
+		return bucket + ":" + hex.EncodeToString(key[len(bucket)+1:])
+	}
+	return hex.EncodeToString(key)
+}
+
+// formatStateValue returns the value decoded as JSON, or hex encoded if it
+// has no registered model or raw is set.
+func formatStateValue(key, value []byte, raw bool) string {
+	if raw {
+		return hex.EncodeToString(value)
+	}
+	model, err := customd.DecodeStateValue(key, value)
+	if err != nil || model == nil {
+		return hex.EncodeToString(value)
+	}
+	out, err := json.Marshal(model)
+	if err != nil {
+		return hex.EncodeToString(value)
+	}
+	return string(out)
+}
+
+func isPrintable(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -10,17 +10,24 @@ import (
 	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
 	"github.com/iov-one/weave/commands"
 	"github.com/iov-one/weave/commands/server"
+	tmflags "github.com/tendermint/tendermint/libs/cli/flags"
 	"github.com/tendermint/tendermint/libs/log"
 )
 
 var (
-	flagHome = "home"
-	varHome  *string
+	flagHome      = "home"
+	flagLogFormat = "log-format"
+	flagLogLevel  = "log-level"
+	varHome       *string
+	varLogFormat  *string
+	varLogLevel   *string
 )
 
 func init() {
 	defaultHome := filepath.Join(os.ExpandEnv("$HOME"), ".custom")
 	varHome = flag.String(flagHome, defaultHome, "directory to store files under")
+	varLogFormat = flag.String(flagLogFormat, "text", "log format: text or json")
+	varLogLevel = flag.String(flagLogLevel, "debug", "log level, for all modules or as module:level pairs, for example \"custom:info,abci-server:error,*:debug\"")
 
 	flag.CommandLine.Usage = helpMessage
 }
@@ -31,20 +38,26 @@ func helpMessage() {
 	fmt.Println("")
 	fmt.Println("help      Print this message")
 	fmt.Println("init      Initialize app options in genesis file")
+	fmt.Println("genesis   Add accounts to the genesis file or validate it")
 	fmt.Println("start     Run the abci server")
+	fmt.Println("snapshot  Create a snapshot of the application state or restore it")
+	fmt.Println("inspect   Read the application state from the database of a stopped node")
+	fmt.Println("testnet   Generate a local testnet or start it with \"testnet start\"")
 	fmt.Println("getblock  Extract a block from blockchain.db")
 	fmt.Println("retry     Run last block again to ensure it produces same result")
 	fmt.Println("testgen   Generate various protoc and json files to test against")
 	fmt.Println("version   Print the app version")
 	fmt.Println(`
   -home string
-        directory to store files under (default "$HOME/.custom")`)
+        directory to store files under (default "$HOME/.custom")
+  -log-format string
+        log format: text or json (default "text")
+  -log-level string
+        log level, for all modules or as module:level pairs, for example
+        "custom:info,abci-server:error,*:debug" (default "debug")`)
 }
 
 func main() {
-	logger := log.NewTMLogger(log.NewSyncWriter(os.Stdout)).
-		With("module", "custom")
-
 	flag.Parse()
 	if flag.NArg() == 0 {
 		fmt.Println("Missing command:")
@@ -52,17 +65,32 @@ func main() {
 		os.Exit(1)
 	}
 
+	logger, err := newLogger(*varLogFormat, *varLogLevel)
+	if err != nil {
+		fmt.Printf("Error: %s\n\n", err)
+		helpMessage()
+		os.Exit(1)
+	}
+	logger = logger.With("module", "custom")
+
 	cmd := flag.Arg(0)
 	rest := flag.Args()[1:]
 
-	var err error
 	switch cmd {
 	case "help":
 		helpMessage()
 	case "init":
-		err = server.InitCmd(customd.GenInitOptions, logger, *varHome, rest)
+		err = initCmd(logger, *varHome, rest)
+	case "genesis":
+		err = genesisCmd(*varHome, rest)
 	case "start":
-		err = server.StartCmd(customd.GenerateApp, logger, *varHome, rest)
+		err = startCmd(logger, *varHome, rest)
+	case "snapshot":
+		err = snapshotCmd(*varHome, rest)
+	case "inspect":
+		err = inspectCmd(*varHome, rest)
+	case "testnet":
+		err = testnetCmd(rest)
 	case "getblock":
 		err = server.GetBlockCmd(rest)
 	case "retry":
@@ -81,3 +109,18 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newLogger returns a logger writing to stdout in the given format, that
+// filters entries by the level of their module.
+func newLogger(format, level string) (log.Logger, error) {
+	var logger log.Logger
+	switch format {
+	case "text":
+		logger = log.NewTMLogger(log.NewSyncWriter(os.Stdout))
+	case "json":
+		logger = log.NewTMJSONLogger(log.NewSyncWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
+	return tmflags.ParseLogLevel(level, logger, "debug")
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/tendermint/tendermint/blockchain"
+	sm "github.com/tendermint/tendermint/state"
+)
+
+// snapshotCmd dispatches the state snapshot subcommands.
+func snapshotCmd(home string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing snapshot command: create or restore")
+	}
+	cmd, rest := args[0], args[1:]
+	switch cmd {
+	case "create":
+		return snapshotCreateCmd(home, rest)
+	case "restore":
+		return snapshotRestoreCmd(home, rest)
+	default:
+		return fmt.Errorf("unknown snapshot command: %s", cmd)
+	}
+}
+
+func snapshotCreateCmd(home string, args []string) error {
+	fl := flag.NewFlagSet("snapshot create", flag.ExitOnError)
+	var (
+		heightFl  = fl.Int64("height", 0, "Height of the exported state. Defaults to the latest one. Only versions kept by the pruning options can be exported.")
+		outFl     = fl.String("o", "", "File to write the snapshot to. Defaults to custom-<height>.snapshot in the current directory.")
+		backendFl = fl.String("db-backend", string(customd.GoLevelDBBackend), dbBackendUsage)
+	)
+	fl.Parse(args)
+
+	db, err := customd.OpenDB(customd.DBBackend(*backendFl), customd.DBPath(home))
+	if err != nil {
+		return fmt.Errorf("cannot open database, is the node running? %s", err)
+	}
+	defer db.Close()
+
+	// The snapshot is written to a temporary file first, so that no
+	// incomplete snapshot is left.
+	dir := "."
+	if *outFl != "" {
+		dir = filepath.Dir(*outFl)
+	}
+	tmp, err := ioutil.TempFile(dir, ".snapshot")
+	if err != nil {
+		return fmt.Errorf("cannot create snapshot file: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	info, err := customd.ExportSnapshot(db, *heightFl, tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot export snapshot: %s", err)
+	}
+
+	out := *outFl
+	if out == "" {
+		out = fmt.Sprintf("custom-%d.snapshot", info.Height)
+	}
+	if err := os.Rename(tmp.Name(), out); err != nil {
+		return fmt.Errorf("cannot save snapshot: %s", err)
+	}
+	fmt.Printf("Exported height %d with app hash %X, %d nodes, to %s\n", info.Height, info.Hash, info.Nodes, out)
+	return nil
+}
+
+// snapshotRestoreCmd restores the application state into a fresh home
+// directory. Tendermint does not start with the application ahead of its
+// block store, so the block store and state of a stopped node at the
+// snapshot height or above are copied as well. If the block store is ahead,
+// tendermint replays the missing blocks on start. The configuration, keys and
+// genesis file of the home directory are not changed.
+func snapshotRestoreCmd(home string, args []string) error {
+	fl := flag.NewFlagSet("snapshot restore", flag.ExitOnError)
+	var (
+		inFl      = fl.String("i", "", "Snapshot file to restore.")
+		tmDataFl  = fl.String("tendermint-data", "", "Data directory of a stopped tendermint node of the same chain, for example ~/.custom/data. Its block store and state are copied into the home directory. Required unless tendermint is synced to the snapshot height by other means.")
+		backendFl = fl.String("db-backend", string(customd.GoLevelDBBackend), dbBackendUsage)
+	)
+	fl.Parse(args)
+
+	if *inFl == "" {
+		return errors.New("snapshot file is required")
+	}
+	if customd.DBBackend(*backendFl) == customd.MemDBBackend {
+		return errors.New("a snapshot cannot be restored into an in-memory database")
+	}
+	f, err := os.Open(*inFl)
+	if err != nil {
+		return fmt.Errorf("cannot open snapshot: %s", err)
+	}
+	defer f.Close()
+
+	dbPath := customd.DBPath(home)
+	if _, err := os.Stat(dbPath); err == nil {
+		return fmt.Errorf("database %s already exists, restore into a fresh home directory", dbPath)
+	}
+	if err := os.MkdirAll(home, 0700); err != nil {
+		return fmt.Errorf("cannot create home directory: %s", err)
+	}
+	db, err := customd.OpenDB(customd.DBBackend(*backendFl), dbPath)
+	if err != nil {
+		return err
+	}
+	info, err := customd.RestoreSnapshot(db, f)
+	db.Close()
+	if err != nil {
+		os.RemoveAll(dbPath)
+		return fmt.Errorf("cannot restore snapshot: %s", err)
+	}
+	fmt.Printf("Restored height %d with app hash %X, %d nodes, into %s\n", info.Height, info.Hash, info.Nodes, dbPath)
+
+	if *tmDataFl == "" {
+		fmt.Printf("Tendermint refuses to start with the application ahead of its block store. Stop a node of the same chain at height %d or above and copy its data/blockstore.db and data/state.db into %s, or restore again with -tendermint-data.\n", info.Height, tmDataDir(home))
+		return nil
+	}
+	height, err := copyTendermintData(*tmDataFl, home, info.Height)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		return fmt.Errorf("cannot restore tendermint data: %s", err)
+	}
+	fmt.Printf("Copied tendermint block store at height %d into %s\n", height, tmDataDir(home))
+	if height > info.Height {
+		fmt.Printf("Tendermint replays blocks %d to %d on start.\n", info.Height+1, height)
+	}
+	return nil
+}
+
+// tendermintDBs are the databases of tendermint that must be restored
+// together with the application state. Other databases, such as the
+// transaction index, are created empty.
+var tendermintDBs = []string{"blockstore", "state"}
+
+// tmDataDir returns the tendermint data directory of the home directory.
+func tmDataDir(home string) string {
+	return filepath.Join(home, "data")
+}
+
+// copyTendermintData copies the block store and state databases from the
+// data directory of a stopped tendermint node into the home directory. The
+// block store must contain the block at the given application height, so
+// that tendermint can start from it. It returns the height of the block
+// store.
+func copyTendermintData(src, home string, height int64) (int64, error) {
+	// Open the databases first to check that the node is stopped, as
+	// the database of a running node is locked.
+	var storeHeight, stateHeight int64
+	for _, name := range tendermintDBs {
+		db, err := customd.OpenReadOnlyDB(customd.GoLevelDBBackend, filepath.Join(src, name+".db"))
+		if err != nil {
+			return 0, fmt.Errorf("cannot open %s, is the node running? %s", name, err)
+		}
+		switch name {
+		case "blockstore":
+			storeHeight = blockchain.LoadBlockStoreStateJSON(db).Height
+		case "state":
+			stateHeight = sm.LoadState(db).LastBlockHeight
+		}
+		db.Close()
+	}
+	if storeHeight < height {
+		return 0, fmt.Errorf("block store is at height %d, below the snapshot height %d", storeHeight, height)
+	}
+	if stateHeight < height {
+		return 0, fmt.Errorf("state is at height %d, below the snapshot height %d", stateHeight, height)
+	}
+
+	dst := tmDataDir(home)
+	for _, name := range tendermintDBs {
+		if _, err := os.Stat(filepath.Join(dst, name+".db")); err == nil {
+			return 0, fmt.Errorf("%s.db already exists in %s", name, dst)
+		}
+	}
+	for _, name := range tendermintDBs {
+		if err := copyDir(filepath.Join(src, name+".db"), filepath.Join(dst, name+".db")); err != nil {
+			for _, name := range tendermintDBs {
+				os.RemoveAll(filepath.Join(dst, name+".db"))
+			}
+			return 0, err
+		}
+	}
+	return storeHeight, nil
+}
+
+// copyDir copies all regular files of the directory. Subdirectories are not
+// copied, as LevelDB does not create them.
+func copyDir(src, dst string) error {
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return err
+	}
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, fi.Name()), filepath.Join(dst, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iov-one/weave"
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave/commands/server"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/tendermint/tendermint/blockchain"
+	cfg "github.com/tendermint/tendermint/config"
+	dbm "github.com/tendermint/tendermint/libs/db"
+	"github.com/tendermint/tendermint/libs/log"
+	nm "github.com/tendermint/tendermint/node"
+	"github.com/tendermint/tendermint/p2p"
+	"github.com/tendermint/tendermint/privval"
+	"github.com/tendermint/tendermint/proxy"
+	tmtypes "github.com/tendermint/tendermint/types"
+)
+
+func TestSnapshotRestoreStartsNode(t *testing.T) {
+	source, err := ioutil.TempDir("", "snapshot-source")
+	assert.Nil(t, err)
+	defer os.RemoveAll(source)
+	genesis := newTestGenesis(t, source)
+
+	n, err := startTestNode(source)
+	assert.Nil(t, err)
+	n.waitForHeight(t, 3)
+	n.stop(t)
+
+	snapshotDir, err := ioutil.TempDir("", "snapshot")
+	assert.Nil(t, err)
+	defer os.RemoveAll(snapshotDir)
+	snapshot := filepath.Join(snapshotDir, "state.snapshot")
+	assert.Nil(t, snapshotCmd(source, []string{"create", "-o", snapshot}))
+
+	// The restored node uses the same validator, so that it can produce
+	// blocks alone. The validator might have signed the next block
+	// already, so the consensus log is needed to continue.
+	restored, err := ioutil.TempDir("", "snapshot-restored")
+	assert.Nil(t, err)
+	defer os.RemoveAll(restored)
+	for _, name := range []string{"config/genesis.json", "config/priv_validator_key.json", "data/priv_validator_state.json", "data/cs.wal/wal"} {
+		copyTestFile(t, filepath.Join(source, name), filepath.Join(restored, name))
+	}
+
+	// Without the tendermint data the restore succeeds, but tendermint
+	// refuses to start with the application ahead of its block store.
+	assert.Nil(t, snapshotCmd(restored, []string{"restore", "-i", snapshot}))
+	if _, err := startTestNode(restored); err == nil {
+		t.Fatal("node started without the block store")
+	}
+	for _, name := range []string{"custom.db", "data/blockstore.db", "data/state.db"} {
+		assert.Nil(t, os.RemoveAll(filepath.Join(restored, name)))
+	}
+
+	assert.Nil(t, snapshotCmd(restored, []string{"restore", "-i", snapshot, "-tendermint-data", filepath.Join(source, "data")}))
+	n, err = startTestNode(restored)
+	assert.Nil(t, err)
+	defer n.stop(t)
+	height := n.node.BlockStore().Height()
+	n.waitForHeight(t, height+2)
+
+	// The node continued the chain of the source node.
+	assert.Equal(t, genesis.ChainID, n.node.ConsensusState().GetState().ChainID)
+	sourceStore := openTestBlockStore(t, source)
+	defer sourceStore.close()
+	assert.Equal(t, sourceStore.LoadBlockMeta(height).BlockID, n.node.BlockStore().LoadBlockMeta(height).BlockID)
+}
+
+// newTestGenesis writes the configuration of a single validator chain into
+// the home directory.
+func newTestGenesis(t *testing.T, home string) *tmtypes.GenesisDoc {
+	t.Helper()
+	config := testNodeConfig(home)
+	pv := privval.GenFilePV(config.PrivValidatorKeyFile(), config.PrivValidatorStateFile())
+	pv.Save()
+
+	appState, err := customd.DevGenesisTemplate("CSTM", weave.NewAddress([]byte("snapshot-test"))).AppState()
+	assert.Nil(t, err)
+	genesis := &tmtypes.GenesisDoc{
+		ChainID:     "snapshot-test",
+		GenesisTime: time.Now(),
+		Validators: []tmtypes.GenesisValidator{
+			{Address: pv.GetPubKey().Address(), PubKey: pv.GetPubKey(), Power: 10},
+		},
+		AppState: appState,
+	}
+	assert.Nil(t, genesis.SaveAs(config.GenesisFile()))
+	return genesis
+}
+
+// testNodeConfig returns the configuration of a node producing blocks
+// quickly, that is listening on random local ports.
+func testNodeConfig(home string) *cfg.Config {
+	config := cfg.DefaultConfig()
+	config.Consensus = cfg.TestConsensusConfig()
+	config.SetRoot(home)
+	config.RPC.ListenAddress = "tcp://127.0.0.1:0"
+	config.P2P.ListenAddress = "tcp://127.0.0.1:0"
+	cfg.EnsureRoot(home)
+	return config
+}
+
+// testNode is an in-process node with the application.
+type testNode struct {
+	node *nm.Node
+	app  io.Closer
+	dbs  []dbm.DB
+}
+
+// startTestNode starts a node using the configuration of the home
+// directory.
+func startTestNode(home string) (n *testNode, err error) {
+	config := testNodeConfig(home)
+	nodeKey, err := p2p.LoadOrGenNodeKey(config.NodeKeyFile())
+	if err != nil {
+		return nil, err
+	}
+	app, err := customd.GenerateApp(&server.Options{Home: home, Logger: log.NewNopLogger()})
+	if err != nil {
+		return nil, err
+	}
+
+	n = &testNode{app: app.(io.Closer)}
+	// Tendermint panics if the state of the application does not match
+	// its own.
+	defer func() {
+		if r := recover(); r != nil {
+			n.close()
+			n, err = nil, fmt.Errorf("cannot start node: %v", r)
+		}
+	}()
+	// Tendermint does not close its databases when the node stops.
+	dbProvider := func(ctx *nm.DBContext) (dbm.DB, error) {
+		db, err := nm.DefaultDBProvider(ctx)
+		if err == nil {
+			n.dbs = append(n.dbs, db)
+		}
+		return db, err
+	}
+	n.node, err = nm.NewNode(config,
+		privval.LoadFilePV(config.PrivValidatorKeyFile(), config.PrivValidatorStateFile()),
+		nodeKey,
+		proxy.NewLocalClientCreator(app),
+		nm.DefaultGenesisDocProviderFunc(config),
+		dbProvider,
+		nm.DefaultMetricsProvider(config.Instrumentation),
+		log.NewNopLogger(),
+	)
+	if err == nil {
+		err = n.node.Start()
+	}
+	if err != nil {
+		n.close()
+		return nil, err
+	}
+	return n, nil
+}
+
+func (n *testNode) waitForHeight(t *testing.T, height int64) {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for n.node.BlockStore().Height() < height {
+		if time.Now().After(deadline) {
+			t.Fatalf("height %d not reached, node is at %d", height, n.node.BlockStore().Height())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (n *testNode) stop(t *testing.T) {
+	t.Helper()
+	if n.node.IsRunning() {
+		assert.Nil(t, n.node.Stop())
+		n.node.Wait()
+	}
+	n.close()
+}
+
+func (n *testNode) close() {
+	for _, db := range n.dbs {
+		db.Close()
+	}
+	n.dbs = nil
+	n.app.Close()
+}
+
+// testBlockStore is a block store of a stopped node.
+type testBlockStore struct {
+	*blockchain.BlockStore
+	db dbm.DB
+}
+
+func openTestBlockStore(t *testing.T, home string) *testBlockStore {
+	t.Helper()
+	db, err := customd.OpenReadOnlyDB(customd.GoLevelDBBackend, filepath.Join(home, "data", "blockstore.db"))
+	assert.Nil(t, err)
+	return &testBlockStore{BlockStore: blockchain.NewBlockStore(db), db: db}
+}
+
+func (s *testBlockStore) close() {
+	s.db.Close()
+}
+
+func copyTestFile(t *testing.T, src, dst string) {
+	t.Helper()
+	raw, err := ioutil.ReadFile(src)
+	assert.Nil(t, err)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(dst), 0700))
+	assert.Nil(t, ioutil.WriteFile(dst, raw, 0600))
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/commands/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	abciserver "github.com/tendermint/tendermint/abci/server"
+	"github.com/tendermint/tendermint/libs/log"
+)
+
+// startCmd runs the ABCI server. It accepts the flags of server.StartCmd,
+// options of the application database and of the metrics.
+//
+// On SIGINT or SIGTERM new transactions are rejected, the current block is
+// finished and the database is closed. The command returns no error if the
+// shutdown completed in time.
+func startCmd(logger log.Logger, home string, args []string) error {
+	defaults := customd.DefaultStoreOptions()
+	fl := flag.NewFlagSet("start", flag.ExitOnError)
+	var (
+		backendFl    = fl.String("db-backend", string(defaults.Backend), dbBackendUsage)
+		keepRecentFl = fl.Int64("pruning-keep-recent", defaults.Pruning.KeepRecent, "Number of recent state versions to keep. Zero keeps all versions.")
+		keepEveryFl  = fl.Int64("pruning-keep-every", defaults.Pruning.KeepEvery, "Keep each state version that is a multiple of this number, in addition to the recent ones. Zero keeps no additional versions.")
+		sampleFl     = fl.Uint64("log-check-sample", 1, "Log only one in this number of CheckTx calls, to limit the logs of high mempool traffic. DeliverTx calls are always logged.")
+		metricsFl    = fl.String("metrics", "", "Address to serve Prometheus metrics of the application on, at /metrics, for example localhost:26661. Empty disables metrics.")
+		shutdownFl   = fl.Duration("shutdown-timeout", 30*time.Second, "Time to wait for the current block to be committed on shutdown.")
+
+		// Flags of server.StartCmd.
+		bindFl   = fl.String("bind", "tcp://localhost:26658", "Address server listens on.")
+		minFeeFl = fl.String("min_fee", "0 IOV", "Minimal anti-spam fee.")
+		debugFl  = fl.Bool("debug", false, "Call stack returned on error.")
+	)
+	fl.Parse(args)
+
+	opts := customd.StoreOptions{
+		Backend: customd.DBBackend(*backendFl),
+		Pruning: customd.PruningOptions{KeepRecent: *keepRecentFl, KeepEvery: *keepEveryFl},
+	}
+	if err := opts.Validate(); err != nil {
+		return fmt.Errorf("invalid store options: %s", err)
+	}
+
+	customd.SetCheckLogSampling(*sampleFl)
+	if *metricsFl != "" {
+		if err := serveMetrics(logger, *metricsFl); err != nil {
+			return err
+		}
+	}
+
+	minFee, err := coin.ParseHumanFormat(*minFeeFl)
+	if err != nil {
+		return fmt.Errorf("invalid minimal fee: %s", err)
+	}
+	options := &server.Options{
+		MinFee: minFee,
+		Debug:  *debugFl,
+		Home:   home,
+		Logger: logger,
+	}
+	application, err := customd.AppGenerator(opts)(options)
+	if err != nil {
+		return err
+	}
+	graceful := customd.NewGracefulApp(application)
+
+	// Signals are trapped before the server starts, so that none is
+	// missed.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	logger.Info("Starting ABCI app", "bind", *bindFl)
+	svr, err := abciserver.NewServer(*bindFl, "socket", graceful)
+	if err != nil {
+		graceful.Close()
+		return fmt.Errorf("cannot create a listener: %s", err)
+	}
+	svr.SetLogger(logger.With("module", "abci-server"))
+	if err := svr.Start(); err != nil {
+		graceful.Close()
+		return fmt.Errorf("cannot start the server: %s", err)
+	}
+
+	sig := <-signals
+	logger.Info("Shutting down, waiting for the current block", "signal", sig)
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- graceful.Shutdown(*shutdownFl) }()
+	select {
+	case err = <-shutdown:
+	case sig := <-signals:
+		err = fmt.Errorf("shutdown interrupted by %s", sig)
+	}
+
+	if serr := svr.Stop(); serr != nil {
+		logger.Error("Cannot stop the server", "err", serr)
+	}
+	if cerr := graceful.Close(); cerr != nil && err == nil {
+		err = fmt.Errorf("cannot close the database: %s", cerr)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("Stopped")
+	return nil
+}
+
+// serveMetrics serves the application and process metrics on the address,
+// in the background.
+func serveMetrics(logger log.Logger, addr string) error {
+	reg := prometheus.NewRegistry()
+	if err := customd.RegisterMetrics(reg); err != nil {
+		return err
+	}
+	reg.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot serve metrics: %s", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	logger.Info("Serving metrics", "addr", ln.Addr().String())
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			logger.Error("Metrics server stopped", "err", err)
+		}
+	}()
+	return nil
+}
+
+// dbBackendUsage describes the flag selecting the database backend.
+var dbBackendUsage = func() string {
+	var names []string
+	for _, b := range customd.DBBackends() {
+		names = append(names, string(b))
+	}
+	return "Database backend of the application state: " + strings.Join(names, ", ") + ". An existing database must be opened with the backend that created it."
+}()
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	customd "github.com/iov-one/weave-starter-kit/cmd/customd/app"
+	"github.com/iov-one/weave-starter-kit/cmd/customd/client"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/commands/server"
+	"github.com/iov-one/weave/crypto"
+	tmcfg "github.com/tendermint/tendermint/config"
+	"github.com/tendermint/tendermint/p2p"
+	"github.com/tendermint/tendermint/privval"
+	tmtype "github.com/tendermint/tendermint/types"
+	tmtime "github.com/tendermint/tendermint/types/time"
+)
+
+const (
+	// testnetManifest is the file describing the nodes of a generated
+	// testnet. It is used to launch them.
+	testnetManifest = "testnet.json"
+	// testnetKeys is the file holding the private keys of the funded
+	// accounts of a generated testnet.
+	testnetKeys = "keys.json"
+	// testnetStopTimeout is how long nodes are given to shut down before
+	// they are killed.
+	testnetStopTimeout = 10 * time.Second
+)
+
+// testnet describes the nodes of a generated testnet.
+type testnet struct {
+	ChainID string        `json:"chain_id"`
+	Nodes   []testnetNode `json:"nodes"`
+}
+
+// testnetNode describes a single node of a testnet. The home directory is
+// relative to the testnet directory.
+type testnetNode struct {
+	Name string `json:"name"`
+	Home string `json:"home"`
+	P2P  string `json:"p2p"`
+	RPC  string `json:"rpc"`
+	ABCI string `json:"abci"`
+}
+
+// testnetCmd generates a local testnet or, with the start subcommand,
+// launches a generated one.
+func testnetCmd(args []string) error {
+	if len(args) > 0 && args[0] == "start" {
+		return testnetStartCmd(args[1:])
+	}
+
+	fl := flag.NewFlagSet("testnet", flag.ExitOnError)
+	var (
+		nFl        = fl.Int("n", 4, "Number of validator nodes.")
+		outFl      = fl.String("o", "./localnet", "Directory to write the node homes to.")
+		chainIDFl  = fl.String("chain-id", "localnet", "Chain ID of the testnet.")
+		tickerFl   = fl.String("ticker", "CSTM", "Ticker of the token.")
+		accountsFl = fl.Int("accounts", 0, "Number of funded accounts to generate in addition to the admin account.")
+		coinsFl    = flCoins(fl, "coin", "Coins of each additional account, for example \"100 CSTM\". Repeat to add several currencies. Defaults to 1000000 of the ticker.")
+		portFl     = fl.Int("base-port", 26656, "First port used by the nodes. Each node uses three ports, for p2p, rpc and abci, starting at base-port + 10 * node index.")
+	)
+	fl.Parse(args)
+
+	if *nFl < 1 {
+		return errors.New("number of nodes must be positive")
+	}
+	if *accountsFl < 0 {
+		return errors.New("number of accounts cannot be negative")
+	}
+	if len(*coinsFl) == 0 {
+		*coinsFl = coinsFlag{&coin.Coin{Whole: 1000000, Ticker: *tickerFl}}
+	}
+	coins, err := coinsFl.normalized()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(*outFl, testnetManifest)); err == nil {
+		return fmt.Errorf("testnet already exists in %s", *outFl)
+	}
+
+	net := testnet{ChainID: *chainIDFl, Nodes: make([]testnetNode, *nFl)}
+	configs := make([]*tmcfg.Config, *nFl)
+	peers := make([]string, *nFl)
+	genesis := &tmtype.GenesisDoc{
+		ChainID:         *chainIDFl,
+		GenesisTime:     tmtime.Now(),
+		ConsensusParams: tmtype.DefaultConsensusParams(),
+	}
+	for i := range net.Nodes {
+		port := *portFl + 10*i
+		node := testnetNode{
+			Name: fmt.Sprintf("node%d", i),
+			Home: fmt.Sprintf("node%d", i),
+			P2P:  fmt.Sprintf("tcp://127.0.0.1:%d", port),
+			RPC:  fmt.Sprintf("tcp://127.0.0.1:%d", port+1),
+			ABCI: fmt.Sprintf("tcp://127.0.0.1:%d", port+2),
+		}
+		net.Nodes[i] = node
+
+		config := tmcfg.DefaultConfig()
+		config.SetRoot(filepath.Join(*outFl, node.Home))
+		config.Moniker = node.Name
+		config.ProxyApp = node.ABCI
+		config.RPC.ListenAddress = node.RPC
+		config.P2P.ListenAddress = node.P2P
+		// All nodes listen on the loopback interface.
+		config.P2P.AddrBookStrict = false
+		config.P2P.AllowDuplicateIP = true
+		// Transaction history requires all tags to be indexed.
+		config.TxIndex.IndexAllTags = true
+		configs[i] = config
+
+		for _, dir := range []string{filepath.Dir(config.GenesisFile()), config.DBDir()} {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return fmt.Errorf("cannot create node directory: %s", err)
+			}
+		}
+		pv := privval.GenFilePV(config.PrivValidatorKeyFile(), config.PrivValidatorStateFile())
+		pv.Save()
+		nodeKey, err := p2p.LoadOrGenNodeKey(config.NodeKeyFile())
+		if err != nil {
+			return fmt.Errorf("cannot create node key: %s", err)
+		}
+		peers[i] = p2p.IDAddressString(nodeKey.ID(), strings.TrimPrefix(node.P2P, "tcp://"))
+
+		pubKey := pv.GetPubKey()
+		genesis.Validators = append(genesis.Validators, tmtype.GenesisValidator{
+			Address: pubKey.Address(),
+			PubKey:  pubKey,
+			Power:   10,
+			Name:    node.Name,
+		})
+	}
+
+	// The admin account is funded by the application options, additional
+	// accounts are appended to them.
+	admin := client.GenPrivateKey()
+	genesis.AppState, err = customd.GenInitOptions([]string{*tickerFl, admin.PublicKey().Address().String()})
+	if err != nil {
+		return fmt.Errorf("cannot create application options: %s", err)
+	}
+	reqs := client.WalletRequests{Wallets: make([]client.WalletRequest, *accountsFl)}
+	for i := range reqs.Wallets {
+		reqs.Wallets[i].Coins = coins
+	}
+	ws := reqs.Normalize(coin.Coin{})
+	if err := client.AddGenesisWallets(genesis, ws); err != nil {
+		return fmt.Errorf("cannot add accounts: %s", err)
+	}
+	if err := genesis.ValidateAndComplete(); err != nil {
+		return fmt.Errorf("invalid genesis: %s", err)
+	}
+	if err := client.ValidateGenesis(genesis); err != nil {
+		return fmt.Errorf("invalid genesis: %s", err)
+	}
+
+	for i, config := range configs {
+		others := make([]string, 0, len(peers)-1)
+		others = append(others, peers[:i]...)
+		others = append(others, peers[i+1:]...)
+		config.P2P.PersistentPeers = strings.Join(others, ",")
+		tmcfg.WriteConfigFile(filepath.Join(config.RootDir, server.DirConfig, "config.toml"), config)
+		if err := genesis.SaveAs(config.GenesisFile()); err != nil {
+			return fmt.Errorf("cannot save genesis: %s", err)
+		}
+	}
+
+	keys := append([]*crypto.PrivateKey{admin}, ws.Keys...)
+	if err := client.SavePrivateKeys(keys, filepath.Join(*outFl, testnetKeys), true); err != nil {
+		return fmt.Errorf("cannot save keys: %s", err)
+	}
+	raw, err := json.MarshalIndent(net, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode testnet: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(*outFl, testnetManifest), raw, 0600); err != nil {
+		return fmt.Errorf("cannot save testnet: %s", err)
+	}
+
+	fmt.Printf("Generated %d nodes of chain %s in %s\n", len(net.Nodes), net.ChainID, *outFl)
+	fmt.Printf("Keys of %d funded accounts written to %s, the first one is the admin\n",
+		len(keys), filepath.Join(*outFl, testnetKeys))
+	fmt.Printf("Run \"customd testnet start -o %s\" to launch the nodes\n", *outFl)
+	return nil
+}
+
+// testnetStartCmd launches all nodes of a generated testnet as local
+// processes, an application and a tendermint process for each of them. It
+// returns when interrupted or when any of the processes exits, after
+// stopping all of them.
+func testnetStartCmd(args []string) error {
+	fl := flag.NewFlagSet("testnet start", flag.ExitOnError)
+	var (
+		outFl        = fl.String("o", "./localnet", "Directory of the generated testnet.")
+		tendermintFl = fl.String("tendermint", "tendermint", "Tendermint binary to run the nodes with.")
+	)
+	fl.Parse(args)
+
+	raw, err := ioutil.ReadFile(filepath.Join(*outFl, testnetManifest))
+	if err != nil {
+		return fmt.Errorf("cannot load testnet: %s", err)
+	}
+	var net testnet
+	if err := json.Unmarshal(raw, &net); err != nil {
+		return fmt.Errorf("cannot decode testnet: %s", err)
+	}
+	customdBin, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot find customd binary: %s", err)
+	}
+
+	var procs []*testnetProcess
+	exited := make(chan *testnetProcess, 2*len(net.Nodes))
+	stop := func() {
+		for _, p := range procs {
+			p.stop()
+		}
+		deadline := time.After(testnetStopTimeout)
+		for _, p := range procs {
+			select {
+			case <-p.done:
+			case <-deadline:
+				p.cmd.Process.Kill()
+				<-p.done
+			}
+		}
+	}
+
+	for _, node := range net.Nodes {
+		home := filepath.Join(*outFl, node.Home)
+		cmds := []*exec.Cmd{
+			exec.Command(customdBin, "-home", home, "start", "-bind", node.ABCI),
+			exec.Command(*tendermintFl, "node", "--home", home),
+		}
+		for _, cmd := range cmds {
+			p, err := startTestnetProcess(node.Name, cmd, home, exited)
+			if err != nil {
+				stop()
+				return err
+			}
+			procs = append(procs, p)
+		}
+		fmt.Printf("Started %s, rpc %s, logs in %s\n", node.Name, node.RPC, home)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	select {
+	case <-sig:
+		fmt.Println("Stopping testnet")
+		stop()
+		return nil
+	case p := <-exited:
+		stop()
+		return fmt.Errorf("%s %s exited: %v", p.node, filepath.Base(p.cmd.Path), p.err)
+	}
+}
+
+// testnetProcess is a running process of a testnet node.
+type testnetProcess struct {
+	node string
+	cmd  *exec.Cmd
+	done chan struct{}
+	err  error
+}
+
+// startTestnetProcess starts the command, writing its output to a log file
+// in the node home directory. The process is sent to exited when it exits.
+func startTestnetProcess(node string, cmd *exec.Cmd, home string, exited chan<- *testnetProcess) (*testnetProcess, error) {
+	logName := filepath.Join(home, filepath.Base(cmd.Path)+".log")
+	logFile, err := os.OpenFile(logName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open log file: %s", err)
+	}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return nil, fmt.Errorf("cannot start %s: %s", cmd.Path, err)
+	}
+
+	p := &testnetProcess{node: node, cmd: cmd, done: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		logFile.Close()
+		close(p.done)
+		exited <- p
+	}()
+	return p, nil
+}
+
+// stop asks the process to shut down, unless it already exited.
+func (p *testnetProcess) stop() {
+	select {
+	case <-p.done:
+	default:
+		p.cmd.Process.Signal(os.Interrupt)
+	}
+}
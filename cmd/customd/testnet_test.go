@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/iov-one/weave"
+	"github.com/iov-one/weave-starter-kit/cmd/customd/client"
+	"github.com/iov-one/weave/coin"
+	"github.com/iov-one/weave/commands/server"
+	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/tendermint/tendermint/p2p"
+	tmtype "github.com/tendermint/tendermint/types"
+)
+
+func TestTestnetGenerate(t *testing.T) {
+	const (
+		nodes    = 3
+		accounts = 2
+	)
+	dir, err := ioutil.TempDir("", "testnet")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	args := []string{
+		"-n", fmt.Sprint(nodes),
+		"-o", dir,
+		"-chain-id", "testnet-test",
+		"-ticker", "TEST",
+		"-accounts", fmt.Sprint(accounts),
+		"-coin", "250 TEST",
+		"-coin", "3 OTHR",
+		"-base-port", "30000",
+	}
+	assert.Nil(t, testnetCmd(args))
+
+	raw, err := ioutil.ReadFile(filepath.Join(dir, testnetManifest))
+	assert.Nil(t, err)
+	var net testnet
+	assert.Nil(t, json.Unmarshal(raw, &net))
+	assert.Equal(t, "testnet-test", net.ChainID)
+	assert.Equal(t, nodes, len(net.Nodes))
+	for i, node := range net.Nodes {
+		port := 30000 + 10*i
+		want := testnetNode{
+			Name: fmt.Sprintf("node%d", i),
+			Home: fmt.Sprintf("node%d", i),
+			P2P:  fmt.Sprintf("tcp://127.0.0.1:%d", port),
+			RPC:  fmt.Sprintf("tcp://127.0.0.1:%d", port+1),
+			ABCI: fmt.Sprintf("tcp://127.0.0.1:%d", port+2),
+		}
+		assert.Equal(t, want, node)
+	}
+
+	// All nodes share the same genesis, with a distinct validator for
+	// each node.
+	var genesis *tmtype.GenesisDoc
+	ids := make([]p2p.ID, nodes)
+	for i, node := range net.Nodes {
+		home := filepath.Join(dir, node.Home)
+		doc, err := tmtype.GenesisDocFromFile(filepath.Join(home, server.DirConfig, "genesis.json"))
+		assert.Nil(t, err)
+		if genesis == nil {
+			genesis = doc
+		}
+		assert.Equal(t, genesis.ValidatorHash(), doc.ValidatorHash())
+		assert.Equal(t, string(genesis.AppState), string(doc.AppState))
+
+		nodeKey, err := p2p.LoadNodeKey(filepath.Join(home, server.DirConfig, "node_key.json"))
+		assert.Nil(t, err)
+		ids[i] = nodeKey.ID()
+	}
+	validators := make(map[string]bool)
+	for _, v := range genesis.Validators {
+		validators[v.PubKey.Address().String()] = true
+	}
+	assert.Equal(t, nodes, len(genesis.Validators))
+	assert.Equal(t, nodes, len(validators))
+	assert.Nil(t, client.ValidateGenesis(genesis))
+
+	// The admin account is funded by the application options and is the
+	// migration admin. It is followed by the additional accounts.
+	keys, err := client.LoadPrivateKeys(filepath.Join(dir, testnetKeys))
+	assert.Nil(t, err)
+	assert.Equal(t, 1+accounts, len(keys))
+	ws, err := client.GenesisWallets(genesis)
+	assert.Nil(t, err)
+	assert.Equal(t, 1+accounts, len(ws.Wallets))
+	for i, w := range ws.Wallets {
+		assert.Equal(t, keys[i].PublicKey().Address(), w.Address)
+	}
+	wantCoins := []coin.Coins{
+		{{Whole: 123456789, Ticker: "TEST"}},
+		{{Whole: 3, Ticker: "OTHR"}, {Whole: 250, Ticker: "TEST"}},
+		{{Whole: 3, Ticker: "OTHR"}, {Whole: 250, Ticker: "TEST"}},
+	}
+	for i, w := range ws.Wallets {
+		if !coin.Coins(w.Coins).Equals(wantCoins[i]) {
+			t.Errorf("wallet %d: want %v coins, got %v", i, wantCoins[i], w.Coins)
+		}
+	}
+	var appState struct {
+		Conf struct {
+			Migration struct {
+				Admin weave.Address `json:"admin"`
+			} `json:"migration"`
+		} `json:"conf"`
+	}
+	assert.Nil(t, json.Unmarshal(genesis.AppState, &appState))
+	assert.Equal(t, keys[0].PublicKey().Address(), appState.Conf.Migration.Admin)
+
+	// Each node is connected to all other nodes, but not to itself.
+	peersRe := regexp.MustCompile(`(?m)^persistent_peers = "(.*)"$`)
+	for i, node := range net.Nodes {
+		raw, err := ioutil.ReadFile(filepath.Join(dir, node.Home, server.DirConfig, "config.toml"))
+		assert.Nil(t, err)
+		m := peersRe.FindSubmatch(raw)
+		if m == nil {
+			t.Fatalf("no persistent peers in the configuration of %s", node.Name)
+		}
+		peers := strings.Split(string(m[1]), ",")
+		assert.Equal(t, nodes-1, len(peers))
+		for j, id := range ids {
+			addr := p2p.IDAddressString(id, strings.TrimPrefix(net.Nodes[j].P2P, "tcp://"))
+			if has := contains(peers, addr); has != (i != j) {
+				t.Errorf("%s: peer %s listed %v", node.Name, addr, has)
+			}
+		}
+	}
+
+	// A testnet is not generated twice into the same directory.
+	if err := testnetCmd(args); err == nil {
+		t.Fatal("testnet generated over an existing one")
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -6,11 +6,16 @@ require (
 	github.com/gogo/protobuf v1.2.1
 	github.com/iov-one/weave v0.21.0
 	github.com/pmezard/go-difflib v1.0.0
+	github.com/prometheus/client_golang v0.9.3
 	github.com/stellar/go v0.0.0-20190723221356-14eed5a46caf
+	github.com/syndtr/goleveldb v1.0.0
+	github.com/tendermint/iavl v0.12.2
 	github.com/tendermint/tendermint v0.31.5
 	github.com/tyler-smith/go-bip39 v1.0.1-0.20181017060643-dbb3b84ba2ef
+	go.etcd.io/bbolt v1.3.5
 	golang.org/x/crypto v0.0.0-20190513172903-22d7a77e9e5f
 	google.golang.org/genproto v0.0.0-20181016170114-94acd270e44e // indirect
+	gopkg.in/yaml.v2 v2.2.1
 )
 
 replace github.com/iov-one/weave-starter-kit => github.com/orkunkl/starter-kit v0.0.1
@@ -1,17 +1,24 @@
 package custom
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/iov-one/weave"
 	"github.com/iov-one/weave/errors"
 	"github.com/iov-one/weave/migration"
 	"github.com/iov-one/weave/x"
+	"github.com/tendermint/tendermint/libs/common"
 )
 
 const (
 	packageName        = "custom"
 	newStateCost int64 = 100
+
+	// StateAddressTag is the name of the tag with the hex encoded address
+	// of a created state, so that the transactions creating states for an
+	// address can be found in the transaction index.
+	StateAddressTag = "state_address"
 )
 
 // RegisterQuery registers buckets for querying.
@@ -223,5 +230,8 @@ func (h CreateStateHandler) Deliver(ctx weave.Context, store weave.KVStore, tx w
 		return nil, err
 	}
 
-	return &weave.DeliverResult{Data: res}, err
+	tags := []common.KVPair{
+		{Key: []byte(StateAddressTag), Value: []byte(fmt.Sprintf("%X", state.Address))},
+	}
+	return &weave.DeliverResult{Data: res, Tags: tags}, err
 }
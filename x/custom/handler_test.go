@@ -2,6 +2,7 @@ package custom
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/iov-one/weave/store"
 	"github.com/iov-one/weave/weavetest"
 	"github.com/iov-one/weave/weavetest/assert"
+	"github.com/tendermint/tendermint/libs/common"
 )
 
 func TestCreateTimedState(t *testing.T) {
@@ -309,6 +311,11 @@ func TestCreateState(t *testing.T) {
 			if tc.expected != nil {
 				err := bucket.Has(kv, res.Data)
 				assert.Nil(t, err)
+
+				assert.Equal(t, []common.KVPair{{
+					Key:   []byte(StateAddressTag),
+					Value: []byte(fmt.Sprintf("%X", tc.expected.Address)),
+				}}, res.Tags)
 			}
 		})
 	}